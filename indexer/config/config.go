@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,25 +16,106 @@ type Config struct {
 	Kafka    KafkaConfig   `yaml:"kafka"`
 	Log      LogConfig     `yaml:"log"`
 	OKX      OKXConfig     `yaml:"okx"`
+	Metrics  MetricsConfig `yaml:"metrics"`
 }
 
 // ChainConfig describes one EVM chain to index.
 type ChainConfig struct {
-	Name                    string   `yaml:"name"`
-	ChainID                 int64    `yaml:"chain_id"`
-	RPCURL                  string   `yaml:"rpc_url"`
-	GridExAddress           string   `yaml:"gridex_address"`
-	LinearStrategyAddress   string   `yaml:"linear_strategy_address"`   // Linear strategy contract address
-	GeometryStrategyAddress string   `yaml:"geometry_strategy_address"` // Geometry strategy contract address
-	StartBlock              uint64   `yaml:"start_block"`
-	BlockBatchSize          uint64   `yaml:"block_batch_size"`    // how many blocks per eth_getLogs call
-	PollInterval            int      `yaml:"poll_interval_ms"`    // milliseconds between polls
-	Confirmations           uint64   `yaml:"confirmations"`       // blocks to wait for finality
-	RPCTPM                  int      `yaml:"rpc_tpm"`             // max RPC requests per minute (0 = unlimited)
-	APRUpdateInterval       int      `yaml:"apr_update_interval"` // seconds between APR recalculations (0 = disabled, default 300)
-	Stablecoins             []string `yaml:"stablecoins"`         // token addresses treated as stablecoins (price = $1)
+	Name                    string           `yaml:"name"`
+	ChainID                 int64            `yaml:"chain_id"`
+	RPCURL                  string           `yaml:"rpc_url"`
+	RPCURLs                 []RPCEndpoint    `yaml:"rpc_urls"`    // weighted RPC endpoints (rpc_url is used when empty)
+	RPCMaxLag               uint64           `yaml:"rpc_max_lag"` // blocks an endpoint may trail the best known head before it is skipped (default 10)
+	RPCRetry                RetryConfig      `yaml:"rpc_retry"`   // retry, backoff and circuit breaker settings for every endpoint
+	WSURL                   string           `yaml:"ws_url"`      // optional WebSocket endpoint for newHeads/logs subscriptions
+	GridExAddress           string           `yaml:"gridex_address"`
+	VaultAddress            string           `yaml:"vault_address"`             // optional Vault contract, indexed for OwnershipTransferred
+	Strategies              []StrategyConfig `yaml:"strategies"`                // strategy contracts to index
+	LinearStrategyAddress   string           `yaml:"linear_strategy_address"`   // Linear strategy contract address (added to strategies)
+	GeometryStrategyAddress string           `yaml:"geometry_strategy_address"` // Geometry strategy contract address (added to strategies)
+	StartBlock              uint64           `yaml:"start_block"`
+	BlockBatchSize          uint64           `yaml:"block_batch_size"`     // how many blocks per eth_getLogs call
+	MaxBlockBatchSize       uint64           `yaml:"max_block_batch_size"` // upper bound for the learned batch size (default block_batch_size)
+	SlowRPCMs               int              `yaml:"slow_rpc_ms"`          // eth_getLogs responses slower than this shrink the batch (default 10000)
+	BackfillWorkers         int              `yaml:"backfill_workers"`     // parallel eth_getLogs windows while far behind the head (0 or 1 = sequential)
+	PollInterval            int              `yaml:"poll_interval_ms"`     // milliseconds between polls
+	Confirmations           uint64           `yaml:"confirmations"`        // blocks to wait for finality
+	FinalityMode            string           `yaml:"finality_mode"`        // confirmations, safe or finalized (default confirmations)
+	TipMode                 bool             `yaml:"tip_mode"`             // also publish provisional events above the finality threshold
+	ReorgDepth              uint64           `yaml:"reorg_depth"`          // max blocks to roll back on a chain reorganization
+	RPCTPM                  int              `yaml:"rpc_tpm"`              // max RPC requests per minute (0 = unlimited)
+	APRUpdateInterval       int              `yaml:"apr_update_interval"`  // seconds between APR recalculations (0 = disabled, default 300)
+	Stablecoins             []string         `yaml:"stablecoins"`          // stablecoins (price = $1) in addition to the built-in ones
+	ABIVersions             []ABIVersion     `yaml:"abi_versions"`         // GridEx contract versions over the chain's history (default: the latest throughout)
+	Reconcile               ReconcileConfig  `yaml:"reconcile"`            // periodic comparison of indexed grids with the contract
+	PriceSource             string           `yaml:"price_source"`         // computed, verify or onchain (default computed)
+	Outbox                  OutboxConfig     `yaml:"outbox"`               // relay of the Kafka messages queued in event_outbox
 }
 
+// OutboxConfig controls the relay that publishes the Kafka messages queued in
+// event_outbox.
+type OutboxConfig struct {
+	PollInterval   int `yaml:"poll_interval_ms"` // wait between polls when idle or after a failure (default 500)
+	BatchSize      int `yaml:"batch_size"`       // messages published per Kafka write (default 500)
+	RetentionHours int `yaml:"retention_hours"`  // sent messages are deleted after this (default 168)
+}
+
+// ReconcileConfig controls the reconciler, which compares a sample of active
+// grids and their orders with the GridEx view functions at the last indexed
+// block.
+type ReconcileConfig struct {
+	Interval   int  `yaml:"interval"`    // seconds between runs (0 = disabled)
+	SampleSize int  `yaml:"sample_size"` // active grids compared per run (default 20)
+	AutoRepair bool `yaml:"auto_repair"` // overwrite mismatching DB values with the contract's
+}
+
+// ABIVersion is a GridEx contract version the chain's GridEx emitted events
+// of. It applies from FromBlock, or from the first FacetUpdated event that
+// routes a selector to one of Facets, until the next version applies.
+type ABIVersion struct {
+	Version   string   `yaml:"version"`    // e.g. v1 or v2
+	FromBlock *uint64  `yaml:"from_block"` // first block of the version (optional)
+	Facets    []string `yaml:"facets"`     // facet addresses of the version (optional)
+}
+
+// RPCEndpoint is one member of a chain's RPC pool.
+type RPCEndpoint struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`  // relative share of requests (default 1)
+	RPCTPM int    `yaml:"rpc_tpm"` // max requests per minute for this endpoint (0 = the chain's rpc_tpm, -1 = unlimited)
+}
+
+// StrategyConfig is a grid strategy contract indexed on a chain.
+type StrategyConfig struct {
+	Type    string `yaml:"type"` // strategy implementation, e.g. linear or geometry
+	Address string `yaml:"address"`
+}
+
+// RetryConfig controls how RPC requests are retried on rate limits and
+// transient server errors.
+type RetryConfig struct {
+	MaxAttempts       int     `yaml:"max_attempts"`        // attempts per request including the first (default 5, 1 = no retries)
+	BaseDelayMs       int     `yaml:"base_delay_ms"`       // first backoff, doubled on every retry (default 500)
+	MaxDelayMs        int     `yaml:"max_delay_ms"`        // cap for the backoff and for Retry-After (default 30000)
+	BudgetRatio       float64 `yaml:"budget_ratio"`        // retries earned per request (default 0.2)
+	BreakerThreshold  int     `yaml:"breaker_threshold"`   // consecutive failures that open the circuit breaker (default 5)
+	BreakerCooldownMs int     `yaml:"breaker_cooldown_ms"` // how long an open breaker rejects requests (default 30000)
+}
+
+// Finality modes select how the scanner decides which blocks are safe to index.
+const (
+	FinalityConfirmations = "confirmations" // latest block minus Confirmations
+	FinalitySafe          = "safe"          // the node's "safe" block tag
+	FinalityFinalized     = "finalized"     // the node's "finalized" block tag
+)
+
+// Price sources select where the prices of new orders come from.
+const (
+	PriceSourceComputed = "computed" // the strategy math in Go
+	PriceSourceVerify   = "verify"   // computed, checked against the strategy contracts
+	PriceSourceOnchain  = "onchain"  // the strategy contracts' getPrice and getReversePrice
+)
+
 // OKXConfig holds OKX DEX API authentication config.
 type OKXConfig struct {
 	APIKey     string `yaml:"api_key"`
@@ -69,6 +151,11 @@ type KafkaConfig struct {
 	Topic   string   `yaml:"topic"`
 }
 
+// MetricsConfig holds the metrics HTTP endpoint settings.
+type MetricsConfig struct {
+	Addr string `yaml:"addr"` // listen address for /debug/vars (empty = disabled)
+}
+
 // LogConfig holds logging settings.
 type LogConfig struct {
 	Level      string `yaml:"level"`       // debug, info, warn, error
@@ -110,6 +197,32 @@ func expandEnv(s string) string {
 	})
 }
 
+// addLegacyStrategy appends the strategy of a linear_strategy_address or
+// geometry_strategy_address key to Strategies, unless the address is already
+// listed there with the same type.
+func (c *ChainConfig) addLegacyStrategy(typ, addr string) error {
+	if addr == "" {
+		return nil
+	}
+	for _, s := range c.Strategies {
+		if !sameAddress(s.Address, addr) {
+			continue
+		}
+		if s.Type != typ {
+			return fmt.Errorf("chain %s: %s_strategy_address %s is listed under strategies as %s", c.Name, typ, addr, s.Type)
+		}
+		return nil
+	}
+	c.Strategies = append(c.Strategies, StrategyConfig{Type: typ, Address: addr})
+	return nil
+}
+
+// sameAddress compares two hex addresses, with or without 0x, ignoring case.
+func sameAddress(a, b string) bool {
+	trim := func(s string) string { return strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X") }
+	return strings.EqualFold(trim(a), trim(b))
+}
+
 // Load reads a YAML config file and returns a Config.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -127,18 +240,107 @@ func Load(path string) (*Config, error) {
 
 	// Apply defaults
 	for i := range cfg.Chains {
+		if len(cfg.Chains[i].RPCURLs) == 0 && cfg.Chains[i].RPCURL != "" {
+			cfg.Chains[i].RPCURLs = []RPCEndpoint{{URL: cfg.Chains[i].RPCURL}}
+		}
+		if len(cfg.Chains[i].RPCURLs) == 0 {
+			return nil, fmt.Errorf("chain %s: rpc_url or rpc_urls is required", cfg.Chains[i].Name)
+		}
+		for j := range cfg.Chains[i].RPCURLs {
+			ep := &cfg.Chains[i].RPCURLs[j]
+			if ep.URL == "" {
+				return nil, fmt.Errorf("chain %s: rpc_urls[%d] has no url", cfg.Chains[i].Name, j)
+			}
+			if ep.Weight <= 0 {
+				ep.Weight = 1
+			}
+			if ep.RPCTPM == 0 {
+				ep.RPCTPM = cfg.Chains[i].RPCTPM
+			}
+		}
+		if err := cfg.Chains[i].addLegacyStrategy("linear", cfg.Chains[i].LinearStrategyAddress); err != nil {
+			return nil, err
+		}
+		if err := cfg.Chains[i].addLegacyStrategy("geometry", cfg.Chains[i].GeometryStrategyAddress); err != nil {
+			return nil, err
+		}
+		if len(cfg.Chains[i].Strategies) == 0 {
+			return nil, fmt.Errorf("chain %s: no strategy contracts configured", cfg.Chains[i].Name)
+		}
+		if cfg.Chains[i].RPCMaxLag == 0 {
+			cfg.Chains[i].RPCMaxLag = 10
+		}
+		retry := &cfg.Chains[i].RPCRetry
+		if retry.MaxAttempts <= 0 {
+			retry.MaxAttempts = 5
+		}
+		if retry.BaseDelayMs <= 0 {
+			retry.BaseDelayMs = 500
+		}
+		if retry.MaxDelayMs <= 0 {
+			retry.MaxDelayMs = 30000
+		}
+		if retry.BudgetRatio <= 0 {
+			retry.BudgetRatio = 0.2
+		}
+		if retry.BreakerThreshold <= 0 {
+			retry.BreakerThreshold = 5
+		}
+		if retry.BreakerCooldownMs <= 0 {
+			retry.BreakerCooldownMs = 30000
+		}
 		if cfg.Chains[i].BlockBatchSize == 0 {
 			cfg.Chains[i].BlockBatchSize = 100
 		}
+		if cfg.Chains[i].MaxBlockBatchSize < cfg.Chains[i].BlockBatchSize {
+			cfg.Chains[i].MaxBlockBatchSize = cfg.Chains[i].BlockBatchSize
+		}
+		if cfg.Chains[i].SlowRPCMs == 0 {
+			cfg.Chains[i].SlowRPCMs = 10000
+		}
 		if cfg.Chains[i].PollInterval == 0 {
 			cfg.Chains[i].PollInterval = 2000
 		}
 		if cfg.Chains[i].Confirmations == 0 {
 			cfg.Chains[i].Confirmations = 3
 		}
+		switch cfg.Chains[i].FinalityMode {
+		case "":
+			cfg.Chains[i].FinalityMode = FinalityConfirmations
+		case FinalityConfirmations, FinalitySafe, FinalityFinalized:
+		default:
+			return nil, fmt.Errorf("chain %s: unknown finality_mode %q", cfg.Chains[i].Name, cfg.Chains[i].FinalityMode)
+		}
+		switch cfg.Chains[i].PriceSource {
+		case "":
+			cfg.Chains[i].PriceSource = PriceSourceComputed
+		case PriceSourceComputed, PriceSourceVerify, PriceSourceOnchain:
+		default:
+			return nil, fmt.Errorf("chain %s: unknown price_source %q", cfg.Chains[i].Name, cfg.Chains[i].PriceSource)
+		}
+		if cfg.Chains[i].ReorgDepth == 0 {
+			cfg.Chains[i].ReorgDepth = 128
+		}
 		if cfg.Chains[i].APRUpdateInterval == 0 {
 			cfg.Chains[i].APRUpdateInterval = 300 // default 5 minutes
 		}
+		if cfg.Chains[i].Reconcile.SampleSize <= 0 {
+			cfg.Chains[i].Reconcile.SampleSize = 20
+		}
+		if cfg.Chains[i].Outbox.PollInterval <= 0 {
+			cfg.Chains[i].Outbox.PollInterval = 500
+		}
+		if cfg.Chains[i].Outbox.BatchSize <= 0 {
+			cfg.Chains[i].Outbox.BatchSize = 500
+		}
+		if cfg.Chains[i].Outbox.RetentionHours <= 0 {
+			cfg.Chains[i].Outbox.RetentionHours = 168
+		}
+		for _, v := range cfg.Chains[i].ABIVersions {
+			if v.FromBlock == nil && len(v.Facets) == 0 {
+				return nil, fmt.Errorf("chain %s: abi_versions %q needs from_block or facets", cfg.Chains[i].Name, v.Version)
+			}
+		}
 	}
 
 	if cfg.Database.Port == 0 {
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadLegacyStrategyAddresses(t *testing.T) {
+	const (
+		linear   = "0x00000000000000000000000000000000000000aa"
+		geometry = "0x00000000000000000000000000000000000000bb"
+	)
+	load := func(t *testing.T, chain string) (*Config, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		yaml := "chains:\n  - name: test\n    rpc_url: http://localhost:8545\n" + chain
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return Load(path)
+	}
+
+	cases := []struct {
+		name  string
+		chain string
+		want  []StrategyConfig
+	}{
+		{
+			name:  "legacy keys only",
+			chain: "    linear_strategy_address: " + linear + "\n    geometry_strategy_address: " + geometry + "\n",
+			want:  []StrategyConfig{{Type: "linear", Address: linear}, {Type: "geometry", Address: geometry}},
+		},
+		{
+			name: "legacy key repeated under strategies",
+			chain: "    linear_strategy_address: " + strings.ToUpper(linear[2:]) + "\n" +
+				"    strategies:\n      - {type: linear, address: " + linear + "}\n",
+			want: []StrategyConfig{{Type: "linear", Address: linear}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := load(t, tc.chain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.Chains[0].Strategies; !slices.Equal(got, tc.want) {
+				t.Fatalf("strategies %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	_, err := load(t, "    linear_strategy_address: "+linear+"\n    strategies:\n      - {type: geometry, address: "+linear+"}\n")
+	if err == nil || !strings.Contains(err.Error(), "listed under strategies as geometry") {
+		t.Fatalf("conflicting types: %v", err)
+	}
+}
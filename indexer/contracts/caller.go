@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"math/big"
 	"strings"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -18,12 +19,52 @@ type ContractCaller interface {
 	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
 }
 
-// GridOrder represents the on-chain GridOrder struct returned by getGridOrder.
+// GridOrder represents the on-chain OrderInfo struct returned by getGridOrder.
 type GridOrder struct {
+	IsAsk     bool
+	Compound  bool
+	Oneshot   bool
+	Fee       uint32
+	Status    uint32
+	GridID    uint64
+	OrderID   uint16
 	Amount    *big.Int
 	RevAmount *big.Int
+	BaseAmt   *big.Int
 	Price     *big.Int
 	RevPrice  *big.Int
+	PairID    uint64
+}
+
+// GridConfig represents the on-chain GridConfig struct returned by getGridConfig.
+type GridConfig struct {
+	Owner         common.Address
+	AskStrategy   common.Address
+	BidStrategy   common.Address
+	Profits       *big.Int
+	BaseAmt       *big.Int
+	GridID        uint64
+	PairID        uint64
+	AskOrderCount uint16
+	BidOrderCount uint16
+	Fee           uint32
+	Compound      bool
+	Oneshot       bool
+	Status        uint32
+}
+
+// PairTokens holds the base and quote token of a pair.
+type PairTokens struct {
+	Base  common.Address
+	Quote common.Address
+}
+
+// StrategyParams holds the parameters a strategy contract stores for one
+// side of a grid. Gap is set for linear strategies, Ratio for geometry ones.
+type StrategyParams struct {
+	Price0 *big.Int
+	Gap    *big.Int
+	Ratio  *big.Int
 }
 
 // TokenInfo holds ERC20 token metadata fetched from chain.
@@ -35,25 +76,41 @@ type TokenInfo struct {
 }
 
 // Caller makes read-only calls to the GridEx contract and ERC20 tokens.
+// Calls can be combined into one Multicall3 request through NewBatch; the
+// single-call methods below are one-element batches.
 type Caller struct {
-	client     ContractCaller
-	gridExAddr common.Address
-	gridExABI  abi.ABI
-	erc20ABI   abi.ABI
+	client       ContractCaller
+	gridExAddr   common.Address
+	gridExABI    abi.ABI
+	erc20ABI     abi.ABI
+	multicallABI abi.ABI
+	linearABI    abi.ABI
+	geometryABI  abi.ABI
+	priceABI     abi.ABI
+	noMulticall  atomic.Bool // set once aggregate3 turned out to be unavailable
 }
 
-// getGridOrder ABI (only the function we need)
-const getGridOrderABIJSON = `[
+// viewFacetABIJSON is the subset of the GridEx ViewFacet used by Caller.
+const viewFacetABIJSON = `[
   {
-    "inputs": [{"name": "gridOrderId", "type": "uint256"}],
+    "inputs": [{"name": "id", "type": "uint64"}],
     "name": "getGridOrder",
     "outputs": [
       {
         "components": [
+          {"name": "isAsk", "type": "bool"},
+          {"name": "compound", "type": "bool"},
+          {"name": "oneshot", "type": "bool"},
+          {"name": "fee", "type": "uint32"},
+          {"name": "status", "type": "uint32"},
+          {"name": "gridId", "type": "uint48"},
+          {"name": "orderId", "type": "uint16"},
           {"name": "amount", "type": "uint128"},
           {"name": "revAmount", "type": "uint128"},
-          {"name": "price", "type": "uint128"},
-          {"name": "revPrice", "type": "uint128"}
+          {"name": "baseAmt", "type": "uint128"},
+          {"name": "price", "type": "uint256"},
+          {"name": "revPrice", "type": "uint256"},
+          {"name": "pairId", "type": "uint64"}
         ],
         "name": "",
         "type": "tuple"
@@ -63,19 +120,51 @@ const getGridOrderABIJSON = `[
     "type": "function"
   },
   {
-    "inputs": [{"name": "gridId", "type": "uint96"}],
+    "inputs": [{"name": "idList", "type": "uint64[]"}],
+    "name": "getGridOrders",
+    "outputs": [
+      {
+        "components": [
+          {"name": "isAsk", "type": "bool"},
+          {"name": "compound", "type": "bool"},
+          {"name": "oneshot", "type": "bool"},
+          {"name": "fee", "type": "uint32"},
+          {"name": "status", "type": "uint32"},
+          {"name": "gridId", "type": "uint48"},
+          {"name": "orderId", "type": "uint16"},
+          {"name": "amount", "type": "uint128"},
+          {"name": "revAmount", "type": "uint128"},
+          {"name": "baseAmt", "type": "uint128"},
+          {"name": "price", "type": "uint256"},
+          {"name": "revPrice", "type": "uint256"},
+          {"name": "pairId", "type": "uint64"}
+        ],
+        "name": "",
+        "type": "tuple[]"
+      }
+    ],
+    "stateMutability": "view",
+    "type": "function"
+  },
+  {
+    "inputs": [{"name": "gridId", "type": "uint48"}],
     "name": "getGridConfig",
     "outputs": [
       {
         "components": [
           {"name": "owner", "type": "address"},
+          {"name": "askStrategy", "type": "address"},
+          {"name": "bidStrategy", "type": "address"},
+          {"name": "profits", "type": "uint128"},
+          {"name": "baseAmt", "type": "uint128"},
+          {"name": "gridId", "type": "uint48"},
           {"name": "pairId", "type": "uint64"},
+          {"name": "askOrderCount", "type": "uint16"},
+          {"name": "bidOrderCount", "type": "uint16"},
+          {"name": "fee", "type": "uint32"},
           {"name": "compound", "type": "bool"},
           {"name": "oneshot", "type": "bool"},
-          {"name": "fee", "type": "uint32"},
-          {"name": "status", "type": "uint8"},
-          {"name": "asks", "type": "uint32"},
-          {"name": "bids", "type": "uint32"}
+          {"name": "status", "type": "uint32"}
         ],
         "name": "",
         "type": "tuple"
@@ -84,6 +173,13 @@ const getGridOrderABIJSON = `[
     "stateMutability": "view",
     "type": "function"
   },
+  {
+    "inputs": [{"name": "gridId", "type": "uint48"}],
+    "name": "getGridProfits",
+    "outputs": [{"name": "", "type": "uint256"}],
+    "stateMutability": "view",
+    "type": "function"
+  },
   {
     "inputs": [{"name": "pairId", "type": "uint64"}],
     "name": "getPairTokens",
@@ -93,6 +189,30 @@ const getGridOrderABIJSON = `[
     ],
     "stateMutability": "view",
     "type": "function"
+  },
+  {
+    "inputs": [
+      {"name": "base", "type": "address"},
+      {"name": "quote", "type": "address"}
+    ],
+    "name": "getPairIdByTokens",
+    "outputs": [{"name": "", "type": "uint64"}],
+    "stateMutability": "view",
+    "type": "function"
+  },
+  {
+    "inputs": [],
+    "name": "getOneshotProtocolFeeBps",
+    "outputs": [{"name": "", "type": "uint32"}],
+    "stateMutability": "view",
+    "type": "function"
+  },
+  {
+    "inputs": [{"name": "strategy", "type": "address"}],
+    "name": "isStrategyWhitelisted",
+    "outputs": [{"name": "", "type": "bool"}],
+    "stateMutability": "view",
+    "type": "function"
   }
 ]`
 
@@ -160,11 +280,66 @@ const erc20ABIJSON = `[
   }
 ]`
 
+// linearStrategyABIJSON and geometryStrategyABIJSON hold the strategies(uint256)
+// getter of the strategy contracts. They differ in the type of the second field.
+const linearStrategyABIJSON = `[
+  {
+    "inputs": [{"name": "", "type": "uint256"}],
+    "name": "strategies",
+    "outputs": [
+      {"name": "basePrice", "type": "uint256"},
+      {"name": "gap", "type": "int256"}
+    ],
+    "stateMutability": "view",
+    "type": "function"
+  }
+]`
+
+const geometryStrategyABIJSON = `[
+  {
+    "inputs": [{"name": "", "type": "uint256"}],
+    "name": "strategies",
+    "outputs": [
+      {"name": "basePrice", "type": "uint256"},
+      {"name": "ratio", "type": "uint256"}
+    ],
+    "stateMutability": "view",
+    "type": "function"
+  }
+]`
+
+// strategyPriceABIJSON holds the price getters every strategy contract
+// implements.
+const strategyPriceABIJSON = `[
+  {
+    "inputs": [
+      {"name": "isAsk", "type": "bool"},
+      {"name": "gridId", "type": "uint48"},
+      {"name": "idx", "type": "uint16"}
+    ],
+    "name": "getPrice",
+    "outputs": [{"name": "", "type": "uint256"}],
+    "stateMutability": "view",
+    "type": "function"
+  },
+  {
+    "inputs": [
+      {"name": "isAsk", "type": "bool"},
+      {"name": "gridId", "type": "uint48"},
+      {"name": "idx", "type": "uint16"}
+    ],
+    "name": "getReversePrice",
+    "outputs": [{"name": "", "type": "uint256"}],
+    "stateMutability": "view",
+    "type": "function"
+  }
+]`
+
 // NewCaller creates a new contract caller.
 // The client parameter must implement ContractCaller (e.g. *ethclient.Client
-// or *rpc.RateLimitedClient).
+// or *rpc.Pool).
 func NewCaller(client ContractCaller, gridExAddr common.Address) (*Caller, error) {
-	gridABI, err := abi.JSON(strings.NewReader(getGridOrderABIJSON))
+	gridABI, err := abi.JSON(strings.NewReader(viewFacetABIJSON))
 	if err != nil {
 		return nil, fmt.Errorf("parse gridex caller abi: %w", err)
 	}
@@ -172,135 +347,371 @@ func NewCaller(client ContractCaller, gridExAddr common.Address) (*Caller, error
 	if err != nil {
 		return nil, fmt.Errorf("parse erc20 abi: %w", err)
 	}
+	multicallABI, err := abi.JSON(strings.NewReader(multicall3ABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse multicall3 abi: %w", err)
+	}
+	linearABI, err := abi.JSON(strings.NewReader(linearStrategyABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse linear strategy abi: %w", err)
+	}
+	geometryABI, err := abi.JSON(strings.NewReader(geometryStrategyABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse geometry strategy abi: %w", err)
+	}
+	priceABI, err := abi.JSON(strings.NewReader(strategyPriceABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse strategy price abi: %w", err)
+	}
 	return &Caller{
-		client:     client,
-		gridExAddr: gridExAddr,
-		gridExABI:  gridABI,
-		erc20ABI:   erc20ABI,
+		client:       client,
+		gridExAddr:   gridExAddr,
+		gridExABI:    gridABI,
+		erc20ABI:     erc20ABI,
+		multicallABI: multicallABI,
+		linearABI:    linearABI,
+		geometryABI:  geometryABI,
+		priceABI:     priceABI,
 	}, nil
 }
 
-// GetGridOrder calls getGridOrder(uint256) on the GridEx contract.
-func (c *Caller) GetGridOrder(ctx context.Context, gridOrderID *big.Int) (*GridOrder, error) {
-	data, err := c.gridExABI.Pack("getGridOrder", gridOrderID)
+// addView queues a ViewFacet call on the GridEx contract. decode receives the
+// return values unpacked into O (see unpackOutputs).
+func addView[O, T any](b *Batch, method string, decode func(O) T, args ...any) *Pending[T] {
+	return addCall(b, b.c.gridExAddr, &b.c.gridExABI, method, decode, args...)
+}
+
+// addCall queues a call of method on the contract at target.
+func addCall[O, T any](b *Batch, target common.Address, contractABI *abi.ABI, method string, decode func(O) T, args ...any) *Pending[T] {
+	p := &Pending[T]{}
+	data, err := contractABI.Pack(method, args...)
 	if err != nil {
-		return nil, fmt.Errorf("pack getGridOrder: %w", err)
+		p.Err = fmt.Errorf("pack %s: %w", method, err)
+		return p
 	}
+	b.add(target, data, func(ret []byte, err error) {
+		if err != nil {
+			p.Err = fmt.Errorf("call %s: %w", method, err)
+			return
+		}
+		out, err := unpackOutputs[O](contractABI, method, ret)
+		if err != nil {
+			p.Err = err
+			return
+		}
+		p.Value = decode(out)
+	})
+	return p
+}
 
-	result, err := c.client.CallContract(ctx, ethereum.CallMsg{
-		To:   &c.gridExAddr,
-		Data: data,
-	}, nil)
+// unpackOutputs unpacks the return data of method into O: the type of the
+// output for a single one, or a struct with a field per named output
+// otherwise. A type that doesn't match the ABI is an error, not a panic.
+func unpackOutputs[O any](contractABI *abi.ABI, method string, ret []byte) (O, error) {
+	var out O
+	outputs := contractABI.Methods[method].Outputs
+	values, err := outputs.Unpack(ret)
 	if err != nil {
-		return nil, fmt.Errorf("call getGridOrder: %w", err)
+		return out, fmt.Errorf("unpack %s: %w", method, err)
+	}
+	if len(outputs) == 1 {
+		v, ok := values[0].(O)
+		if !ok {
+			return out, fmt.Errorf("decode %s: got %T, want %T", method, values[0], out)
+		}
+		return v, nil
 	}
+	if err := outputs.Copy(&out, values); err != nil {
+		return out, fmt.Errorf("decode %s: %w", method, err)
+	}
+	return out, nil
+}
 
-	values, err := c.gridExABI.Methods["getGridOrder"].Outputs.Unpack(result)
-	if err != nil {
-		return nil, fmt.Errorf("unpack getGridOrder: %w", err)
+// StrategyKey is the key strategy contracts store a grid side under in
+// strategies(uint256): the grid ID, with bit 128 set for the ask side.
+func StrategyKey(isAsk bool, gridID uint64) *big.Int {
+	key := new(big.Int).SetUint64(gridID)
+	if isAsk {
+		key.SetBit(key, 128, 1)
 	}
+	return key
+}
 
-	// ABI unpacking returns the struct as an anonymous struct with json tags
-	s := values[0].(struct {
-		Amount    *big.Int `json:"amount"`
-		RevAmount *big.Int `json:"revAmount"`
-		Price     *big.Int `json:"price"`
-		RevPrice  *big.Int `json:"revPrice"`
-	})
+// orderInfoTuple is the OrderInfo struct as ABI unpacking returns it: an
+// anonymous struct with json tags.
+type orderInfoTuple = struct {
+	IsAsk     bool     `json:"isAsk"`
+	Compound  bool     `json:"compound"`
+	Oneshot   bool     `json:"oneshot"`
+	Fee       uint32   `json:"fee"`
+	Status    uint32   `json:"status"`
+	GridId    *big.Int `json:"gridId"`
+	OrderId   uint16   `json:"orderId"`
+	Amount    *big.Int `json:"amount"`
+	RevAmount *big.Int `json:"revAmount"`
+	BaseAmt   *big.Int `json:"baseAmt"`
+	Price     *big.Int `json:"price"`
+	RevPrice  *big.Int `json:"revPrice"`
+	PairId    uint64   `json:"pairId"`
+}
 
+func newGridOrder(s orderInfoTuple) *GridOrder {
 	return &GridOrder{
+		IsAsk:     s.IsAsk,
+		Compound:  s.Compound,
+		Oneshot:   s.Oneshot,
+		Fee:       s.Fee,
+		Status:    s.Status,
+		GridID:    s.GridId.Uint64(),
+		OrderID:   s.OrderId,
 		Amount:    s.Amount,
 		RevAmount: s.RevAmount,
+		BaseAmt:   s.BaseAmt,
 		Price:     s.Price,
 		RevPrice:  s.RevPrice,
-	}, nil
+		PairID:    s.PairId,
+	}
 }
 
-// GetPairTokens calls getPairTokens(uint64) on the GridEx contract.
-func (c *Caller) GetPairTokens(ctx context.Context, pairID uint64) (base, quote common.Address, err error) {
-	data, err := c.gridExABI.Pack("getPairTokens", pairID)
-	if err != nil {
-		return common.Address{}, common.Address{}, fmt.Errorf("pack getPairTokens: %w", err)
-	}
+// GridOrder queues getGridOrder(uint64).
+func (b *Batch) GridOrder(orderID uint64) *Pending[*GridOrder] {
+	return addView(b, "getGridOrder", newGridOrder, orderID)
+}
 
-	result, err := c.client.CallContract(ctx, ethereum.CallMsg{
-		To:   &c.gridExAddr,
-		Data: data,
-	}, nil)
-	if err != nil {
-		return common.Address{}, common.Address{}, fmt.Errorf("call getPairTokens: %w", err)
-	}
+// GridOrders queues getGridOrders(uint64[]). The orders are returned in the
+// order of orderIDs.
+func (b *Batch) GridOrders(orderIDs []uint64) *Pending[[]*GridOrder] {
+	return addView(b, "getGridOrders", func(tuples []orderInfoTuple) []*GridOrder {
+		orders := make([]*GridOrder, len(tuples))
+		for i, t := range tuples {
+			orders[i] = newGridOrder(t)
+		}
+		return orders
+	}, orderIDs)
+}
 
-	values, err := c.gridExABI.Methods["getPairTokens"].Outputs.Unpack(result)
-	if err != nil {
-		return common.Address{}, common.Address{}, fmt.Errorf("unpack getPairTokens: %w", err)
-	}
+// gridConfigTuple is the GridConfig struct as ABI unpacking returns it.
+type gridConfigTuple = struct {
+	Owner         common.Address `json:"owner"`
+	AskStrategy   common.Address `json:"askStrategy"`
+	BidStrategy   common.Address `json:"bidStrategy"`
+	Profits       *big.Int       `json:"profits"`
+	BaseAmt       *big.Int       `json:"baseAmt"`
+	GridId        *big.Int       `json:"gridId"`
+	PairId        uint64         `json:"pairId"`
+	AskOrderCount uint16         `json:"askOrderCount"`
+	BidOrderCount uint16         `json:"bidOrderCount"`
+	Fee           uint32         `json:"fee"`
+	Compound      bool           `json:"compound"`
+	Oneshot       bool           `json:"oneshot"`
+	Status        uint32         `json:"status"`
+}
 
-	base = values[0].(common.Address)
-	quote = values[1].(common.Address)
-	return base, quote, nil
+// GridConfig queues getGridConfig(uint48).
+func (b *Batch) GridConfig(gridID uint64) *Pending[*GridConfig] {
+	return addView(b, "getGridConfig", func(s gridConfigTuple) *GridConfig {
+		return &GridConfig{
+			Owner:         s.Owner,
+			AskStrategy:   s.AskStrategy,
+			BidStrategy:   s.BidStrategy,
+			Profits:       s.Profits,
+			BaseAmt:       s.BaseAmt,
+			GridID:        s.GridId.Uint64(),
+			PairID:        s.PairId,
+			AskOrderCount: s.AskOrderCount,
+			BidOrderCount: s.BidOrderCount,
+			Fee:           s.Fee,
+			Compound:      s.Compound,
+			Oneshot:       s.Oneshot,
+			Status:        s.Status,
+		}
+	}, new(big.Int).SetUint64(gridID))
 }
 
-// GetTokenInfo fetches ERC20 token metadata from chain.
-func (c *Caller) GetTokenInfo(ctx context.Context, tokenAddr common.Address) (*TokenInfo, error) {
-	info := &TokenInfo{Address: tokenAddr}
+// GridProfits queues getGridProfits(uint48).
+func (b *Batch) GridProfits(gridID uint64) *Pending[*big.Int] {
+	return addView(b, "getGridProfits", identity[*big.Int], new(big.Int).SetUint64(gridID))
+}
+
+// PairTokens queues getPairTokens(uint64).
+func (b *Batch) PairTokens(pairID uint64) *Pending[PairTokens] {
+	return addView(b, "getPairTokens", identity[PairTokens], pairID)
+}
+
+// PairIDByTokens queues getPairIdByTokens(address,address).
+func (b *Batch) PairIDByTokens(base, quote common.Address) *Pending[uint64] {
+	return addView(b, "getPairIdByTokens", identity[uint64], base, quote)
+}
+
+// OneshotProtocolFeeBps queues getOneshotProtocolFeeBps().
+func (b *Batch) OneshotProtocolFeeBps() *Pending[uint32] {
+	return addView(b, "getOneshotProtocolFeeBps", identity[uint32])
+}
+
+// IsStrategyWhitelisted queues isStrategyWhitelisted(address).
+func (b *Batch) IsStrategyWhitelisted(strategy common.Address) *Pending[bool] {
+	return addView(b, "isStrategyWhitelisted", identity[bool], strategy)
+}
+
+// LinearStrategy queues strategies(uint256) on a linear strategy contract.
+func (b *Batch) LinearStrategy(strategy common.Address, isAsk bool, gridID uint64) *Pending[*StrategyParams] {
+	return addCall(b, strategy, &b.c.linearABI, "strategies", func(out struct{ BasePrice, Gap *big.Int }) *StrategyParams {
+		return &StrategyParams{Price0: out.BasePrice, Gap: out.Gap}
+	}, StrategyKey(isAsk, gridID))
+}
+
+// GeometryStrategy queues strategies(uint256) on a geometry strategy contract.
+func (b *Batch) GeometryStrategy(strategy common.Address, isAsk bool, gridID uint64) *Pending[*StrategyParams] {
+	return addCall(b, strategy, &b.c.geometryABI, "strategies", func(out struct{ BasePrice, Ratio *big.Int }) *StrategyParams {
+		return &StrategyParams{Price0: out.BasePrice, Ratio: out.Ratio}
+	}, StrategyKey(isAsk, gridID))
+}
+
+// StrategyPrice queues getPrice(bool,uint48,uint16) on a strategy contract:
+// the price of order idx (0-based) on a grid side.
+func (b *Batch) StrategyPrice(strategy common.Address, isAsk bool, gridID uint64, idx uint16) *Pending[*big.Int] {
+	return addCall(b, strategy, &b.c.priceABI, "getPrice", identity[*big.Int], isAsk, new(big.Int).SetUint64(gridID), idx)
+}
 
-	// Get name
-	nameData, err := c.erc20ABI.Pack("name")
+// StrategyReversePrice queues getReversePrice(bool,uint48,uint16) on a
+// strategy contract: the price order idx flips to once filled.
+func (b *Batch) StrategyReversePrice(strategy common.Address, isAsk bool, gridID uint64, idx uint16) *Pending[*big.Int] {
+	return addCall(b, strategy, &b.c.priceABI, "getReversePrice", identity[*big.Int], isAsk, new(big.Int).SetUint64(gridID), idx)
+}
+
+// identity is the decode function of calls whose output needs no conversion.
+func identity[T any](v T) T { return v }
+
+// TokenInfo queues the name(), symbol() and decimals() calls of an ERC20
+// token. Tokens that don't implement one of them get an empty name or symbol
+// and 18 decimals; the Pending error is only set if a call can't be packed.
+func (b *Batch) TokenInfo(token common.Address) *Pending[*TokenInfo] {
+	info := &TokenInfo{Address: token}
+	p := &Pending[*TokenInfo]{Value: info}
+
+	nameData, err := b.c.erc20ABI.Pack("name")
 	if err != nil {
-		return nil, fmt.Errorf("pack name: %w", err)
+		p.Err = fmt.Errorf("pack name: %w", err)
+		return p
 	}
-	nameResult, err := c.client.CallContract(ctx, ethereum.CallMsg{
-		To:   &tokenAddr,
-		Data: nameData,
-	}, nil)
+	symbolData, err := b.c.erc20ABI.Pack("symbol")
 	if err != nil {
-		// Some tokens don't implement name(), use empty string
-		slog.Error("failed to call ERC20 name()", "token", tokenAddr.Hex(), "error", err)
-		info.Name = ""
-	} else {
-		values, err := c.erc20ABI.Methods["name"].Outputs.Unpack(nameResult)
-		if err == nil && len(values) > 0 {
-			info.Name = values[0].(string)
-		}
+		p.Err = fmt.Errorf("pack symbol: %w", err)
+		return p
 	}
-
-	// Get symbol
-	symbolData, err := c.erc20ABI.Pack("symbol")
+	decimalsData, err := b.c.erc20ABI.Pack("decimals")
 	if err != nil {
-		slog.Error("failed to pack ERC20 symbol()", "token", tokenAddr.Hex(), "error", err)
-		return nil, fmt.Errorf("pack symbol: %w", err)
+		p.Err = fmt.Errorf("pack decimals: %w", err)
+		return p
 	}
-	symbolResult, err := c.client.CallContract(ctx, ethereum.CallMsg{
-		To:   &tokenAddr,
-		Data: symbolData,
-	}, nil)
-	if err != nil {
-		info.Symbol = ""
-	} else {
-		values, err := c.erc20ABI.Methods["symbol"].Outputs.Unpack(symbolResult)
-		if err == nil && len(values) > 0 {
-			info.Symbol = values[0].(string)
+
+	b.add(token, nameData, func(ret []byte, err error) {
+		if err != nil {
+			// Some tokens don't implement name(), use empty string
+			slog.Error("failed to call ERC20 name()", "token", token.Hex(), "error", err)
+			return
 		}
-	}
+		if name, err := unpackOutputs[string](&b.c.erc20ABI, "name", ret); err == nil {
+			info.Name = name
+		}
+	})
+	b.add(token, symbolData, func(ret []byte, err error) {
+		if err != nil {
+			return
+		}
+		if symbol, err := unpackOutputs[string](&b.c.erc20ABI, "symbol", ret); err == nil {
+			info.Symbol = symbol
+		}
+	})
+	b.add(token, decimalsData, func(ret []byte, err error) {
+		if err != nil {
+			info.Decimals = 18 // default
+			return
+		}
+		if decimals, err := unpackOutputs[uint8](&b.c.erc20ABI, "decimals", ret); err == nil {
+			info.Decimals = decimals
+		}
+	})
+	return p
+}
+
+// GetGridOrder calls getGridOrder(uint64) on the GridEx contract.
+func (c *Caller) GetGridOrder(ctx context.Context, orderID uint64) (*GridOrder, error) {
+	b := c.NewBatch()
+	return executeOne(ctx, b, b.GridOrder(orderID))
+}
+
+// GetGridConfig calls getGridConfig(uint48) on the GridEx contract.
+func (c *Caller) GetGridConfig(ctx context.Context, gridID uint64) (*GridConfig, error) {
+	b := c.NewBatch()
+	return executeOne(ctx, b, b.GridConfig(gridID))
+}
+
+// GetGridProfits calls getGridProfits(uint48) on the GridEx contract.
+func (c *Caller) GetGridProfits(ctx context.Context, gridID uint64) (*big.Int, error) {
+	b := c.NewBatch()
+	return executeOne(ctx, b, b.GridProfits(gridID))
+}
+
+// GetPairTokens calls getPairTokens(uint64) on the GridEx contract.
+func (c *Caller) GetPairTokens(ctx context.Context, pairID uint64) (base, quote common.Address, err error) {
+	b := c.NewBatch()
+	pair, err := executeOne(ctx, b, b.PairTokens(pairID))
+	return pair.Base, pair.Quote, err
+}
+
+// GetPairIDByTokens calls getPairIdByTokens(address,address) on the GridEx contract.
+func (c *Caller) GetPairIDByTokens(ctx context.Context, base, quote common.Address) (uint64, error) {
+	b := c.NewBatch()
+	return executeOne(ctx, b, b.PairIDByTokens(base, quote))
+}
+
+// GetOneshotProtocolFeeBps calls getOneshotProtocolFeeBps() on the GridEx contract.
+func (c *Caller) GetOneshotProtocolFeeBps(ctx context.Context) (uint32, error) {
+	b := c.NewBatch()
+	return executeOne(ctx, b, b.OneshotProtocolFeeBps())
+}
 
-	// Get decimals
-	decimalsData, err := c.erc20ABI.Pack("decimals")
+// IsStrategyWhitelisted calls isStrategyWhitelisted(address) on the GridEx contract.
+func (c *Caller) IsStrategyWhitelisted(ctx context.Context, strategy common.Address) (bool, error) {
+	b := c.NewBatch()
+	return executeOne(ctx, b, b.IsStrategyWhitelisted(strategy))
+}
+
+// GetTokenInfo fetches ERC20 token metadata from chain in one request.
+func (c *Caller) GetTokenInfo(ctx context.Context, tokenAddr common.Address) (*TokenInfo, error) {
+	infos, err := c.GetTokenInfos(ctx, []common.Address{tokenAddr})
 	if err != nil {
-		return nil, fmt.Errorf("pack decimals: %w", err)
+		return nil, err
 	}
-	decimalsResult, err := c.client.CallContract(ctx, ethereum.CallMsg{
-		To:   &tokenAddr,
-		Data: decimalsData,
-	}, nil)
-	if err != nil {
-		info.Decimals = 18 // default
-	} else {
-		values, err := c.erc20ABI.Methods["decimals"].Outputs.Unpack(decimalsResult)
-		if err == nil && len(values) > 0 {
-			info.Decimals = values[0].(uint8)
+	return infos[0], nil
+}
+
+// GetTokenInfos fetches ERC20 token metadata for several tokens in one request.
+func (c *Caller) GetTokenInfos(ctx context.Context, tokens []common.Address) ([]*TokenInfo, error) {
+	b := c.NewBatch()
+	pending := make([]*Pending[*TokenInfo], len(tokens))
+	for i, token := range tokens {
+		pending[i] = b.TokenInfo(token)
+		if pending[i].Err != nil {
+			return nil, pending[i].Err
 		}
 	}
+	if err := b.Execute(ctx); err != nil {
+		return nil, err
+	}
+	infos := make([]*TokenInfo, len(tokens))
+	for i, p := range pending {
+		infos[i] = p.Value
+	}
+	return infos, nil
+}
 
-	return info, nil
+// executeOne executes a batch holding the single call p.
+func executeOne[T any](ctx context.Context, b *Batch, p *Pending[T]) (T, error) {
+	if err := b.Execute(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+	return p.Value, p.Err
 }
@@ -1,331 +1,474 @@
 package contracts
 
 import (
+	"embed"
 	"fmt"
 	"math/big"
-	"strings"
+	"reflect"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
-// Decoder decodes GridEx contract event logs.
+//go:generate sh -c "cp ../../abi/TradeFacet.json ../../abi/CancelFacet.json ../../abi/AdminFacet.json ../../abi/Linear.json ../../abi/Geometry.json abi/"
+
+// abiFiles holds copies of the contract ABIs in the repository's abi/
+// directory, which is outside this module and can't be embedded directly.
+// go generate refreshes them. abi/v1 holds the events of the v1 facets that
+// differ from the current ones.
+//
+//go:embed abi/*.json abi/v1/*.json
+var abiFiles embed.FS
+
+// gridExFacets are the facets whose events the GridEx contract emits.
+var gridExFacets = []string{"TradeFacet.json", "CancelFacet.json", "AdminFacet.json"}
+
+// Decoder decodes GridEx contract event logs of one contract version.
 type Decoder struct {
+	version     Version
 	abi         abi.ABI
 	strategyABI abi.ABI
 	geometryABI abi.ABI
 }
 
-// linearStrategyABI is the ABI for the Linear strategy contract events.
-// Updated for v2: gridId is now uint48 (was uint128)
-const linearStrategyABI = `[
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": false, "name": "isAsk", "type": "bool"},
-      {"indexed": false, "name": "gridId", "type": "uint48"},
-      {"indexed": false, "name": "price0", "type": "uint256"},
-      {"indexed": false, "name": "gap", "type": "int256"}
-    ],
-    "name": "LinearStrategyCreated",
-    "type": "event"
-  }
-]`
-
-// geometryStrategyABI is the ABI for the Geometry strategy contract events.
-// Updated for v2: gridId is now uint48 (was uint128)
-const geometryStrategyABI = `[
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": false, "name": "isAsk", "type": "bool"},
-      {"indexed": false, "name": "gridId", "type": "uint48"},
-      {"indexed": false, "name": "price0", "type": "uint256"},
-      {"indexed": false, "name": "ratio", "type": "uint256"}
-    ],
-    "name": "GeometryStrategyCreated",
-    "type": "event"
-  }
-]`
-
-// gridExABI is a minimal ABI containing only the events we care about.
-// Updated for v2 contract with new types (uint48 gridId, uint64 orderId, uint16 order counts)
-const gridExABI = `[
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": true, "name": "base", "type": "address"},
-      {"indexed": true, "name": "quote", "type": "address"},
-      {"indexed": false, "name": "pairId", "type": "uint64"}
-    ],
-    "name": "PairCreated",
-    "type": "event"
-  },
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": true, "name": "owner", "type": "address"},
-      {"indexed": false, "name": "pairId", "type": "uint64"},
-      {"indexed": false, "name": "amount", "type": "uint256"},
-      {"indexed": false, "name": "gridId", "type": "uint48"},
-      {"indexed": false, "name": "asks", "type": "uint32"},
-      {"indexed": false, "name": "bids", "type": "uint32"},
-      {"indexed": false, "name": "fee", "type": "uint32"},
-      {"indexed": false, "name": "compound", "type": "bool"},
-      {"indexed": false, "name": "oneshot", "type": "bool"}
-    ],
-    "name": "GridOrderCreated",
-    "type": "event"
-  },
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": false, "name": "taker", "type": "address"},
-      {"indexed": false, "name": "orderId", "type": "uint64"},
-      {"indexed": false, "name": "baseAmt", "type": "uint256"},
-      {"indexed": false, "name": "quoteVol", "type": "uint256"},
-      {"indexed": false, "name": "orderAmt", "type": "uint256"},
-      {"indexed": false, "name": "orderRevAmt", "type": "uint256"},
-      {"indexed": false, "name": "isAsk", "type": "bool"}
-    ],
-    "name": "FilledOrder",
-    "type": "event"
-  },
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": true, "name": "owner", "type": "address"},
-      {"indexed": true, "name": "orderId", "type": "uint64"},
-      {"indexed": true, "name": "gridId", "type": "uint48"}
-    ],
-    "name": "CancelGridOrder",
-    "type": "event"
-  },
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": true, "name": "owner", "type": "address"},
-      {"indexed": true, "name": "gridId", "type": "uint48"}
-    ],
-    "name": "CancelWholeGrid",
-    "type": "event"
-  },
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": true, "name": "sender", "type": "address"},
-      {"indexed": false, "name": "gridId", "type": "uint48"},
-      {"indexed": false, "name": "fee", "type": "uint32"}
-    ],
-    "name": "GridFeeChanged",
-    "type": "event"
-  },
-  {
-    "anonymous": false,
-    "inputs": [
-      {"indexed": false, "name": "gridId", "type": "uint48"},
-      {"indexed": false, "name": "quote", "type": "address"},
-      {"indexed": false, "name": "to", "type": "address"},
-      {"indexed": false, "name": "amt", "type": "uint256"}
-    ],
-    "name": "WithdrawProfit",
-    "type": "event"
-  }
-]`
-
-// NewDecoder creates a new event decoder.
+// NewDecoder creates a new event decoder for the latest contract version.
 func NewDecoder() (*Decoder, error) {
-	parsed, err := abi.JSON(strings.NewReader(gridExABI))
+	return NewVersionDecoder(Latest)
+}
+
+// NewVersionDecoder creates an event decoder for the GridEx events of a
+// contract version. Strategy contracts are not upgraded in place, so their
+// events are the same for every version.
+func NewVersionDecoder(version Version) (*Decoder, error) {
+	gridEx := abi.ABI{Events: make(map[string]abi.Event)}
+	for _, name := range gridExFacets {
+		facet, err := loadABI(name)
+		if err != nil {
+			return nil, err
+		}
+		for eventName, event := range facet.Events {
+			if known, ok := gridEx.Events[eventName]; ok && known.ID != event.ID {
+				return nil, fmt.Errorf("%s: event %s conflicts with %s", name, event.Sig, known.Sig)
+			}
+			gridEx.Events[eventName] = event
+		}
+	}
+	for _, name := range versionABIs[version] {
+		changed, err := loadABI(name)
+		if err != nil {
+			return nil, err
+		}
+		for eventName, event := range changed.Events {
+			gridEx.Events[eventName] = event
+		}
+	}
+	linear, err := loadABI("Linear.json")
 	if err != nil {
-		return nil, fmt.Errorf("parse gridex abi: %w", err)
+		return nil, err
 	}
-	stratParsed, err := abi.JSON(strings.NewReader(linearStrategyABI))
+	geometry, err := loadABI("Geometry.json")
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{version: version, abi: gridEx, strategyABI: linear, geometryABI: geometry}, nil
+}
+
+// Version returns the contract version the decoder decodes.
+func (d *Decoder) Version() Version {
+	return d.version
+}
+
+// Knows reports whether topic is the topic of an event of the decoder's
+// contract version.
+func (d *Decoder) Knows(topic common.Hash) bool {
+	_, ok := d.eventByID(topic)
+	return ok
+}
+
+// loadABI parses an embedded contract ABI.
+func loadABI(name string) (abi.ABI, error) {
+	f, err := abiFiles.Open("abi/" + name)
 	if err != nil {
-		return nil, fmt.Errorf("parse linear strategy abi: %w", err)
+		return abi.ABI{}, fmt.Errorf("open abi %s: %w", name, err)
 	}
-	geometryParsed, err := abi.JSON(strings.NewReader(geometryStrategyABI))
+	defer f.Close()
+	parsed, err := abi.JSON(f)
 	if err != nil {
-		return nil, fmt.Errorf("parse geometry strategy abi: %w", err)
+		return abi.ABI{}, fmt.Errorf("parse abi %s: %w", name, err)
 	}
-	return &Decoder{abi: parsed, strategyABI: stratParsed, geometryABI: geometryParsed}, nil
+	return parsed, nil
 }
 
-// DecodePairCreated decodes a PairCreated event log.
-func (d *Decoder) DecodePairCreated(log types.Log) (*PairCreatedEvent, error) {
-	event := &PairCreatedEvent{}
+// unpackLog binds a log of the named event into out, a pointer to a struct.
+// Indexed inputs are taken from the topics and matched to fields by their
+// abi tag or abi.ToCamelCase name; the others are unpacked from the data with
+// abi.UnpackIntoInterface. A field whose type does not match the ABI is an
+// error.
+func unpackLog(a *abi.ABI, name string, log types.Log, out any) (err error) {
+	// The abi package panics on some type mismatches; report them instead.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", name, r)
+		}
+	}()
+
+	event, ok := a.Events[name]
+	if !ok {
+		return fmt.Errorf("%s: event not in ABI", name)
+	}
+	var indexed abi.Arguments
+	for _, in := range event.Inputs {
+		if in.Indexed {
+			indexed = append(indexed, in)
+		}
+	}
+	if len(log.Topics) != len(indexed)+1 {
+		return fmt.Errorf("%s: expected %d topics, got %d", name, len(indexed)+1, len(log.Topics))
+	}
 
-	// Indexed parameters are in Topics
-	if len(log.Topics) < 3 {
-		return nil, fmt.Errorf("PairCreated: expected 3 topics, got %d", len(log.Topics))
+	if len(indexed) > 0 {
+		values := make(map[string]interface{}, len(indexed))
+		if err := abi.ParseTopicsIntoMap(values, indexed, log.Topics[1:]); err != nil {
+			return fmt.Errorf("parse %s topics: %w", name, err)
+		}
+		for _, arg := range indexed {
+			if err := setField(out, arg.Name, values[arg.Name]); err != nil {
+				return fmt.Errorf("parse %s topics: %w", name, err)
+			}
+		}
 	}
-	event.Base = common.HexToAddress(log.Topics[1].Hex())
-	event.Quote = common.HexToAddress(log.Topics[2].Hex())
 
-	// Non-indexed parameters are in Data
-	values, err := d.abi.Events["PairCreated"].Inputs.NonIndexed().Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unpack PairCreated data: %w", err)
+	if err := a.UnpackIntoInterface(out, name, log.Data); err != nil {
+		return fmt.Errorf("unpack %s data: %w", name, err)
 	}
-	event.PairID = values[0].(uint64)
+	return nil
+}
+
+// setField assigns v to the field of the struct out points to that is tagged
+// abi:"name", or else named abi.ToCamelCase(name).
+func setField(out any, name string, v interface{}) error {
+	dst := reflect.ValueOf(out).Elem()
+	field := reflect.Value{}
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Type().Field(i).Tag.Get("abi") == name {
+			field = dst.Field(i)
+			break
+		}
+	}
+	if !field.IsValid() {
+		field = dst.FieldByName(abi.ToCamelCase(name))
+	}
+	if !field.IsValid() {
+		return fmt.Errorf("no field for %s in %T", name, out)
+	}
+	src := reflect.ValueOf(v)
+	if !src.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("cannot assign %s of type %s to field of type %s", name, src.Type(), field.Type())
+	}
+	field.Set(src)
+	return nil
+}
 
+// The following structs bind events whose uint48 (v1: uint128) grid IDs the
+// abi package decodes as *big.Int; the decoded events carry them as uint64.
+
+type gridOrderCreatedLog struct {
+	Owner    common.Address
+	PairID   uint64 `abi:"pairId"`
+	Amount   *big.Int
+	GridID   *big.Int `abi:"gridId"`
+	Asks     uint32
+	Bids     uint32
+	Fee      uint32
+	Compound bool
+	Oneshot  bool
+}
+
+type filledOrderLog struct {
+	Taker       common.Address
+	OrderID     uint64 `abi:"gridOrderId"`
+	BaseAmt     *big.Int
+	QuoteVol    *big.Int
+	OrderAmt    *big.Int
+	OrderRevAmt *big.Int
+	IsAsk       bool
+}
+
+type filledOrderLogV1 struct {
+	Taker       common.Address
+	OrderID     *big.Int `abi:"gridOrderId"`
+	BaseAmt     *big.Int
+	QuoteVol    *big.Int
+	OrderAmt    *big.Int
+	OrderRevAmt *big.Int
+	IsAsk       bool
+}
+
+type cancelGridOrderLog struct {
+	Owner   common.Address
+	OrderID uint64   `abi:"orderId"`
+	GridID  *big.Int `abi:"gridId"`
+}
+
+type cancelGridOrderLogV1 struct {
+	Owner   common.Address
+	OrderID *big.Int `abi:"orderId"`
+	GridID  *big.Int `abi:"gridId"`
+}
+
+type cancelWholeGridLog struct {
+	Owner  common.Address
+	GridID *big.Int `abi:"gridId"`
+}
+
+type gridFeeChangedLog struct {
+	Sender common.Address
+	GridID *big.Int `abi:"gridId"`
+	Fee    uint32
+}
+
+type withdrawProfitLog struct {
+	GridID *big.Int `abi:"gridId"`
+	Quote  common.Address
+	To     common.Address
+	Amt    *big.Int
+}
+
+// gridID converts a decoded grid ID, which exceeds uint48 only in v1.
+func gridID(name string, id *big.Int) (uint64, error) {
+	if !id.IsUint64() {
+		return 0, fmt.Errorf("%s: grid ID %s overflows uint64", name, id)
+	}
+	return id.Uint64(), nil
+}
+
+// DecodePairCreated decodes a PairCreated event log.
+func (d *Decoder) DecodePairCreated(log types.Log) (*PairCreatedEvent, error) {
+	event := &PairCreatedEvent{}
+	if err := unpackLog(&d.abi, "PairCreated", log, event); err != nil {
+		return nil, err
+	}
 	return event, nil
 }
 
 // DecodeGridOrderCreated decodes a GridOrderCreated event log.
-// Updated to match contract: GridOrderCreated(address indexed owner, uint64 pairId, uint256 amount, uint48 gridId, uint32 asks, uint32 bids, uint32 fee, bool compound, bool oneshot)
 func (d *Decoder) DecodeGridOrderCreated(log types.Log) (*GridOrderCreatedEvent, error) {
-	event := &GridOrderCreatedEvent{}
-
-	// Indexed: owner
-	if len(log.Topics) < 2 {
-		return nil, fmt.Errorf("GridOrderCreated: expected 2 topics, got %d", len(log.Topics))
+	var raw gridOrderCreatedLog
+	if err := unpackLog(&d.abi, "GridOrderCreated", log, &raw); err != nil {
+		return nil, err
 	}
-	event.Owner = common.HexToAddress(log.Topics[1].Hex())
-
-	// Non-indexed parameters
-	values, err := d.abi.Events["GridOrderCreated"].Inputs.NonIndexed().Unpack(log.Data)
+	id, err := gridID("GridOrderCreated", raw.GridID)
 	if err != nil {
-		return nil, fmt.Errorf("unpack GridOrderCreated data: %w", err)
+		return nil, err
 	}
-
-	event.PairID = values[0].(uint64)
-	event.Amount = values[1].(*big.Int)
-	// gridId is uint48, abi library returns it as *big.Int
-	gridIDBig := values[2].(*big.Int)
-	event.GridID = gridIDBig.Uint64()
-	event.Asks = values[3].(uint32)
-	event.Bids = values[4].(uint32)
-	event.Fee = values[5].(uint32)
-	event.Compound = values[6].(bool)
-	event.Oneshot = values[7].(bool)
-
-	return event, nil
+	return &GridOrderCreatedEvent{
+		Owner:    raw.Owner,
+		PairID:   raw.PairID,
+		Amount:   raw.Amount,
+		GridID:   id,
+		Asks:     raw.Asks,
+		Bids:     raw.Bids,
+		Fee:      raw.Fee,
+		Compound: raw.Compound,
+		Oneshot:  raw.Oneshot,
+	}, nil
 }
 
 // DecodeFilledOrder decodes a FilledOrder event log.
-// Updated for v2 contract with uint64 orderId.
 func (d *Decoder) DecodeFilledOrder(log types.Log) (*FilledOrderEvent, error) {
-	event := &FilledOrderEvent{}
-
-	// All parameters are non-indexed
-	values, err := d.abi.Events["FilledOrder"].Inputs.NonIndexed().Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unpack FilledOrder data: %w", err)
+	if d.version == V1 {
+		var raw filledOrderLogV1
+		if err := unpackLog(&d.abi, "FilledOrder", log, &raw); err != nil {
+			return nil, err
+		}
+		return &FilledOrderEvent{
+			Taker:       raw.Taker,
+			OrderID:     raw.OrderID,
+			BaseAmt:     raw.BaseAmt,
+			QuoteVol:    raw.QuoteVol,
+			OrderAmt:    raw.OrderAmt,
+			OrderRevAmt: raw.OrderRevAmt,
+			IsAsk:       raw.IsAsk,
+		}, nil
 	}
 
-	event.Taker = values[0].(common.Address)
-	event.OrderID = values[1].(uint64)
-	event.BaseAmt = values[2].(*big.Int)
-	event.QuoteVol = values[3].(*big.Int)
-	event.OrderAmt = values[4].(*big.Int)
-	event.OrderRevAmt = values[5].(*big.Int)
-	event.IsAsk = values[6].(bool)
-
-	return event, nil
+	var raw filledOrderLog
+	if err := unpackLog(&d.abi, "FilledOrder", log, &raw); err != nil {
+		return nil, err
+	}
+	return &FilledOrderEvent{
+		Taker:       raw.Taker,
+		OrderID:     new(big.Int).SetUint64(raw.OrderID),
+		BaseAmt:     raw.BaseAmt,
+		QuoteVol:    raw.QuoteVol,
+		OrderAmt:    raw.OrderAmt,
+		OrderRevAmt: raw.OrderRevAmt,
+		IsAsk:       raw.IsAsk,
+	}, nil
 }
 
-// DecodeCancelGridOrder decodes a CancelGridOrder event log.
-// Updated for v2 contract with new types.
+// DecodeCancelGridOrder decodes a CancelGridOrder event log. The v1 event
+// carries the orderId within the grid, which is combined with the grid ID so
+// OrderID is the gridOrderId for every version.
 func (d *Decoder) DecodeCancelGridOrder(log types.Log) (*CancelGridOrderEvent, error) {
-	event := &CancelGridOrderEvent{}
-
-	// All parameters are indexed (in Topics)
-	if len(log.Topics) < 4 {
-		return nil, fmt.Errorf("CancelGridOrder: expected 4 topics, got %d", len(log.Topics))
+	if d.version == V1 {
+		var raw cancelGridOrderLogV1
+		if err := unpackLog(&d.abi, "CancelGridOrder", log, &raw); err != nil {
+			return nil, err
+		}
+		id, err := gridID("CancelGridOrder", raw.GridID)
+		if err != nil {
+			return nil, err
+		}
+		return &CancelGridOrderEvent{Owner: raw.Owner, OrderID: d.version.GridOrderID(id, raw.OrderID), GridID: id}, nil
 	}
-	event.Owner = common.HexToAddress(log.Topics[1].Hex())
-	// orderId is uint64
-	event.OrderID = new(big.Int).SetBytes(log.Topics[2].Bytes()).Uint64()
-	// gridId is uint48
-	event.GridID = new(big.Int).SetBytes(log.Topics[3].Bytes()).Uint64()
 
-	return event, nil
+	var raw cancelGridOrderLog
+	if err := unpackLog(&d.abi, "CancelGridOrder", log, &raw); err != nil {
+		return nil, err
+	}
+	return &CancelGridOrderEvent{Owner: raw.Owner, OrderID: new(big.Int).SetUint64(raw.OrderID), GridID: raw.GridID.Uint64()}, nil
 }
 
 // DecodeCancelWholeGrid decodes a CancelWholeGrid event log.
-// Updated for v2 contract with uint48 gridId.
 func (d *Decoder) DecodeCancelWholeGrid(log types.Log) (*CancelWholeGridEvent, error) {
-	event := &CancelWholeGridEvent{}
+	var raw cancelWholeGridLog
+	if err := unpackLog(&d.abi, "CancelWholeGrid", log, &raw); err != nil {
+		return nil, err
+	}
+	id, err := gridID("CancelWholeGrid", raw.GridID)
+	if err != nil {
+		return nil, err
+	}
+	return &CancelWholeGridEvent{Owner: raw.Owner, GridID: id}, nil
+}
+
+// DecodeGridFeeChanged decodes a GridFeeChanged event log.
+func (d *Decoder) DecodeGridFeeChanged(log types.Log) (*GridFeeChangedEvent, error) {
+	var raw gridFeeChangedLog
+	if err := unpackLog(&d.abi, "GridFeeChanged", log, &raw); err != nil {
+		return nil, err
+	}
+	id, err := gridID("GridFeeChanged", raw.GridID)
+	if err != nil {
+		return nil, err
+	}
+	return &GridFeeChangedEvent{Sender: raw.Sender, GridID: id, Fee: raw.Fee}, nil
+}
 
-	if len(log.Topics) < 3 {
-		return nil, fmt.Errorf("CancelWholeGrid: expected 3 topics, got %d", len(log.Topics))
+// DecodeWithdrawProfit decodes a WithdrawProfit event log.
+func (d *Decoder) DecodeWithdrawProfit(log types.Log) (*WithdrawProfitEvent, error) {
+	var raw withdrawProfitLog
+	if err := unpackLog(&d.abi, "WithdrawProfit", log, &raw); err != nil {
+		return nil, err
 	}
-	event.Owner = common.HexToAddress(log.Topics[1].Hex())
-	event.GridID = new(big.Int).SetBytes(log.Topics[2].Bytes()).Uint64()
+	id, err := gridID("WithdrawProfit", raw.GridID)
+	if err != nil {
+		return nil, err
+	}
+	return &WithdrawProfitEvent{GridID: id, Quote: raw.Quote, To: raw.To, Amt: raw.Amt}, nil
+}
 
+// DecodeStrategyWhitelistUpdated decodes a StrategyWhitelistUpdated event log.
+func (d *Decoder) DecodeStrategyWhitelistUpdated(log types.Log) (*StrategyWhitelistUpdatedEvent, error) {
+	event := &StrategyWhitelistUpdatedEvent{}
+	if err := unpackLog(&d.abi, "StrategyWhitelistUpdated", log, event); err != nil {
+		return nil, err
+	}
 	return event, nil
 }
 
-// DecodeGridFeeChanged decodes a GridFeeChanged event log.
-// Updated for v2 contract with uint48 gridId.
-func (d *Decoder) DecodeGridFeeChanged(log types.Log) (*GridFeeChangedEvent, error) {
-	event := &GridFeeChangedEvent{}
+// DecodeCollectProtocol decodes a CollectProtocol event log.
+func (d *Decoder) DecodeCollectProtocol(log types.Log) (*CollectProtocolEvent, error) {
+	event := &CollectProtocolEvent{}
+	if err := unpackLog(&d.abi, "CollectProtocol", log, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
 
-	if len(log.Topics) < 2 {
-		return nil, fmt.Errorf("GridFeeChanged: expected 2 topics, got %d", len(log.Topics))
+// DecodeOneshotProtocolFeeChanged decodes a OneshotProtocolFeeChanged event log.
+func (d *Decoder) DecodeOneshotProtocolFeeChanged(log types.Log) (*OneshotProtocolFeeChangedEvent, error) {
+	event := &OneshotProtocolFeeChangedEvent{}
+	if err := unpackLog(&d.abi, "OneshotProtocolFeeChanged", log, event); err != nil {
+		return nil, err
 	}
-	event.Sender = common.HexToAddress(log.Topics[1].Hex())
+	return event, nil
+}
 
-	values, err := d.abi.Events["GridFeeChanged"].Inputs.NonIndexed().Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unpack GridFeeChanged data: %w", err)
+// DecodeQuotableTokenUpdated decodes a QuotableTokenUpdated event log.
+func (d *Decoder) DecodeQuotableTokenUpdated(log types.Log) (*QuotableTokenUpdatedEvent, error) {
+	event := &QuotableTokenUpdatedEvent{}
+	if err := unpackLog(&d.abi, "QuotableTokenUpdated", log, event); err != nil {
+		return nil, err
 	}
-	event.GridID = values[0].(uint64)
-	event.Fee = values[1].(uint32)
+	return event, nil
+}
 
+// DecodePaused decodes a Paused or Unpaused event log, which share a layout.
+func (d *Decoder) DecodePaused(log types.Log) (*PauseEvent, error) {
+	event := &PauseEvent{}
+	if err := unpackLog(&d.abi, "Paused", log, event); err != nil {
+		return nil, err
+	}
 	return event, nil
 }
 
-// DecodeWithdrawProfit decodes a WithdrawProfit event log.
-// Updated for v2 contract with uint48 gridId.
-func (d *Decoder) DecodeWithdrawProfit(log types.Log) (*WithdrawProfitEvent, error) {
-	event := &WithdrawProfitEvent{}
+// DecodeFacetUpdated decodes a FacetUpdated event log.
+func (d *Decoder) DecodeFacetUpdated(log types.Log) (*FacetUpdatedEvent, error) {
+	event := &FacetUpdatedEvent{}
+	if err := unpackLog(&d.abi, "FacetUpdated", log, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
 
-	values, err := d.abi.Events["WithdrawProfit"].Inputs.NonIndexed().Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unpack WithdrawProfit data: %w", err)
+// DecodeOwnershipTransferred decodes an OwnershipTransferred event log.
+func (d *Decoder) DecodeOwnershipTransferred(log types.Log) (*OwnershipTransferredEvent, error) {
+	event := &OwnershipTransferredEvent{}
+	if err := unpackLog(&d.abi, "OwnershipTransferred", log, event); err != nil {
+		return nil, err
 	}
-	event.GridID = values[0].(uint64)
-	event.Quote = values[1].(common.Address)
-	event.To = values[2].(common.Address)
-	event.Amt = values[3].(*big.Int)
+	return event, nil
+}
 
+// DecodeRefundFailed decodes a RefundFailed event log.
+func (d *Decoder) DecodeRefundFailed(log types.Log) (*RefundFailedEvent, error) {
+	event := &RefundFailedEvent{}
+	if err := unpackLog(&d.abi, "RefundFailed", log, event); err != nil {
+		return nil, err
+	}
 	return event, nil
 }
 
+// DecodeTransfer decodes an ERC20 Transfer event log. ERC721 transfers, which
+// index the token id, are rejected.
+func (d *Decoder) DecodeTransfer(log types.Log) (*TransferEvent, error) {
+	if len(log.Topics) != 3 || len(log.Data) != 32 {
+		return nil, fmt.Errorf("Transfer: expected 3 topics and 32 bytes of data, got %d and %d", len(log.Topics), len(log.Data))
+	}
+	return &TransferEvent{
+		From:  common.HexToAddress(log.Topics[1].Hex()),
+		To:    common.HexToAddress(log.Topics[2].Hex()),
+		Value: new(big.Int).SetBytes(log.Data),
+	}, nil
+}
+
 // DecodeLinearStrategyCreated decodes a LinearStrategyCreated event log.
 func (d *Decoder) DecodeLinearStrategyCreated(log types.Log) (*LinearStrategyCreatedEvent, error) {
 	event := &LinearStrategyCreatedEvent{}
-
-	// All parameters are non-indexed
-	values, err := d.strategyABI.Events["LinearStrategyCreated"].Inputs.NonIndexed().Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unpack LinearStrategyCreated data: %w", err)
+	if err := unpackLog(&d.strategyABI, "LinearStrategyCreated", log, event); err != nil {
+		return nil, err
 	}
-
-	event.IsAsk = values[0].(bool)
-	event.GridID = values[1].(*big.Int)
-	event.Price0 = values[2].(*big.Int)
-	event.Gap = values[3].(*big.Int)
-
 	return event, nil
 }
 
 // DecodeGeometryStrategyCreated decodes a GeometryStrategyCreated event log.
 func (d *Decoder) DecodeGeometryStrategyCreated(log types.Log) (*GeometryStrategyCreatedEvent, error) {
 	event := &GeometryStrategyCreatedEvent{}
-
-	// All parameters are non-indexed
-	values, err := d.geometryABI.Events["GeometryStrategyCreated"].Inputs.NonIndexed().Unpack(log.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unpack GeometryStrategyCreated data: %w", err)
+	if err := unpackLog(&d.geometryABI, "GeometryStrategyCreated", log, event); err != nil {
+		return nil, err
 	}
-
-	event.IsAsk = values[0].(bool)
-	event.GridID = values[1].(*big.Int)
-	event.Price0 = values[2].(*big.Int)
-	event.Ratio = values[3].(*big.Int)
-
 	return event, nil
 }
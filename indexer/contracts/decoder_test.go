@@ -0,0 +1,198 @@
+package contracts
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestEmbeddedABIsMatchRepository(t *testing.T) {
+	entries, err := abiFiles.ReadDir("abi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() { // older versions, not in the repository's abi/
+			continue
+		}
+		want, err := os.ReadFile(filepath.Join("..", "..", "abi", e.Name()))
+		if os.IsNotExist(err) {
+			t.Skip("repository abi/ directory not available")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := abiFiles.ReadFile("abi/" + e.Name())
+		if !bytes.Equal(got, want) {
+			t.Errorf("contracts/abi/%s differs from abi/%s; run go generate ./contracts", e.Name(), e.Name())
+		}
+	}
+}
+
+func TestTopicsMatchABI(t *testing.T) {
+	d, err := NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics := map[string]common.Hash{
+		"PairCreated":               TopicPairCreated,
+		"GridOrderCreated":          TopicGridOrderCreated,
+		"FilledOrder":               TopicFilledOrder,
+		"CancelGridOrder":           TopicCancelGridOrder,
+		"CancelWholeGrid":           TopicCancelWholeGrid,
+		"GridFeeChanged":            TopicGridFeeChanged,
+		"WithdrawProfit":            TopicWithdrawProfit,
+		"StrategyWhitelistUpdated":  TopicStrategyWhitelistUpdated,
+		"CollectProtocol":           TopicCollectProtocol,
+		"OneshotProtocolFeeChanged": TopicOneshotProtocolFeeChanged,
+		"QuotableTokenUpdated":      TopicQuotableTokenUpdated,
+		"Paused":                    TopicPaused,
+		"Unpaused":                  TopicUnpaused,
+		"FacetUpdated":              TopicFacetUpdated,
+		"OwnershipTransferred":      TopicOwnershipTransferred,
+		"RefundFailed":              TopicRefundFailed,
+	}
+	for name, topic := range topics {
+		event, ok := d.abi.Events[name]
+		if !ok {
+			t.Errorf("%s missing from the GridEx ABI", name)
+			continue
+		}
+		if event.ID != topic {
+			t.Errorf("%s: topic %s, ABI %s (%s)", name, topic.Hex(), event.ID.Hex(), event.Sig)
+		}
+	}
+	if id := d.strategyABI.Events["LinearStrategyCreated"].ID; id != TopicLinearStrategyCreated {
+		t.Errorf("LinearStrategyCreated: topic %s, ABI %s", TopicLinearStrategyCreated.Hex(), id.Hex())
+	}
+	if id := d.geometryABI.Events["GeometryStrategyCreated"].ID; id != TopicGeometryStrategyCreated {
+		t.Errorf("GeometryStrategyCreated: topic %s, ABI %s", TopicGeometryStrategyCreated.Hex(), id.Hex())
+	}
+}
+
+func TestDecodeGridOrderCreated(t *testing.T) {
+	d, err := NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := common.HexToAddress("0xaa")
+	data, err := d.abi.Events["GridOrderCreated"].Inputs.NonIndexed().Pack(
+		uint64(7), big.NewInt(1e18), big.NewInt(42), uint32(10), uint32(12), uint32(500), true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := types.Log{
+		Topics: []common.Hash{TopicGridOrderCreated, common.BytesToHash(owner.Bytes())},
+		Data:   data,
+	}
+
+	event, err := d.DecodeGridOrderCreated(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GridOrderCreatedEvent{Owner: owner, PairID: 7, Amount: big.NewInt(1e18), GridID: 42, Asks: 10, Bids: 12, Fee: 500, Compound: true}
+	if event.Amount.Cmp(want.Amount) != 0 {
+		t.Fatalf("amount=%s", event.Amount)
+	}
+	event.Amount = want.Amount
+	if *event != want {
+		t.Fatalf("event=%+v, want %+v", *event, want)
+	}
+
+	// A binding whose types don't match the ABI, e.g. after a change of the
+	// contract's integer widths, fails instead of panicking.
+	var drifted struct {
+		Owner  [20]byte
+		GridID uint64 `abi:"gridId"`
+	}
+	if err := unpackLog(&d.abi, "GridOrderCreated", log, &drifted); err == nil {
+		t.Fatal("expected an error for a mismatched binding")
+	}
+	log.Topics = log.Topics[:1]
+	if _, err := d.DecodeGridOrderCreated(log); err == nil {
+		t.Fatal("expected an error for a missing topic")
+	}
+}
+
+func TestDecodeFacetUpdated(t *testing.T) {
+	d, err := NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	facet := common.HexToAddress("0xbeef")
+	var selector common.Hash
+	copy(selector[:], []byte{0x12, 0x34, 0x56, 0x78})
+
+	event, err := d.DecodeFacetUpdated(types.Log{
+		Topics: []common.Hash{TopicFacetUpdated, selector, common.BytesToHash(facet.Bytes())},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Selector != [4]byte{0x12, 0x34, 0x56, 0x78} || event.Facet != facet {
+		t.Fatalf("event=%+v", *event)
+	}
+}
+
+func TestV1Decoder(t *testing.T) {
+	d, err := NewVersionDecoder(V1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics := map[string]common.Hash{
+		"PairCreated":      TopicPairCreated,
+		"GridOrderCreated": TopicGridOrderCreatedV1,
+		"FilledOrder":      TopicFilledOrderV1,
+		"CancelGridOrder":  TopicCancelGridOrderV1,
+		"CancelWholeGrid":  TopicCancelWholeGridV1,
+		"GridFeeChanged":   TopicGridFeeChangedV1,
+		"WithdrawProfit":   TopicWithdrawProfitV1,
+		"FacetUpdated":     TopicFacetUpdated,
+	}
+	for name, topic := range topics {
+		if id := d.abi.Events[name].ID; id != topic {
+			t.Errorf("%s: topic %s, ABI %s", name, topic.Hex(), id.Hex())
+		}
+	}
+	if d.Knows(TopicFilledOrder) || !d.Knows(TopicFilledOrderV1) {
+		t.Error("v1 decoder must know the v1 FilledOrder only")
+	}
+
+	// FilledOrder carries the uint256 gridOrderId of an ask order of grid 3.
+	gridOrderID := V1.GridOrderID(3, V1.OrderID(true, 5))
+	data, err := d.abi.Events["FilledOrder"].Inputs.Pack(
+		common.HexToAddress("0xaa"), gridOrderID, big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filled, err := d.DecodeFilledOrder(types.Log{Topics: []common.Hash{TopicFilledOrderV1}, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filled.OrderID.Cmp(gridOrderID) != 0 {
+		t.Fatalf("orderId=%s, want %s", filled.OrderID, gridOrderID)
+	}
+
+	// CancelGridOrder carries the orderId within the grid.
+	owner := common.BytesToHash(common.HexToAddress("0xaa").Bytes())
+	cancelled, err := d.DecodeCancelGridOrder(types.Log{Topics: []common.Hash{
+		TopicCancelGridOrderV1, owner, common.BigToHash(V1.OrderID(true, 5)), common.BigToHash(big.NewInt(3)),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.GridID != 3 || cancelled.OrderID.Cmp(gridOrderID) != 0 {
+		t.Fatalf("event=%+v, want grid 3 and gridOrderId %s", *cancelled, gridOrderID)
+	}
+
+	// Grid IDs beyond uint64 are rejected rather than truncated.
+	huge := new(big.Int).Lsh(big.NewInt(1), 100)
+	if _, err := d.DecodeCancelWholeGrid(types.Log{Topics: []common.Hash{TopicCancelWholeGridV1, owner, common.BigToHash(huge)}}); err == nil {
+		t.Fatal("expected an error for a grid ID overflowing uint64")
+	}
+}
@@ -43,22 +43,68 @@ var (
 	// GeometryStrategyCreated(bool isAsk, uint48 gridId, uint256 price0, uint256 ratio)
 	// Emitted by the Geometry strategy contract before GridOrderCreated.
 	TopicGeometryStrategyCreated = crypto.Keccak256Hash([]byte("GeometryStrategyCreated(bool,uint48,uint256,uint256)"))
+
+	// StrategyWhitelistUpdated(address indexed sender, address indexed strategy, bool whitelisted)
+	// Emitted by the AdminFacet when a strategy contract is allowed or disallowed.
+	TopicStrategyWhitelistUpdated = crypto.Keccak256Hash([]byte("StrategyWhitelistUpdated(address,address,bool)"))
+
+	// CollectProtocol(address indexed sender, address indexed recipient, uint256 amount)
+	// Emitted when accrued protocol fees are paid out. The token is not part of
+	// the event; it is the ERC20 Transfer to recipient in the same transaction.
+	TopicCollectProtocol = crypto.Keccak256Hash([]byte("CollectProtocol(address,address,uint256)"))
+
+	// OneshotProtocolFeeChanged(address indexed sender, uint32 oldFeeBps, uint32 newFeeBps)
+	TopicOneshotProtocolFeeChanged = crypto.Keccak256Hash([]byte("OneshotProtocolFeeChanged(address,uint32,uint32)"))
+
+	// QuotableTokenUpdated(address quote, uint256 priority)
+	// A token with a non-zero priority can be the quote token of a pair; of two
+	// quotable tokens the one with the higher priority is the quote.
+	TopicQuotableTokenUpdated = crypto.Keccak256Hash([]byte("QuotableTokenUpdated(address,uint256)"))
+
+	// Paused(address account) / Unpaused(address account) of the GridEx AdminFacet.
+	TopicPaused   = crypto.Keccak256Hash([]byte("Paused(address)"))
+	TopicUnpaused = crypto.Keccak256Hash([]byte("Unpaused(address)"))
+
+	// FacetUpdated(bytes4 indexed selector, address indexed facet)
+	// Emitted for every function selector routed to a new facet.
+	TopicFacetUpdated = crypto.Keccak256Hash([]byte("FacetUpdated(bytes4,address)"))
+
+	// OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+	// Emitted by both the GridEx and the Vault.
+	TopicOwnershipTransferred = crypto.Keccak256Hash([]byte("OwnershipTransferred(address,address)"))
+
+	// RefundFailed(address indexed to, uint256 amount)
+	// Emitted by the TradeFacet when refunding native currency (ETH/BNB) to a user fails.
+	TopicRefundFailed = crypto.Keccak256Hash([]byte("RefundFailed(address,uint256)"))
+
+	// Transfer(address indexed from, address indexed to, uint256 value) of ERC20 tokens.
+	TopicTransfer = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// Topics of the v1 events whose signatures changed in v2 (see abi/v1). The
+// other events kept their signatures.
+var (
+	TopicGridOrderCreatedV1 = crypto.Keccak256Hash([]byte("GridOrderCreated(address,uint64,uint256,uint128,uint32,uint32,uint32,bool,bool)"))
+	TopicFilledOrderV1      = crypto.Keccak256Hash([]byte("FilledOrder(address,uint256,uint256,uint256,uint256,uint256,bool)"))
+	TopicCancelGridOrderV1  = crypto.Keccak256Hash([]byte("CancelGridOrder(address,uint128,uint128)"))
+	TopicCancelWholeGridV1  = crypto.Keccak256Hash([]byte("CancelWholeGrid(address,uint128)"))
+	TopicGridFeeChangedV1   = crypto.Keccak256Hash([]byte("GridFeeChanged(address,uint128,uint32)"))
+	TopicWithdrawProfitV1   = crypto.Keccak256Hash([]byte("WithdrawProfit(uint128,address,address,uint256)"))
 )
 
 // ASK_ORDER_FLAG is the high bit flag for ask orders.
 // In Solidity: uint128 constant ASK_ORDER_FLAG = 1 << 127
 var ASKOrderFlag = new(big.Int).Lsh(big.NewInt(1), 127)
 
-// OrderIDMask is used to extract the raw orderId from a gridOrderId.
+// OrderIDMask is used to extract the raw orderId from a v1 gridOrderId.
 // In Solidity: uint128 constant ODER_ID_MASK = (1 << 128) - 1
-// Note: This may no longer be needed with the new uint64 orderId
 var OrderIDMask = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
 
 // PairCreatedEvent represents a decoded PairCreated event.
 type PairCreatedEvent struct {
 	Base   common.Address
 	Quote  common.Address
-	PairID uint64
+	PairID uint64 `abi:"pairId"`
 }
 
 // GridOrderCreatedEvent represents a decoded GridOrderCreated event.
@@ -76,10 +122,9 @@ type GridOrderCreatedEvent struct {
 }
 
 // FilledOrderEvent represents a decoded FilledOrder event.
-// Note: orderId is now uint64
 type FilledOrderEvent struct {
 	Taker       common.Address
-	OrderID     uint64 // uint64 (was uint256 gridOrderId)
+	OrderID     *big.Int // gridOrderId: uint64 in v2, uint256 in v1
 	BaseAmt     *big.Int
 	QuoteVol    *big.Int
 	OrderAmt    *big.Int
@@ -90,8 +135,8 @@ type FilledOrderEvent struct {
 // CancelGridOrderEvent represents a decoded CancelGridOrder event.
 type CancelGridOrderEvent struct {
 	Owner   common.Address
-	OrderID uint64 // uint64 (was uint128)
-	GridID  uint64 // uint48 (was uint128)
+	OrderID *big.Int // gridOrderId; v1 events carry the uint128 orderId within the grid
+	GridID  uint64   // uint48 (was uint128)
 }
 
 // CancelWholeGridEvent represents a decoded CancelWholeGrid event.
@@ -118,7 +163,7 @@ type WithdrawProfitEvent struct {
 // LinearStrategyCreatedEvent represents a decoded LinearStrategyCreated event.
 type LinearStrategyCreatedEvent struct {
 	IsAsk  bool
-	GridID *big.Int // uint128
+	GridID *big.Int `abi:"gridId"` // uint48
 	Price0 *big.Int
 	Gap    *big.Int
 }
@@ -126,21 +171,77 @@ type LinearStrategyCreatedEvent struct {
 // GeometryStrategyCreatedEvent represents a decoded GeometryStrategyCreated event.
 type GeometryStrategyCreatedEvent struct {
 	IsAsk  bool
-	GridID *big.Int // uint128
+	GridID *big.Int `abi:"gridId"` // uint48
 	Price0 *big.Int
 	Ratio  *big.Int
 }
 
-// ExtractGridIDOrderID extracts gridId and orderId from a gridOrderId (uint256).
+// StrategyWhitelistUpdatedEvent represents a decoded StrategyWhitelistUpdated event.
+type StrategyWhitelistUpdatedEvent struct {
+	Sender      common.Address
+	Strategy    common.Address
+	Whitelisted bool
+}
+
+// CollectProtocolEvent represents a decoded CollectProtocol event.
+type CollectProtocolEvent struct {
+	Sender    common.Address
+	Recipient common.Address
+	Amount    *big.Int
+}
+
+// OneshotProtocolFeeChangedEvent represents a decoded OneshotProtocolFeeChanged event.
+type OneshotProtocolFeeChangedEvent struct {
+	Sender    common.Address
+	OldFeeBps uint32
+	NewFeeBps uint32
+}
+
+// QuotableTokenUpdatedEvent represents a decoded QuotableTokenUpdated event.
+type QuotableTokenUpdatedEvent struct {
+	Quote    common.Address
+	Priority *big.Int
+}
+
+// PauseEvent represents a decoded Paused or Unpaused event.
+type PauseEvent struct {
+	Account common.Address
+}
+
+// FacetUpdatedEvent represents a decoded FacetUpdated event.
+type FacetUpdatedEvent struct {
+	Selector [4]byte
+	Facet    common.Address
+}
+
+// OwnershipTransferredEvent represents a decoded OwnershipTransferred event.
+type OwnershipTransferredEvent struct {
+	PreviousOwner common.Address
+	NewOwner      common.Address
+}
+
+// RefundFailedEvent represents a decoded RefundFailed event.
+type RefundFailedEvent struct {
+	To     common.Address
+	Amount *big.Int
+}
+
+// TransferEvent represents a decoded ERC20 Transfer event.
+type TransferEvent struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+}
+
+// ExtractGridIDOrderID extracts gridId and orderId from a v1 gridOrderId (uint256).
 // gridOrderId = (gridId << 128) | orderId
-// Note: This function is kept for backward compatibility but may not be needed with v2.
 func ExtractGridIDOrderID(gridOrderID *big.Int) (gridID *big.Int, orderID *big.Int) {
 	orderID = new(big.Int).And(gridOrderID, OrderIDMask)
 	gridID = new(big.Int).Rsh(gridOrderID, 128)
 	return gridID, orderID
 }
 
-// IsAskOrder checks if an orderId has the ASK_ORDER_FLAG set.
+// IsAskOrder checks if a v1 orderId has the ASK_ORDER_FLAG set.
 func IsAskOrder(orderID *big.Int) bool {
 	return new(big.Int).And(orderID, ASKOrderFlag).Sign() > 0
 }
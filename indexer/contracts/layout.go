@@ -0,0 +1,74 @@
+package contracts
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrABIMismatch is returned when a log carries the topic of a known event
+// but not its layout, e.g. after a facet upgrade changed the event's
+// parameters without changing its signature's indexed flags. Decoding such a
+// log would silently produce wrong values.
+var ErrABIMismatch = errors.New("event log does not match the known ABI")
+
+// CheckLayout verifies that a log of a known event has the number of topics
+// and the amount of data its ABI implies. Logs of unknown events pass: a
+// layout change that also changes the topic is left to the caller, which
+// knows whether a facet upgrade preceded the log.
+func (d *Decoder) CheckLayout(log types.Log) error {
+	if len(log.Topics) == 0 {
+		return nil
+	}
+	event, ok := d.eventByID(log.Topics[0])
+	if !ok {
+		return nil
+	}
+
+	indexed := 0
+	for _, in := range event.Inputs {
+		if in.Indexed {
+			indexed++
+		}
+	}
+	if len(log.Topics) != indexed+1 {
+		return fmt.Errorf("%w: %s has %d topics, want %d (contract %s, tx %s, log %d)",
+			ErrABIMismatch, event.Name, len(log.Topics), indexed+1, log.Address.Hex(), log.TxHash.Hex(), log.Index)
+	}
+
+	nonIndexed := event.Inputs.NonIndexed()
+	if size, ok := staticSize(nonIndexed); ok && len(log.Data) != size {
+		return fmt.Errorf("%w: %s has %d bytes of data, want %d (contract %s, tx %s, log %d)",
+			ErrABIMismatch, event.Name, len(log.Data), size, log.Address.Hex(), log.TxHash.Hex(), log.Index)
+	}
+	if _, err := nonIndexed.Unpack(log.Data); err != nil {
+		return fmt.Errorf("%w: %s: %v (contract %s, tx %s, log %d)",
+			ErrABIMismatch, event.Name, err, log.Address.Hex(), log.TxHash.Hex(), log.Index)
+	}
+	return nil
+}
+
+// eventByID finds the event of a topic in the GridEx and strategy ABIs.
+func (d *Decoder) eventByID(topic common.Hash) (*abi.Event, bool) {
+	for _, a := range []*abi.ABI{&d.abi, &d.strategyABI, &d.geometryABI} {
+		if event, err := a.EventByID(topic); err == nil {
+			return event, true
+		}
+	}
+	return nil, false
+}
+
+// staticSize returns the encoded size of args when all of them are
+// elementary types of one word each.
+func staticSize(args abi.Arguments) (int, bool) {
+	for _, arg := range args {
+		switch arg.Type.T {
+		case abi.SliceTy, abi.StringTy, abi.BytesTy, abi.ArrayTy, abi.TupleTy:
+			return 0, false
+		}
+	}
+	return 32 * len(args), true
+}
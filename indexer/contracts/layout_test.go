@@ -0,0 +1,41 @@
+package contracts
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestCheckLayout(t *testing.T) {
+	d, err := NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	word := make([]byte, 32)
+	owner := common.BytesToHash(common.HexToAddress("0x1").Bytes())
+	tests := []struct {
+		name    string
+		log     types.Log
+		wantErr bool
+	}{
+		{"paused", types.Log{Topics: []common.Hash{TopicPaused}, Data: word}, false},
+		{"paused with indexed account", types.Log{Topics: []common.Hash{TopicPaused, owner}}, true},
+		{"ownership transferred", types.Log{Topics: []common.Hash{TopicOwnershipTransferred, owner, owner}}, false},
+		{"ownership transferred with data", types.Log{Topics: []common.Hash{TopicOwnershipTransferred, owner, owner}, Data: word}, true},
+		{"filled order short data", types.Log{Topics: []common.Hash{TopicFilledOrder}, Data: make([]byte, 6*32)}, true},
+		{"filled order", types.Log{Topics: []common.Hash{TopicFilledOrder}, Data: make([]byte, 7*32)}, false},
+		{"unknown event", types.Log{Topics: []common.Hash{{0x01}}, Data: word}, false},
+	}
+	for _, tt := range tests {
+		err := d.CheckLayout(tt.log)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: CheckLayout() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrABIMismatch) {
+			t.Errorf("%s: error %v is not ErrABIMismatch", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package contracts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Multicall3Address is the address Multicall3 is deployed at on nearly every
+// EVM chain (same deployer and nonce everywhere).
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// maxMulticallCalls bounds the number of calls packed into one aggregate3 so
+// the eth_call stays well below node gas and response size limits.
+const maxMulticallCalls = 100
+
+const multicall3ABIJSON = `[
+  {
+    "inputs": [
+      {
+        "components": [
+          {"name": "target", "type": "address"},
+          {"name": "allowFailure", "type": "bool"},
+          {"name": "callData", "type": "bytes"}
+        ],
+        "name": "calls",
+        "type": "tuple[]"
+      }
+    ],
+    "name": "aggregate3",
+    "outputs": [
+      {
+        "components": [
+          {"name": "success", "type": "bool"},
+          {"name": "returnData", "type": "bytes"}
+        ],
+        "name": "returnData",
+        "type": "tuple[]"
+      }
+    ],
+    "stateMutability": "payable",
+    "type": "function"
+  }
+]`
+
+// errNoMulticall3 means aggregate3 returned no data, i.e. there is no
+// contract at Multicall3Address on this chain.
+var errNoMulticall3 = errors.New("multicall3 is not deployed")
+
+// errCallReverted is reported for a call that failed inside aggregate3.
+var errCallReverted = errors.New("execution reverted")
+
+// multicall3Call mirrors the Multicall3.Call3 struct.
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// multicall3Result mirrors the Multicall3.Result struct.
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// Pending is the result of a call queued on a Batch. Value and Err are set
+// by Batch.Execute.
+type Pending[T any] struct {
+	Value T
+	Err   error
+}
+
+// batchCall is one queued eth_call and the function that decodes its result.
+type batchCall struct {
+	target common.Address
+	data   []byte
+	handle func(ret []byte, err error)
+}
+
+// Batch collects view calls and executes them together in a single Multicall3
+// aggregate3 eth_call. On chains without Multicall3 it falls back to one
+// eth_call per queued call. A Batch is not safe for concurrent use.
+type Batch struct {
+	c     *Caller
+	calls []batchCall
+	block *big.Int // block the calls are executed at, nil for the latest
+}
+
+// NewBatch starts an empty batch executed at the latest block.
+func (c *Caller) NewBatch() *Batch {
+	return &Batch{c: c}
+}
+
+// NewBatchAt starts an empty batch executed at a past block. The RPC node
+// must keep the state of that block.
+func (c *Caller) NewBatchAt(block uint64) *Batch {
+	return &Batch{c: c, block: new(big.Int).SetUint64(block)}
+}
+
+// Len returns the number of queued calls.
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+func (b *Batch) add(target common.Address, data []byte, handle func(ret []byte, err error)) {
+	b.calls = append(b.calls, batchCall{target: target, data: data, handle: handle})
+}
+
+// Execute runs all queued calls and fills in their Pending results. A failing
+// call only sets its own Pending.Err; Execute returns an error when the batch
+// as a whole could not be executed (e.g. the RPC request failed).
+func (b *Batch) Execute(ctx context.Context) error {
+	calls := b.calls
+	b.calls = nil
+
+	if len(calls) == 1 || !b.c.multicallAvailable() {
+		return b.c.callEach(ctx, calls, b.block)
+	}
+
+	for start := 0; start < len(calls); start += maxMulticallCalls {
+		chunk := calls[start:min(start+maxMulticallCalls, len(calls))]
+		results, err := b.c.aggregate3(ctx, chunk, b.block)
+		if errors.Is(err, errNoMulticall3) {
+			// At a past block Multicall3 may only not be deployed yet, so
+			// only this batch falls back.
+			if b.block != nil {
+				slog.Debug("multicall3 not deployed at block, falling back to individual calls",
+					"address", Multicall3Address.Hex(), "block", b.block)
+				return b.c.callEach(ctx, calls[start:], b.block)
+			}
+			b.c.noMulticall.Store(true)
+			slog.Warn("multicall3 not available, falling back to individual calls",
+				"address", Multicall3Address.Hex())
+			return b.c.callEach(ctx, calls[start:], b.block)
+		}
+		if err != nil {
+			return err
+		}
+		for i, r := range results {
+			if r.Success {
+				chunk[i].handle(r.ReturnData, nil)
+			} else {
+				chunk[i].handle(nil, errCallReverted)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Caller) multicallAvailable() bool {
+	return !c.noMulticall.Load()
+}
+
+// callEach is the fallback path: one eth_call per queued call.
+func (c *Caller) callEach(ctx context.Context, calls []batchCall, block *big.Int) error {
+	for _, call := range calls {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ret, err := c.client.CallContract(ctx, ethereum.CallMsg{
+			To:   &call.target,
+			Data: call.data,
+		}, block)
+		call.handle(ret, err)
+	}
+	return nil
+}
+
+// aggregate3 executes calls through Multicall3 with allowFailure set, so a
+// reverting call does not revert the others.
+func (c *Caller) aggregate3(ctx context.Context, calls []batchCall, block *big.Int) ([]multicall3Result, error) {
+	args := make([]multicall3Call, len(calls))
+	for i, call := range calls {
+		args[i] = multicall3Call{Target: call.target, AllowFailure: true, CallData: call.data}
+	}
+	data, err := c.multicallABI.Pack("aggregate3", args)
+	if err != nil {
+		return nil, fmt.Errorf("pack aggregate3: %w", err)
+	}
+
+	ret, err := c.client.CallContract(ctx, ethereum.CallMsg{
+		To:   &Multicall3Address,
+		Data: data,
+	}, block)
+	if err != nil {
+		return nil, fmt.Errorf("call aggregate3: %w", err)
+	}
+	if len(ret) == 0 {
+		return nil, errNoMulticall3
+	}
+
+	outputs := c.multicallABI.Methods["aggregate3"].Outputs
+	values, err := outputs.Unpack(ret)
+	if err != nil {
+		return nil, fmt.Errorf("unpack aggregate3: %w", err)
+	}
+	var results []multicall3Result
+	if err := outputs.Copy(&results, values); err != nil {
+		return nil, fmt.Errorf("decode aggregate3: %w", err)
+	}
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(results), len(calls))
+	}
+	return results, nil
+}
@@ -0,0 +1,294 @@
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeChain answers eth_calls from a table keyed by target and calldata, and
+// optionally implements Multicall3 on top of it.
+type fakeChain struct {
+	t         *testing.T
+	caller    *Caller
+	multicall bool
+	answers   map[common.Address]map[string][]byte
+	calls     int
+	block     *big.Int // block of the last call
+}
+
+func (f *fakeChain) answer(to common.Address, data []byte) ([]byte, bool) {
+	ret, ok := f.answers[to][string(data)]
+	return ret, ok
+}
+
+func (f *fakeChain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.calls++
+	f.block = blockNumber
+	if *msg.To != Multicall3Address {
+		if ret, ok := f.answer(*msg.To, msg.Data); ok {
+			return ret, nil
+		}
+		return nil, errCallReverted
+	}
+	if !f.multicall {
+		return nil, nil // no code at the address
+	}
+
+	method := f.caller.multicallABI.Methods["aggregate3"]
+	if !bytes.Equal(msg.Data[:4], method.ID) {
+		f.t.Fatalf("unexpected multicall selector %x", msg.Data[:4])
+	}
+	args, err := method.Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		f.t.Fatalf("unpack aggregate3 args: %v", err)
+	}
+	calls := args[0].([]struct {
+		Target       common.Address `json:"target"`
+		AllowFailure bool           `json:"allowFailure"`
+		CallData     []byte         `json:"callData"`
+	})
+	results := make([]multicall3Result, len(calls))
+	for i, c := range calls {
+		results[i].ReturnData, results[i].Success = f.answer(c.Target, c.CallData)
+	}
+	return method.Outputs.Pack(results)
+}
+
+func newFakeChain(t *testing.T, multicall bool) (*fakeChain, *Caller) {
+	f := &fakeChain{t: t, multicall: multicall, answers: make(map[common.Address]map[string][]byte)}
+	caller, err := NewCaller(f, common.HexToAddress("0x1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.caller = caller
+	return f, caller
+}
+
+func (f *fakeChain) set(to common.Address, data []byte, ret []byte) {
+	if f.answers[to] == nil {
+		f.answers[to] = make(map[string][]byte)
+	}
+	f.answers[to][string(data)] = ret
+}
+
+func (f *fakeChain) setERC20(token common.Address, name, symbol string, decimals uint8) {
+	erc20 := f.caller.erc20ABI
+	for method, value := range map[string]any{"name": name, "symbol": symbol, "decimals": decimals} {
+		data, _ := erc20.Pack(method)
+		ret, err := erc20.Methods[method].Outputs.Pack(value)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		f.set(token, data, ret)
+	}
+}
+
+func TestBatchMulticall(t *testing.T) {
+	for _, multicall := range []bool{true, false} {
+		f, caller := newFakeChain(t, multicall)
+
+		usdt := common.HexToAddress("0xaa")
+		weird := common.HexToAddress("0xbb") // implements decimals() only
+		f.setERC20(usdt, "Tether USD", "USDT", 6)
+		decimals, _ := caller.erc20ABI.Pack("decimals")
+		ret, _ := caller.erc20ABI.Methods["decimals"].Outputs.Pack(uint8(9))
+		f.set(weird, decimals, ret)
+
+		view := caller.gridExABI
+		pairData, _ := view.Pack("getPairTokens", uint64(7))
+		pairRet, _ := view.Methods["getPairTokens"].Outputs.Pack(usdt, weird)
+		f.set(caller.gridExAddr, pairData, pairRet)
+
+		b := caller.NewBatch()
+		pair := b.PairTokens(7)
+		missing := b.PairTokens(8)
+		info := b.TokenInfo(usdt)
+		partial := b.TokenInfo(weird)
+		if err := b.Execute(context.Background()); err != nil {
+			t.Fatalf("multicall=%v: execute: %v", multicall, err)
+		}
+
+		wantCalls := 1
+		if !multicall {
+			wantCalls = 1 + 8 // empty aggregate3, then one call per queued call
+		}
+		if f.calls != wantCalls {
+			t.Errorf("multicall=%v: %d eth_calls, want %d", multicall, f.calls, wantCalls)
+		}
+		if pair.Err != nil || pair.Value.Base != usdt || pair.Value.Quote != weird {
+			t.Errorf("multicall=%v: pair=%+v err=%v", multicall, pair.Value, pair.Err)
+		}
+		if missing.Err == nil {
+			t.Errorf("multicall=%v: expected an error for a reverting call", multicall)
+		}
+		if got := info.Value; got.Name != "Tether USD" || got.Symbol != "USDT" || got.Decimals != 6 {
+			t.Errorf("multicall=%v: token info %+v", multicall, got)
+		}
+		if got := partial.Value; got.Name != "" || got.Symbol != "" || got.Decimals != 9 {
+			t.Errorf("multicall=%v: partial token info %+v", multicall, got)
+		}
+		if caller.multicallAvailable() != multicall {
+			t.Errorf("multicall=%v: multicallAvailable()=%v", multicall, caller.multicallAvailable())
+		}
+	}
+}
+
+func TestBatchAtBeforeMulticall(t *testing.T) {
+	f, caller := newFakeChain(t, false)
+	usdt := common.HexToAddress("0xaa")
+	f.setERC20(usdt, "Tether USD", "USDT", 6)
+
+	// Multicall3 has no code at a past block: only that batch falls back.
+	b := caller.NewBatchAt(99)
+	info := b.TokenInfo(usdt)
+	if err := b.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if info.Err != nil || info.Value.Symbol != "USDT" {
+		t.Fatalf("token info %+v err=%v", info.Value, info.Err)
+	}
+	if !caller.multicallAvailable() {
+		t.Fatal("an empty aggregate3 at a past block disabled multicall")
+	}
+
+	// At the latest block it is not deployed at all.
+	b = caller.NewBatch()
+	b.TokenInfo(usdt)
+	if err := b.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if caller.multicallAvailable() {
+		t.Fatal("an empty aggregate3 at the latest block kept multicall")
+	}
+}
+
+func TestBatchDecodeMismatch(t *testing.T) {
+	f, caller := newFakeChain(t, true)
+	view := caller.gridExABI
+	base, quote := common.HexToAddress("0xaa"), common.HexToAddress("0xbb")
+	data, _ := view.Pack("getPairIdByTokens", base, quote)
+	ret, _ := view.Methods["getPairIdByTokens"].Outputs.Pack(uint64(7))
+	f.set(caller.gridExAddr, data, ret)
+	data, _ = view.Pack("getPairTokens", uint64(7))
+	ret, _ = view.Methods["getPairTokens"].Outputs.Pack(base, quote)
+	f.set(caller.gridExAddr, data, ret)
+
+	// Output types that don't match the ABI fail the call instead of
+	// panicking inside Execute.
+	b := caller.NewBatch()
+	id := addView(b, "getPairIdByTokens", identity[string], base, quote)
+	pair := addView(b, "getPairTokens", identity[struct{ Base, Other common.Address }], uint64(7))
+	ok := b.PairIDByTokens(base, quote)
+	if err := b.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if id.Err == nil || pair.Err == nil {
+		t.Fatalf("id err=%v pair err=%v, want decode errors", id.Err, pair.Err)
+	}
+	if ok.Err != nil || ok.Value != 7 {
+		t.Fatalf("pair id=%d err=%v", ok.Value, ok.Err)
+	}
+}
+
+func TestBatchStrategyParams(t *testing.T) {
+	f, caller := newFakeChain(t, true)
+	linear := common.HexToAddress("0xcc")
+	geometry := common.HexToAddress("0xdd")
+
+	askKey := new(big.Int).Lsh(big.NewInt(1), 128)
+	askKey.Or(askKey, big.NewInt(42))
+	if StrategyKey(true, 42).Cmp(askKey) != 0 || StrategyKey(false, 42).Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("StrategyKey: ask=%s bid=%s", StrategyKey(true, 42), StrategyKey(false, 42))
+	}
+
+	data, _ := caller.linearABI.Pack("strategies", StrategyKey(false, 42))
+	ret, _ := caller.linearABI.Methods["strategies"].Outputs.Pack(big.NewInt(1000), big.NewInt(-10))
+	f.set(linear, data, ret)
+	data, _ = caller.geometryABI.Pack("strategies", StrategyKey(true, 42))
+	ret, _ = caller.geometryABI.Methods["strategies"].Outputs.Pack(big.NewInt(2000), big.NewInt(1e18))
+	f.set(geometry, data, ret)
+
+	b := caller.NewBatch()
+	bid := b.LinearStrategy(linear, false, 42)
+	ask := b.GeometryStrategy(geometry, true, 42)
+	if err := b.Execute(context.Background()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if bid.Err != nil || bid.Value.Price0.Int64() != 1000 || bid.Value.Gap.Int64() != -10 || bid.Value.Ratio != nil {
+		t.Errorf("linear params %+v err=%v", bid.Value, bid.Err)
+	}
+	if ask.Err != nil || ask.Value.Price0.Int64() != 2000 || ask.Value.Ratio.Int64() != 1e18 || ask.Value.Gap != nil {
+		t.Errorf("geometry params %+v err=%v", ask.Value, ask.Err)
+	}
+}
+
+func TestBatchStrategyPrices(t *testing.T) {
+	f, caller := newFakeChain(t, true)
+	geometry := common.HexToAddress("0xdd")
+
+	data, _ := caller.priceABI.Pack("getPrice", true, big.NewInt(42), uint16(3))
+	ret, _ := caller.priceABI.Methods["getPrice"].Outputs.Pack(big.NewInt(2662))
+	f.set(geometry, data, ret)
+	data, _ = caller.priceABI.Pack("getReversePrice", true, big.NewInt(42), uint16(3))
+	ret, _ = caller.priceABI.Methods["getReversePrice"].Outputs.Pack(big.NewInt(2420))
+	f.set(geometry, data, ret)
+
+	b := caller.NewBatchAt(99)
+	price := b.StrategyPrice(geometry, true, 42, 3)
+	rev := b.StrategyReversePrice(geometry, true, 42, 3)
+	other := b.StrategyPrice(geometry, false, 42, 3) // unanswered, reverts
+	if err := b.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if price.Err != nil || price.Value.Int64() != 2662 {
+		t.Errorf("price=%v err=%v", price.Value, price.Err)
+	}
+	if rev.Err != nil || rev.Value.Int64() != 2420 {
+		t.Errorf("reverse price=%v err=%v", rev.Value, rev.Err)
+	}
+	if other.Err == nil {
+		t.Error("expected an error for a reverting call")
+	}
+}
+
+func TestBatchGridOrdersAt(t *testing.T) {
+	f, caller := newFakeChain(t, true)
+
+	view := caller.gridExABI
+	ids := []uint64{42<<16 | 0x8000, 42 << 16}
+	data, _ := view.Pack("getGridOrders", ids)
+	ret, err := view.Methods["getGridOrders"].Outputs.Pack([]orderInfoTuple{
+		{IsAsk: true, GridId: big.NewInt(42), OrderId: 0x8000, Amount: big.NewInt(5), RevAmount: big.NewInt(0),
+			BaseAmt: big.NewInt(5), Price: big.NewInt(100), RevPrice: big.NewInt(90), PairId: 1},
+		{GridId: big.NewInt(42), Amount: big.NewInt(7), RevAmount: big.NewInt(3),
+			BaseAmt: big.NewInt(5), Price: big.NewInt(80), RevPrice: big.NewInt(90), PairId: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.set(caller.gridExAddr, data, ret)
+
+	b := caller.NewBatchAt(1234)
+	orders := b.GridOrders(ids)
+	profits := b.GridProfits(42) // unanswered, reverts
+	if err := b.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if f.block == nil || f.block.Uint64() != 1234 {
+		t.Fatalf("executed at block %v, want 1234", f.block)
+	}
+	if orders.Err != nil || len(orders.Value) != 2 {
+		t.Fatalf("orders=%v err=%v", orders.Value, orders.Err)
+	}
+	if o := orders.Value[1]; o.IsAsk || o.GridID != 42 || o.Amount.Int64() != 7 || o.RevAmount.Int64() != 3 {
+		t.Errorf("bid order %+v", *o)
+	}
+	if profits.Err == nil {
+		t.Error("expected an error for a reverting call")
+	}
+}
@@ -0,0 +1,77 @@
+package contracts
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Version identifies a release of the GridEx facets whose events differ from
+// the other releases'. Facets are upgraded in place, so one GridEx address
+// emits the events of several versions over its history.
+type Version string
+
+const (
+	// V1 grids have uint128 IDs. An order is identified by the uint256
+	// gridOrderId = (gridId << 128) | orderId, where ask orderIds carry
+	// ASK_ORDER_FLAG (1 << 127) and bid orderIds start from 0.
+	V1 Version = "v1"
+	// V2 grids have uint48 IDs. An order is identified by the uint64
+	// gridOrderId = (gridId << 16) | orderId, where ask orderIds start from
+	// ASK_ORDER_START_ID (0x8000) and bid orderIds from 0.
+	V2 Version = "v2"
+
+	// Latest is the version of the facet ABIs in abi/.
+	Latest = V2
+)
+
+// versionABIs lists the embedded ABIs whose events replace those of the
+// latest facets in older versions. They only hold the events that changed.
+var versionABIs = map[Version][]string{
+	V1: {"v1/GridEx.json"},
+}
+
+// askOrderStartIDV2 is ASK_ORDER_START_ID of the v2 facets.
+const askOrderStartIDV2 = 0x8000
+
+// ParseVersion parses a version name as used in the configuration.
+func ParseVersion(s string) (Version, error) {
+	switch v := Version(s); v {
+	case V1, V2:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown contract version %q", s)
+}
+
+// OrderID returns the orderId, within its grid, of the i-th (0-based) ask or
+// bid order of a grid.
+func (v Version) OrderID(isAsk bool, i uint32) *big.Int {
+	id := new(big.Int).SetUint64(uint64(i))
+	if !isAsk {
+		return id
+	}
+	if v == V1 {
+		return id.Or(id, ASKOrderFlag)
+	}
+	return id.Add(id, big.NewInt(askOrderStartIDV2))
+}
+
+// GridOrderID combines a grid ID and an orderId into the gridOrderId that
+// identifies the order in FilledOrder events and in the orders table.
+func (v Version) GridOrderID(gridID uint64, orderID *big.Int) *big.Int {
+	shift := uint(16)
+	if v == V1 {
+		shift = 128
+	}
+	id := new(big.Int).Lsh(new(big.Int).SetUint64(gridID), shift)
+	return id.Or(id, orderID)
+}
+
+// SplitGridOrderID is the inverse of GridOrderID.
+func (v Version) SplitGridOrderID(gridOrderID *big.Int) (gridID uint64, orderID *big.Int) {
+	if v == V1 {
+		g, o := ExtractGridIDOrderID(gridOrderID)
+		return g.Uint64(), o
+	}
+	mask := big.NewInt(1<<16 - 1)
+	return new(big.Int).Rsh(gridOrderID, 16).Uint64(), new(big.Int).And(gridOrderID, mask)
+}
@@ -0,0 +1,37 @@
+package contracts
+
+import "testing"
+
+func TestGridOrderIDs(t *testing.T) {
+	tests := []struct {
+		version Version
+		isAsk   bool
+		i       uint32
+		want    string // gridOrderId of grid 5
+	}{
+		{V2, false, 0, "0x50000"},
+		{V2, true, 0, "0x58000"},
+		{V2, true, 3, "0x58003"},
+		{V1, false, 2, "0x500000000000000000000000000000002"},
+		{V1, true, 2, "0x580000000000000000000000000000002"},
+	}
+	for _, tt := range tests {
+		id := tt.version.GridOrderID(5, tt.version.OrderID(tt.isAsk, tt.i))
+		if got := "0x" + id.Text(16); got != tt.want {
+			t.Errorf("%s ask=%v i=%d: gridOrderId=%s, want %s", tt.version, tt.isAsk, tt.i, got, tt.want)
+		}
+		gridID, orderID := tt.version.SplitGridOrderID(id)
+		if gridID != 5 || orderID.Cmp(tt.version.OrderID(tt.isAsk, tt.i)) != 0 {
+			t.Errorf("%s: split %s = (%d, %s)", tt.version, id, gridID, orderID)
+		}
+	}
+	if !IsAskOrder(V1.OrderID(true, 0)) || IsAskOrder(V1.OrderID(false, 0)) {
+		t.Error("v1 ask orderIds must carry ASK_ORDER_FLAG")
+	}
+	if _, err := ParseVersion("v3"); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+	if v, _ := ParseVersion("v1"); v != V1 {
+		t.Errorf("ParseVersion(v1)=%s", v)
+	}
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OutboxEvent is a Kafka message stored in event_outbox.
+type OutboxEvent struct {
+	ID             int64
+	IdempotencyKey string
+	EventType      string
+	PartitionKey   string
+	Payload        []byte // the JSON encoded message
+	BlockNumber    uint64
+}
+
+// InsertOutboxEvents queues Kafka messages within a transaction, in order. An
+// event whose idempotency key is already queued is skipped.
+func InsertOutboxEvents(ctx context.Context, tx pgx.Tx, chainID int64, events []OutboxEvent) error {
+	for _, e := range events {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO event_outbox (chain_id, idempotency_key, event_type, partition_key, payload, block_number)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (chain_id, idempotency_key) DO NOTHING
+		`, chainID, e.IdempotencyKey, e.EventType, e.PartitionKey, e.Payload, int64(e.BlockNumber))
+		if err != nil {
+			return fmt.Errorf("insert outbox event %s: %w", e.IdempotencyKey, err)
+		}
+	}
+	return nil
+}
+
+// GetPendingOutboxEvents returns up to limit unsent events of a chain, oldest
+// first.
+func (r *Repository) GetPendingOutboxEvents(ctx context.Context, chainID int64, limit int) ([]OutboxEvent, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, idempotency_key, event_type, partition_key, payload, block_number
+		FROM event_outbox
+		WHERE chain_id = $1 AND sent_at IS NULL
+		ORDER BY id
+		LIMIT $2
+	`, chainID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query pending outbox events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxEvent, error) {
+		var (
+			e     OutboxEvent
+			block int64
+		)
+		err := row.Scan(&e.ID, &e.IdempotencyKey, &e.EventType, &e.PartitionKey, &e.Payload, &block)
+		e.BlockNumber = uint64(block)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan outbox event: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxEventsSent records within a transaction that events were
+// published.
+func MarkOutboxEventsSent(ctx context.Context, tx pgx.Tx, chainID int64, ids []int64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE event_outbox SET sent_at = NOW()
+		WHERE chain_id = $1 AND id = ANY($2)
+	`, chainID, ids)
+	if err != nil {
+		return fmt.Errorf("mark outbox events sent: %w", err)
+	}
+	return nil
+}
+
+// CountPendingOutboxEvents returns the number of unsent events of a chain.
+func (r *Repository) CountPendingOutboxEvents(ctx context.Context, chainID int64) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM event_outbox WHERE chain_id = $1 AND sent_at IS NULL`, chainID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count pending outbox events: %w", err)
+	}
+	return n, nil
+}
+
+// PruneOutbox deletes the events of a chain sent more than retention ago and
+// returns how many were deleted.
+func (r *Repository) PruneOutbox(ctx context.Context, chainID int64, retention time.Duration) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+		DELETE FROM event_outbox
+		WHERE chain_id = $1 AND sent_at IS NOT NULL AND sent_at < NOW() - $2::BIGINT * INTERVAL '1 second'
+	`, chainID, int64(retention/time.Second))
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
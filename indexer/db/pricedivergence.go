@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PriceDivergence is a new order whose computed prices differ from the ones
+// its strategy contract returns.
+type PriceDivergence struct {
+	GridID           int64
+	OrderID          string
+	IsAsk            bool
+	Strategy         string
+	StrategyAddress  string
+	ComputedPrice    string
+	OnchainPrice     string
+	ComputedRevPrice string
+	OnchainRevPrice  string
+	UsedOnchain      bool
+}
+
+// InsertPriceDivergence records an order price divergence within a
+// transaction. Re-processing the order replaces its row.
+func InsertPriceDivergence(ctx context.Context, tx pgx.Tx, chainID int64, d PriceDivergence, blockNumber uint64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO order_price_divergences (chain_id, grid_id, order_id, is_ask, strategy, strategy_address,
+			computed_price, onchain_price, computed_rev_price, onchain_rev_price, used_onchain, create_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (chain_id, order_id) DO UPDATE
+		SET grid_id = EXCLUDED.grid_id, is_ask = EXCLUDED.is_ask,
+		    strategy = EXCLUDED.strategy, strategy_address = EXCLUDED.strategy_address,
+		    computed_price = EXCLUDED.computed_price, onchain_price = EXCLUDED.onchain_price,
+		    computed_rev_price = EXCLUDED.computed_rev_price, onchain_rev_price = EXCLUDED.onchain_rev_price,
+		    used_onchain = EXCLUDED.used_onchain, create_block = EXCLUDED.create_block
+	`, chainID, d.GridID, d.OrderID, d.IsAsk, d.Strategy, d.StrategyAddress,
+		d.ComputedPrice, d.OnchainPrice, d.ComputedRevPrice, d.OnchainRevPrice, d.UsedOnchain, int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("insert price divergence: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Protocol event names stored in protocol_events.event.
+const (
+	ProtocolEventPaused               = "Paused"
+	ProtocolEventUnpaused             = "Unpaused"
+	ProtocolEventFacetUpdated         = "FacetUpdated"
+	ProtocolEventOwnershipTransferred = "OwnershipTransferred"
+)
+
+// ProtocolEvent is one governance or lifecycle event of the GridEx contract or
+// the Vault. Data is the decoded event and is stored as JSON.
+type ProtocolEvent struct {
+	Contract  string
+	Event     string
+	Data      any
+	TxHash    string
+	LogIndex  uint
+	Timestamp time.Time
+}
+
+// InsertProtocolEvent records a protocol event within a transaction.
+// Re-processing the same log is a no-op.
+func InsertProtocolEvent(ctx context.Context, tx pgx.Tx, chainID int64, e ProtocolEvent, blockNumber uint64) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", e.Event, err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO protocol_events (chain_id, contract, event, data, tx_hash, log_index, timestamp, create_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING
+	`, chainID, e.Contract, e.Event, string(data), e.TxHash, int(e.LogIndex), e.Timestamp, int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("insert protocol event: %w", err)
+	}
+	return nil
+}
+
+// GetPaused returns whether the GridEx contract of a chain is paused, i.e.
+// whether its last Paused/Unpaused event is a Paused one.
+func (r *Repository) GetPaused(ctx context.Context, chainID int64) (bool, error) {
+	var event string
+	err := r.pool.QueryRow(ctx, `
+		SELECT event FROM protocol_events
+		WHERE chain_id = $1 AND event IN ($2, $3)
+		ORDER BY create_block DESC, log_index DESC
+		LIMIT 1
+	`, chainID, ProtocolEventPaused, ProtocolEventUnpaused).Scan(&event)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get paused state: %w", err)
+	}
+	return event == ProtocolEventPaused, nil
+}
+
+// FacetUpdate is a FacetUpdated event: a function selector routed to a new
+// facet at a position in the chain.
+type FacetUpdate struct {
+	Facet       string
+	BlockNumber uint64
+	LogIndex    uint
+}
+
+// GetFacetUpdates returns the indexed FacetUpdated events of a chain in chain
+// order.
+func (r *Repository) GetFacetUpdates(ctx context.Context, chainID int64) ([]FacetUpdate, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT data->>'facet', create_block, log_index FROM protocol_events
+		WHERE chain_id = $1 AND event = $2
+		ORDER BY create_block, log_index
+	`, chainID, ProtocolEventFacetUpdated)
+	if err != nil {
+		return nil, fmt.Errorf("query facet updates: %w", err)
+	}
+	defer rows.Close()
+
+	var updates []FacetUpdate
+	for rows.Next() {
+		var (
+			u        FacetUpdate
+			block    int64
+			logIndex int
+		)
+		if err := rows.Scan(&u.Facet, &block, &logIndex); err != nil {
+			return nil, fmt.Errorf("scan facet update: %w", err)
+		}
+		u.BlockNumber, u.LogIndex = uint64(block), uint(logIndex)
+		updates = append(updates, u)
+	}
+	return updates, rows.Err()
+}
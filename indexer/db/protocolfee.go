@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ProtocolFeeCollection is one CollectProtocol event. Token is empty when the
+// payout could not be matched to an ERC20 transfer.
+type ProtocolFeeCollection struct {
+	Sender    string
+	Recipient string
+	Token     string
+	Amount    string
+	TxHash    string
+	LogIndex  uint
+	Timestamp time.Time
+}
+
+// InsertProtocolFeeCollection records a protocol fee payout within a transaction.
+// Re-processing the same log is a no-op.
+func InsertProtocolFeeCollection(ctx context.Context, tx pgx.Tx, chainID int64, c ProtocolFeeCollection, blockNumber uint64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO protocol_fee_collections (chain_id, sender, recipient, token, amount, tx_hash, log_index, timestamp, create_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING
+	`, chainID, c.Sender, c.Recipient, c.Token, c.Amount, c.TxHash, int(c.LogIndex), c.Timestamp, int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("insert protocol fee collection: %w", err)
+	}
+	return nil
+}
+
+// OneshotProtocolFeeChange is one OneshotProtocolFeeChanged event.
+type OneshotProtocolFeeChange struct {
+	Sender    string
+	OldFeeBps uint32
+	NewFeeBps uint32
+	TxHash    string
+	LogIndex  uint
+}
+
+// InsertOneshotProtocolFeeChange records a change of the oneshot protocol fee
+// within a transaction. Re-processing the same log is a no-op.
+func InsertOneshotProtocolFeeChange(ctx context.Context, tx pgx.Tx, chainID int64, c OneshotProtocolFeeChange, blockNumber uint64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO oneshot_protocol_fee_changes (chain_id, sender, old_fee_bps, new_fee_bps, tx_hash, log_index, create_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING
+	`, chainID, c.Sender, int64(c.OldFeeBps), int64(c.NewFeeBps), c.TxHash, int(c.LogIndex), int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("insert oneshot protocol fee change: %w", err)
+	}
+	return nil
+}
+
+// GetOneshotProtocolFeeBps returns the oneshot protocol fee in effect for a log
+// at (blockNumber, logIndex): the last change before it. The boolean result is
+// false when no change precedes it.
+func GetOneshotProtocolFeeBps(ctx context.Context, tx pgx.Tx, chainID int64, blockNumber uint64, logIndex uint) (uint32, bool, error) {
+	var bps int64
+	err := tx.QueryRow(ctx, `
+		SELECT new_fee_bps FROM oneshot_protocol_fee_changes
+		WHERE chain_id = $1 AND (create_block < $2 OR (create_block = $2 AND log_index < $3))
+		ORDER BY create_block DESC, log_index DESC
+		LIMIT 1
+	`, chainID, int64(blockNumber), int(logIndex)).Scan(&bps)
+	if err == pgx.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("get oneshot protocol fee: %w", err)
+	}
+	return uint32(bps), true, nil
+}
+
+// ProtocolRevenue is the protocol fee revenue in one quote token: the fees
+// accrued from fills and the amount paid out through CollectProtocol.
+type ProtocolRevenue struct {
+	QuoteToken string `json:"quote_token"`
+	Accrued    string `json:"accrued"`
+	Collected  string `json:"collected"`
+}
+
+// computeProtocolRevenue sums protocol fees per quote token. Payouts whose
+// token is unknown are reported under an empty quote_token.
+func computeProtocolRevenue(ctx context.Context, tx pgx.Tx, chainID int64) ([]ProtocolRevenue, error) {
+	rows, err := tx.Query(ctx, `
+		WITH accrued AS (
+			SELECT quote_address AS token, SUM(protocol_fee::NUMERIC) AS amount
+			FROM order_fills WHERE chain_id = $1
+			GROUP BY quote_address
+		), collected AS (
+			SELECT token, SUM(amount::NUMERIC) AS amount
+			FROM protocol_fee_collections WHERE chain_id = $1
+			GROUP BY token
+		)
+		SELECT COALESCE(a.token, c.token), COALESCE(a.amount, 0)::TEXT, COALESCE(c.amount, 0)::TEXT
+		FROM accrued a FULL JOIN collected c ON a.token = c.token
+		ORDER BY 1
+	`, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("query protocol revenue: %w", err)
+	}
+	revenue, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ProtocolRevenue, error) {
+		var r ProtocolRevenue
+		err := row.Scan(&r.QuoteToken, &r.Accrued, &r.Collected)
+		return r, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan protocol revenue: %w", err)
+	}
+	return revenue, nil
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ProvisionalEvent is a log published in tip mode before its block passed the
+// finality threshold.
+type ProvisionalEvent struct {
+	BlockNumber uint64
+	BlockHash   string
+	TxHash      string
+	LogIndex    uint
+	EventTypes  []string // Kafka event types published for this log
+}
+
+// Key identifies the log on a specific fork.
+func (e ProvisionalEvent) Key() string {
+	return ProvisionalEventKey(e.TxHash, e.LogIndex, e.BlockHash)
+}
+
+// ProvisionalEventKey builds the key matching ProvisionalEvent.Key for a log.
+func ProvisionalEventKey(txHash string, logIndex uint, blockHash string) string {
+	return fmt.Sprintf("%s:%d:%s", strings.ToLower(txHash), logIndex, strings.ToLower(blockHash))
+}
+
+// InsertProvisionalEvent records a published provisional log within a transaction.
+// It returns false if the same log on the same block was already recorded.
+func InsertProvisionalEvent(ctx context.Context, tx pgx.Tx, chainID int64, ev ProvisionalEvent) (bool, error) {
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO provisional_events (chain_id, block_number, block_hash, tx_hash, log_index, event_types)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING
+	`, chainID, int64(ev.BlockNumber), strings.ToLower(ev.BlockHash), strings.ToLower(ev.TxHash),
+		int(ev.LogIndex), strings.Join(ev.EventTypes, ","))
+	if err != nil {
+		return false, fmt.Errorf("insert provisional event: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetProvisionalEventKeys returns the keys of provisional events recorded for
+// blocks in [fromBlock, toBlock].
+func (r *Repository) GetProvisionalEventKeys(ctx context.Context, chainID int64, fromBlock, toBlock uint64) (map[string]struct{}, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT tx_hash, log_index, block_hash FROM provisional_events
+		WHERE chain_id = $1 AND block_number BETWEEN $2 AND $3
+	`, chainID, int64(fromBlock), int64(toBlock))
+	if err != nil {
+		return nil, fmt.Errorf("get provisional event keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string]struct{})
+	for rows.Next() {
+		var txHash, blockHash string
+		var logIndex int
+		if err := rows.Scan(&txHash, &logIndex, &blockHash); err != nil {
+			return nil, fmt.Errorf("scan provisional event key: %w", err)
+		}
+		keys[ProvisionalEventKey(txHash, uint(logIndex), blockHash)] = struct{}{}
+	}
+	return keys, rows.Err()
+}
+
+// TakeProvisionalEvents deletes and returns all provisional events at or below
+// maxBlock. It is called by the canonical pass once those blocks are final.
+func TakeProvisionalEvents(ctx context.Context, tx pgx.Tx, chainID int64, maxBlock uint64) ([]ProvisionalEvent, error) {
+	rows, err := tx.Query(ctx, `
+		DELETE FROM provisional_events
+		WHERE chain_id = $1 AND block_number <= $2
+		RETURNING block_number, block_hash, tx_hash, log_index, event_types
+	`, chainID, int64(maxBlock))
+	if err != nil {
+		return nil, fmt.Errorf("take provisional events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ProvisionalEvent
+	for rows.Next() {
+		var ev ProvisionalEvent
+		var blockNumber int64
+		var logIndex int
+		var eventTypes string
+		if err := rows.Scan(&blockNumber, &ev.BlockHash, &ev.TxHash, &logIndex, &eventTypes); err != nil {
+			return nil, fmt.Errorf("scan provisional event: %w", err)
+		}
+		ev.BlockNumber = uint64(blockNumber)
+		ev.LogIndex = uint(logIndex)
+		if eventTypes != "" {
+			ev.EventTypes = strings.Split(eventTypes, ",")
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
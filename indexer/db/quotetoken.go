@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QuoteToken is a token of the quote token registry. Priority is a base-10
+// uint256; "0" means the token is no longer quotable.
+type QuoteToken struct {
+	Address  string
+	Priority string
+}
+
+// UpsertQuoteToken sets the priority of a quote token within a transaction.
+func UpsertQuoteToken(ctx context.Context, tx pgx.Tx, chainID int64, address, priority string, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "quote_tokens", blockNumber, "chain_id = $1 AND address = $3", address); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO quote_tokens (chain_id, address, priority, create_block, update_block)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (chain_id, address) DO UPDATE
+		SET priority = EXCLUDED.priority, update_block = EXCLUDED.update_block, updated_at = NOW()
+	`, chainID, address, priority, int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("upsert quote token: %w", err)
+	}
+	return nil
+}
+
+// GetQuoteTokenPriorities returns the priorities of the registry tokens among
+// addresses, keyed by address. Tokens never registered are missing from the map.
+func GetQuoteTokenPriorities(ctx context.Context, tx pgx.Tx, chainID int64, addresses ...string) (map[string]*big.Int, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT address, priority FROM quote_tokens
+		WHERE chain_id = $1 AND address = ANY($2)
+	`, chainID, addresses)
+	if err != nil {
+		return nil, fmt.Errorf("query quote token priorities: %w", err)
+	}
+	tokens, err := pgx.CollectRows(rows, scanQuoteToken)
+	if err != nil {
+		return nil, fmt.Errorf("scan quote token priorities: %w", err)
+	}
+	return quoteTokenPriorities(tokens)
+}
+
+// GetQuoteTokens returns the quote token registry of a chain, removed tokens included.
+func (r *Repository) GetQuoteTokens(ctx context.Context, chainID int64) ([]QuoteToken, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT address, priority FROM quote_tokens WHERE chain_id = $1 ORDER BY address
+	`, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("query quote tokens: %w", err)
+	}
+	tokens, err := pgx.CollectRows(rows, scanQuoteToken)
+	if err != nil {
+		return nil, fmt.Errorf("scan quote tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func scanQuoteToken(row pgx.CollectableRow) (QuoteToken, error) {
+	var t QuoteToken
+	err := row.Scan(&t.Address, &t.Priority)
+	return t, err
+}
+
+func quoteTokenPriorities(tokens []QuoteToken) (map[string]*big.Int, error) {
+	priorities := make(map[string]*big.Int, len(tokens))
+	for _, t := range tokens {
+		p, ok := new(big.Int).SetString(t.Priority, 10)
+		if !ok {
+			return nil, fmt.Errorf("quote token %s: invalid priority %q", t.Address, t.Priority)
+		}
+		priorities[t.Address] = p
+	}
+	return priorities, nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Fields compared by the reconciler, stored in reconciliation_issues.field.
+const (
+	ReconcileFieldAmount    = "amount"
+	ReconcileFieldRevAmount = "rev_amount"
+	ReconcileFieldStatus    = "status"
+	ReconcileFieldFee       = "fee"
+	ReconcileFieldProfits   = "profits"
+)
+
+// ReconcileGrid is the indexed state of an active grid that the reconciler
+// compares with the contract.
+type ReconcileGrid struct {
+	GridID  int64
+	Status  int
+	Fee     int
+	Profits string
+	Orders  []ReconcileOrder // active orders
+}
+
+// ReconcileOrder is the indexed state of an active order.
+type ReconcileOrder struct {
+	OrderID   string
+	Amount    string
+	RevAmount string
+}
+
+// ReconciliationIssue is a value that differs between the DB and the
+// contract. OrderID is empty for the fields of the grid itself.
+type ReconciliationIssue struct {
+	GridID     int64
+	OrderID    string
+	Field      string
+	DBValue    string
+	ChainValue string
+	Repaired   bool
+}
+
+// SampleActiveGrids returns up to n random active grids of a chain with their
+// active orders, and the last indexed block. All of them are read from one
+// snapshot, so the rows show the state as of that block.
+func (r *Repository) SampleActiveGrids(ctx context.Context, chainID int64, n int) (uint64, []ReconcileGrid, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, nil, fmt.Errorf("begin snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var block int64
+	err = tx.QueryRow(ctx, `SELECT last_block FROM indexer_state WHERE chain_id = $1`, chainID).Scan(&block)
+	if err == pgx.ErrNoRows {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("get last block: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT grid_id, status, fee, COALESCE(NULLIF(profits, ''), '0')
+		FROM grids
+		WHERE chain_id = $1 AND status = 1
+		ORDER BY random()
+		LIMIT $2
+	`, chainID, n)
+	if err != nil {
+		return 0, nil, fmt.Errorf("query active grids: %w", err)
+	}
+	grids, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ReconcileGrid, error) {
+		var g ReconcileGrid
+		err := row.Scan(&g.GridID, &g.Status, &g.Fee, &g.Profits)
+		return g, err
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("scan active grid: %w", err)
+	}
+	if len(grids) == 0 {
+		return uint64(block), nil, nil
+	}
+
+	ids := make([]int64, len(grids))
+	byID := make(map[int64]*ReconcileGrid, len(grids))
+	for i := range grids {
+		ids[i] = grids[i].GridID
+		byID[grids[i].GridID] = &grids[i]
+	}
+	rows, err = tx.Query(ctx, `
+		SELECT grid_id, order_id, amount, rev_amount
+		FROM orders
+		WHERE chain_id = $1 AND grid_id = ANY($2) AND status = 0
+		ORDER BY grid_id, order_id
+	`, chainID, ids)
+	if err != nil {
+		return 0, nil, fmt.Errorf("query active orders: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			gridID int64
+			o      ReconcileOrder
+		)
+		if err := rows.Scan(&gridID, &o.OrderID, &o.Amount, &o.RevAmount); err != nil {
+			return 0, nil, fmt.Errorf("scan active order: %w", err)
+		}
+		byID[gridID].Orders = append(byID[gridID].Orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("query active orders: %w", err)
+	}
+	return uint64(block), grids, nil
+}
+
+// RecordReconciliation stores the issues found for a grid at block within a
+// transaction. An issue seen before updates its row; the grid's open issues
+// that were not found again are resolved.
+func RecordReconciliation(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, block uint64, issues []ReconciliationIssue) error {
+	keys := make([]string, len(issues))
+	for i, issue := range issues {
+		keys[i] = issue.OrderID + "/" + issue.Field
+		_, err := tx.Exec(ctx, `
+			INSERT INTO reconciliation_issues (chain_id, grid_id, order_id, field, db_value, chain_value,
+				block_number, repaired, resolved)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+			ON CONFLICT (chain_id, grid_id, order_id, field) DO UPDATE
+			SET db_value = EXCLUDED.db_value,
+			    chain_value = EXCLUDED.chain_value,
+			    block_number = EXCLUDED.block_number,
+			    repaired = EXCLUDED.repaired,
+			    resolved = EXCLUDED.resolved,
+			    occurrences = reconciliation_issues.occurrences + 1,
+			    last_seen_at = NOW()
+		`, chainID, gridID, issue.OrderID, issue.Field, issue.DBValue, issue.ChainValue, int64(block), issue.Repaired)
+		if err != nil {
+			return fmt.Errorf("insert reconciliation issue: %w", err)
+		}
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE reconciliation_issues SET resolved = TRUE
+		WHERE chain_id = $1 AND grid_id = $2 AND NOT resolved
+		  AND NOT (order_id || '/' || field = ANY($3))
+	`, chainID, gridID, keys)
+	if err != nil {
+		return fmt.Errorf("resolve reconciliation issues: %w", err)
+	}
+	return nil
+}
+
+// RepairOrder overwrites an order's amounts with the contract's values as of
+// block. It reports false, and changes nothing, if the order was updated by a
+// later block in the meantime.
+func RepairOrder(ctx context.Context, tx pgx.Tx, chainID int64, orderID, amount, revAmount string, block uint64) (bool, error) {
+	if err := journalRows(ctx, tx, chainID, "orders", block, "chain_id = $1 AND order_id = $3", orderID); err != nil {
+		return false, err
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE orders SET amount = $1, rev_amount = $2, update_block = $5, updated_at = NOW()
+		WHERE chain_id = $3 AND order_id = $4 AND update_block <= $5
+	`, amount, revAmount, chainID, orderID, int64(block))
+	if err != nil {
+		return false, fmt.Errorf("repair order: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RepairGrid overwrites a grid's status, fee and profits with the contract's
+// values as of block. Like RepairOrder, it leaves grids updated by a later
+// block alone.
+func RepairGrid(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, status, fee int, profits string, block uint64) (bool, error) {
+	if err := journalRows(ctx, tx, chainID, "grids", block, "chain_id = $1 AND grid_id = $3", gridID); err != nil {
+		return false, err
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE grids SET status = $1, fee = $2, profits = $3, update_block = $6, updated_at = NOW()
+		WHERE chain_id = $4 AND grid_id = $5 AND update_block <= $6
+	`, status, fee, profits, chainID, gridID, int64(block))
+	if err != nil {
+		return false, fmt.Errorf("repair grid: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
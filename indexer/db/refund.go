@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RefundFailure is one RefundFailed event. Action is the GridEx event of the
+// same transaction and GridID the grid it names, if any.
+type RefundFailure struct {
+	Address   string
+	Amount    string
+	Action    string
+	GridID    *int64
+	TxHash    string
+	LogIndex  uint
+	Timestamp time.Time
+}
+
+// InsertRefundFailure records a failed native refund within a transaction.
+// Re-processing the same log is a no-op.
+func InsertRefundFailure(ctx context.Context, tx pgx.Tx, chainID int64, f RefundFailure, blockNumber uint64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO refund_failures (chain_id, address, amount, action, grid_id, tx_hash, log_index, timestamp, create_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING
+	`, chainID, f.Address, f.Amount, f.Action, f.GridID, f.TxHash, int(f.LogIndex), f.Timestamp, int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("insert refund failure: %w", err)
+	}
+	return nil
+}
+
+// UnrefundedBalance is the native currency an address is owed from failed
+// refunds that are not resolved yet.
+type UnrefundedBalance struct {
+	Address    string
+	Amount     string
+	Failures   int64
+	FirstBlock uint64
+	LastBlock  uint64
+}
+
+// GetUnrefundedNativeBalances returns the addresses of a chain with unresolved
+// failed refunds, largest amount first.
+func (r *Repository) GetUnrefundedNativeBalances(ctx context.Context, chainID int64) ([]UnrefundedBalance, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT address, amount, failures, first_block, last_block
+		FROM unrefunded_native_balances
+		WHERE chain_id = $1
+		ORDER BY amount::NUMERIC DESC, address
+	`, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("query unrefunded native balances: %w", err)
+	}
+	balances, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (UnrefundedBalance, error) {
+		var b UnrefundedBalance
+		var first, last int64
+		err := row.Scan(&b.Address, &b.Amount, &b.Failures, &first, &last)
+		b.FirstBlock, b.LastBlock = uint64(first), uint64(last)
+		return b, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan unrefunded native balances: %w", err)
+	}
+	return balances, nil
+}
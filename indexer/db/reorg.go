@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// journaledTables lists the tables whose rows are journaled before an in-place
+// update so they can be restored when the block that changed them is orphaned.
+// Rows created in orphaned blocks are removed via their create_block instead.
+var journaledTables = map[string]bool{
+	"grids":        true,
+	"orders":       true,
+	"pairs":        true,
+	"quote_tokens": true,
+}
+
+// BlockRef identifies a block the scanner has indexed.
+type BlockRef struct {
+	Number     uint64
+	Hash       string
+	ParentHash string
+}
+
+// RollbackResult summarises the rows reverted by RollbackToBlock.
+type RollbackResult struct {
+	GridIDs     []int64  // grids created or modified after the ancestor
+	FillTxs     []string // tx hashes of order fills that were deleted
+	JournalRows int      // number of row images restored from reorg_journal
+}
+
+// InsertBlockHashes records the hashes of indexed blocks within a transaction.
+// An existing entry for the same block number is overwritten.
+func InsertBlockHashes(ctx context.Context, tx pgx.Tx, chainID int64, refs []BlockRef) error {
+	for _, ref := range refs {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO block_hashes (chain_id, block_number, block_hash, parent_hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (chain_id, block_number) DO UPDATE
+			SET block_hash = EXCLUDED.block_hash, parent_hash = EXCLUDED.parent_hash, created_at = NOW()
+		`, chainID, int64(ref.Number), ref.Hash, ref.ParentHash)
+		if err != nil {
+			return fmt.Errorf("insert block hash %d: %w", ref.Number, err)
+		}
+	}
+	return nil
+}
+
+// GetBlockHash returns the stored hash for a block. The boolean result is
+// false when the block was never recorded (or has been pruned).
+func (r *Repository) GetBlockHash(ctx context.Context, chainID int64, blockNumber uint64) (string, bool, error) {
+	var hash string
+	err := r.pool.QueryRow(ctx,
+		`SELECT block_hash FROM block_hashes WHERE chain_id = $1 AND block_number = $2`,
+		chainID, int64(blockNumber),
+	).Scan(&hash)
+	if err == pgx.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("get block hash: %w", err)
+	}
+	return hash, true, nil
+}
+
+// GetRecentBlockHashes returns up to limit stored blocks at or below
+// maxBlock, newest first. It is used to walk back to the common ancestor.
+func (r *Repository) GetRecentBlockHashes(ctx context.Context, chainID int64, maxBlock uint64, limit int) ([]BlockRef, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT block_number, block_hash, parent_hash FROM block_hashes
+		WHERE chain_id = $1 AND block_number <= $2
+		ORDER BY block_number DESC
+		LIMIT $3
+	`, chainID, int64(maxBlock), limit)
+	if err != nil {
+		return nil, fmt.Errorf("get recent block hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var refs []BlockRef
+	for rows.Next() {
+		var ref BlockRef
+		var number int64
+		if err := rows.Scan(&number, &ref.Hash, &ref.ParentHash); err != nil {
+			return nil, fmt.Errorf("scan block hash row: %w", err)
+		}
+		ref.Number = uint64(number)
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// PruneReorgHistory removes block hashes and journal entries below minBlock.
+// Blocks that deep are considered final and can no longer be rolled back.
+func PruneReorgHistory(ctx context.Context, tx pgx.Tx, chainID int64, minBlock uint64) error {
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM block_hashes WHERE chain_id = $1 AND block_number < $2`,
+		chainID, int64(minBlock)); err != nil {
+		return fmt.Errorf("prune block hashes: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM reorg_journal WHERE chain_id = $1 AND block_number < $2`,
+		chainID, int64(minBlock)); err != nil {
+		return fmt.Errorf("prune reorg journal: %w", err)
+	}
+	return nil
+}
+
+// journalRows saves the current image of the rows in table matching where,
+// tagged with the block that is about to modify them. where may reference
+// $1 (chain_id) and the extra args starting at $3.
+func journalRows(ctx context.Context, tx pgx.Tx, chainID int64, table string, blockNumber uint64, where string, args ...any) error {
+	if !journaledTables[table] {
+		return fmt.Errorf("journal rows: table %q is not journaled", table)
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO reorg_journal (chain_id, block_number, table_name, row_data)
+		SELECT $1, $2, '%s', to_jsonb(t) FROM %s t WHERE %s
+	`, table, table, where)
+	params := append([]any{chainID, int64(blockNumber)}, args...)
+	if _, err := tx.Exec(ctx, query, params...); err != nil {
+		return fmt.Errorf("journal %s: %w", table, err)
+	}
+	return nil
+}
+
+// RollbackToBlock reverts every change the indexer made after ancestor:
+// journaled row images are restored newest-first, rows created after the
+// ancestor are deleted, and the indexer_state cursor is reset to ancestor.
+func RollbackToBlock(ctx context.Context, tx pgx.Tx, chainID int64, ancestor uint64) (*RollbackResult, error) {
+	res := &RollbackResult{}
+	block := int64(ancestor)
+
+	// Collect what is about to be reverted before the rows disappear.
+	rows, err := tx.Query(ctx, `
+		SELECT grid_id FROM grids WHERE chain_id = $1 AND update_block > $2
+		UNION
+		SELECT grid_id FROM orders WHERE chain_id = $1 AND update_block > $2
+		ORDER BY grid_id
+	`, chainID, block)
+	if err != nil {
+		return nil, fmt.Errorf("query reverted grids: %w", err)
+	}
+	res.GridIDs, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("scan reverted grids: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, `
+		SELECT DISTINCT tx_hash FROM order_fills WHERE chain_id = $1 AND create_block > $2
+		ORDER BY tx_hash
+	`, chainID, block)
+	if err != nil {
+		return nil, fmt.Errorf("query reverted fills: %w", err)
+	}
+	res.FillTxs, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("scan reverted fills: %w", err)
+	}
+
+	// Restore pre-images newest-first so the oldest image of a row wins.
+	type journalEntry struct {
+		table string
+		data  []byte
+	}
+	rows, err = tx.Query(ctx, `
+		SELECT table_name, row_data FROM reorg_journal
+		WHERE chain_id = $1 AND block_number > $2
+		ORDER BY id DESC
+	`, chainID, block)
+	if err != nil {
+		return nil, fmt.Errorf("query reorg journal: %w", err)
+	}
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (journalEntry, error) {
+		var e journalEntry
+		err := row.Scan(&e.table, &e.data)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan reorg journal: %w", err)
+	}
+
+	for _, e := range entries {
+		if !journaledTables[e.table] {
+			return nil, fmt.Errorf("restore journal: unexpected table %q", e.table)
+		}
+		if _, err := tx.Exec(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE id = ($1::JSONB->>'id')::INTEGER`, e.table),
+			string(e.data)); err != nil {
+			return nil, fmt.Errorf("restore %s: delete current row: %w", e.table, err)
+		}
+		if _, err := tx.Exec(ctx,
+			fmt.Sprintf(`INSERT INTO %s SELECT * FROM jsonb_populate_record(NULL::%s, $1::JSONB)`, e.table, e.table),
+			string(e.data)); err != nil {
+			return nil, fmt.Errorf("restore %s: insert journaled row: %w", e.table, err)
+		}
+	}
+	res.JournalRows = len(entries)
+
+	// Remove rows that only exist on the orphaned branch.
+	orphaned := []string{
+		"order_fills", "orders", "grids", "pairs", "grid_strategy_params", "strategies",
+		"protocol_fee_collections", "oneshot_protocol_fee_changes", "quote_tokens",
+		"protocol_events", "refund_failures", "unknown_logs", "order_price_divergences",
+	}
+	for _, table := range orphaned {
+		if _, err := tx.Exec(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE chain_id = $1 AND create_block > $2`, table),
+			chainID, block); err != nil {
+			return nil, fmt.Errorf("delete orphaned %s: %w", table, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM reorg_journal WHERE chain_id = $1 AND block_number > $2`,
+		chainID, block); err != nil {
+		return nil, fmt.Errorf("clear reorg journal: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM block_hashes WHERE chain_id = $1 AND block_number > $2`,
+		chainID, block); err != nil {
+		return nil, fmt.Errorf("clear block hashes: %w", err)
+	}
+
+	if err := UpdateLastBlock(ctx, tx, chainID, ancestor); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
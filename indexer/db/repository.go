@@ -2,12 +2,15 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/gridex/indexer/pricing"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -25,6 +28,8 @@ type ActiveGridRow struct {
 	CreatedAt          time.Time
 	BaseTokenAddress   string
 	QuoteTokenAddress  string
+	BaseDecimals       int
+	QuoteDecimals      int
 }
 
 // GridOrderAmounts holds aggregated order amounts for a grid.
@@ -35,13 +40,24 @@ type GridOrderAmounts struct {
 	QuoteAmount string
 }
 
+// Pool is the part of *pgxpool.Pool a Repository uses.
+type Pool interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+var _ Pool = (*pgxpool.Pool)(nil)
+
 // Repository provides database operations within transactions.
 type Repository struct {
-	pool *pgxpool.Pool
+	pool Pool
 }
 
 // NewRepository creates a new Repository.
-func NewRepository(pool *pgxpool.Pool) *Repository {
+func NewRepository(pool Pool) *Repository {
 	return &Repository{pool: pool}
 }
 
@@ -82,6 +98,19 @@ func (r *Repository) WithTx(ctx context.Context, fn TxFunc) error {
 	return nil
 }
 
+// WithScratchTx executes fn within a transaction that is always rolled back.
+// It lets callers run the regular write path to derive results without
+// persisting anything.
+func (r *Repository) WithScratchTx(ctx context.Context, fn TxFunc) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	return fn(ctx, tx)
+}
+
 // UpdateLastBlock updates the last scanned block for a chain within a transaction.
 func UpdateLastBlock(ctx context.Context, tx pgx.Tx, chainID int64, blockNumber uint64) error {
 	_, err := tx.Exec(ctx, `
@@ -109,6 +138,34 @@ func UpdateKafkaOffset(ctx context.Context, tx pgx.Tx, chainID int64, kafkaOffse
 	return nil
 }
 
+// UpdateBatchSize stores the eth_getLogs window size learned for a chain
+// within a transaction, so it survives restarts.
+func UpdateBatchSize(ctx context.Context, tx pgx.Tx, chainID int64, batchSize uint64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE indexer_state SET batch_size = $2 WHERE chain_id = $1
+	`, chainID, int64(batchSize))
+	if err != nil {
+		return fmt.Errorf("update batch size: %w", err)
+	}
+	return nil
+}
+
+// GetBatchSize returns the learned eth_getLogs window size for a chain.
+// Returns 0 if nothing has been learned yet.
+func (r *Repository) GetBatchSize(ctx context.Context, chainID int64) (uint64, error) {
+	var batchSize int64
+	err := r.pool.QueryRow(ctx,
+		`SELECT COALESCE(batch_size, 0) FROM indexer_state WHERE chain_id = $1`, chainID,
+	).Scan(&batchSize)
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get batch size: %w", err)
+	}
+	return uint64(batchSize), nil
+}
+
 // GetKafkaOffset returns the last Kafka offset for a chain.
 // Returns 0 if no record exists.
 func (r *Repository) GetKafkaOffset(ctx context.Context, chainID int64) (int64, error) {
@@ -162,6 +219,8 @@ func UpsertToken(ctx context.Context, tx pgx.Tx, chainID int64,
 // initPrice is the initial price when the grid was created (typically bidPrice0).
 // initBasePrice/initQuotePrice are USD prices at creation time from OKX DEX API.
 // aprExcludeIl/aprReal are APR calculation fields (empty on creation, updated by periodic timer).
+// baseDecimals/quoteDecimals are the pair tokens' decimals; the normalized initial amounts are
+// the raw ones in human units.
 func InsertGrid(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64,
 	owner string, pairID int, baseToken, quoteToken, initialBaseAmount, initialQuoteAmount string,
 	askOrderCount, bidOrderCount, fee int, compound, oneshot bool,
@@ -170,6 +229,7 @@ func InsertGrid(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64,
 	askRatio, bidRatio string,
 	initPrice string,
 	initBasePrice, initQuotePrice string,
+	baseDecimals, quoteDecimals int, initialBaseAmountNormalized, initialQuoteAmountNormalized string,
 	blockNumber uint64) error {
 	_, err := tx.Exec(ctx, `
 		INSERT INTO grids (grid_id, chain_id, owner, pair_id, base_token, quote_token,
@@ -180,9 +240,11 @@ func InsertGrid(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64,
 			ask_ratio, bid_ratio,
 			init_price,
 			init_base_price, init_quote_price, apr_theoretical, apr_real,
+			base_decimals, quote_decimals, initial_base_amount_normalized, initial_quote_amount_normalized,
 			create_block, update_block)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, 1,
-			$14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, '', '', $25, $25)
+			$14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, '', '',
+			$26, $27, $28, $29, $25, $25)
 		ON CONFLICT DO NOTHING
 	`, gridID, chainID, owner, pairID, baseToken, quoteToken,
 		askOrderCount, bidOrderCount, initialBaseAmount, initialQuoteAmount,
@@ -192,7 +254,8 @@ func InsertGrid(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64,
 		askRatio, bidRatio,
 		initPrice,
 		initBasePrice, initQuotePrice,
-		int64(blockNumber))
+		int64(blockNumber),
+		baseDecimals, quoteDecimals, initialBaseAmountNormalized, initialQuoteAmountNormalized)
 	if err != nil {
 		return fmt.Errorf("insert grid: %w", err)
 	}
@@ -208,19 +271,23 @@ func orderIDToHex(orderID string) string {
 }
 
 // InsertOrder inserts a new order record within a transaction.
+// priceNormalized/revPriceNormalized are the raw prices in quote tokens per base token.
 func InsertOrder(ctx context.Context, tx pgx.Tx, chainID int64, orderID string,
 	gridID int64, pairID int, isAsk, compound, oneshot bool, fee int,
 	amount, revAmount, initialBaseAmount, initialQuoteAmount, price, revPrice string,
+	priceNormalized, revPriceNormalized string,
 	blockNumber uint64) error {
 	hexOrderID := orderIDToHex(orderID)
 	_, err := tx.Exec(ctx, `
 		INSERT INTO orders (order_id, chain_id, grid_id, pair_id, is_ask, compound, oneshot,
 			fee, status, amount, rev_amount, initial_base_amount, initial_quote_amount,
-			price, rev_price, hex_order_id, create_block, update_block)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 0, $9, $10, $11, $12, $13, $14, $15, $16, $16)
+			price, rev_price, price_normalized, rev_price_normalized,
+			hex_order_id, create_block, update_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 0, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $18)
 		ON CONFLICT DO NOTHING
 	`, orderID, chainID, gridID, pairID, isAsk, compound, oneshot, fee,
 		amount, revAmount, initialBaseAmount, initialQuoteAmount, price, revPrice,
+		priceNormalized, revPriceNormalized,
 		hexOrderID, int64(blockNumber))
 	if err != nil {
 		return fmt.Errorf("insert order: %w", err)
@@ -231,12 +298,12 @@ func InsertOrder(ctx context.Context, tx pgx.Tx, chainID int64, orderID string,
 // InsertOrderFill inserts an order fill record within a transaction.
 func InsertOrderFill(ctx context.Context, tx pgx.Tx, chainID int64,
 	txHash, taker, orderID, filledAmount, filledVolume string, isAsk bool, pairID int, ts time.Time,
-	gridID int64, quoteAddress, priceGap, gridProfit, orderFee string, isReverse bool,
+	gridID int64, quoteAddress, priceGap, gridProfit, orderFee, protocolFee string, isReverse bool,
 	blockNumber uint64) error {
 	_, err := tx.Exec(ctx, `
-		INSERT INTO order_fills (chain_id, tx_hash, taker, order_id, filled_amount, filled_volume, is_ask, pair_id, timestamp, grid_id, quote_address, price_gap, grid_profit, order_fee, is_reverse, create_block, update_block)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $16)
-	`, chainID, txHash, taker, orderID, filledAmount, filledVolume, isAsk, pairID, ts, gridID, quoteAddress, priceGap, gridProfit, orderFee, isReverse, int64(blockNumber))
+		INSERT INTO order_fills (chain_id, tx_hash, taker, order_id, filled_amount, filled_volume, is_ask, pair_id, timestamp, grid_id, quote_address, price_gap, grid_profit, order_fee, protocol_fee, is_reverse, create_block, update_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $17)
+	`, chainID, txHash, taker, orderID, filledAmount, filledVolume, isAsk, pairID, ts, gridID, quoteAddress, priceGap, gridProfit, orderFee, protocolFee, isReverse, int64(blockNumber))
 	if err != nil {
 		return fmt.Errorf("insert order fill: %w", err)
 	}
@@ -247,6 +314,9 @@ func InsertOrderFill(ctx context.Context, tx pgx.Tx, chainID int64,
 // A oneshot order becomes completed (status=1) once its remaining amount reaches zero.
 func UpdateOrderOnFill(ctx context.Context, tx pgx.Tx, chainID int64,
 	orderID, newAmount, newRevAmount string, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "orders", blockNumber, "chain_id = $1 AND order_id = $3", orderID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE orders
 		SET amount = $1,
@@ -267,6 +337,9 @@ func UpdateOrderOnFill(ctx context.Context, tx pgx.Tx, chainID int64,
 
 // CancelOrder sets an order's status to cancelled (status=2).
 func CancelOrder(ctx context.Context, tx pgx.Tx, chainID int64, orderID string, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "orders", blockNumber, "chain_id = $1 AND order_id = $3", orderID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE orders SET status = 2, update_block = $3, updated_at = NOW()
 		WHERE chain_id = $1 AND order_id = $2
@@ -279,6 +352,12 @@ func CancelOrder(ctx context.Context, tx pgx.Tx, chainID int64, orderID string,
 
 // CancelGrid sets a grid's status to cancelled (status=2) and all its orders.
 func CancelGrid(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "grids", blockNumber, "chain_id = $1 AND grid_id = $3", gridID); err != nil {
+		return err
+	}
+	if err := journalRows(ctx, tx, chainID, "orders", blockNumber, "chain_id = $1 AND grid_id = $3", gridID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE grids SET status = 2, update_block = $3, updated_at = NOW()
 		WHERE chain_id = $1 AND grid_id = $2
@@ -301,6 +380,9 @@ func CancelGrid(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, blo
 
 // UpdateGridFee updates a grid's fee.
 func UpdateGridFee(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, fee int, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "grids", blockNumber, "chain_id = $1 AND grid_id = $3", gridID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE grids SET fee = $1, update_block = $4, updated_at = NOW()
 		WHERE chain_id = $2 AND grid_id = $3
@@ -313,6 +395,9 @@ func UpdateGridFee(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64,
 
 // UpdateGridProfits adds to a grid's current accumulated profits.
 func UpdateGridProfits(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, amt string, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "grids", blockNumber, "chain_id = $1 AND grid_id = $3", gridID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE grids SET profits = (CAST(profits AS NUMERIC) + CAST($1 AS NUMERIC))::TEXT,
 		    update_block = $4, updated_at = NOW()
@@ -326,6 +411,9 @@ func UpdateGridProfits(ctx context.Context, tx pgx.Tx, chainID int64, gridID int
 
 // SubtractGridProfits deducts withdrawn profits from a grid's current accumulated profits.
 func SubtractGridProfits(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, amt string, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "grids", blockNumber, "chain_id = $1 AND grid_id = $3", gridID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE grids
 		SET profits = GREATEST(CAST(profits AS NUMERIC) - CAST($1 AS NUMERIC), 0)::TEXT,
@@ -341,6 +429,9 @@ func SubtractGridProfits(ctx context.Context, tx pgx.Tx, chainID int64, gridID i
 // UpdateGridTotalProfit adds to a grid's total_profit field.
 // total_profit accumulates gridProfit + orderFee from each fill.
 func UpdateGridTotalProfit(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64, profitToAdd string, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "grids", blockNumber, "chain_id = $1 AND grid_id = $3", gridID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE grids SET total_profit = (CAST(COALESCE(total_profit, '0') AS NUMERIC) + CAST($1 AS NUMERIC))::TEXT,
 		    update_block = $4, updated_at = NOW()
@@ -354,6 +445,9 @@ func UpdateGridTotalProfit(ctx context.Context, tx pgx.Tx, chainID int64, gridID
 
 // IncrementPairActiveGrids increments the active_grids count for a pair.
 func IncrementPairActiveGrids(ctx context.Context, tx pgx.Tx, chainID int64, pairID int, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "pairs", blockNumber, "chain_id = $1 AND pair_id = $3", pairID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE pairs SET active_grids = active_grids + 1, update_block = $3, updated_at = NOW()
 		WHERE chain_id = $1 AND pair_id = $2
@@ -366,6 +460,9 @@ func IncrementPairActiveGrids(ctx context.Context, tx pgx.Tx, chainID int64, pai
 
 // DecrementPairActiveGrids decrements the active_grids count for a pair.
 func DecrementPairActiveGrids(ctx context.Context, tx pgx.Tx, chainID int64, pairID int, blockNumber uint64) error {
+	if err := journalRows(ctx, tx, chainID, "pairs", blockNumber, "chain_id = $1 AND pair_id = $3", pairID); err != nil {
+		return err
+	}
 	_, err := tx.Exec(ctx, `
 		UPDATE pairs SET active_grids = GREATEST(active_grids - 1, 0), update_block = $3, updated_at = NOW()
 		WHERE chain_id = $1 AND pair_id = $2
@@ -502,13 +599,15 @@ type ProtocolStats struct {
 	TotalTrades int    // total number of order fills
 	TotalProfit string // SUM of profits from all grids
 	ActiveUsers int    // distinct grid owners
+
+	ProtocolRevenue []ProtocolRevenue // protocol fees accrued and collected, per quote token
 }
 
 // ComputeProtocolStats aggregates protocol-level statistics from existing tables.
 // nativeTokenPrice is the USD price of the chain's native token (e.g., BNB, ETH)
 // fetched from Binance. It is used to value wrapped native tokens in TVL.
 // If nativeTokenPrice is nil, wrapped native tokens are valued at $0.
-func ComputeProtocolStats(ctx context.Context, tx pgx.Tx, chainID int64, nativeTokenPrice *big.Float) (*ProtocolStats, error) {
+func ComputeProtocolStats(ctx context.Context, tx pgx.Tx, chainID int64, anchors map[string]pricing.TokenType, nativeTokenPrice *big.Float) (*ProtocolStats, error) {
 	stats := &ProtocolStats{}
 
 	// Total volume: SUM of filled_volume (quote token amounts) from order_fills
@@ -524,7 +623,7 @@ func ComputeProtocolStats(ctx context.Context, tx pgx.Tx, chainID int64, nativeT
 	// For each active order, we include BOTH amount (base token) and rev_amount (quote token),
 	// but only if the respective token is a stablecoin or wrapped native token.
 	// Stablecoins are valued at $1; wrapped native tokens at the Binance spot price.
-	tvl, err := computeTVL(ctx, tx, chainID, nativeTokenPrice)
+	tvl, err := computeTVL(ctx, tx, chainID, anchors, nativeTokenPrice)
 	if err != nil {
 		return nil, fmt.Errorf("compute total tvl: %w", err)
 	}
@@ -564,24 +663,37 @@ func ComputeProtocolStats(ctx context.Context, tx pgx.Tx, chainID int64, nativeT
 		return nil, fmt.Errorf("compute active users: %w", err)
 	}
 
+	stats.ProtocolRevenue, err = computeProtocolRevenue(ctx, tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+
 	return stats, nil
 }
 
 // computeTVL calculates the total TVL by summing USD values of stablecoins and
 // wrapped native tokens held in active orders.
 // For each active order:
-//   - amount is denominated in the base token (pair's base_token_address)
-//   - rev_amount is denominated in the quote token (pair's quote_token_address)
+//   - an ask's amount is in the base token and its rev_amount in the quote token
+//   - a bid's amount is in the quote token and its rev_amount in the base token
 //
-// Only tokens classified as stablecoins or wrapped native are counted.
-// Stablecoins are valued at $1; wrapped native tokens at nativeTokenPrice.
-func computeTVL(ctx context.Context, tx pgx.Tx, chainID int64, nativeTokenPrice *big.Float) (string, error) {
+// Raw amounts are converted with the decimals recorded on the order's grid.
+// Only the pricing anchors are counted: stablecoins are valued at $1, wrapped
+// native tokens at nativeTokenPrice.
+func computeTVL(ctx context.Context, tx pgx.Tx, chainID int64, anchors map[string]pricing.TokenType, nativeTokenPrice *big.Float) (string, error) {
+	lookup := func(addr string) (pricing.TVLTokenInfo, bool) {
+		typ, ok := anchors[strings.ToLower(addr)]
+		return pricing.TVLTokenInfo{Type: typ}, ok
+	}
+
 	// Query all active orders joined with their pair to get token addresses.
 	rows, err := tx.Query(ctx, `
-		SELECT o.amount, o.rev_amount,
-		       p.base_token_address, p.quote_token_address
+		SELECT o.is_ask, o.amount, o.rev_amount,
+		       p.base_token_address, p.quote_token_address,
+		       g.base_decimals, g.quote_decimals
 		FROM orders o
 		JOIN pairs p ON o.pair_id = p.pair_id AND o.chain_id = p.chain_id
+		JOIN grids g ON o.grid_id = g.grid_id AND o.chain_id = g.chain_id
 		WHERE o.chain_id = $1 AND o.status = 0
 	`, chainID)
 	if err != nil {
@@ -594,19 +706,29 @@ func computeTVL(ctx context.Context, tx pgx.Tx, chainID int64, nativeTokenPrice
 	one := new(big.Float).SetFloat64(1)
 
 	for rows.Next() {
-		var amountStr, revAmountStr, baseAddr, quoteAddr string
-		if err := rows.Scan(&amountStr, &revAmountStr, &baseAddr, &quoteAddr); err != nil {
+		var (
+			isAsk                                        bool
+			amountStr, revAmountStr, baseAddr, quoteAddr string
+			baseDecimals, quoteDecimals                  int
+		)
+		if err := rows.Scan(&isAsk, &amountStr, &revAmountStr, &baseAddr, &quoteAddr,
+			&baseDecimals, &quoteDecimals); err != nil {
 			return "0", fmt.Errorf("scan order row for tvl: %w", err)
 		}
 
-		// Check base token (amount is in base token units)
-		if baseInfo, ok := pricing.LookupTVLToken(chainID, baseAddr); ok {
-			addTokenValue(totalUSD, amountStr, baseInfo, nativeTokenPrice, one)
+		baseAmountStr, quoteAmountStr := amountStr, revAmountStr
+		if !isAsk {
+			baseAmountStr, quoteAmountStr = revAmountStr, amountStr
+		}
+
+		if baseInfo, ok := lookup(baseAddr); ok {
+			baseInfo.Decimals = baseDecimals
+			addTokenValue(totalUSD, baseAmountStr, baseInfo, nativeTokenPrice, one)
 		}
 
-		// Check quote token (rev_amount is in quote token units)
-		if quoteInfo, ok := pricing.LookupTVLToken(chainID, quoteAddr); ok {
-			addTokenValue(totalUSD, revAmountStr, quoteInfo, nativeTokenPrice, one)
+		if quoteInfo, ok := lookup(quoteAddr); ok {
+			quoteInfo.Decimals = quoteDecimals
+			addTokenValue(totalUSD, quoteAmountStr, quoteInfo, nativeTokenPrice, one)
 		}
 	}
 	if err := rows.Err(); err != nil {
@@ -659,9 +781,13 @@ func addTokenValue(acc *big.Float, rawAmount string, info pricing.TVLTokenInfo,
 
 // UpsertProtocolStats writes aggregated stats to the protocol_stats table.
 func UpsertProtocolStats(ctx context.Context, tx pgx.Tx, chainID int64, date string, stats *ProtocolStats, blockNumber uint64) error {
-	_, err := tx.Exec(ctx, `
-		INSERT INTO protocol_stats (chain_id, date, total_volume, total_tvl, total_grids, total_trades, total_profit, active_users, create_block, update_block)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+	revenue, err := json.Marshal(stats.ProtocolRevenue)
+	if err != nil {
+		return fmt.Errorf("marshal protocol revenue: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO protocol_stats (chain_id, date, total_volume, total_tvl, total_grids, total_trades, total_profit, active_users, protocol_revenue, create_block, update_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $10, $9, $9)
 		ON CONFLICT (chain_id, date) DO UPDATE SET
 			total_volume = EXCLUDED.total_volume,
 			total_tvl = EXCLUDED.total_tvl,
@@ -669,9 +795,10 @@ func UpsertProtocolStats(ctx context.Context, tx pgx.Tx, chainID int64, date str
 			total_trades = EXCLUDED.total_trades,
 			total_profit = EXCLUDED.total_profit,
 			active_users = EXCLUDED.active_users,
+			protocol_revenue = EXCLUDED.protocol_revenue,
 			update_block = EXCLUDED.update_block
 	`, chainID, date, stats.TotalVolume, stats.TotalTVL, stats.TotalGrids,
-		stats.TotalTrades, stats.TotalProfit, stats.ActiveUsers, int64(blockNumber))
+		stats.TotalTrades, stats.TotalProfit, stats.ActiveUsers, int64(blockNumber), string(revenue))
 	if err != nil {
 		return fmt.Errorf("upsert protocol stats: %w", err)
 	}
@@ -694,7 +821,9 @@ var AllLeaderboardPeriods = []LeaderboardPeriod{
 
 // UpdateLeaderboard refreshes the leaderboard table for all periods.
 // For each period it aggregates data from grids, orders, and order_fills,
-// then upserts one row per active grid into the leaderboard table.
+// then upserts one row per active grid into the leaderboard table. rank orders
+// all grids by normalized profit; quote_rank orders the grids with the same
+// quote token, whose profits are in the same unit.
 func UpdateLeaderboard(ctx context.Context, tx pgx.Tx, chainID int64, blockNumber uint64) error {
 	for _, p := range AllLeaderboardPeriods {
 		if err := updateLeaderboardPeriod(ctx, tx, chainID, p, blockNumber); err != nil {
@@ -727,7 +856,8 @@ func updateLeaderboardPeriod(ctx context.Context, tx pgx.Tx, chainID int64, p Le
 	}
 
 	query := fmt.Sprintf(`
-INSERT INTO leaderboard (chain_id, grid_id, trader, pair, profit, profit_rate, volume, trades, tvl, apr, period, rank, update_block)
+INSERT INTO leaderboard (chain_id, grid_id, trader, pair, profit, profit_rate, volume, trades, tvl, apr, period, rank,
+  profit_normalized, volume_normalized, tvl_normalized, quote_token_address, quote_rank, update_block)
 SELECT
   g.chain_id,
   g.grid_id,
@@ -748,10 +878,19 @@ SELECT
     ELSE 0
   END AS apr,
   $2 AS period,
-  ROW_NUMBER() OVER (ORDER BY g.total_profit::NUMERIC DESC) AS rank,
+  -- raw profits of pairs with different quote decimals are not comparable
+  ROW_NUMBER() OVER (ORDER BY g.total_profit::NUMERIC * power(10::NUMERIC, -g.quote_decimals) DESC) AS rank,
+  normalize_raw(g.total_profit, g.quote_decimals) AS profit_normalized,
+  normalize_raw(COALESCE(fills.volume, '0'), g.quote_decimals) AS volume_normalized,
+  normalize_raw(COALESCE(tvl_sub.tvl, '0'), g.quote_decimals) AS tvl_normalized,
+  p.quote_token_address,
+  -- profits are in the quote token, so grids are also ranked among those with the same one
+  ROW_NUMBER() OVER (PARTITION BY p.quote_token_address ORDER BY g.total_profit::NUMERIC DESC) AS quote_rank,
   $3 AS update_block
 FROM grids g
--- initial_investment: initial_quote_amount + initial_base_amount * bid_price0 / 1e36
+JOIN pairs p ON p.chain_id = g.chain_id AND p.pair_id = g.pair_id
+-- initial_investment in raw quote units: initial_quote_amount + initial_base_amount * bid_price0 / 1e36,
+-- as prices are raw quote units per raw base unit times 1e36
 LEFT JOIN LATERAL (
   SELECT CASE
     WHEN g.bid_price0 != '' AND g.bid_price0 != '0'
@@ -788,6 +927,11 @@ ON CONFLICT (chain_id, period, grid_id) DO UPDATE SET
   tvl = EXCLUDED.tvl,
   apr = EXCLUDED.apr,
   rank = EXCLUDED.rank,
+  profit_normalized = EXCLUDED.profit_normalized,
+  volume_normalized = EXCLUDED.volume_normalized,
+  tvl_normalized = EXCLUDED.tvl_normalized,
+  quote_token_address = EXCLUDED.quote_token_address,
+  quote_rank = EXCLUDED.quote_rank,
   update_block = EXCLUDED.update_block,
   updated_at = NOW()
 `, timeFilter)
@@ -866,7 +1010,8 @@ func (r *Repository) GetActiveGridsForAPR(ctx context.Context, chainID int64) ([
 			g.initial_base_amount, g.initial_quote_amount,
 			g.init_base_price, g.init_quote_price,
 			g.total_profit, g.compound, g.created_at,
-			p.base_token_address, p.quote_token_address
+			p.base_token_address, p.quote_token_address,
+			g.base_decimals, g.quote_decimals
 		FROM grids g
 		JOIN pairs p ON g.chain_id = p.chain_id AND g.pair_id = p.pair_id
 		WHERE g.chain_id = $1 AND g.status = 1
@@ -886,6 +1031,7 @@ func (r *Repository) GetActiveGridsForAPR(ctx context.Context, chainID int64) ([
 			&g.InitBasePrice, &g.InitQuotePrice,
 			&g.Profits, &g.Compound, &g.CreatedAt,
 			&g.BaseTokenAddress, &g.QuoteTokenAddress,
+			&g.BaseDecimals, &g.QuoteDecimals,
 		); err != nil {
 			return nil, fmt.Errorf("scan active grid row: %w", err)
 		}
@@ -918,7 +1064,7 @@ func (r *Repository) GetGridOrderAmounts(ctx context.Context, chainID int64, gri
 // GridOrderForTheoretical holds order data needed for theoretical TVL calculation.
 type GridOrderForTheoretical struct {
 	IsAsk  bool
-	Price  string // order price (in quote token)
+	Price  string // raw order price, quote units per base unit * 10^36
 	Amount string // for ask: base amount, for bid: quote amount
 	RevAmt string // for ask: quote amount (rev_amount), for bid: base amount (rev_amount)
 }
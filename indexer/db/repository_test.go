@@ -6,11 +6,14 @@ import (
 	"log/slog"
 	"math/big"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/gridex/indexer/config"
 	"github.com/gridex/indexer/pricing"
+	"github.com/jackc/pgx/v5"
 )
 
 // loadProdConfig loads config.prod.yaml from the indexer root directory.
@@ -90,7 +93,8 @@ func TestComputeProtocolStats(t *testing.T) {
 	}
 	defer tx.Rollback(ctx) //nolint:errcheck
 
-	stats, err = ComputeProtocolStats(ctx, tx, chainID, nativeTokenPrice)
+	anchors := pricing.AnchorTokens(chainID, cfg.Chains[0].Stablecoins)
+	stats, err = ComputeProtocolStats(ctx, tx, chainID, anchors, nativeTokenPrice)
 	if err != nil {
 		t.Fatalf("ComputeProtocolStats: %v", err)
 	}
@@ -131,3 +135,67 @@ func TestComputeProtocolStats(t *testing.T) {
 		t.Logf("rollback: %v (may already be rolled back by defer)", err)
 	}
 }
+
+// tvlTx is a pgx.Tx answering queries from canned rows, keyed by a
+// substring of the SQL.
+type tvlTx struct {
+	pgx.Tx
+	rows map[string][][]any
+}
+
+func (tx tvlTx) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	for key, rows := range tx.rows {
+		if strings.Contains(sql, key) {
+			return &tvlRows{rows: rows, i: -1}, nil
+		}
+	}
+	return &tvlRows{i: -1}, nil
+}
+
+type tvlRows struct {
+	pgx.Rows
+	rows [][]any
+	i    int
+}
+
+func (r *tvlRows) Next() bool { r.i++; return r.i < len(r.rows) }
+func (r *tvlRows) Err() error { return nil }
+func (r *tvlRows) Close()     {}
+
+func (r *tvlRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.rows[r.i][i]))
+	}
+	return nil
+}
+
+func TestComputeTVL(t *testing.T) {
+	const (
+		weth = "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"
+		usdc = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	)
+	// One WETH/USDC ask holding 1 WETH and 1500 USDC of proceeds.
+	orders := [][]any{{true, "1000000000000000000", "1500000000", weth, strings.ToUpper(usdc), 18, 6}}
+
+	cases := []struct {
+		name    string
+		anchors map[string]pricing.TokenType
+		want    string
+	}{
+		{"every anchor counts", pricing.AnchorTokens(1, nil), "3500000000000000000000"},
+		{"only anchors count", map[string]pricing.TokenType{usdc: pricing.TokenTypeStablecoin}, "1500000000000000000000"},
+		{"no anchors", nil, "0"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := tvlTx{rows: map[string][][]any{"FROM orders": orders}}
+			got, err := computeTVL(context.Background(), tx, 1, tc.anchors, big.NewFloat(2000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("tvl %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
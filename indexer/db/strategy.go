@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GridStrategyParams holds the strategy parameters of one side of a grid.
+// Gap is set for linear strategies, Ratio for geometry ones.
+type GridStrategyParams struct {
+	GridID          int64
+	IsAsk           bool
+	Strategy        string
+	StrategyAddress string
+	Price0          string
+	Gap             string
+	Ratio           string
+}
+
+// UpsertGridStrategyParams stores the strategy parameters of a grid side within a transaction.
+func UpsertGridStrategyParams(ctx context.Context, tx pgx.Tx, chainID int64, p GridStrategyParams, blockNumber uint64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO grid_strategy_params (chain_id, grid_id, is_ask, strategy, strategy_address,
+			price0, gap, ratio, create_block, update_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		ON CONFLICT (chain_id, grid_id, is_ask) DO UPDATE
+		SET strategy = EXCLUDED.strategy, strategy_address = EXCLUDED.strategy_address,
+		    price0 = EXCLUDED.price0, gap = EXCLUDED.gap, ratio = EXCLUDED.ratio,
+		    update_block = EXCLUDED.update_block
+	`, chainID, p.GridID, p.IsAsk, p.Strategy, p.StrategyAddress,
+		p.Price0, p.Gap, p.Ratio, int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("upsert grid strategy params: %w", err)
+	}
+	return nil
+}
+
+// GetGridStrategyParams returns the stored strategy parameters of a grid,
+// at most one per side.
+func GetGridStrategyParams(ctx context.Context, tx pgx.Tx, chainID int64, gridID int64) ([]GridStrategyParams, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT grid_id, is_ask, strategy, strategy_address, price0, gap, ratio
+		FROM grid_strategy_params WHERE chain_id = $1 AND grid_id = $2
+	`, chainID, gridID)
+	if err != nil {
+		return nil, fmt.Errorf("query grid strategy params: %w", err)
+	}
+	params, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (GridStrategyParams, error) {
+		var p GridStrategyParams
+		err := row.Scan(&p.GridID, &p.IsAsk, &p.Strategy, &p.StrategyAddress, &p.Price0, &p.Gap, &p.Ratio)
+		return p, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan grid strategy params: %w", err)
+	}
+	return params, nil
+}
+
+// StrategyWhitelistUpdate is one StrategyWhitelistUpdated event.
+type StrategyWhitelistUpdate struct {
+	Address     string
+	Whitelisted bool
+	Sender      string
+	TxHash      string
+	LogIndex    uint
+}
+
+// InsertStrategyWhitelistUpdate records a whitelist change within a transaction.
+// Re-processing the same log is a no-op.
+func InsertStrategyWhitelistUpdate(ctx context.Context, tx pgx.Tx, chainID int64, u StrategyWhitelistUpdate, blockNumber uint64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO strategies (chain_id, address, whitelisted, sender, tx_hash, log_index, create_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING
+	`, chainID, u.Address, u.Whitelisted, u.Sender, u.TxHash, int(u.LogIndex), int64(blockNumber))
+	if err != nil {
+		return fmt.Errorf("insert strategy whitelist update: %w", err)
+	}
+	return nil
+}
+
+// GetWhitelistedStrategies returns the addresses whose latest whitelist update
+// whitelisted them.
+func (r *Repository) GetWhitelistedStrategies(ctx context.Context, chainID int64) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT address FROM (
+			SELECT DISTINCT ON (address) address, whitelisted FROM strategies
+			WHERE chain_id = $1
+			ORDER BY address, create_block DESC, log_index DESC
+		) latest
+		WHERE whitelisted
+		ORDER BY address
+	`, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("query whitelisted strategies: %w", err)
+	}
+	addrs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("scan whitelisted strategies: %w", err)
+	}
+	return addrs, nil
+}
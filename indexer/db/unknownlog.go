@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// InsertUnknownLog stores a log no handler recognized within a transaction.
+// Re-processing the same log is a no-op.
+func InsertUnknownLog(ctx context.Context, tx pgx.Tx, chainID int64, log types.Log) error {
+	topics := make([]string, len(log.Topics))
+	for i, t := range log.Topics {
+		topics[i] = t.Hex()
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO unknown_logs (chain_id, address, topics, data, block_hash, tx_hash, tx_index, log_index, create_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING
+	`, chainID, strings.ToLower(log.Address.Hex()), topics, log.Data, log.BlockHash.Hex(),
+		log.TxHash.Hex(), int(log.TxIndex), int(log.Index), int64(log.BlockNumber))
+	if err != nil {
+		return fmt.Errorf("insert unknown log: %w", err)
+	}
+	return nil
+}
+
+// UnknownLog is a quarantined log awaiting a handler.
+type UnknownLog struct {
+	ID  int64
+	Log types.Log
+}
+
+// GetPendingUnknownLogs returns the quarantined logs of a chain that have not
+// been decoded yet, in chain order.
+func (r *Repository) GetPendingUnknownLogs(ctx context.Context, chainID int64) ([]UnknownLog, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, address, topics, data, block_hash, tx_hash, tx_index, log_index, create_block
+		FROM unknown_logs
+		WHERE chain_id = $1 AND decoded_at IS NULL
+		ORDER BY create_block, log_index
+	`, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("query unknown logs: %w", err)
+	}
+	logs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (UnknownLog, error) {
+		var (
+			u                          UnknownLog
+			address, blockHash, txHash string
+			topics                     []string
+			txIndex, logIndex          int
+			blockNumber                int64
+		)
+		if err := row.Scan(&u.ID, &address, &topics, &u.Log.Data, &blockHash, &txHash, &txIndex, &logIndex, &blockNumber); err != nil {
+			return u, err
+		}
+		u.Log.Address = common.HexToAddress(address)
+		for _, t := range topics {
+			u.Log.Topics = append(u.Log.Topics, common.HexToHash(t))
+		}
+		u.Log.BlockHash = common.HexToHash(blockHash)
+		u.Log.TxHash = common.HexToHash(txHash)
+		u.Log.TxIndex = uint(txIndex)
+		u.Log.Index = uint(logIndex)
+		u.Log.BlockNumber = uint64(blockNumber)
+		return u, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan unknown logs: %w", err)
+	}
+	return logs, nil
+}
+
+// MarkUnknownLogDecoded records that a quarantined log has been processed by
+// a handler.
+func MarkUnknownLogDecoded(ctx context.Context, tx pgx.Tx, id int64) error {
+	if _, err := tx.Exec(ctx, `UPDATE unknown_logs SET decoded_at = NOW() WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("mark unknown log decoded: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package fixedpoint converts the integer amounts and prices of the GridEx
+// contracts to human units.
+//
+// Amounts are raw token units: a token with d decimals has 10^d raw units per
+// token. Prices are raw quote units per raw base unit, times PRICE_MULTIPLIER
+// (10^36). The contracts' arithmetic on them needs no decimals, so the raw
+// values the indexer stores match the chain for any pair. Only converting to
+// human units does: a human price is price / 10^36 * 10^(baseDecimals -
+// quoteDecimals).
+package fixedpoint
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// priceDecimals is the number of decimals of PRICE_MULTIPLIER.
+const priceDecimals = 36
+
+// PriceMultiplier is PRICE_MULTIPLIER of the GridEx contracts.
+var PriceMultiplier = pow10(priceDecimals)
+
+// floatPrec is the mantissa precision of the big.Float values returned here,
+// enough for uint256 values without rounding.
+const floatPrec = 512
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Pair holds the decimals of a pair's base and quote token.
+type Pair struct {
+	Base  uint8
+	Quote uint8
+}
+
+// priceScale is the number of decimal places a raw price is shifted by.
+func (p Pair) priceScale() int {
+	return priceDecimals + int(p.Quote) - int(p.Base)
+}
+
+// QuoteAmount returns the raw quote amount of baseAmt raw base units at a raw
+// price, floor(baseAmt * price / PRICE_MULTIPLIER), like Lens.calcQuoteAmount.
+func QuoteAmount(baseAmt, price *big.Int) *big.Int {
+	q := new(big.Int).Mul(baseAmt, price)
+	return q.Div(q, PriceMultiplier)
+}
+
+// Amount formats a raw amount of a token with decimals in human units. The
+// result is exact, without trailing zeros.
+func Amount(raw *big.Int, decimals uint8) string {
+	return shift(raw, int(decimals))
+}
+
+// ParseAmount is Amount for a raw amount in base 10.
+func ParseAmount(raw string, decimals uint8) (string, error) {
+	n, err := parse(raw)
+	if err != nil {
+		return "", err
+	}
+	return Amount(n, decimals), nil
+}
+
+// Price formats a raw price as quote tokens per base token. The result is
+// exact, without trailing zeros.
+func (p Pair) Price(raw *big.Int) string {
+	return shift(raw, p.priceScale())
+}
+
+// ParsePrice is Price for a raw price in base 10.
+func (p Pair) ParsePrice(raw string) (string, error) {
+	n, err := parse(raw)
+	if err != nil {
+		return "", err
+	}
+	return p.Price(n), nil
+}
+
+// AmountFloat returns a raw amount in base 10 in human units.
+func AmountFloat(raw string, decimals uint8) (*big.Float, error) {
+	n, err := parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return toFloat(n, int(decimals)), nil
+}
+
+// PriceFloat returns a raw price in base 10 as quote tokens per base token.
+func (p Pair) PriceFloat(raw string) (*big.Float, error) {
+	n, err := parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return toFloat(n, p.priceScale()), nil
+}
+
+func parse(raw string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(raw, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid raw value %q", raw)
+	}
+	return n, nil
+}
+
+// toFloat returns n / 10^scale.
+func toFloat(n *big.Int, scale int) *big.Float {
+	f := new(big.Float).SetPrec(floatPrec).SetInt(n)
+	if scale >= 0 {
+		return f.Quo(f, new(big.Float).SetPrec(floatPrec).SetInt(pow10(scale)))
+	}
+	return f.Mul(f, new(big.Float).SetPrec(floatPrec).SetInt(pow10(-scale)))
+}
+
+// shift formats n / 10^scale exactly in base 10.
+func shift(n *big.Int, scale int) string {
+	if scale <= 0 {
+		return new(big.Int).Mul(n, pow10(-scale)).String()
+	}
+	digits := new(big.Int).Abs(n).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-scale], strings.TrimRight(digits[len(digits)-scale:], "0")
+	s := whole
+	if frac != "" {
+		s += "." + frac
+	}
+	if n.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package fixedpoint
+
+import (
+	"math/big"
+	"testing"
+)
+
+func mustInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid int %q", s)
+	}
+	return n
+}
+
+// TestGrids checks grids as the contracts store them. Their raw prices are
+// what the webapp's priceToContractBigInt sends: price * 10^36 *
+// 10^(quoteDecimals - baseDecimals).
+func TestGrids(t *testing.T) {
+	tests := []struct {
+		name       string
+		pair       Pair
+		price      string // raw
+		baseAmt    string // raw, per order
+		wantPrice  string
+		wantQuote  string // raw quote amount of one bid
+		wantAmount string // that amount in quote tokens
+		wantBase   string // baseAmt in base tokens
+	}{
+		{
+			name:       "WETH/USDC bids 0.5 WETH at 3000",
+			pair:       Pair{Base: 18, Quote: 6},
+			price:      "3000000000000000000000000000",
+			baseAmt:    "500000000000000000",
+			wantPrice:  "3000",
+			wantQuote:  "1500000000",
+			wantAmount: "1500",
+			wantBase:   "0.5",
+		},
+		{
+			name:       "WBNB/USDT bids 2 WBNB at 612.5",
+			pair:       Pair{Base: 18, Quote: 18},
+			price:      "612500000000000000000000000000000000000",
+			baseAmt:    "2000000000000000000",
+			wantPrice:  "612.5",
+			wantQuote:  "1225000000000000000000",
+			wantAmount: "1225",
+			wantBase:   "2",
+		},
+		{
+			name:       "WBTC/DAI bids 0.01 WBTC at 65000.25",
+			pair:       Pair{Base: 8, Quote: 18},
+			price:      "650002500000000000000000000000000000000000000000000",
+			baseAmt:    "1000000",
+			wantPrice:  "65000.25",
+			wantQuote:  "650002500000000000000",
+			wantAmount: "650.0025",
+			wantBase:   "0.01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, baseAmt := mustInt(t, tt.price), mustInt(t, tt.baseAmt)
+			if got := tt.pair.Price(price); got != tt.wantPrice {
+				t.Errorf("Price=%s, want %s", got, tt.wantPrice)
+			}
+			quote := QuoteAmount(baseAmt, price)
+			if quote.String() != tt.wantQuote {
+				t.Fatalf("QuoteAmount=%s, want %s", quote, tt.wantQuote)
+			}
+			if got := Amount(quote, tt.pair.Quote); got != tt.wantAmount {
+				t.Errorf("quote Amount=%s, want %s", got, tt.wantAmount)
+			}
+			if got, err := ParseAmount(tt.baseAmt, tt.pair.Base); err != nil || got != tt.wantBase {
+				t.Errorf("base ParseAmount=%s, %v, want %s", got, err, tt.wantBase)
+			}
+
+			// The human values agree: quote = base * price.
+			base, _ := AmountFloat(tt.baseAmt, tt.pair.Base)
+			p, _ := tt.pair.PriceFloat(tt.price)
+			q, _ := AmountFloat(tt.wantQuote, tt.pair.Quote)
+			product := new(big.Float).Mul(base, p)
+			if got, want := product.Text('g', 40), q.Text('g', 40); got != want {
+				t.Errorf("base * price = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestAmount(t *testing.T) {
+	tests := []struct {
+		raw      string
+		decimals uint8
+		want     string
+	}{
+		{"0", 18, "0"},
+		{"5", 6, "0.000005"},
+		{"1000000", 6, "1"},
+		{"1234567", 0, "1234567"},
+		{"-2500000", 6, "-2.5"},
+	}
+	for _, tt := range tests {
+		if got, err := ParseAmount(tt.raw, tt.decimals); err != nil || got != tt.want {
+			t.Errorf("ParseAmount(%s, %d)=%s, %v, want %s", tt.raw, tt.decimals, got, err, tt.want)
+		}
+	}
+	if _, err := ParseAmount("1.5", 6); err == nil {
+		t.Error("expected an error for a non-integer raw amount")
+	}
+
+	// A negative linear gap; a base token with 36+ more decimals than the
+	// quote token scales the raw price up.
+	if got, _ := (Pair{Base: 18, Quote: 6}).ParsePrice("-1000000000000000000000000"); got != "-1" {
+		t.Errorf("gap price=%s", got)
+	}
+	if got := (Pair{Base: 40, Quote: 0}).Price(big.NewInt(3)); got != "30000" {
+		t.Errorf("scaled-up price=%s", got)
+	}
+}
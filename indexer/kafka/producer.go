@@ -31,17 +31,47 @@ const (
 	EventGridCancelled   EventType = "grid_cancelled"
 	EventGridFeeChanged  EventType = "grid_fee_changed"
 	EventProfitWithdrawn EventType = "profit_withdrawn"
+	EventQuoteToken      EventType = "quote_token_updated"
+	EventPaused          EventType = "protocol_paused"
+	EventUnpaused        EventType = "protocol_unpaused"
+	EventFacetUpdated    EventType = "facet_updated"
+	EventOwnership       EventType = "ownership_transferred"
+	EventRefundFailed    EventType = "refund_failed"
+	EventReconciliation  EventType = "reconciliation_issue"
+	EventChainReorg      EventType = "chain_reorg"
+	EventConfirmed       EventType = "event_confirmed"
+	EventReverted        EventType = "event_reverted"
 )
 
 // Message is the envelope for all Kafka messages.
 type Message struct {
-	EventType   EventType   `json:"event_type"`
-	ChainID     int64       `json:"chain_id"`
-	BlockNumber uint64      `json:"block_number"`
-	TxHash      string      `json:"tx_hash"`
-	LogIndex    uint        `json:"log_index"`
-	Timestamp   int64       `json:"timestamp"`
-	Data        interface{} `json:"data"`
+	EventType      EventType   `json:"event_type"`
+	ChainID        int64       `json:"chain_id"`
+	BlockNumber    uint64      `json:"block_number"`
+	TxHash         string      `json:"tx_hash"`
+	LogIndex       uint        `json:"log_index"`
+	Timestamp      int64       `json:"timestamp"`                 // processing time
+	BlockTimestamp int64       `json:"block_timestamp,omitempty"` // time of the block the event was emitted in
+	BlockHash      string      `json:"block_hash,omitempty"`
+	Provisional    bool        `json:"provisional,omitempty"`     // published in tip mode before the block is final
+	IdempotencyKey string      `json:"idempotency_key,omitempty"` // the same for every delivery of the message
+	Data           interface{} `json:"data"`
+}
+
+// PartitionKey is the Kafka key of the message. Messages with the same key
+// keep their order.
+func (m *Message) PartitionKey() string {
+	return fmt.Sprintf("%d:%s", m.ChainID, m.EventType)
+}
+
+// IdempotencyKeyHeader is the Kafka header carrying Message.IdempotencyKey.
+const IdempotencyKeyHeader = "idempotency_key"
+
+// Record is an encoded message, as written to Kafka.
+type Record struct {
+	Key            string
+	IdempotencyKey string
+	Value          []byte
 }
 
 // PairCreatedData is the data payload for pair_created events.
@@ -71,6 +101,11 @@ type GridCreatedData struct {
 	AskGap             string `json:"ask_gap,omitempty"`
 	BidPrice0          string `json:"bid_price0,omitempty"`
 	BidGap             string `json:"bid_gap,omitempty"`
+
+	BaseDecimals                 int    `json:"base_decimals"`
+	QuoteDecimals                int    `json:"quote_decimals"`
+	InitialBaseAmountNormalized  string `json:"initial_base_amount_normalized"`
+	InitialQuoteAmountNormalized string `json:"initial_quote_amount_normalized"`
 }
 
 // OrderCreatedData is the data payload for order_created events.
@@ -85,6 +120,10 @@ type OrderCreatedData struct {
 	RevPrice           string `json:"rev_price"`
 	InitialBaseAmount  string `json:"initial_base_amount"`
 	InitialQuoteAmount string `json:"initial_quote_amount"`
+
+	AmountNormalized   string `json:"amount_normalized"`
+	PriceNormalized    string `json:"price_normalized"`
+	RevPriceNormalized string `json:"rev_price_normalized"`
 }
 
 // OrderFilledData is the data payload for order_filled events.
@@ -126,6 +165,80 @@ type ProfitWithdrawnData struct {
 	Amount string `json:"amount"`
 }
 
+// QuoteTokenUpdatedData is the data payload for quote_token_updated events.
+// A priority of "0" means the token can no longer be used as a quote token.
+type QuoteTokenUpdatedData struct {
+	Token    string `json:"token"`
+	Symbol   string `json:"symbol"`
+	Priority string `json:"priority"`
+}
+
+// ProtocolPauseData is the data payload for protocol_paused and
+// protocol_unpaused events.
+type ProtocolPauseData struct {
+	Account string `json:"account"`
+}
+
+// FacetUpdatedData is the data payload for facet_updated events. Selector is
+// the 0x-prefixed 4-byte function selector now routed to Facet; the zero
+// address means the selector was removed.
+type FacetUpdatedData struct {
+	Selector string `json:"selector"`
+	Facet    string `json:"facet"`
+}
+
+// OwnershipTransferredData is the data payload for ownership_transferred
+// events. Contract is the GridEx contract or the Vault.
+type OwnershipTransferredData struct {
+	Contract      string `json:"contract"`
+	PreviousOwner string `json:"previous_owner"`
+	NewOwner      string `json:"new_owner"`
+}
+
+// RefundFailedData is the data payload for refund_failed events: native
+// currency the GridEx contract failed to send back to Address. Action is the
+// GridEx event of the same transaction, e.g. grid_created, and GridID the grid
+// it names (0 if none).
+type RefundFailedData struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Action  string `json:"action,omitempty"`
+	GridID  int64  `json:"grid_id,omitempty"`
+}
+
+// ReconciliationIssueData is the data payload for reconciliation_issue events:
+// an indexed value that differs from the contract's at the envelope's block.
+// OrderID is empty for the fields of the grid itself. Repaired is set when the
+// DB value was overwritten with the contract's.
+type ReconciliationIssueData struct {
+	GridID     int64  `json:"grid_id"`
+	OrderID    string `json:"order_id,omitempty"`
+	Field      string `json:"field"`
+	DBValue    string `json:"db_value"`
+	ChainValue string `json:"chain_value"`
+	Repaired   bool   `json:"repaired"`
+}
+
+// ChainReorgData is the data payload for chain_reorg events.
+// Consumers must discard every event they received for blocks in
+// [FromBlock, ToBlock]; the indexer re-emits the canonical events after re-scanning.
+type ChainReorgData struct {
+	AncestorBlock    uint64   `json:"ancestor_block"`
+	AncestorHash     string   `json:"ancestor_hash"`
+	FromBlock        uint64   `json:"from_block"`
+	ToBlock          uint64   `json:"to_block"`
+	RevertedGridIDs  []int64  `json:"reverted_grid_ids"`
+	RevertedFillTxes []string `json:"reverted_fill_txes"`
+}
+
+// ProvisionalResolvedData is the data payload for event_confirmed and
+// event_reverted events. The envelope carries the tx hash, log index and block
+// number of the provisional log it resolves.
+type ProvisionalResolvedData struct {
+	BlockHash  string   `json:"block_hash"`  // block hash the provisional events were published with
+	EventTypes []string `json:"event_types"` // event types published provisionally for the log
+}
+
 // Producer sends messages to Kafka.
 type Producer struct {
 	writer *kafkago.Writer
@@ -228,10 +341,8 @@ func (p *Producer) Send(ctx context.Context, msg *Message) error {
 	}
 
 	// Use chainID + eventType as key for ordering
-	key := fmt.Sprintf("%d:%s", msg.ChainID, msg.EventType)
-
 	err = p.writer.WriteMessages(ctx, kafkago.Message{
-		Key:   []byte(key),
+		Key:   []byte(msg.PartitionKey()),
 		Value: data,
 	})
 	if err != nil {
@@ -258,9 +369,8 @@ func (p *Producer) SendBatch(ctx context.Context, msgs []*Message) error {
 		if err != nil {
 			return fmt.Errorf("marshal kafka message: %w", err)
 		}
-		key := fmt.Sprintf("%d:%s", msg.ChainID, msg.EventType)
 		kafkaMsgs = append(kafkaMsgs, kafkago.Message{
-			Key:   []byte(key),
+			Key:   []byte(msg.PartitionKey()),
 			Value: data,
 		})
 	}
@@ -274,6 +384,32 @@ func (p *Producer) SendBatch(ctx context.Context, msgs []*Message) error {
 	return nil
 }
 
+// WriteRecords writes encoded messages to Kafka in one batch, in order. The
+// idempotency key of each is sent in the IdempotencyKeyHeader header.
+func (p *Producer) WriteRecords(ctx context.Context, recs []Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	kafkaMsgs := make([]kafkago.Message, len(recs))
+	for i, rec := range recs {
+		kafkaMsgs[i] = kafkago.Message{
+			Key:   []byte(rec.Key),
+			Value: rec.Value,
+		}
+		if rec.IdempotencyKey != "" {
+			kafkaMsgs[i].Headers = []kafkago.Header{{Key: IdempotencyKeyHeader, Value: []byte(rec.IdempotencyKey)}}
+		}
+	}
+
+	if err := p.writer.WriteMessages(ctx, kafkaMsgs...); err != nil {
+		return fmt.Errorf("write kafka batch: %w", err)
+	}
+
+	p.logger.Debug("kafka records sent", "count", len(recs))
+	return nil
+}
+
 // LastOffset returns the last offset of the Kafka topic.
 // This can be used by the indexer to track the latest offset for tradebot synchronization.
 func (p *Producer) LastOffset(brokers []string, topic string) (int64, error) {
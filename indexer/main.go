@@ -12,11 +12,10 @@ import (
 	"sync"
 	"syscall"
 
-	"github.com/ethereum/go-ethereum/ethclient"
-
 	"github.com/gridex/indexer/config"
 	"github.com/gridex/indexer/db"
 	"github.com/gridex/indexer/kafka"
+	"github.com/gridex/indexer/metrics"
 	"github.com/gridex/indexer/rpc"
 	"github.com/gridex/indexer/scanner"
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -37,6 +36,7 @@ func (w *panicOnErrorWriter) Write(p []byte) (int, error) {
 
 func main() {
 	configPath := flag.String("config", "config.yaml", "path to config file")
+	reprocessUnknown := flag.Bool("reprocess-unknown", false, "decode the logs quarantined in unknown_logs with the current handlers, then exit")
 	flag.Parse()
 
 	// Load configuration
@@ -121,6 +121,11 @@ func main() {
 		cancel()
 	}()
 
+	// Expose runtime metrics (batch sizes, split counts, ...) if configured
+	if cfg.Metrics.Addr != "" {
+		go metrics.Serve(ctx, cfg.Metrics.Addr, logger)
+	}
+
 	// Connect to database
 	pool, err := db.NewPool(ctx, cfg.Database.DSN())
 	if err != nil {
@@ -160,26 +165,17 @@ func main() {
 	for _, chainCfg := range cfg.Chains {
 		cCfg := chainCfg // capture loop variable
 
-		// Connect to RPC
-		rawClient, err := ethclient.DialContext(ctx, cCfg.RPCURL)
+		// Connect to every RPC endpoint of the chain; each one gets its own
+		// rate limiter (rpc_tpm, 0 or unset = unlimited)
+		client, err := rpc.NewPool(ctx, cCfg, logger)
 		if err != nil {
 			logger.Error("failed to connect to RPC",
 				"chain", cCfg.Name,
-				"rpc_url", cCfg.RPCURL,
 				"error", err,
 			)
 			os.Exit(1)
 		}
 
-		// Wrap with rate limiter (0 or unset = unlimited)
-		client := rpc.NewRateLimitedClient(rawClient, cCfg.RPCTPM)
-		if cCfg.RPCTPM > 0 {
-			logger.Info("RPC rate limiting enabled",
-				"chain", cCfg.Name,
-				"rpc_tpm", cCfg.RPCTPM,
-			)
-		}
-
 		s, err := scanner.New(cCfg, cfg.OKX, client, repo, producer, cfg.Kafka.Brokers, cfg.Kafka.Topic, logger)
 		if err != nil {
 			logger.Error("failed to create scanner",
@@ -194,6 +190,25 @@ func main() {
 			defer wg.Done()
 			defer client.Close()
 
+			go client.Run(ctx)
+			if *reprocessUnknown {
+				decoded, err := s.ReprocessUnknownLogs(ctx)
+				if err != nil {
+					logger.Error("failed to reprocess unknown logs",
+						"chain", cCfg.Name,
+						"decoded", decoded,
+						"error", err,
+					)
+				}
+				// Publish the queued messages, as no relay runs in this mode
+				if err := s.FlushOutbox(ctx); err != nil {
+					logger.Error("failed to publish queued kafka messages",
+						"chain", cCfg.Name,
+						"error", err,
+					)
+				}
+				return
+			}
 			if err := s.Run(ctx); err != nil && ctx.Err() == nil {
 				logger.Error("scanner exited with error",
 					"chain", cCfg.Name,
@@ -0,0 +1,94 @@
+// Package metrics exposes indexer runtime metrics through the standard library
+// expvar package. Every metric is a map keyed by chain name (or chain/endpoint
+// for RPC metrics) and is served as JSON at /debug/vars when metrics.addr is
+// configured.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// BatchSize is the current eth_getLogs window size per chain.
+	BatchSize = expvar.NewMap("gridex_batch_size")
+	// BatchSplits counts ranges bisected after a "limit exceeded" error.
+	BatchSplits = expvar.NewMap("gridex_batch_splits_total")
+	// BatchShrinks counts window reductions (limit errors and slow responses).
+	BatchShrinks = expvar.NewMap("gridex_batch_shrinks_total")
+	// BatchGrows counts window increases after consecutive fast successes.
+	BatchGrows = expvar.NewMap("gridex_batch_grows_total")
+
+	// RPCLatency is the moving average request latency per RPC endpoint.
+	RPCLatency = expvar.NewMap("gridex_rpc_latency_ms")
+	// RPCRequests counts requests sent to each RPC endpoint.
+	RPCRequests = expvar.NewMap("gridex_rpc_requests_total")
+	// RPCErrors counts failed requests per RPC endpoint.
+	RPCErrors = expvar.NewMap("gridex_rpc_errors_total")
+	// RPCHealthy is 1 while an RPC endpoint receives traffic, 0 while it is
+	// ejected or lagging.
+	RPCHealthy = expvar.NewMap("gridex_rpc_healthy")
+
+	// UnknownLogs counts logs of watched contracts no handler recognized.
+	UnknownLogs = expvar.NewMap("gridex_unknown_logs_total")
+	// UnconfiguredFacetLogs counts unknown GridEx logs that follow an upgrade
+	// to a facet of no configured contract version. Alert on any increase.
+	UnconfiguredFacetLogs = expvar.NewMap("gridex_unconfigured_facet_logs_total")
+
+	// ReconciliationIssues counts DB values found to differ from the contract
+	// by the reconciler, per chain/field.
+	ReconciliationIssues = expvar.NewMap("gridex_reconciliation_issues_total")
+
+	// PriceDivergences counts new orders whose computed prices differ from
+	// their strategy contract's, per chain/strategy type.
+	PriceDivergences = expvar.NewMap("gridex_price_divergences_total")
+
+	// OutboxPending is the number of queued Kafka messages not yet published.
+	OutboxPending = expvar.NewMap("gridex_outbox_pending")
+	// OutboxPublished counts messages the outbox relay published.
+	OutboxPublished = expvar.NewMap("gridex_outbox_published_total")
+	// OutboxErrors counts failed outbox relay runs.
+	OutboxErrors = expvar.NewMap("gridex_outbox_errors_total")
+
+	// Paused is 1 while the GridEx contract of a chain is paused.
+	Paused = expvar.NewMap("gridex_paused")
+)
+
+var setMu sync.Mutex
+
+// Set stores v as the value of key in m, creating the entry if needed.
+func Set(m *expvar.Map, key string, v int64) {
+	setMu.Lock()
+	defer setMu.Unlock()
+	if iv, ok := m.Get(key).(*expvar.Int); ok {
+		iv.Set(v)
+		return
+	}
+	iv := new(expvar.Int)
+	iv.Set(v)
+	m.Set(key, iv)
+}
+
+// Serve exposes /debug/vars on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string, logger *slog.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("metrics server listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("metrics server failed", "addr", addr, "error", err)
+	}
+}
@@ -0,0 +1,29 @@
+-- Migration: Chain reorganization tracking
+-- block_hashes records the hash of every block the scanner has anchored on
+-- (batch boundaries and blocks that contained GridEx logs). The scanner compares
+-- them against the node's canonical chain to detect reorgs.
+-- reorg_journal keeps the pre-image of every row mutated by the indexer so that
+-- updates made in orphaned blocks can be undone when rolling back to the common ancestor.
+-- Both tables are pruned to the last reorg_depth blocks.
+
+CREATE TABLE IF NOT EXISTS block_hashes (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_hash VARCHAR(66) NOT NULL,
+    parent_hash VARCHAR(66) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS block_hashes_chain_block_uq ON block_hashes (chain_id, block_number);
+
+CREATE TABLE IF NOT EXISTS reorg_journal (
+    id BIGSERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    table_name VARCHAR(64) NOT NULL,
+    row_data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS reorg_journal_chain_block_idx ON reorg_journal (chain_id, block_number);
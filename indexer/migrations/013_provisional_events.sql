@@ -0,0 +1,19 @@
+-- Migration: Provisional (tip mode) event tracking
+-- When tip_mode is enabled the scanner publishes events from blocks above the
+-- finality threshold with provisional=true, without touching the canonical tables.
+-- Each published log is recorded here until the canonical pass reaches its block,
+-- at which point an event_confirmed or event_reverted message is sent and the row removed.
+
+CREATE TABLE IF NOT EXISTS provisional_events (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_hash VARCHAR(66) NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INTEGER NOT NULL,
+    event_types VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS provisional_events_log_uq ON provisional_events (chain_id, tx_hash, log_index, block_hash);
+CREATE INDEX IF NOT EXISTS provisional_events_chain_block_idx ON provisional_events (chain_id, block_number);
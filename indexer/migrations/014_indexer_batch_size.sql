@@ -0,0 +1,5 @@
+-- Migration: Persist the learned eth_getLogs window size per chain
+-- The scanner shrinks its block batch after "limit exceeded" errors or slow responses
+-- and grows it after consecutive successes; the learned size is restored on restart.
+
+ALTER TABLE indexer_state ADD COLUMN IF NOT EXISTS batch_size BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,22 @@
+-- Migration: Persist grid strategy parameters
+-- LinearStrategyCreated / GeometryStrategyCreated are emitted before the
+-- GridOrderCreated event that consumes them. Their parameters are stored here in
+-- the same transaction, so a restart or a batch boundary between the events does
+-- not lose them. One row per grid side; strategy is "linear" or "geometry".
+
+CREATE TABLE IF NOT EXISTS grid_strategy_params (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    grid_id BIGINT NOT NULL,
+    is_ask BOOLEAN NOT NULL,
+    strategy VARCHAR(32) NOT NULL,
+    strategy_address VARCHAR(42) NOT NULL DEFAULT '',
+    price0 VARCHAR(80) NOT NULL,
+    gap VARCHAR(80) NOT NULL DEFAULT '',
+    ratio VARCHAR(80) NOT NULL DEFAULT '',
+    create_block BIGINT NOT NULL,
+    update_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS grid_strategy_params_side_uq ON grid_strategy_params (chain_id, grid_id, is_ask);
@@ -0,0 +1,20 @@
+-- Migration: Strategy whitelist history
+-- One row per StrategyWhitelistUpdated event emitted by the GridEx AdminFacet.
+-- The latest row of an address tells whether it is currently whitelisted; the
+-- scanner loads the whitelisted addresses on startup and watches their logs in
+-- addition to the strategies configured for the chain.
+
+CREATE TABLE IF NOT EXISTS strategies (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    address VARCHAR(42) NOT NULL,
+    whitelisted BOOLEAN NOT NULL,
+    sender VARCHAR(42) NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INTEGER NOT NULL,
+    create_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS strategies_log_uq ON strategies (chain_id, tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS strategies_chain_address_idx ON strategies (chain_id, address, create_block);
@@ -0,0 +1,54 @@
+-- Migration: Protocol fee revenue ledger
+-- protocol_fee_collections has one row per CollectProtocol event. The event does
+-- not name the token; token is taken from the ERC20 Transfer to the recipient in
+-- the same transaction and left empty when there is none (e.g. native payouts).
+-- oneshot_protocol_fee_changes is the history of OneshotProtocolFeeChanged; the
+-- row preceding a fill gives the share of its fee taken by the protocol.
+-- order_fills.protocol_fee is the protocol's part of each fill's fee, in quote
+-- token units. Existing fills are backfilled assuming the default oneshot rate
+-- of 7500 bps: a quarter of the total fee (order_fee / 3), plus 75% of order_fee
+-- for oneshot orders.
+
+CREATE TABLE IF NOT EXISTS protocol_fee_collections (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    sender VARCHAR(42) NOT NULL,
+    recipient VARCHAR(42) NOT NULL,
+    token VARCHAR(42) NOT NULL DEFAULT '',
+    amount VARCHAR(78) NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INTEGER NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    create_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS protocol_fee_collections_log_uq ON protocol_fee_collections (chain_id, tx_hash, log_index);
+
+CREATE TABLE IF NOT EXISTS oneshot_protocol_fee_changes (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    sender VARCHAR(42) NOT NULL,
+    old_fee_bps INTEGER NOT NULL,
+    new_fee_bps INTEGER NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INTEGER NOT NULL,
+    create_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS oneshot_protocol_fee_changes_log_uq ON oneshot_protocol_fee_changes (chain_id, tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS oneshot_protocol_fee_changes_block_idx ON oneshot_protocol_fee_changes (chain_id, create_block, log_index);
+
+ALTER TABLE order_fills ADD COLUMN IF NOT EXISTS protocol_fee VARCHAR(78) NOT NULL DEFAULT '0';
+
+UPDATE order_fills f
+SET protocol_fee = (
+    TRUNC(f.order_fee::NUMERIC / 3)
+    + CASE WHEN o.oneshot THEN f.order_fee::NUMERIC - TRUNC(f.order_fee::NUMERIC / 4) ELSE 0 END
+)::TEXT
+FROM orders o
+WHERE o.chain_id = f.chain_id AND o.order_id = f.order_id
+  AND f.protocol_fee = '0' AND COALESCE(f.order_fee, '') NOT IN ('', '0');
+
+ALTER TABLE protocol_stats ADD COLUMN IF NOT EXISTS protocol_revenue JSONB NOT NULL DEFAULT '[]';
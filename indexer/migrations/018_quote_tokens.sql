@@ -0,0 +1,19 @@
+-- Migration: Quote token registry
+-- Maintained from QuotableTokenUpdated events. A token with a non-zero priority
+-- can be the quote token of a pair; of two quotable tokens the one with the
+-- higher priority is the quote. Priority 0 means the token was removed. The
+-- registry also decides which stablecoins and wrapped native tokens count as
+-- pricing anchors for TVL and APR.
+
+CREATE TABLE IF NOT EXISTS quote_tokens (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    address VARCHAR(42) NOT NULL,
+    priority VARCHAR(78) NOT NULL,
+    create_block BIGINT NOT NULL,
+    update_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS quote_tokens_address_uq ON quote_tokens (chain_id, address);
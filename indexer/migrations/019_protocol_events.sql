@@ -0,0 +1,21 @@
+-- Migration: Protocol governance audit log
+-- One row per Paused, Unpaused, FacetUpdated and OwnershipTransferred event of
+-- the GridEx contract and the Vault. data holds the decoded event, in the same
+-- shape as the Kafka message payload. The latest Paused/Unpaused row gives the
+-- current paused state of a chain.
+
+CREATE TABLE IF NOT EXISTS protocol_events (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    contract VARCHAR(42) NOT NULL,
+    event VARCHAR(32) NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INTEGER NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    create_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS protocol_events_log_uq ON protocol_events (chain_id, tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS protocol_events_event_idx ON protocol_events (chain_id, event, create_block, log_index);
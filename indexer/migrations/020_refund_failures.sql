@@ -0,0 +1,35 @@
+-- Migration: Failed native currency refunds
+-- One row per RefundFailed event: the TradeFacet could not send back native
+-- currency (ETH/BNB) to `address`, e.g. the excess of placeETHGridOrders, and
+-- the amount stays in the contract. action and grid_id come from the GridEx
+-- event of the same transaction (grid_created, grid_cancelled, order_cancelled,
+-- order_filled or profit_withdrawn); grid_id is NULL when that event names no
+-- grid. Support sets resolved once the funds have been returned.
+
+CREATE TABLE IF NOT EXISTS refund_failures (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    address VARCHAR(42) NOT NULL,
+    amount VARCHAR(78) NOT NULL,
+    action VARCHAR(32) NOT NULL DEFAULT '',
+    grid_id BIGINT,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INTEGER NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    create_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS refund_failures_log_uq ON refund_failures (chain_id, tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS refund_failures_address_idx ON refund_failures (chain_id, address);
+
+CREATE OR REPLACE VIEW unrefunded_native_balances AS
+SELECT chain_id, address,
+       SUM(amount::NUMERIC)::TEXT AS amount,
+       COUNT(*) AS failures,
+       MIN(create_block) AS first_block,
+       MAX(create_block) AS last_block
+FROM refund_failures
+WHERE NOT resolved
+GROUP BY chain_id, address;
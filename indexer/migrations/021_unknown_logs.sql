@@ -0,0 +1,23 @@
+-- Migration: Quarantine for unrecognized logs
+-- The scanner fetches every log of the watched contracts. Logs it has no
+-- handler for are stored here raw instead of being dropped, so events added to
+-- the contracts later can be decoded from these rows (indexer -reprocess-unknown).
+-- decoded_at is set once a row has been processed by a handler.
+
+CREATE TABLE IF NOT EXISTS unknown_logs (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    address VARCHAR(42) NOT NULL,
+    topics TEXT[] NOT NULL,
+    data BYTEA NOT NULL,
+    block_hash VARCHAR(66) NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    tx_index INTEGER NOT NULL,
+    log_index INTEGER NOT NULL,
+    create_block BIGINT NOT NULL,
+    decoded_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS unknown_logs_log_uq ON unknown_logs (chain_id, tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS unknown_logs_pending_idx ON unknown_logs (chain_id, create_block, log_index) WHERE decoded_at IS NULL;
@@ -0,0 +1,26 @@
+-- Migration: Reconciliation of indexed state with the contract
+-- The reconciler compares a sample of active grids with the GridEx view
+-- functions at the last indexed block. One row per mismatching value: field is
+-- amount or rev_amount for an order (order_id set), status, fee or profits for
+-- a grid (order_id ''). A mismatch seen again updates its row; resolved is set
+-- once the values agree, or right away when auto_repair overwrote the DB value
+-- (repaired).
+
+CREATE TABLE IF NOT EXISTS reconciliation_issues (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    grid_id BIGINT NOT NULL,
+    order_id VARCHAR(78) NOT NULL DEFAULT '',
+    field VARCHAR(32) NOT NULL,
+    db_value VARCHAR(78) NOT NULL,
+    chain_value VARCHAR(78) NOT NULL,
+    block_number BIGINT NOT NULL,
+    repaired BOOLEAN NOT NULL DEFAULT FALSE,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    first_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reconciliation_issues_uq ON reconciliation_issues (chain_id, grid_id, order_id, field);
+CREATE INDEX IF NOT EXISTS reconciliation_issues_open_idx ON reconciliation_issues (chain_id) WHERE NOT resolved;
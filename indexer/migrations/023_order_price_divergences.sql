@@ -0,0 +1,25 @@
+-- Migration: Order prices that differ from the strategy contracts
+-- With price_source verify or onchain, the price and reverse price computed for
+-- every new order are compared with the strategy contract's getPrice and
+-- getReversePrice at the creation block. One row per order whose prices differ;
+-- used_onchain is set when the order was stored with the contract's values.
+
+CREATE TABLE IF NOT EXISTS order_price_divergences (
+    id SERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    grid_id BIGINT NOT NULL,
+    order_id VARCHAR(78) NOT NULL,
+    is_ask BOOLEAN NOT NULL,
+    strategy VARCHAR(20) NOT NULL,
+    strategy_address VARCHAR(42) NOT NULL,
+    computed_price VARCHAR(78) NOT NULL,
+    onchain_price VARCHAR(78) NOT NULL,
+    computed_rev_price VARCHAR(78) NOT NULL,
+    onchain_rev_price VARCHAR(78) NOT NULL,
+    used_onchain BOOLEAN NOT NULL,
+    create_block BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS order_price_divergences_order_uq ON order_price_divergences (chain_id, order_id);
+CREATE INDEX IF NOT EXISTS order_price_divergences_grid_idx ON order_price_divergences (chain_id, grid_id);
@@ -0,0 +1,63 @@
+-- Migration: Token decimals and human-normalized amounts
+-- Amounts stay stored in raw token units and prices as raw quote units per raw
+-- base unit times 10^36, exactly as on chain. Each grid now also records the
+-- decimals of its pair's tokens, and the values fixed at creation are stored
+-- normalized to human units as well: amounts / 10^decimals, prices in quote
+-- tokens per base token. Running values (order amounts, profits) are
+-- normalized by the views below.
+
+CREATE OR REPLACE FUNCTION normalize_raw(raw TEXT, scale INTEGER) RETURNS TEXT AS $$
+    SELECT CASE WHEN raw IS NULL OR raw = '' THEN ''
+        ELSE regexp_replace((raw::NUMERIC * power(10::NUMERIC, -scale))::TEXT,
+                            '(\.[0-9]*[1-9])0+$|\.0+$', '\1')
+    END
+$$ LANGUAGE SQL IMMUTABLE;
+
+ALTER TABLE grids ADD COLUMN IF NOT EXISTS base_decimals SMALLINT NOT NULL DEFAULT 18;
+ALTER TABLE grids ADD COLUMN IF NOT EXISTS quote_decimals SMALLINT NOT NULL DEFAULT 18;
+ALTER TABLE grids ADD COLUMN IF NOT EXISTS initial_base_amount_normalized TEXT NOT NULL DEFAULT '';
+ALTER TABLE grids ADD COLUMN IF NOT EXISTS initial_quote_amount_normalized TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS price_normalized TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS rev_price_normalized TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS profit_normalized TEXT NOT NULL DEFAULT '0';
+ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS volume_normalized TEXT NOT NULL DEFAULT '0';
+ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS tvl_normalized TEXT NOT NULL DEFAULT '0';
+
+-- Backfill the decimals of existing grids from their pair's tokens.
+UPDATE grids g
+SET base_decimals = bt.decimals, quote_decimals = qt.decimals
+FROM pairs p
+JOIN tokens bt ON bt.chain_id = p.chain_id AND bt.address = p.base_token_address
+JOIN tokens qt ON qt.chain_id = p.chain_id AND qt.address = p.quote_token_address
+WHERE p.chain_id = g.chain_id AND p.pair_id = g.pair_id;
+
+UPDATE grids
+SET initial_base_amount_normalized = normalize_raw(initial_base_amount, base_decimals),
+    initial_quote_amount_normalized = normalize_raw(initial_quote_amount, quote_decimals)
+WHERE initial_base_amount_normalized = '';
+
+UPDATE orders o
+SET price_normalized = normalize_raw(o.price, 36 + g.quote_decimals - g.base_decimals),
+    rev_price_normalized = normalize_raw(o.rev_price, 36 + g.quote_decimals - g.base_decimals)
+FROM grids g
+WHERE g.chain_id = o.chain_id AND g.grid_id = o.grid_id AND o.price_normalized = '';
+
+-- Running grid values in human units; profits are in the quote token.
+CREATE OR REPLACE VIEW grids_normalized AS
+SELECT chain_id, grid_id, pair_id, base_token, quote_token, base_decimals, quote_decimals,
+       initial_base_amount_normalized, initial_quote_amount_normalized,
+       normalize_raw(total_profit, quote_decimals) AS total_profit_normalized,
+       normalize_raw(profits, quote_decimals) AS profits_normalized
+FROM grids;
+
+-- Running order amounts in human units. An ask's amount is in the base token
+-- and its rev_amount in the quote token; a bid's the other way round.
+CREATE OR REPLACE VIEW orders_normalized AS
+SELECT o.chain_id, o.order_id, o.grid_id, o.is_ask, o.status,
+       normalize_raw(o.amount, CASE WHEN o.is_ask THEN g.base_decimals ELSE g.quote_decimals END) AS amount_normalized,
+       normalize_raw(o.rev_amount, CASE WHEN o.is_ask THEN g.quote_decimals ELSE g.base_decimals END) AS rev_amount_normalized,
+       o.price_normalized, o.rev_price_normalized
+FROM orders o
+JOIN grids g ON g.chain_id = o.chain_id AND g.grid_id = o.grid_id;
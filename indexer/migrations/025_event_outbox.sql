@@ -0,0 +1,22 @@
+-- Migration: Transactional outbox for Kafka messages
+-- Messages are written here in the same transaction as the rows they describe.
+-- A relay per chain publishes the unsent rows in id order and sets sent_at, so
+-- a message exists if and only if its transaction committed. Delivery is
+-- at-least-once: consumers deduplicate on idempotency_key, which is also sent
+-- in the message and in its idempotency_key header.
+
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    chain_id INTEGER NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    event_type VARCHAR(40) NOT NULL,
+    partition_key TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    block_number BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS event_outbox_key_uq ON event_outbox (chain_id, idempotency_key);
+CREATE INDEX IF NOT EXISTS event_outbox_pending_idx ON event_outbox (chain_id, id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS event_outbox_sent_idx ON event_outbox (chain_id, sent_at) WHERE sent_at IS NOT NULL;
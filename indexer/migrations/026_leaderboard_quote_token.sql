@@ -0,0 +1,16 @@
+-- Migration: Rank the leaderboard per quote token
+-- Profits are in the quote token of each grid's pair, so profits of grids
+-- quoted in different tokens (e.g. USDC and WETH) are not comparable. The rank
+-- of a grid is now its position among the grids with the same quote token in
+-- the period; clients filter on quote_token_address to read one ranking.
+
+ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS quote_token_address VARCHAR(42) NOT NULL DEFAULT '';
+
+UPDATE leaderboard l
+SET quote_token_address = p.quote_token_address
+FROM grids g
+JOIN pairs p ON p.chain_id = g.chain_id AND p.pair_id = g.pair_id
+WHERE g.chain_id = l.chain_id AND g.grid_id = l.grid_id AND l.quote_token_address = '';
+
+CREATE INDEX IF NOT EXISTS leaderboard_chain_id_period_quote_rank_idx
+  ON leaderboard (chain_id, period, quote_token_address, rank);
@@ -0,0 +1,13 @@
+-- Migration: Keep the global leaderboard rank and add a per quote token rank
+-- Migration 026 made rank restart for every quote token, but the backend API
+-- orders and returns rank as the position among all grids of the period.
+-- rank is global again (by normalized profit) and quote_rank holds the
+-- position among the grids with the same quote_token_address. Both are
+-- recomputed on the next leaderboard refresh.
+
+ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS quote_rank INTEGER NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS leaderboard_chain_id_period_quote_rank_idx;
+
+CREATE INDEX IF NOT EXISTS leaderboard_chain_id_period_quote_token_rank_idx
+  ON leaderboard (chain_id, period, quote_token_address, quote_rank);
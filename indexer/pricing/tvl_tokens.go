@@ -58,14 +58,16 @@ var tvlTokenRegistry = map[int64]map[string]TVLTokenInfo{
 	},
 }
 
-// LookupTVLToken returns the TVL token info for a given chain and token address.
-// Returns (info, true) if the token is a stablecoin or wrapped native token,
-// or (zero, false) if the token is not relevant for TVL calculation.
-func LookupTVLToken(chainID int64, tokenAddress string) (TVLTokenInfo, bool) {
-	chainTokens, ok := tvlTokenRegistry[chainID]
-	if !ok {
-		return TVLTokenInfo{}, false
+// AnchorTokens returns the tokens of a chain that are priced without a
+// price lookup, keyed by lowercase address: the built-in stablecoins and
+// wrapped native token, plus extraStablecoins.
+func AnchorTokens(chainID int64, extraStablecoins []string) map[string]TokenType {
+	anchors := make(map[string]TokenType, len(tvlTokenRegistry[chainID])+len(extraStablecoins))
+	for addr, info := range tvlTokenRegistry[chainID] {
+		anchors[addr] = info.Type
 	}
-	info, ok := chainTokens[strings.ToLower(tokenAddress)]
-	return info, ok
+	for _, addr := range extraStablecoins {
+		anchors[strings.ToLower(addr)] = TokenTypeStablecoin
+	}
+	return anchors
 }
@@ -0,0 +1,598 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"math/rand/v2"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/gridex/indexer/config"
+	"github.com/gridex/indexer/metrics"
+)
+
+const (
+	// ewmaAlpha is the weight of the newest sample in the latency and error
+	// rate moving averages.
+	ewmaAlpha = 0.2
+	// ejectAfterFailures is the number of consecutive failures that takes an
+	// endpoint out of rotation.
+	ejectAfterFailures = 3
+	// minEjection and maxEjection bound how long an ejected endpoint is kept
+	// out of rotation. The period doubles every time an endpoint is ejected
+	// again without a success in between.
+	minEjection = 30 * time.Second
+	maxEjection = 5 * time.Minute
+	// healthCheckInterval is how often every endpoint is asked for its head
+	// to detect lagging nodes. Only used with more than one endpoint.
+	healthCheckInterval = 30 * time.Second
+)
+
+// errLagging is returned internally when an endpoint's head trails the pool.
+var errLagging = errors.New("endpoint is lagging behind the pool")
+
+// errIncompleteBatch is returned internally when an element of a batch came
+// back not found or null, which a node that has not seen the block yet
+// answers. The batch is sent again to another endpoint.
+var errIncompleteBatch = errors.New("batch element not found")
+
+// nodeClient is the per-endpoint client used by Pool (*RateLimitedClient).
+type nodeClient interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	BatchCallContext(ctx context.Context, b []gethrpc.BatchElem) error
+	Burst() int
+	Close()
+}
+
+// node is one endpoint of the pool together with its health statistics.
+type node struct {
+	name   string // host part of the URL; the path may carry an API key
+	key    string // metrics key: chain/name
+	weight int
+	client nodeClient
+
+	mu           sync.Mutex
+	latency      float64 // EWMA in milliseconds
+	errRate      float64 // EWMA of failures, 0..1
+	failures     int     // consecutive failures
+	ejectedUntil time.Time
+	ejection     time.Duration // length of the last ejection
+	head         uint64
+	lagging      bool
+}
+
+// Pool spreads RPC requests over several endpoints of one chain. It picks
+// endpoints at random, weighted by the configured weight and their observed
+// latency and error rate, and fails over to the next endpoint when a request
+// fails at the transport level or the data is not found. Endpoints that fail repeatedly are ejected for
+// an increasing period, and endpoints whose head trails the best known head by
+// more than maxLag blocks are skipped until they catch up. Requests for a
+// specific block prefer endpoints known to have reached it, so logs are never
+// read from a node that has not seen the block yet while another one has.
+//
+// Pool implements scanner.EthClient and contracts.ContractCaller.
+type Pool struct {
+	chain  string
+	maxLag uint64
+	logger *slog.Logger
+	nodes  []*node
+}
+
+// NewPool dials every endpoint of the chain and wraps each one in its own rate
+// limiter, retry budget and circuit breaker.
+func NewPool(ctx context.Context, cfg config.ChainConfig, logger *slog.Logger) (*Pool, error) {
+	chain, endpoints := cfg.Name, cfg.RPCURLs
+	policy := NewRetryPolicy(cfg.RPCRetry)
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no rpc endpoints configured")
+	}
+
+	clients := make([]nodeClient, 0, len(endpoints))
+	names := make([]string, 0, len(endpoints))
+	weights := make([]int, 0, len(endpoints))
+	for i, ep := range endpoints {
+		name := endpointName(ep.URL, i)
+		client, err := DialRateLimited(ctx, ep.URL, ep.RPCTPM, policy,
+			logger.With("chain", chain, "endpoint", name))
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, fmt.Errorf("dial rpc endpoint %s: %w", name, err)
+		}
+		clients = append(clients, client)
+		names = append(names, name)
+		weights = append(weights, ep.Weight)
+
+		logger.Info("RPC endpoint added",
+			"chain", chain,
+			"endpoint", name,
+			"weight", ep.Weight,
+			"rpc_tpm", ep.RPCTPM,
+		)
+	}
+	return newPool(chain, clients, names, weights, cfg.RPCMaxLag, logger), nil
+}
+
+func newPool(chain string, clients []nodeClient, names []string, weights []int, maxLag uint64, logger *slog.Logger) *Pool {
+	p := &Pool{
+		chain:  chain,
+		maxLag: maxLag,
+		logger: logger.With("component", "rpc_pool"),
+	}
+	seen := make(map[string]bool)
+	for i, c := range clients {
+		name := names[i]
+		if seen[name] {
+			name = fmt.Sprintf("%s#%d", name, i)
+		}
+		seen[name] = true
+		n := &node{
+			name:   name,
+			key:    chain + "/" + name,
+			weight: max(weights[i], 1),
+			client: c,
+		}
+		metrics.Set(metrics.RPCHealthy, n.key, 1)
+		p.nodes = append(p.nodes, n)
+	}
+	return p
+}
+
+// endpointName returns the host of an endpoint URL for logs and metrics.
+func endpointName(rawURL string, i int) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return fmt.Sprintf("endpoint-%d", i)
+}
+
+// Run periodically cross-checks the head of every endpoint until ctx is
+// cancelled. With a single endpoint there is nothing to compare and Run
+// returns immediately.
+func (p *Pool) Run(ctx context.Context) {
+	if len(p.nodes) < 2 {
+		return
+	}
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		p.checkHeads(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHeads asks every endpoint that is not currently ejected for its head.
+// This is also how ejected endpoints are re-admitted: once the ejection
+// expires, a successful probe puts them back into rotation.
+func (p *Pool) checkHeads(ctx context.Context) {
+	var wg sync.WaitGroup
+	now := time.Now()
+	for _, n := range p.nodes {
+		n.mu.Lock()
+		ejected := now.Before(n.ejectedUntil)
+		n.mu.Unlock()
+		if ejected {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			head, err := n.client.BlockNumber(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !isRequestError(err) {
+				p.observe(n, time.Since(start), err)
+				return
+			}
+			p.observe(n, time.Since(start), nil)
+			if err == nil {
+				n.mu.Lock()
+				n.head = head
+				n.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Compare once all heads are in, not against whichever answered first.
+	for _, n := range p.nodes {
+		n.mu.Lock()
+		head := n.head
+		n.mu.Unlock()
+		if head > 0 {
+			p.updateHead(n, head)
+		}
+	}
+}
+
+// Close closes every endpoint's connection.
+func (p *Pool) Close() {
+	for _, n := range p.nodes {
+		n.client.Close()
+	}
+}
+
+// Burst returns the combined burst of all endpoint limiters, or 0 if any
+// endpoint is not rate limited.
+func (p *Pool) Burst() int {
+	total := 0
+	for _, n := range p.nodes {
+		b := n.client.Burst()
+		if b == 0 {
+			return 0
+		}
+		total += b
+	}
+	return total
+}
+
+// BlockNumber returns the most recent block number. A result that trails the
+// best head seen on other endpoints by more than maxLag marks the endpoint as
+// lagging and the request is retried elsewhere.
+func (p *Pool) BlockNumber(ctx context.Context) (uint64, error) {
+	return call(ctx, p, "eth_blockNumber", 0, func(n *node) (uint64, error) {
+		head, err := n.client.BlockNumber(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if p.updateHead(n, head) {
+			return 0, fmt.Errorf("%w: head %d", errLagging, head)
+		}
+		return head, nil
+	})
+}
+
+// FilterLogs executes a filter query on an endpoint that has reached ToBlock.
+func (p *Pool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return call(ctx, p, "eth_getLogs", blockNeeded(q.ToBlock), func(n *node) ([]types.Log, error) {
+		return n.client.FilterLogs(ctx, q)
+	})
+}
+
+// BlockByNumber returns a block by its number.
+func (p *Pool) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return call(ctx, p, "eth_getBlockByNumber", blockNeeded(number), func(n *node) (*types.Block, error) {
+		return n.client.BlockByNumber(ctx, number)
+	})
+}
+
+// HeaderByNumber returns a block header by its number.
+// A nil number returns the latest header.
+func (p *Pool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return call(ctx, p, "eth_getBlockByNumber", blockNeeded(number), func(n *node) (*types.Header, error) {
+		return n.client.HeaderByNumber(ctx, number)
+	})
+}
+
+// TransactionReceipt returns the receipt of a transaction by transaction hash.
+// The block is not known up front; a "not found" answer is retried on the
+// other endpoints instead.
+func (p *Pool) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return call(ctx, p, "eth_getTransactionReceipt", 0, func(n *node) (*types.Receipt, error) {
+		return n.client.TransactionReceipt(ctx, txHash)
+	})
+}
+
+// CallContract executes a message call on an endpoint that has reached
+// blockNumber.
+func (p *Pool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return call(ctx, p, "eth_call", blockNeeded(blockNumber), func(n *node) ([]byte, error) {
+		return n.client.CallContract(ctx, msg, blockNumber)
+	})
+}
+
+// BatchCallContext sends a JSON-RPC batch to a single endpoint that has
+// reached the highest block the elements ask for. Element errors are left in
+// b[i].Error. A failure of the whole batch fails over, and so does an element
+// that comes back not found or null; if every endpoint answers that, the last
+// answer is left in b.
+func (p *Pool) BatchCallContext(ctx context.Context, b []gethrpc.BatchElem) error {
+	_, err := call(ctx, p, "batch", batchBlockNeeded(b), func(n *node) (struct{}, error) {
+		if err := n.client.BatchCallContext(ctx, b); err != nil {
+			return struct{}{}, err
+		}
+		if slices.ContainsFunc(b, isMissingElem) {
+			return struct{}{}, errIncompleteBatch
+		}
+		return struct{}{}, nil
+	})
+	if errors.Is(err, errIncompleteBatch) {
+		return nil
+	}
+	return err
+}
+
+// batchBlockNeeded returns the highest block number passed as the first
+// argument of a batch element, or 0 if none asks for a block by number.
+func batchBlockNeeded(b []gethrpc.BatchElem) uint64 {
+	var need uint64
+	for _, elem := range b {
+		if len(elem.Args) == 0 {
+			continue
+		}
+		arg, ok := elem.Args[0].(string)
+		if !ok {
+			continue
+		}
+		if n, err := hexutil.DecodeUint64(arg); err == nil {
+			need = max(need, n)
+		}
+	}
+	return need
+}
+
+// isMissingElem reports whether a batch element was answered with "not found"
+// or a null result.
+func isMissingElem(elem gethrpc.BatchElem) bool {
+	if elem.Error != nil {
+		return isNotFoundErr(elem.Error)
+	}
+	v := reflect.ValueOf(elem.Result)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return false
+	}
+	switch v = v.Elem(); v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isNotFoundErr reports whether err says the requested block, transaction or
+// receipt does not exist, which a node that is behind may answer for data
+// another endpoint already has.
+func isNotFoundErr(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not found") && !strings.Contains(msg, "method not found")
+}
+
+// blockNeeded returns the block an endpoint must have reached to answer a
+// request for number, or 0 for "latest" and block tags.
+func blockNeeded(number *big.Int) uint64 {
+	if number == nil || number.Sign() <= 0 || !number.IsUint64() {
+		return 0
+	}
+	return number.Uint64()
+}
+
+// call runs fn on up to every endpoint of the pool, in order of pick, until
+// one succeeds or returns an error that another endpoint would return too.
+func call[T any](ctx context.Context, p *Pool, method string, need uint64, fn func(*node) (T, error)) (T, error) {
+	var zero T
+	var lastErr error
+	tried := make(map[*node]bool, len(p.nodes))
+	for range p.nodes {
+		n := p.pick(tried, need)
+		if n == nil {
+			break
+		}
+		tried[n] = true
+
+		start := time.Now()
+		v, err := fn(n)
+		if err == nil || isRequestError(err) {
+			p.observe(n, time.Since(start), nil)
+			return v, err
+		}
+		if ctx.Err() != nil {
+			return zero, err
+		}
+		switch {
+		case errors.Is(err, errIncompleteBatch) || isNotFoundErr(err):
+			// The endpoint answered; another one may have the data.
+			p.observe(n, time.Since(start), nil)
+		case !errors.Is(err, errLagging):
+			p.observe(n, time.Since(start), err)
+		}
+		lastErr = err
+
+		if len(tried) < len(p.nodes) {
+			p.logger.Warn("RPC request failed, trying next endpoint",
+				"chain", p.chain,
+				"endpoint", n.name,
+				"method", method,
+				"error", err,
+			)
+		}
+	}
+	if lastErr == nil {
+		return zero, fmt.Errorf("%s: no rpc endpoint available", method)
+	}
+	if len(tried) == 1 {
+		return zero, lastErr
+	}
+	return zero, fmt.Errorf("%s failed on all endpoints: %w", method, lastErr)
+}
+
+// isRequestError reports whether err is a response to the request itself (a
+// JSON-RPC error object) rather than a failure of the endpoint. Such errors are
+// returned to the caller as-is: another endpoint would answer the same, and the
+// endpoint is evidently healthy. Rate limits are the exception, since another
+// endpoint may well have capacity, and so is "not found", which a node that is
+// behind answers for data another endpoint already has.
+func isRequestError(err error) bool {
+	var rpcErr gethrpc.Error
+	return errors.As(err, &rpcErr) && !isRateLimitErr(err) && !isNotFoundErr(err)
+}
+
+// pick selects an untried endpoint at random, weighted by its score. Healthy
+// endpoints that have reached need are preferred; if there are none, it falls
+// back to lagging endpoints and finally to ejected ones, so a request is never
+// refused while any endpoint is left.
+func (p *Pool) pick(tried map[*node]bool, need uint64) *node {
+	now := time.Now()
+	var healthy, reachable, rest []*node
+	for _, n := range p.nodes {
+		if tried[n] {
+			continue
+		}
+		n.mu.Lock()
+		ejected := now.Before(n.ejectedUntil)
+		behind := n.lagging || (need > 0 && n.head > 0 && n.head < need)
+		n.mu.Unlock()
+
+		switch {
+		case !ejected && !behind:
+			healthy = append(healthy, n)
+		case !ejected:
+			reachable = append(reachable, n)
+		default:
+			rest = append(rest, n)
+		}
+	}
+	for _, candidates := range [][]*node{healthy, reachable, rest} {
+		if len(candidates) > 0 {
+			return weightedPick(candidates)
+		}
+	}
+	return nil
+}
+
+func weightedPick(candidates []*node) *node {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	scores := make([]float64, len(candidates))
+	total := 0.0
+	for i, n := range candidates {
+		scores[i] = n.score()
+		total += scores[i]
+	}
+	r := rand.Float64() * total
+	for i, s := range scores {
+		if r < s {
+			return candidates[i]
+		}
+		r -= s
+	}
+	return candidates[len(candidates)-1]
+}
+
+// score is the endpoint's share of traffic: its weight, reduced by its error
+// rate and by every 100ms of average latency.
+func (n *node) score() float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return float64(n.weight) * (1 - 0.9*n.errRate) / (1 + n.latency/100)
+}
+
+// observe records the outcome of one request and ejects the endpoint after
+// ejectAfterFailures consecutive failures.
+func (p *Pool) observe(n *node, took time.Duration, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ms := float64(took) / float64(time.Millisecond)
+	if n.latency == 0 {
+		n.latency = ms
+	} else {
+		n.latency += ewmaAlpha * (ms - n.latency)
+	}
+	sample := 0.0
+	if err != nil {
+		sample = 1
+	}
+	n.errRate += ewmaAlpha * (sample - n.errRate)
+
+	metrics.RPCRequests.Add(n.key, 1)
+	metrics.Set(metrics.RPCLatency, n.key, int64(n.latency))
+
+	if err == nil {
+		if !n.ejectedUntil.IsZero() {
+			p.logger.Info("RPC endpoint re-admitted", "chain", p.chain, "endpoint", n.name)
+			n.ejectedUntil = time.Time{}
+			n.ejection = 0
+			n.setHealthyMetric()
+		}
+		n.failures = 0
+		return
+	}
+
+	metrics.RPCErrors.Add(n.key, 1)
+	n.failures++
+	if n.failures < ejectAfterFailures {
+		return
+	}
+	n.failures = 0
+	n.ejection = min(max(n.ejection*2, minEjection), maxEjection)
+	n.ejectedUntil = time.Now().Add(n.ejection)
+	n.setHealthyMetric()
+	p.logger.Warn("RPC endpoint ejected",
+		"chain", p.chain,
+		"endpoint", n.name,
+		"for", n.ejection,
+		"error_rate", n.errRate,
+		"error", err,
+	)
+}
+
+// updateHead records an endpoint's head and re-evaluates whether it lags the
+// best head known to the pool. It reports whether the endpoint is lagging.
+func (p *Pool) updateHead(n *node, head uint64) bool {
+	n.mu.Lock()
+	n.head = head
+	n.mu.Unlock()
+
+	// Ejected endpoints don't count: their head may be stale or bogus.
+	var best uint64
+	now := time.Now()
+	for _, o := range p.nodes {
+		o.mu.Lock()
+		if !now.Before(o.ejectedUntil) {
+			best = max(best, o.head)
+		}
+		o.mu.Unlock()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	lagging := head+p.maxLag < best
+	if lagging != n.lagging {
+		n.lagging = lagging
+		n.setHealthyMetric()
+		if lagging {
+			p.logger.Warn("RPC endpoint is lagging", "chain", p.chain, "endpoint", n.name, "head", head, "best_head", best)
+		} else {
+			p.logger.Info("RPC endpoint caught up", "chain", p.chain, "endpoint", n.name, "head", head)
+		}
+	}
+	return lagging
+}
+
+// setHealthyMetric must be called with n.mu held.
+func (n *node) setHealthyMetric() {
+	healthy := int64(1)
+	if n.lagging || !n.ejectedUntil.IsZero() {
+		healthy = 0
+	}
+	metrics.Set(metrics.RPCHealthy, n.key, healthy)
+}
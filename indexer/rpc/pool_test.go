@@ -0,0 +1,225 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+)
+
+type fakeNode struct {
+	head    uint64
+	err     error
+	calls   int
+	closed  bool
+	burst   int
+	logs    []types.Log
+	lastReq ethereum.FilterQuery
+	receipt *types.Receipt
+	batchFn func(b []gethrpc.BatchElem) error
+}
+
+func (f *fakeNode) BlockNumber(ctx context.Context) (uint64, error) {
+	f.calls++
+	return f.head, f.err
+}
+
+func (f *fakeNode) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	f.calls++
+	f.lastReq = q
+	return f.logs, f.err
+}
+
+func (f *fakeNode) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	panic("BlockByNumber not mocked")
+}
+
+func (f *fakeNode) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	panic("HeaderByNumber not mocked")
+}
+
+func (f *fakeNode) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	f.calls++
+	if f.receipt == nil && f.err == nil {
+		return nil, ethereum.NotFound
+	}
+	return f.receipt, f.err
+}
+
+func (f *fakeNode) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeNode) BatchCallContext(ctx context.Context, b []gethrpc.BatchElem) error {
+	f.calls++
+	return f.batchFn(b)
+}
+
+func (f *fakeNode) Burst() int { return f.burst }
+func (f *fakeNode) Close()     { f.closed = true }
+
+func testPool(maxLag uint64, nodes ...*fakeNode) *Pool {
+	clients := make([]nodeClient, len(nodes))
+	names := make([]string, len(nodes))
+	weights := make([]int, len(nodes))
+	for i, n := range nodes {
+		clients[i] = n
+		names[i] = "node"
+		weights[i] = 1
+	}
+	return newPool("test", clients, names, weights, maxLag, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestPoolFailoverAndEjection(t *testing.T) {
+	down := &fakeNode{err: errors.New("dial tcp: connection refused")}
+	up := &fakeNode{head: 100}
+	p := testPool(10, down, up)
+
+	// Every request succeeds through the healthy endpoint, and the failing one
+	// stops receiving traffic once it is ejected.
+	for i := range 200 {
+		head, err := p.BlockNumber(context.Background())
+		if err != nil || head != 100 {
+			t.Fatalf("request %d: head=%d err=%v", i, head, err)
+		}
+	}
+	if down.calls != ejectAfterFailures {
+		t.Fatalf("down endpoint got %d calls, want %d before ejection", down.calls, ejectAfterFailures)
+	}
+	if !time.Now().Before(p.nodes[0].ejectedUntil) {
+		t.Fatalf("down endpoint was not ejected")
+	}
+
+	// Once the ejection expires, a success re-admits the endpoint.
+	down.err = nil
+	down.head = 100
+	p.nodes[0].ejectedUntil = time.Now().Add(-time.Second)
+	p.checkHeads(context.Background())
+	if !p.nodes[0].ejectedUntil.IsZero() {
+		t.Fatalf("recovered endpoint was not re-admitted")
+	}
+
+	// JSON-RPC errors are answers, not endpoint failures: no failover.
+	up.err = &jsonError{code: 3, msg: "execution reverted"}
+	down.err = up.err
+	before := down.calls + up.calls
+	if _, err := p.CallContract(context.Background(), ethereum.CallMsg{}, nil); err != up.err {
+		t.Fatalf("expected the revert to be returned as-is, got %v", err)
+	}
+	if calls := down.calls + up.calls - before; calls != 1 {
+		t.Fatalf("revert was sent to %d endpoints, want 1", calls)
+	}
+}
+
+func TestPoolSkipsLaggingEndpoints(t *testing.T) {
+	ahead := &fakeNode{head: 1000, logs: []types.Log{{BlockNumber: 995}}}
+	behind := &fakeNode{head: 900}
+	p := testPool(10, ahead, behind)
+
+	p.checkHeads(context.Background())
+	if !p.nodes[1].lagging || p.nodes[0].lagging {
+		t.Fatalf("lagging flags: ahead=%v behind=%v", p.nodes[0].lagging, p.nodes[1].lagging)
+	}
+
+	for range 20 {
+		q := ethereum.FilterQuery{FromBlock: big.NewInt(990), ToBlock: big.NewInt(995)}
+		logs, err := p.FilterLogs(context.Background(), q)
+		if err != nil || len(logs) != 1 {
+			t.Fatalf("logs=%v err=%v", logs, err)
+		}
+	}
+	if behind.calls != 1 { // only the health check
+		t.Fatalf("lagging endpoint got %d calls", behind.calls)
+	}
+
+	// Catching up puts it back into rotation.
+	behind.head = 1000
+	p.checkHeads(context.Background())
+	if p.nodes[1].lagging {
+		t.Fatalf("endpoint still lagging after catching up")
+	}
+}
+
+func TestPoolNotFoundFailover(t *testing.T) {
+	ctx := context.Background()
+	receipt := &types.Receipt{BlockNumber: big.NewInt(995)}
+	ahead := &fakeNode{head: 1000, receipt: receipt}
+	behind := &fakeNode{head: 900}
+	p := testPool(1000, ahead, behind)
+	p.checkHeads(ctx)
+
+	// A receipt the lagging endpoint doesn't have yet is read from the other.
+	for range 20 {
+		if got, err := p.TransactionReceipt(ctx, common.Hash{}); err != nil || got != receipt {
+			t.Fatalf("receipt=%v err=%v", got, err)
+		}
+	}
+	if !p.nodes[1].ejectedUntil.IsZero() {
+		t.Fatal("not found ejected the endpoint")
+	}
+
+	// A batch asking for a block goes to an endpoint that has reached it.
+	header := &types.Header{Number: big.NewInt(995)}
+	ahead.batchFn = func(b []gethrpc.BatchElem) error {
+		*b[0].Result.(**types.Header) = header
+		return nil
+	}
+	behind.batchFn = func(b []gethrpc.BatchElem) error {
+		*b[0].Result.(**types.Header) = nil
+		return nil
+	}
+	behind.calls = 0
+	for range 20 {
+		var got *types.Header
+		elems := []gethrpc.BatchElem{{Method: "eth_getBlockByNumber", Args: []any{"0x3e3", false}, Result: &got}}
+		if err := p.BatchCallContext(ctx, elems); err != nil || got != header {
+			t.Fatalf("header=%v err=%v", got, err)
+		}
+	}
+	if behind.calls != 0 {
+		t.Fatalf("endpoint behind the block got %d batches", behind.calls)
+	}
+
+	// A null element is sent to another endpoint; if every endpoint answers
+	// null, that answer is returned.
+	p = testPool(1000, &fakeNode{batchFn: behind.batchFn}, &fakeNode{batchFn: ahead.batchFn})
+	for range 20 {
+		var got *types.Header
+		elems := []gethrpc.BatchElem{{Method: "eth_getTransactionByHash", Args: []any{common.Hash{}}, Result: &got}}
+		if err := p.BatchCallContext(ctx, elems); err != nil || got != header {
+			t.Fatalf("header=%v err=%v", got, err)
+		}
+	}
+	p = testPool(1000, &fakeNode{batchFn: behind.batchFn}, &fakeNode{batchFn: behind.batchFn})
+	var got *types.Header
+	if err := p.BatchCallContext(ctx, []gethrpc.BatchElem{{Method: "eth_getBlockByNumber", Result: &got}}); err != nil || got != nil {
+		t.Fatalf("header=%v err=%v, want the null answer", got, err)
+	}
+}
+
+func TestPoolBurst(t *testing.T) {
+	if got := testPool(10, &fakeNode{burst: 2}, &fakeNode{burst: 3}).Burst(); got != 5 {
+		t.Fatalf("Burst()=%d want 5", got)
+	}
+	if got := testPool(10, &fakeNode{burst: 2}, &fakeNode{}).Burst(); got != 0 {
+		t.Fatalf("Burst() with an unlimited endpoint=%d want 0", got)
+	}
+}
+
+// jsonError implements go-ethereum's rpc.Error.
+type jsonError struct {
+	code int
+	msg  string
+}
+
+func (e *jsonError) Error() string  { return e.msg }
+func (e *jsonError) ErrorCode() int { return e.code }
@@ -1,31 +1,51 @@
-// Package rpc provides a rate-limited wrapper around go-ethereum's ethclient.
+// Package rpc provides a rate-limited wrapper around go-ethereum's ethclient
+// and a pool that spreads requests over several such endpoints.
 package rpc
 
 import (
 	"context"
 	"log/slog"
 	"math/big"
-	"strings"
-	"time"
+	"net/http"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 	"golang.org/x/time/rate"
 )
 
 // RateLimitedClient wraps an ethclient.Client with a token-bucket rate limiter
-// to control the maximum number of RPC requests per second.
+// to control the maximum number of RPC requests per second. Every method is
+// retried according to the client's RetryPolicy.
 type RateLimitedClient struct {
 	client  *ethclient.Client
 	limiter *rate.Limiter
+	retrier *retrier
 }
 
 // NewRateLimitedClient creates a new rate-limited wrapper around the given
 // ethclient.Client. The tpm parameter specifies the maximum requests per minute.
 // If tpm <= 0, no rate limiting is applied (the limiter allows unlimited throughput).
-func NewRateLimitedClient(client *ethclient.Client, tpm int) *RateLimitedClient {
+func NewRateLimitedClient(client *ethclient.Client, tpm int, policy RetryPolicy, logger *slog.Logger) *RateLimitedClient {
+	return newRateLimitedClient(client, tpm, newRetrier(policy, logger))
+}
+
+// DialRateLimited connects to url and wraps the client like
+// NewRateLimitedClient. Over HTTP it also honours Retry-After headers, which
+// are not visible through ethclient errors.
+func DialRateLimited(ctx context.Context, url string, tpm int, policy RetryPolicy, logger *slog.Logger) (*RateLimitedClient, error) {
+	r := newRetrier(policy, logger)
+	httpClient := &http.Client{Transport: &retryAfterTransport{base: http.DefaultTransport, retrier: r}}
+	rc, err := gethrpc.DialOptions(ctx, url, gethrpc.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return newRateLimitedClient(ethclient.NewClient(rc), tpm, r), nil
+}
+
+func newRateLimitedClient(client *ethclient.Client, tpm int, r *retrier) *RateLimitedClient {
 	var limiter *rate.Limiter
 	if tpm <= 0 {
 		limiter = rate.NewLimiter(rate.Inf, 0)
@@ -39,11 +59,26 @@ func NewRateLimitedClient(client *ethclient.Client, tpm int) *RateLimitedClient
 	return &RateLimitedClient{
 		client:  client,
 		limiter: limiter,
+		retrier: r,
 	}
 }
 
-// wait blocks until the rate limiter allows one more request, or ctx is cancelled.
+// Burst returns the number of requests the limiter admits at once, or 0 if
+// requests are not rate limited. Callers use it to size worker pools so that
+// parallel requests don't just queue up behind the limiter.
+func (r *RateLimitedClient) Burst() int {
+	if r.limiter.Limit() == rate.Inf {
+		return 0
+	}
+	return r.limiter.Burst()
+}
+
+// wait blocks until the provider's Retry-After has passed and the rate limiter
+// allows one more request, or ctx is cancelled.
 func (r *RateLimitedClient) wait(ctx context.Context) error {
+	if err := r.retrier.waitRetryAfter(ctx); err != nil {
+		return err
+	}
 	return r.limiter.Wait(ctx)
 }
 
@@ -51,79 +86,56 @@ func (r *RateLimitedClient) wait(ctx context.Context) error {
 // This call IS rate-limited because many RPC providers (e.g. Tatum) count
 // all requests — including eth_blockNumber — toward their rate limit.
 func (r *RateLimitedClient) BlockNumber(ctx context.Context) (uint64, error) {
-	if err := r.wait(ctx); err != nil {
-		return 0, err
-	}
-	return r.client.BlockNumber(ctx)
+	return retry(ctx, r, "eth_blockNumber", func() (uint64, error) {
+		return r.client.BlockNumber(ctx)
+	})
 }
 
 // FilterLogs executes a filter query.
 func (r *RateLimitedClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
-	if err := r.wait(ctx); err != nil {
-		return nil, err
-	}
-	return r.client.FilterLogs(ctx, q)
+	return retry(ctx, r, "eth_getLogs", func() ([]types.Log, error) {
+		return r.client.FilterLogs(ctx, q)
+	})
 }
 
 // BlockByNumber returns a block by its number.
 func (r *RateLimitedClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
-	if err := r.wait(ctx); err != nil {
-		return nil, err
-	}
-	return r.client.BlockByNumber(ctx, number)
+	return retry(ctx, r, "eth_getBlockByNumber", func() (*types.Block, error) {
+		return r.client.BlockByNumber(ctx, number)
+	})
+}
+
+// HeaderByNumber returns a block header by its number.
+// A nil number returns the latest header.
+func (r *RateLimitedClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return retry(ctx, r, "eth_getBlockByNumber", func() (*types.Header, error) {
+		return r.client.HeaderByNumber(ctx, number)
+	})
 }
 
 // TransactionReceipt returns the receipt of a transaction by transaction hash.
 func (r *RateLimitedClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
-	if err := r.wait(ctx); err != nil {
-		return nil, err
-	}
-	return r.client.TransactionReceipt(ctx, txHash)
+	return retry(ctx, r, "eth_getTransactionReceipt", func() (*types.Receipt, error) {
+		return r.client.TransactionReceipt(ctx, txHash)
+	})
 }
 
 // CallContract executes a message call transaction, which is directly executed
 // in the VM of the node, but never mined into the blockchain.
-// It retries with exponential backoff on HTTP 429 (Too Many Requests) errors.
 func (r *RateLimitedClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
-	const maxRetries = 5
-	backoff := 15 * time.Second // start with 15s for very tight rate limits (e.g. 5 req/min)
-
-	for attempt := 0; ; attempt++ {
-		if err := r.wait(ctx); err != nil {
-			return nil, err
-		}
-
-		result, err := r.client.CallContract(ctx, msg, blockNumber)
-		if err == nil {
-			return result, nil
-		}
-
-		if !is429Error(err) || attempt >= maxRetries {
-			return nil, err
-		}
-
-		slog.Warn("RPC 429 rate limited, backing off",
-			"attempt", attempt+1,
-			"backoff", backoff,
-			"error", err)
-
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(backoff):
-		}
-
-		backoff = backoff * 2 // exponential backoff
-	}
+	return retry(ctx, r, "eth_call", func() ([]byte, error) {
+		return r.client.CallContract(ctx, msg, blockNumber)
+	})
 }
 
-// is429Error checks whether an error indicates an HTTP 429 Too Many Requests response.
-func is429Error(err error) bool {
-	if err == nil {
-		return false
-	}
-	msg := strings.ToLower(err.Error())
-	return strings.Contains(msg, "429") && strings.Contains(msg, "too many")
+// BatchCallContext sends several JSON-RPC requests in one HTTP round trip.
+// The batch counts as a single request against the rate limiter; errors of
+// individual elements are reported in b[i].Error and are not retried.
+func (r *RateLimitedClient) BatchCallContext(ctx context.Context, b []gethrpc.BatchElem) error {
+	_, err := retry(ctx, r, "batch", func() (struct{}, error) {
+		return struct{}{}, r.client.Client().BatchCallContext(ctx, b)
+	})
+	return err
 }
 
 // Close closes the underlying ethclient connection.
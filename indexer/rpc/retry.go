@@ -0,0 +1,332 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/gridex/indexer/config"
+)
+
+// retryBudgetCap is the number of retry tokens an idle client accumulates,
+// which is also the burst of retries allowed before the budget ratio applies.
+const retryBudgetCap = 10
+
+// ErrCircuitOpen is returned without contacting the endpoint while its
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("rpc circuit breaker open")
+
+// RetryPolicy is the static part of the retry behaviour shared by all methods.
+type RetryPolicy struct {
+	MaxAttempts      int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	BudgetRatio      float64
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// NewRetryPolicy converts a chain's rpc_retry settings.
+func NewRetryPolicy(cfg config.RetryConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:      cfg.MaxAttempts,
+		BaseDelay:        time.Duration(cfg.BaseDelayMs) * time.Millisecond,
+		MaxDelay:         time.Duration(cfg.MaxDelayMs) * time.Millisecond,
+		BudgetRatio:      cfg.BudgetRatio,
+		BreakerThreshold: cfg.BreakerThreshold,
+		BreakerCooldown:  time.Duration(cfg.BreakerCooldownMs) * time.Millisecond,
+	}
+}
+
+// backoff returns the delay before retry number attempt (1-based):
+// exponential in attempt, capped at MaxDelay, with "equal jitter" so that
+// parallel workers hitting the same limit don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MaxDelay
+	if attempt < 32 {
+		d = min(p.BaseDelay<<(attempt-1), p.MaxDelay)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retrier holds the per-endpoint retry state: the retry budget, the circuit
+// breaker and the earliest time the provider asked us to come back.
+type retrier struct {
+	policy RetryPolicy
+	logger *slog.Logger
+
+	// notBefore is a UnixNano timestamp set from Retry-After headers and
+	// backoff hints in JSON-RPC errors.
+	notBefore atomic.Int64
+
+	mu        sync.Mutex
+	tokens    float64
+	failures  int
+	openUntil time.Time
+	probing   bool // a half-open trial request is in flight
+}
+
+func newRetrier(policy RetryPolicy, logger *slog.Logger) *retrier {
+	return &retrier{policy: policy, logger: logger, tokens: retryBudgetCap}
+}
+
+// delayUntil records that the provider asked for no requests before now+d.
+func (r *retrier) delayUntil(d time.Duration) {
+	d = min(d, r.policy.MaxDelay)
+	until := time.Now().Add(d).UnixNano()
+	for {
+		cur := r.notBefore.Load()
+		if cur >= until || r.notBefore.CompareAndSwap(cur, until) {
+			return
+		}
+	}
+}
+
+// waitRetryAfter blocks until the provider's Retry-After has passed.
+func (r *retrier) waitRetryAfter(ctx context.Context) error {
+	d := time.Until(time.Unix(0, r.notBefore.Load()))
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// deposit earns BudgetRatio retry tokens for a new request.
+func (r *retrier) deposit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = min(r.tokens+r.policy.BudgetRatio, retryBudgetCap)
+}
+
+// withdraw spends one retry token. It returns false when the budget is
+// exhausted, so a struggling provider sees at most BudgetRatio extra load.
+func (r *retrier) withdraw() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// allow reports whether the breaker lets a request through. After the
+// cooldown it admits a single trial request (half-open state).
+func (r *retrier) allow() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.openUntil.IsZero() {
+		return nil
+	}
+	if time.Now().Before(r.openUntil) || r.probing {
+		return ErrCircuitOpen
+	}
+	r.probing = true
+	return nil
+}
+
+// record updates the breaker with the outcome of one attempt. Cancellations
+// say nothing about the endpoint and only release a half-open trial.
+func (r *retrier) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		r.probing = false
+		return
+	}
+	if err == nil || isRequestError(err) || isNotFoundErr(err) {
+		if !r.openUntil.IsZero() {
+			r.logger.Info("RPC circuit breaker closed")
+		}
+		r.failures = 0
+		r.openUntil = time.Time{}
+		r.probing = false
+		return
+	}
+
+	r.failures++
+	if r.probing || r.failures >= r.policy.BreakerThreshold {
+		r.logger.Warn("RPC circuit breaker opened",
+			"failures", r.failures,
+			"cooldown", r.policy.BreakerCooldown,
+			"error", err,
+		)
+		r.failures = 0
+		r.openUntil = time.Now().Add(r.policy.BreakerCooldown)
+		r.probing = false
+	}
+}
+
+// retry runs fn under the client's rate limiter and retry policy.
+func retry[T any](ctx context.Context, c *RateLimitedClient, method string, fn func() (T, error)) (T, error) {
+	var zero T
+	r := c.retrier
+	r.deposit()
+
+	for attempt := 1; ; attempt++ {
+		if err := r.allow(); err != nil {
+			return zero, err
+		}
+		if err := c.wait(ctx); err != nil {
+			r.record(err)
+			return zero, err
+		}
+
+		v, err := fn()
+		r.record(err)
+		if err == nil {
+			return v, nil
+		}
+		if ctx.Err() != nil || attempt >= r.policy.MaxAttempts || !isRetryableErr(err) {
+			return zero, err
+		}
+		if hint, ok := retryHint(err); ok {
+			r.delayUntil(hint)
+		}
+		if !r.withdraw() {
+			r.logger.Warn("RPC retry budget exhausted", "method", method, "error", err)
+			return zero, err
+		}
+
+		backoff := r.policy.backoff(attempt)
+		r.logger.Warn("RPC request failed, backing off",
+			"method", method,
+			"attempt", attempt,
+			"backoff", backoff,
+			"error", err,
+		)
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// rateLimitCodes are JSON-RPC error codes that providers use for rate and
+// capacity limits (besides plain 429, -32005 is shared with "limit exceeded"
+// for oversized eth_getLogs queries and is checked by message).
+var rateLimitCodes = map[int]bool{
+	429:    true, // HTTP status echoed as JSON-RPC code
+	-32007: true, // request limit reached
+	-32016: true, // over rate limit
+	-32090: true, // too many requests, retry later
+}
+
+// isRateLimitErr reports whether err means the provider throttled us.
+func isRateLimitErr(err error) bool {
+	var httpErr gethrpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	var rpcErr gethrpc.Error
+	if errors.As(err, &rpcErr) {
+		if rateLimitCodes[rpcErr.ErrorCode()] {
+			return true
+		}
+		if rpcErr.ErrorCode() != -32005 {
+			return false
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "too many requests") ||
+		strings.Contains(msg, "rate limit") ||
+		strings.Contains(msg, "request rate exceeded") ||
+		strings.Contains(msg, "request count exceeded") ||
+		strings.Contains(msg, "compute units") ||
+		strings.Contains(msg, "capacity exceeded")
+}
+
+// isRetryableErr reports whether retrying the same endpoint may succeed:
+// rate limits, gateway errors and timeouts. Connection failures are left to
+// the pool's failover and the circuit breaker.
+func isRetryableErr(err error) bool {
+	if isRateLimitErr(err) {
+		return true
+	}
+	var httpErr gethrpc.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded) || strings.Contains(strings.ToLower(err.Error()), "timeout")
+}
+
+// retryHint extracts a provider-requested delay from a JSON-RPC error's data,
+// e.g. {"rate": {"backoff_seconds": 30}} or {"retry_after": 5}.
+func retryHint(err error) (time.Duration, bool) {
+	var dataErr gethrpc.DataError
+	if !errors.As(err, &dataErr) {
+		return 0, false
+	}
+	data, ok := dataErr.ErrorData().(map[string]any)
+	if !ok {
+		return 0, false
+	}
+	if rate, ok := data["rate"].(map[string]any); ok {
+		data = rate
+	}
+	for _, key := range []string{"backoff_seconds", "retry_after"} {
+		if secs, ok := data[key].(float64); ok && secs > 0 {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+	}
+	return 0, false
+}
+
+// retryAfterTransport records Retry-After headers of throttled responses so
+// that every request to the endpoint waits for them, not only the one that
+// received the header (go-ethereum's HTTPError does not expose headers).
+type retryAfterTransport struct {
+	base    http.RoundTripper
+	retrier *retrier
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			t.retrier.delayUntil(d)
+		}
+	}
+	return resp, nil
+}
+
+// parseRetryAfter parses a Retry-After value in delay-seconds or HTTP-date form.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
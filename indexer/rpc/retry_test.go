@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+)
+
+func testRetryClient(policy RetryPolicy) *RateLimitedClient {
+	return newRateLimitedClient(nil, 0, newRetrier(policy, slog.New(slog.NewTextHandler(io.Discard, nil))))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:      4,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         5 * time.Millisecond,
+		BudgetRatio:      0.5,
+		BreakerThreshold: 100,
+		BreakerCooldown:  time.Hour,
+	}
+	ctx := context.Background()
+
+	// Rate limits are retried until they clear.
+	c := testRetryClient(policy)
+	calls := 0
+	v, err := retry(ctx, c, "eth_getLogs", func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, gethrpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}
+		}
+		return 42, nil
+	})
+	if err != nil || v != 42 || calls != 3 {
+		t.Fatalf("v=%d err=%v calls=%d", v, err, calls)
+	}
+
+	// Answers such as reverts are not retried.
+	calls = 0
+	revert := &jsonError{code: 3, msg: "execution reverted"}
+	if _, err := retry(ctx, c, "eth_call", func() (int, error) { calls++; return 0, revert }); err != revert || calls != 1 {
+		t.Fatalf("revert: err=%v calls=%d", err, calls)
+	}
+
+	// -32005 is a rate limit or an oversized query depending on the message;
+	// the latter must reach the scanner's range splitting untouched.
+	calls = 0
+	tooLarge := &jsonError{code: -32005, msg: "query returned more than 10000 results"}
+	if _, err := retry(ctx, c, "eth_getLogs", func() (int, error) { calls++; return 0, tooLarge }); err != tooLarge || calls != 1 {
+		t.Fatalf("limit exceeded: err=%v calls=%d", err, calls)
+	}
+	if !isRetryableErr(&jsonError{code: -32005, msg: "daily request count exceeded, request rate limited"}) {
+		t.Fatalf("-32005 rate limit not retryable")
+	}
+
+	// Attempts stop at MaxAttempts.
+	calls = 0
+	throttled := &jsonError{code: 429, msg: "exceeded compute units per second"}
+	if _, err := retry(ctx, c, "eth_getLogs", func() (int, error) { calls++; return 0, throttled }); err != throttled || calls != policy.MaxAttempts {
+		t.Fatalf("max attempts: err=%v calls=%d", err, calls)
+	}
+
+	// Once the budget is spent, failures are returned after a single attempt.
+	c.retrier.tokens = 0
+	calls = 0
+	if _, err := retry(ctx, c, "eth_getLogs", func() (int, error) { calls++; return 0, throttled }); err != throttled || calls != 1 {
+		t.Fatalf("exhausted budget: err=%v calls=%d", err, calls)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	c := testRetryClient(RetryPolicy{MaxAttempts: 1, BreakerThreshold: 2, BreakerCooldown: time.Hour})
+	ctx := context.Background()
+	down := errors.New("dial tcp: connection refused")
+
+	for range 2 {
+		if _, err := retry(ctx, c, "eth_blockNumber", func() (int, error) { return 0, down }); err != down {
+			t.Fatalf("err=%v", err)
+		}
+	}
+	called := false
+	if _, err := retry(ctx, c, "eth_blockNumber", func() (int, error) { called = true; return 1, nil }); !errors.Is(err, ErrCircuitOpen) || called {
+		t.Fatalf("open breaker: err=%v called=%v", err, called)
+	}
+
+	// After the cooldown a single trial is let through; a success closes it.
+	c.retrier.openUntil = time.Now().Add(-time.Second)
+	if v, err := retry(ctx, c, "eth_blockNumber", func() (int, error) { return 1, nil }); err != nil || v != 1 {
+		t.Fatalf("half-open trial: v=%d err=%v", v, err)
+	}
+	if !c.retrier.openUntil.IsZero() {
+		t.Fatalf("breaker still open after a successful trial")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.in, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q)=%v,%v want %v,%v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
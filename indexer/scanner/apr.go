@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/fixedpoint"
+	"github.com/gridex/indexer/pricing"
 )
 
 // runAPRUpdater starts a periodic timer that recalculates APR for all active grids.
@@ -56,10 +58,10 @@ func (s *Scanner) updateAllGridAPRs(ctx context.Context) error {
 
 	chainIndex := fmt.Sprintf("%d", s.cfg.ChainID)
 
-	// Build stablecoin lookup set (case-insensitive) from chain config
-	stablecoinSet := make(map[string]bool, len(s.cfg.Stablecoins))
-	for _, addr := range s.cfg.Stablecoins {
-		stablecoinSet[strings.ToLower(addr)] = true
+	// Quotable stablecoins are priced at $1
+	anchors, err := s.pricingAnchors(ctx)
+	if err != nil {
+		return fmt.Errorf("load pricing anchors: %w", err)
 	}
 
 	// Cache prices per token address to avoid redundant API calls
@@ -70,7 +72,7 @@ func (s *Scanner) updateAllGridAPRs(ctx context.Context) error {
 			return p, nil
 		}
 		// If the token is a stablecoin, use price = 1 directly
-		if stablecoinSet[strings.ToLower(tokenAddr)] {
+		if anchors[strings.ToLower(tokenAddr)] == pricing.TokenTypeStablecoin {
 			priceCache[tokenAddr] = "1"
 			return "1", nil
 		}
@@ -116,6 +118,7 @@ func (s *Scanner) updateAllGridAPRs(ctx context.Context) error {
 
 		// Calculate APR
 		aprTheoretical, aprReal, err := calculateAPR(
+			fixedpoint.Pair{Base: uint8(g.BaseDecimals), Quote: uint8(g.QuoteDecimals)},
 			g.InitialBaseAmount, g.InitialQuoteAmount,
 			g.InitBasePrice, g.InitQuotePrice,
 			amounts.BaseAmount, amounts.QuoteAmount,
@@ -168,9 +171,11 @@ func (s *Scanner) updateAllGridAPRs(ctx context.Context) error {
 }
 
 // calculateAPR computes both apr_theoretical and apr_real based on the formulas in apr.md.
-// All numeric string inputs are raw big number strings (no decimals).
+// Amounts, profits and order prices are raw big number strings, converted to human units
+// with the decimals of pair before they are valued at the USD prices.
 // Returns the APR values as string representations of the rate (e.g. "0.1523" for 15.23%).
 func calculateAPR(
+	pair fixedpoint.Pair,
 	initBaseAmount, initQuoteAmount string,
 	initBasePrice, initQuotePrice string,
 	currentBaseAmount, currentQuoteAmount string,
@@ -180,13 +185,13 @@ func calculateAPR(
 	createdAt time.Time,
 ) (aprTheoretical string, aprReal string, err error) {
 	// Parse all values as big.Float for precision
-	initBaseAmt, ok := new(big.Float).SetString(initBaseAmount)
-	if !ok {
-		return "", "", fmt.Errorf("invalid init_base_amount: %s", initBaseAmount)
+	initBaseAmt, err := fixedpoint.AmountFloat(initBaseAmount, pair.Base)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid init_base_amount: %w", err)
 	}
-	initQuoteAmt, ok := new(big.Float).SetString(initQuoteAmount)
-	if !ok {
-		return "", "", fmt.Errorf("invalid init_quote_amount: %s", initQuoteAmount)
+	initQuoteAmt, err := fixedpoint.AmountFloat(initQuoteAmount, pair.Quote)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid init_quote_amount: %w", err)
 	}
 	initBPrice, ok := new(big.Float).SetString(initBasePrice)
 	if !ok {
@@ -196,13 +201,13 @@ func calculateAPR(
 	if !ok {
 		return "", "", fmt.Errorf("invalid init_quote_price: %s", initQuotePrice)
 	}
-	curBaseAmt, ok := new(big.Float).SetString(currentBaseAmount)
-	if !ok {
-		return "", "", fmt.Errorf("invalid current_base_amount: %s", currentBaseAmount)
+	curBaseAmt, err := fixedpoint.AmountFloat(currentBaseAmount, pair.Base)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid current_base_amount: %w", err)
 	}
-	curQuoteAmt, ok := new(big.Float).SetString(currentQuoteAmount)
-	if !ok {
-		return "", "", fmt.Errorf("invalid current_quote_amount: %s", currentQuoteAmount)
+	curQuoteAmt, err := fixedpoint.AmountFloat(currentQuoteAmount, pair.Quote)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid current_quote_amount: %w", err)
 	}
 	curBPrice, ok := new(big.Float).SetString(currentBasePrice)
 	if !ok {
@@ -212,9 +217,9 @@ func calculateAPR(
 	if !ok {
 		return "", "", fmt.Errorf("invalid current_quote_price: %s", currentQuotePrice)
 	}
-	profit, ok := new(big.Float).SetString(gridProfit)
-	if !ok {
-		return "", "", fmt.Errorf("invalid grid_profit: %s", gridProfit)
+	profit, err := fixedpoint.AmountFloat(gridProfit, pair.Quote)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid grid_profit: %w", err)
 	}
 
 	// init_usd = init_base_amount * init_base_price + init_quote_amount * init_quote_price
@@ -265,12 +270,17 @@ func calculateAPR(
 	curPriceInQuote := new(big.Float).Quo(curBPrice, curQPrice)
 
 	for _, order := range orders {
-		orderPrice, ok := new(big.Float).SetString(order.Price)
-		if !ok {
+		orderPrice, err := pair.PriceFloat(order.Price)
+		if err != nil || orderPrice.Sign() <= 0 {
 			continue // skip invalid order
 		}
-		orderAmt, ok := new(big.Float).SetString(order.Amount)
-		if !ok {
+		// An ask's amount is in the base token, a bid's in the quote token.
+		amountDecimals := pair.Quote
+		if order.IsAsk {
+			amountDecimals = pair.Base
+		}
+		orderAmt, err := fixedpoint.AmountFloat(order.Amount, amountDecimals)
+		if err != nil {
 			continue
 		}
 
@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/gridex/indexer/db"
+)
+
+// backfillWindowsPerRound bounds how many windows one backfill call covers,
+// so the main loop regularly re-evaluates the head and the backfill distance.
+const backfillWindowsPerRound = 16
+
+// burstLimiter is implemented by clients with a shared request budget
+// (e.g. *rpc.RateLimitedClient).
+type burstLimiter interface {
+	Burst() int
+}
+
+// backfillWindow is one prefetched block range, ready to be committed.
+type backfillWindow struct {
+	from, to  uint64
+	addresses []common.Address // contracts the logs were fetched for
+	logs      []types.Log
+	blockRefs []db.BlockRef
+	err       error
+}
+
+// backfillWorkers returns the number of parallel fetchers to use, or 0 if
+// parallel backfill is disabled. It never exceeds the rate limiter's burst,
+// since extra workers would only wait on the shared limiter.
+func (s *Scanner) backfillWorkers() int {
+	workers := s.cfg.BackfillWorkers
+	if workers <= 1 {
+		return 0
+	}
+	if bl, ok := s.client.(burstLimiter); ok {
+		if burst := bl.Burst(); burst > 0 {
+			workers = min(workers, burst)
+		}
+	}
+	if workers <= 1 {
+		return 0
+	}
+	return workers
+}
+
+// backfillDistance is how far behind the safe block the scanner must be to
+// backfill in parallel. Closer to the head it switches to live mode, which
+// checks every batch for reorgs; backfill stays at least reorg_depth below.
+func (s *Scanner) backfillDistance(workers int) uint64 {
+	return max(uint64(workers)*s.batch.current(), s.cfg.ReorgDepth)
+}
+
+// backfill fetches [fromBlock, toBlock] in windows of the learned batch size
+// through a pool of workers, and commits the windows strictly in block order
+// through processLogs (strategyCache and order lookups depend on that order). At most
+// 2*workers windows are prefetched ahead of the commit. It returns the next
+// block to scan; on error that is the first uncommitted block.
+func (s *Scanner) backfill(ctx context.Context, fromBlock, toBlock uint64, workers int) (uint64, error) {
+	return s.backfillWindows(ctx, fromBlock, toBlock, workers, s.batch.current(), s.fetchBackfillWindow, s.commitBackfillWindow)
+}
+
+// backfillWindows runs backfill with windows of batch blocks, fetched by fetch
+// and committed by commit.
+func (s *Scanner) backfillWindows(ctx context.Context, fromBlock, toBlock uint64, workers int, batch uint64,
+	fetch func(ctx context.Context, fromBlock, toBlock uint64) backfillWindow,
+	commit func(ctx context.Context, w backfillWindow) error) (uint64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	windows := min((toBlock-fromBlock)/batch+1, uint64(workers*backfillWindowsPerRound))
+
+	s.logger.Info("backfilling blocks", "from", fromBlock, "to", min(fromBlock+windows*batch-1, toBlock), "workers", workers)
+
+	// queue preserves window order; its capacity bounds the prefetch.
+	queue := make(chan chan backfillWindow, 2*workers)
+	sem := make(chan struct{}, workers)
+
+	go func() {
+		defer close(queue)
+		for i := range windows {
+			from := fromBlock + i*batch
+			to := min(from+batch-1, toBlock)
+
+			result := make(chan backfillWindow, 1)
+			select {
+			case queue <- result:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				defer func() { <-sem }()
+				result <- fetch(ctx, from, to)
+			}()
+		}
+	}()
+
+	next := fromBlock
+	for result := range queue {
+		var w backfillWindow
+		select {
+		case w = <-result:
+		case <-ctx.Done():
+			return next, ctx.Err()
+		}
+		if w.err != nil {
+			return next, fmt.Errorf("fetch blocks %d-%d: %w", w.from, w.to, w.err)
+		}
+
+		if err := commit(ctx, w); err != nil {
+			return next, fmt.Errorf("process blocks %d-%d: %w", w.from, w.to, err)
+		}
+		next = w.to + 1
+	}
+	return next, nil
+}
+
+// commitBackfillWindow indexes the logs of a fetched window.
+func (s *Scanner) commitBackfillWindow(ctx context.Context, w backfillWindow) error {
+	if err := s.processLogs(ctx, w.logs, w.addresses, w.from, w.to, w.blockRefs); err != nil {
+		return err
+	}
+	s.logger.Info("processed blocks", "from", w.from, "to", w.to, "events", len(w.logs))
+
+	if s.ws != nil {
+		s.ws.prune(w.to)
+	}
+	return nil
+}
+
+// fetchBackfillWindow fetches the logs and end header for one window.
+func (s *Scanner) fetchBackfillWindow(ctx context.Context, fromBlock, toBlock uint64) backfillWindow {
+	w := backfillWindow{from: fromBlock, to: toBlock, addresses: s.contractAddresses()}
+
+	endHeader, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(toBlock))
+	if err != nil {
+		w.err = fmt.Errorf("fetch header %d: %w", toBlock, err)
+		return w
+	}
+
+	w.logs, w.err = s.fetchLogsAdaptive(ctx, fromBlock, toBlock)
+	if w.err != nil {
+		return w
+	}
+	if w.err = s.checkEndHeader(ctx, endHeader); w.err != nil {
+		return w
+	}
+	w.blockRefs, w.err = batchBlockRefs(nil, endHeader, w.logs)
+	if w.err != nil {
+		return w
+	}
+
+	// Warm the header cache here so processLogs finds every block time.
+	w.err = s.prefetchHeaders(ctx, w.logs)
+	return w
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxBatchElems bounds the size of one JSON-RPC batch request. Most providers
+// accept 100 or more; some reject larger batches outright.
+const maxBatchElems = 100
+
+// batchCall sends elems as JSON-RPC batch requests of at most maxBatchElems.
+// Per-element errors are left in elems[i].Error.
+func (s *Scanner) batchCall(ctx context.Context, elems []gethrpc.BatchElem) error {
+	for start := 0; start < len(elems); start += maxBatchElems {
+		chunk := elems[start:min(start+maxBatchElems, len(elems))]
+		if err := s.client.BatchCallContext(ctx, chunk); err != nil {
+			return fmt.Errorf("batch call: %w", err)
+		}
+	}
+	return nil
+}
+
+// isMethodUnsupportedErr reports whether the node rejected a method it does
+// not implement, as opposed to failing the call.
+func isMethodUnsupportedErr(err error) bool {
+	var rpcErr gethrpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "method not found") ||
+		strings.Contains(msg, "does not exist") ||
+		strings.Contains(msg, "not supported") ||
+		strings.Contains(msg, "unsupported method")
+}
+
+// fetchBlockReceipts returns every receipt of a block in one round trip with
+// eth_getBlockReceipts. Nodes without that method get the block and then all
+// of its receipts in one batch request.
+func (s *Scanner) fetchBlockReceipts(ctx context.Context, blockNum uint64) ([]*types.Receipt, error) {
+	if !s.blockReceiptsUnsupported.Load() {
+		var receipts []*types.Receipt
+		elems := []gethrpc.BatchElem{{
+			Method: "eth_getBlockReceipts",
+			Args:   []any{hexutil.EncodeUint64(blockNum)},
+			Result: &receipts,
+		}}
+		if err := s.batchCall(ctx, elems); err != nil {
+			return nil, err
+		}
+		switch err := elems[0].Error; {
+		case err == nil && receipts == nil:
+			return nil, fmt.Errorf("block %d not found", blockNum)
+		case err == nil:
+			return receipts, nil
+		case isMethodUnsupportedErr(err):
+			s.blockReceiptsUnsupported.Store(true)
+			s.logger.Info("eth_getBlockReceipts not supported, batching eth_getTransactionReceipt instead", "error", err)
+		default:
+			return nil, fmt.Errorf("eth_getBlockReceipts %d: %w", blockNum, err)
+		}
+	}
+
+	block, err := s.client.BlockByNumber(ctx, new(big.Int).SetUint64(blockNum))
+	if err != nil {
+		return nil, fmt.Errorf("fetch block %d: %w", blockNum, err)
+	}
+
+	txs := block.Transactions()
+	receipts := make([]*types.Receipt, len(txs))
+	elems := make([]gethrpc.BatchElem, len(txs))
+	for i, tx := range txs {
+		elems[i] = gethrpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []any{tx.Hash()},
+			Result: &receipts[i],
+		}
+	}
+	if err := s.batchCall(ctx, elems); err != nil {
+		return nil, err
+	}
+	for i, elem := range elems {
+		if elem.Error != nil {
+			return nil, fmt.Errorf("fetch receipt for tx %s in block %d: %w", txs[i].Hash().Hex(), blockNum, elem.Error)
+		}
+		if receipts[i] == nil {
+			return nil, fmt.Errorf("receipt for tx %s in block %d not found", txs[i].Hash().Hex(), blockNum)
+		}
+	}
+	return receipts, nil
+}
+
+// fetchHeaders returns the headers of the given blocks in one batch request.
+func (s *Scanner) fetchHeaders(ctx context.Context, numbers []uint64) (map[uint64]*types.Header, error) {
+	headers := make([]*types.Header, len(numbers))
+	elems := make([]gethrpc.BatchElem, len(numbers))
+	for i, n := range numbers {
+		elems[i] = gethrpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []any{hexutil.EncodeUint64(n), false},
+			Result: &headers[i],
+		}
+	}
+	if err := s.batchCall(ctx, elems); err != nil {
+		return nil, err
+	}
+
+	out := make(map[uint64]*types.Header, len(numbers))
+	for i, elem := range elems {
+		if elem.Error != nil {
+			return nil, fmt.Errorf("fetch header %d: %w", numbers[i], elem.Error)
+		}
+		if headers[i] == nil {
+			return nil, fmt.Errorf("header %d not found", numbers[i])
+		}
+		out[numbers[i]] = headers[i]
+	}
+	return out, nil
+}
+
+// receiptLogs returns the logs in receipts emitted by one of addrs.
+func receiptLogs(receipts []*types.Receipt, addrs map[common.Address]struct{}) []types.Log {
+	var out []types.Log
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			// Check address matches only — no topic filtering
+			if _, ok := addrs[log.Address]; ok {
+				out = append(out, *log)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package scanner
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gridex/indexer/metrics"
+)
+
+const (
+	// batchGrowAfter is the number of consecutive fast, full-size successes
+	// required before the window grows.
+	batchGrowAfter = 3
+	// minBatchSize is the smallest window the controller will shrink to.
+	minBatchSize = 1
+)
+
+// batchController learns the eth_getLogs window size the RPC provider
+// accepts. It shrinks the window when a range hits a limit or responds slowly,
+// and grows it again after consecutive fast successes. It is safe for
+// concurrent use by backfill workers. A nil controller is a fixed window of
+// minBatchSize blocks: its methods are safe to call and record nothing.
+type batchController struct {
+	chain  string
+	logger *slog.Logger
+	max    uint64
+	slow   time.Duration
+
+	mu     sync.Mutex
+	size   uint64
+	streak int
+	splits int64
+}
+
+func newBatchController(chain string, initial, maxSize uint64, slow time.Duration, logger *slog.Logger) *batchController {
+	maxSize = max(maxSize, minBatchSize)
+	c := &batchController{
+		chain:  chain,
+		logger: logger,
+		max:    maxSize,
+		slow:   slow,
+		size:   min(max(initial, minBatchSize), maxSize),
+	}
+	metrics.Set(metrics.BatchSize, chain, int64(c.size))
+	return c
+}
+
+// restore sets the window to a size learned in a previous run.
+func (c *batchController) restore(size uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = min(max(size, minBatchSize), c.max)
+	metrics.Set(metrics.BatchSize, c.chain, int64(c.size))
+}
+
+// current returns the window size to use for the next batch.
+func (c *batchController) current() uint64 {
+	if c == nil {
+		return minBatchSize
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// splitCount returns how many ranges have been split since startup.
+func (c *batchController) splitCount() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.splits
+}
+
+// observeLimitExceeded records that a range of n blocks exceeded the
+// provider's limits. The window is capped at half of that range.
+func (c *batchController) observeLimitExceeded(n uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.splits++
+	metrics.BatchSplits.Add(c.chain, 1)
+	c.streak = 0
+	c.resize(min(c.size, max(n/2, minBatchSize)), "limit exceeded")
+}
+
+// observeSuccess records a successful eth_getLogs call over n blocks.
+// Slow responses shrink the window; fast ones at full size grow it.
+func (c *batchController) observeSuccess(n uint64, took time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.slow > 0 && took > c.slow {
+		c.streak = 0
+		c.resize(max(c.size*3/4, minBatchSize), "slow response")
+		return
+	}
+
+	// Sub-ranges of a split batch say nothing about the full window.
+	if n < c.size {
+		return
+	}
+	c.streak++
+	if c.streak >= batchGrowAfter {
+		c.streak = 0
+		c.resize(min(c.size+max(c.size/4, 1), c.max), "consecutive successes")
+	}
+}
+
+// resize must be called with c.mu held.
+func (c *batchController) resize(size uint64, reason string) {
+	if size == c.size {
+		return
+	}
+	if size < c.size {
+		metrics.BatchShrinks.Add(c.chain, 1)
+	} else {
+		metrics.BatchGrows.Add(c.chain, 1)
+	}
+	c.logger.Info("adjusted block batch size", "from", c.size, "to", size, "reason", reason, "splits", c.splits)
+	c.size = size
+	metrics.Set(metrics.BatchSize, c.chain, int64(size))
+}
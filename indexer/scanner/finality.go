@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/gridex/indexer/config"
+)
+
+// finalityTagReprobeInterval is how long finality_mode falls back to
+// confirmations after the RPC rejected the block tag, before the tag is tried
+// again. Through an RPC pool the rejection may have come from one endpoint.
+const finalityTagReprobeInterval = 10 * time.Minute
+
+// isBlockTagUnsupportedErr reports whether an error from HeaderByNumber means
+// the node does not know the "safe"/"finalized" tags (pre-merge clients,
+// some L2 and BSC RPC providers), as opposed to a transient failure.
+// ethereum.NotFound and geth's "safe block not found"/"finalized block not
+// found" are transient: nodes return them until the first block is marked safe
+// or finalized, e.g. right after genesis or during a sync.
+func isBlockTagUnsupportedErr(err error) bool {
+	if err == nil || errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var rpcErr gethrpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32602 {
+		return true // invalid params
+	}
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "block not found") {
+		return false
+	}
+	return strings.Contains(msg, "not supported") ||
+		strings.Contains(msg, "unsupported") ||
+		strings.Contains(msg, "invalid block tag") ||
+		strings.Contains(msg, "invalid block number") ||
+		strings.Contains(msg, "hex string without 0x prefix") ||
+		strings.Contains(msg, "cannot unmarshal")
+}
+
+// confirmedBlock returns latestBlock minus the configured confirmation count.
+func (s *Scanner) confirmedBlock(latestBlock uint64) uint64 {
+	if latestBlock > s.cfg.Confirmations {
+		return latestBlock - s.cfg.Confirmations
+	}
+	return latestBlock
+}
+
+// resolveSafeBlock returns the highest block the scanner may index according
+// to the chain's finality_mode. For "safe" and "finalized" it reads the tagged
+// header from the node; if the node does not support the tag it logs and falls
+// back to the confirmation count for finalityTagReprobeInterval. If reading
+// the tag fails otherwise, the last tagged block read is kept, as the
+// confirmation count could reach past it.
+func (s *Scanner) resolveSafeBlock(ctx context.Context, latestBlock uint64) uint64 {
+	var tag gethrpc.BlockNumber
+	switch s.cfg.FinalityMode {
+	case config.FinalitySafe:
+		tag = gethrpc.SafeBlockNumber
+	case config.FinalityFinalized:
+		tag = gethrpc.FinalizedBlockNumber
+	default:
+		return s.confirmedBlock(latestBlock)
+	}
+
+	if time.Now().Before(s.finalityTagUnsupportedUntil) {
+		return s.confirmedBlock(latestBlock)
+	}
+
+	header, err := s.client.HeaderByNumber(ctx, big.NewInt(tag.Int64()))
+	if err != nil {
+		if isBlockTagUnsupportedErr(err) {
+			s.finalityTagUnsupportedUntil = time.Now().Add(finalityTagReprobeInterval)
+			s.logger.Warn("RPC does not support block tag, falling back to confirmations",
+				"finality_mode", s.cfg.FinalityMode,
+				"confirmations", s.cfg.Confirmations,
+				"retry_in", finalityTagReprobeInterval,
+				"error", err)
+			return s.confirmedBlock(latestBlock)
+		}
+		s.logger.Warn("failed to fetch tagged header, keeping the previous one",
+			"finality_mode", s.cfg.FinalityMode, "tagged_block", s.taggedBlock, "error", err)
+		return min(s.taggedBlock, latestBlock)
+	}
+
+	// The tagged block can never be ahead of the latest block we observed.
+	s.taggedBlock = max(s.taggedBlock, header.Number.Uint64())
+	return min(s.taggedBlock, latestBlock)
+}
@@ -5,91 +5,40 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
-	"time"
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/jackc/pgx/v5"
 
 	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/fixedpoint"
 	"github.com/gridex/indexer/kafka"
 )
 
-// handleLinearStrategyCreated processes a LinearStrategyCreated event from the strategy contract.
-// It caches price0 and gap per gridId for later use by handleGridOrderCreated.
-func (s *Scanner) handleLinearStrategyCreated(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeLinearStrategyCreated(log)
+// handleStrategyCreated processes the creation event of a strategy contract.
+// It caches the side's parameters per gridId for handleGridOrderCreated and
+// persists them in case that event is processed after a restart.
+func (s *Scanner) handleStrategyCreated(ctx context.Context, tx pgx.Tx, log types.Log, strat Strategy) ([]*kafka.Message, error) {
+	event, err := strat.DecodeCreated(log)
 	if err != nil {
-		return nil, fmt.Errorf("decode LinearStrategyCreated: %w", err)
+		return nil, err
 	}
 
-	gridIDStr := event.GridID.String()
-
-	s.logger.Info("LinearStrategyCreated",
-		"grid_id", gridIDStr,
+	s.logger.Info("StrategyCreated",
+		"strategy", strat.Type(),
+		"grid_id", event.GridID,
 		"is_ask", event.IsAsk,
-		"price0", event.Price0.String(),
-		"gap", event.Gap.String(),
+		"price0", event.Params.Price0.String(),
+		"gap", bigString(event.Params.Gap),
+		"ratio", bigString(event.Params.Ratio),
 	)
 
-	// Cache the strategy info keyed by gridIdStr + isAsk.
 	// Ask and bid orders can have different strategies.
-	key := gridIDStr + "_ask"
-	if !event.IsAsk {
-		key = gridIDStr + "_bid"
-	}
-	info := &strategyInfo{
-		AskStrategy: StrategyTypeLinear,
-		AskPrice0:   event.Price0,
-		AskGap:      event.Gap,
-	}
-	if !event.IsAsk {
-		info = &strategyInfo{
-			BidStrategy: StrategyTypeLinear,
-			BidPrice0:   event.Price0,
-			BidGap:      event.Gap,
-		}
-	}
-	s.strategyCache[key] = info
-
-	return nil, nil
-}
-
-// handleGeometryStrategyCreated processes a GeometryStrategyCreated event from the geometry strategy contract.
-// It caches price0 and ratio per gridId for later use by handleGridOrderCreated.
-func (s *Scanner) handleGeometryStrategyCreated(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeGeometryStrategyCreated(log)
-	if err != nil {
-		return nil, fmt.Errorf("decode GeometryStrategyCreated: %w", err)
-	}
-
-	gridIDStr := event.GridID.String()
-
-	s.logger.Info("GeometryStrategyCreated",
-		"grid_id", gridIDStr,
-		"is_ask", event.IsAsk,
-		"price0", event.Price0.String(),
-		"ratio", event.Ratio.String(),
-	)
+	s.strategyCache[strategyCacheKey(event.GridID, event.IsAsk)] = &gridSide{strategy: strat, addr: log.Address, params: event.Params}
 
-	// Cache the strategy info keyed by gridIdStr + isAsk.
-	// Ask and bid orders can have different strategies.
-	key := gridIDStr + "_ask"
-	if !event.IsAsk {
-		key = gridIDStr + "_bid"
-	}
-	info := &strategyInfo{
-		AskStrategy: StrategyTypeGeometry,
-		AskPrice0:   event.Price0,
-		AskRatio:    event.Ratio,
-	}
-	if !event.IsAsk {
-		info = &strategyInfo{
-			BidStrategy: StrategyTypeGeometry,
-			BidPrice0:   event.Price0,
-			BidRatio:    event.Ratio,
-		}
+	row := strategyParamsRow(event.GridID, event.IsAsk, strat, log.Address, event.Params)
+	if err := db.UpsertGridStrategyParams(ctx, tx, s.cfg.ChainID, row, log.BlockNumber); err != nil {
+		return nil, err
 	}
-	s.strategyCache[key] = info
 
 	return nil, nil
 }
@@ -107,6 +56,10 @@ func (s *Scanner) handlePairCreated(ctx context.Context, tx pgx.Tx, log types.Lo
 		"quote", event.Quote.Hex(),
 	)
 
+	if err := s.checkPairOrientation(ctx, tx, event.PairID, event.Base, event.Quote); err != nil {
+		return nil, err
+	}
+
 	// Fetch token info for both base and quote
 	baseInfo, err := s.getOrFetchToken(ctx, tx, event.Base, log.BlockNumber)
 	if err != nil {
@@ -136,7 +89,10 @@ func (s *Scanner) handlePairCreated(ctx context.Context, tx pgx.Tx, log types.Lo
 	}
 
 	// Build Kafka message
-	msg := s.makeBaseMsg(log, kafka.EventPairCreated)
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventPairCreated)
+	if err != nil {
+		return nil, err
+	}
 	msg.Data = &kafka.PairCreatedData{
 		PairID:       int(event.PairID),
 		BaseAddress:  strings.ToLower(event.Base.Hex()),
@@ -150,57 +106,25 @@ func (s *Scanner) handlePairCreated(ctx context.Context, tx pgx.Tx, log types.Lo
 
 // handleGridOrderCreated processes a GridOrderCreated event.
 func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeGridOrderCreated(log)
+	event, err := s.decoderAt(log).DecodeGridOrderCreated(log)
 	if err != nil {
 		return nil, fmt.Errorf("decode GridOrderCreated: %w", err)
 	}
 
 	gridID := int64(event.GridID)
-	gridIDStr := fmt.Sprintf("%d", event.GridID)
-
-	// Consume cached strategy data (if any).
-	// The strategy events fire before GridOrderCreated in the same tx.
-	// Ask and bid strategies are cached separately with keys: gridIdStr + "_ask" / gridIdStr + "_bid"
-	askStratInfo, askOk := s.strategyCache[gridIDStr+"_ask"]
-	bidStratInfo, bidOk := s.strategyCache[gridIDStr+"_bid"]
-	if !askOk && !bidOk {
-		s.logger.Error("not found strategy for grid", "grid_id", gridID)
-		return nil, fmt.Errorf("not found strategy for grid")
-	}
-
-	var askStrategy, bidStrategy string
-	var askPrice0, askGap, bidPrice0, bidGap string
-	var askRatio, bidRatio string
-	var bidPrice0Int, bidGapInt *big.Int // kept as *big.Int for initialQuoteAmount calculation
-	if askStratInfo != nil {
-		askStrategy = string(askStratInfo.AskStrategy)
-		if askStratInfo.AskPrice0 != nil {
-			askPrice0 = askStratInfo.AskPrice0.String()
-		}
-		if askStratInfo.AskGap != nil {
-			askGap = askStratInfo.AskGap.String()
-		}
-		if askStratInfo.AskRatio != nil {
-			askRatio = askStratInfo.AskRatio.String()
-		}
-	}
-	if bidStratInfo != nil {
-		bidStrategy = string(bidStratInfo.BidStrategy)
-		if bidStratInfo.BidPrice0 != nil {
-			bidPrice0 = bidStratInfo.BidPrice0.String()
-			bidPrice0Int = new(big.Int).Set(bidStratInfo.BidPrice0)
-		}
-		if bidStratInfo.BidGap != nil {
-			bidGap = bidStratInfo.BidGap.String()
-			bidGapInt = new(big.Int).Set(bidStratInfo.BidGap)
-		}
-		if bidStratInfo.BidRatio != nil {
-			bidRatio = bidStratInfo.BidRatio.String()
-		}
+
+	// Strategy parameters of both sides. The strategy events fire before
+	// GridOrderCreated in the same tx; see loadGridStrategies for the fallbacks.
+	ask, bid, err := s.loadGridStrategies(ctx, tx, event, log.BlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("load strategy for grid %d: %w", gridID, err)
 	}
 	// Remove from cache after consumption
-	delete(s.strategyCache, gridIDStr+"_ask")
-	delete(s.strategyCache, gridIDStr+"_bid")
+	delete(s.strategyCache, strategyCacheKey(event.GridID, true))
+	delete(s.strategyCache, strategyCacheKey(event.GridID, false))
+
+	askStrategy, askPrice0, askGap, askRatio := ask.columns()
+	bidStrategy, bidPrice0, bidGap, bidRatio := bid.columns()
 
 	s.logger.Info("consumed strategy cache",
 		"grid_id", gridID,
@@ -215,23 +139,22 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 	)
 
 	// Get pair tokens from chain to populate base_token and quote_token
-	baseAddr, quoteAddr, err := s.caller.GetPairTokens(ctx, event.PairID)
+	baseAddr, quoteAddr, err := s.getOrFetchPairTokens(ctx, event.PairID)
 	if err != nil {
 		return nil, fmt.Errorf("get pair tokens: %w", err)
 	}
 
-	baseInfo, err := s.getOrFetchToken(ctx, tx, baseAddr, log.BlockNumber)
-	if err != nil {
-		return nil, fmt.Errorf("fetch base token: %w", err)
-	}
-	quoteInfo, err := s.getOrFetchToken(ctx, tx, quoteAddr, log.BlockNumber)
+	// Both tokens' metadata in a single multicall when neither is cached
+	tokens, err := s.getOrFetchTokens(ctx, tx, log.BlockNumber, baseAddr, quoteAddr)
 	if err != nil {
-		return nil, fmt.Errorf("fetch quote token: %w", err)
+		return nil, fmt.Errorf("fetch pair tokens: %w", err)
 	}
+	baseInfo, quoteInfo := tokens[0], tokens[1]
 
-	// Fetch init_price from OKX DEX Aggregator Quote API
+	// Fetch init_price from OKX DEX Aggregator Quote API. The provisional
+	// pass rolls the grid row back, so it skips the HTTP calls.
 	initPrice := ""
-	if s.okxPriceClient != nil {
+	if s.okxPriceClient != nil && !s.provisional {
 		initPrice, err = s.okxPriceClient.GetPairPrice(ctx, s.cfg.ChainID,
 			strings.ToLower(baseAddr.Hex()), strings.ToLower(quoteAddr.Hex()),
 			baseInfo.Decimals, quoteInfo.Decimals)
@@ -255,7 +178,7 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 	chainIndex := fmt.Sprintf("%d", s.cfg.ChainID)
 	initBasePrice := ""
 	initQuotePrice := ""
-	if s.okxPriceClient != nil {
+	if s.okxPriceClient != nil && !s.provisional {
 		initBasePrice, err = s.okxPriceClient.GetTokenPrice(ctx, chainIndex, strings.ToLower(baseAddr.Hex()))
 		if err != nil {
 			s.logger.Warn("failed to fetch init_base_price from OKX",
@@ -279,36 +202,40 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 	}
 
 	// Calculate initialBaseAmount and initialQuoteAmount per Lens.sol calcGridAmount logic.
-	// For Linear strategy: price_i = bidPrice0 + bidGap * i (bidGap is int256, negative for bids)
-	// For Geometry strategy: price_i = bidPrice0 * (bidRatio / RATIO_MULTIPLIER)^i
-	// quoteAmt_i = floor(baseAmt * price_i / PRICE_MULTIPLIER)
 	// initialBaseAmount = baseAmt * askCount
+	// initialQuoteAmount = sum of floor(baseAmt * price_i / PRICE_MULTIPLIER) over the bids,
+	// with price_i given by the bid side's strategy.
 	//
-	// IMPORTANT: The contract's calcQuoteAmount uses PRICE_MULTIPLIER = 10^36, which assumes
-	// base and quote tokens have the same decimals. When they differ, we need to adjust:
-	// quoteAmount *= 10^(quoteDecimals - baseDecimals)
-	if bidPrice0Int == nil {
-		bidPrice0Int = new(big.Int)
-	}
-	if bidGapInt == nil {
-		bidGapInt = new(big.Int)
+	// Prices are raw quote units per raw base unit times 10^36, so these are raw token
+	// amounts for any pair, matching the contract; decimals only matter for the
+	// normalized values (see package fixedpoint).
+	pair := fixedpoint.Pair{Base: baseInfo.Decimals, Quote: quoteInfo.Decimals}
+	initBase, initQuote := new(big.Int), new(big.Int)
+	if ask != nil {
+		initBase = ask.strategy.InitialAmount(ask.params, true, event.Amount, event.Asks)
+	}
+	if bid != nil {
+		initQuote = bid.strategy.InitialAmount(bid.params, false, event.Amount, event.Bids)
+	}
+
+	// With price_source verify or onchain, every order's prices are also read
+	// from the strategy contracts; in onchain mode the bids' quote amounts
+	// follow from those.
+	askPrices, bidPrices, err := s.fetchOrderPrices(ctx, log, event, ask, bid)
+	if err != nil {
+		return nil, fmt.Errorf("grid %d: %w", gridID, err)
 	}
-	var bidRatioInt *big.Int
-	if bidStratInfo != nil && bidStratInfo.BidRatio != nil {
-		bidRatioInt = new(big.Int).Set(bidStratInfo.BidRatio)
+	if s.usesOnchainPrices() && bid != nil {
+		initQuote = new(big.Int)
+		for _, p := range bidPrices {
+			initQuote.Add(initQuote, calcQuoteAmount(event.Amount, p.price))
+		}
 	}
-	initBase, initQuote := calcInitialAmounts(event.Amount, bidPrice0Int, bidGapInt, bidRatioInt, StrategyType(bidStrategy), uint32(event.Asks), uint32(event.Bids))
-
-	// Adjust for decimal difference between base and quote tokens
-	// The contract's PRICE_MULTIPLIER doesn't account for different token decimals
-	// if quoteInfo.Decimals > baseInfo.Decimals {
-	// 	decimalDiff := quoteInfo.Decimals - baseInfo.Decimals
-	// 	adjustment := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimalDiff)), nil)
-	// 	initQuote.Mul(initQuote, adjustment)
-	// }
 
 	initialBaseAmountStr := initBase.String()
 	initialQuoteAmountStr := initQuote.String()
+	initialBaseNormalized := fixedpoint.Amount(initBase, pair.Base)
+	initialQuoteNormalized := fixedpoint.Amount(initQuote, pair.Quote)
 
 	s.logger.Info("GridOrderCreated",
 		"grid_id", gridID,
@@ -318,6 +245,8 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 		"bids", event.Bids,
 		"initial_base_amount", initialBaseAmountStr,
 		"initial_quote_amount", initialQuoteAmountStr,
+		"initial_base_amount_normalized", initialBaseNormalized,
+		"initial_quote_amount_normalized", initialQuoteNormalized,
 	)
 
 	// Insert grid with strategy data
@@ -332,6 +261,7 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 		askRatio, bidRatio,
 		initPrice,
 		initBasePrice, initQuotePrice,
+		int(pair.Base), int(pair.Quote), initialBaseNormalized, initialQuoteNormalized,
 		log.BlockNumber); err != nil {
 		return nil, err
 	}
@@ -344,7 +274,10 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 	var msgs []*kafka.Message
 
 	// Grid created message
-	gridMsg := s.makeBaseMsg(log, kafka.EventGridCreated)
+	gridMsg, err := s.makeBaseMsg(ctx, log, kafka.EventGridCreated)
+	if err != nil {
+		return nil, err
+	}
 	gridMsg.Data = &kafka.GridCreatedData{
 		GridID:             gridID,
 		Owner:              strings.ToLower(event.Owner.Hex()),
@@ -362,37 +295,39 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 		AskGap:             askGap,
 		BidPrice0:          bidPrice0,
 		BidGap:             bidGap,
+
+		BaseDecimals:                 int(pair.Base),
+		QuoteDecimals:                int(pair.Quote),
+		InitialBaseAmountNormalized:  initialBaseNormalized,
+		InitialQuoteAmountNormalized: initialQuoteNormalized,
 	}
 	msgs = append(msgs, gridMsg)
 
 	// Compute and insert individual orders from strategy parameters (no contract calls).
-	// Order ID encoding: gridOrderId = (gridId << 16) | orderId
-	// Ask orders: orderId starts from ASK_ORDER_START_ID (0x8000 = 32768)
-	// Bid orders: orderId starts from 0
-	const AskOrderStartID = uint16(0x8000) // 32768
+	// The order ID encoding depends on the contract version, see contracts.Version:
+	// v2: gridOrderId = (gridId << 16) | orderId, ask orderIds start from 0x8000
+	// v1: gridOrderId = (gridId << 128) | orderId, ask orderIds carry 1 << 127
+	// Bid orderIds start from 0 in both.
+	version := s.decoderAt(log).Version()
 
-	// Ask orders: 0x8000, 0x8001, ..., 0x8000 + asks - 1
 	for i := uint32(0); i < event.Asks; i++ {
-		orderID := AskOrderStartID + uint16(i)
-		gridOrderID := toGridOrderIDV2(event.GridID, orderID)
+		gridOrderID := version.GridOrderID(event.GridID, version.OrderID(true, i))
 
 		orderMsgs, err := s.computeAndInsertOrder(ctx, tx, log, gridOrderID, gridID,
 			int(event.PairID), true, event.Compound, event.Oneshot, int(event.Fee),
-			event.Amount, askStratInfo, i)
+			event.Amount, pair, ask, i, priceAt(askPrices, i))
 		if err != nil {
 			return nil, fmt.Errorf("insert ask order %d: %w", i, err)
 		}
 		msgs = append(msgs, orderMsgs...)
 	}
 
-	// Bid orders: 0, 1, ..., bids - 1
 	for i := uint32(0); i < event.Bids; i++ {
-		orderID := uint16(i)
-		gridOrderID := toGridOrderIDV2(event.GridID, orderID)
+		gridOrderID := version.GridOrderID(event.GridID, version.OrderID(false, i))
 
 		orderMsgs, err := s.computeAndInsertOrder(ctx, tx, log, gridOrderID, gridID,
 			int(event.PairID), false, event.Compound, event.Oneshot, int(event.Fee),
-			event.Amount, bidStratInfo, i)
+			event.Amount, pair, bid, i, priceAt(bidPrices, i))
 		if err != nil {
 			return nil, fmt.Errorf("insert bid order %d: %w", i, err)
 		}
@@ -402,123 +337,71 @@ func (s *Scanner) handleGridOrderCreated(ctx context.Context, tx pgx.Tx, log typ
 	return msgs, nil
 }
 
-// computeAndInsertOrder calculates order properties from strategy parameters
-// (price0, gap/ratio, orderIndex) and inserts the order into the DB.
+// computeAndInsertOrder calculates order properties from the side's strategy
+// parameters and orderIndex, and inserts the order into the DB.
 // This avoids calling the contract's GetGridOrder method.
 //
-// For a linear grid strategy:
-//   - Ask order i: price = askPrice0 + askGap * i, amount = baseAmt
-//   - Bid order i: price = bidPrice0 + bidGap * i, amount = calcQuoteAmount(baseAmt, price)
-//   - revPrice is the corresponding price on the opposite side at the same index
+//   - price = side.strategy.Price(params, i); revPrice is the price the order flips to
+//   - Ask order amount = baseAmt (base token)
+//   - Bid order amount = calcQuoteAmount(baseAmt, price) (quote token)
 //   - revAmount is 0 for newly created orders
 //
-// For a geometry grid strategy:
-//   - Ask order i: price = askPrice0 * (askRatio / RATIO_MULTIPLIER)^i, amount = baseAmt
-//   - Bid order i: price = bidPrice0 * (bidRatio / RATIO_MULTIPLIER)^i, amount = calcQuoteAmount(baseAmt, price)
-//   - revPrice is the corresponding price on the opposite side at the same index
-//   - revAmount is 0 for newly created orders
+// pair gives the decimals for the normalized amount and prices.
+//
+// onchain holds the prices the strategy contract returns for the order, if
+// they were read; see checkOrderPrice.
 func (s *Scanner) computeAndInsertOrder(ctx context.Context, tx pgx.Tx, log types.Log,
-	gridOrderID uint64, gridID int64, pairID int, isAsk, compound, oneshot bool,
-	fee int, baseAmt *big.Int, strat *linearStrategyInfo, orderIndex uint32,
+	gridOrderID *big.Int, gridID int64, pairID int, isAsk, compound, oneshot bool,
+	fee int, baseAmt *big.Int, pair fixedpoint.Pair, side *gridSide, orderIndex uint32, onchain *orderPrice,
 ) ([]*kafka.Message, error) {
+	if side == nil {
+		return nil, fmt.Errorf("no strategy for side (ask=%v)", isAsk)
+	}
+
+	orderIDStr := gridOrderID.String()
 
 	var (
-		price, revPrice, amount               *big.Int
+		amount                                *big.Int
 		initialBaseAmount, initialQuoteAmount string
 	)
 	revAmount := big.NewInt(0)
+	price := side.strategy.Price(side.params, orderIndex)
+	prices, err := s.checkOrderPrice(ctx, tx, log, gridID, orderIDStr, isAsk, side,
+		orderPrice{price: price, revPrice: side.strategy.ReversePrice(side.params, price)}, onchain)
+	if err != nil {
+		return nil, err
+	}
+	price, revPrice := prices.price, prices.revPrice
 
-	// Calculate decimal adjustment factor for quote amount calculation
-	// The contract's PRICE_MULTIPLIER doesn't account for different token decimals
-	// var decimalAdjustment *big.Int
-	// if quoteDecimals > baseDecimals {
-	// 	decimalAdjustment = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(quoteDecimals-baseDecimals)), nil)
-	// } else {
-	// 	decimalAdjustment = big.NewInt(1)
-	// }
-
+	// Amounts are raw units of the order's token, like on chain.
+	var amountNormalized string
 	if isAsk {
-		// Determine strategy type for ask orders
-		askStrategy := strat.AskStrategy
-		askPrice0 := strat.AskPrice0
-		if askPrice0 == nil {
-			panic("askPrice0 is nil")
-		}
-
-		if askStrategy == StrategyTypeGeometry {
-			if strat.AskRatio == nil {
-				panic("askRatio is nil")
-			}
-			// Geometry strategy: price = askPrice0 * (askRatio / RATIO_MULTIPLIER)^i
-			price = calcGeometryPrice(askPrice0, strat.AskRatio, orderIndex)
-			// revPrice for ask = price * RATIO_MULTIPLIER / askRatio (the price when order flips to bid)
-			revPrice = new(big.Int).Mul(price, ratioMultiplier)
-			revPrice.Div(revPrice, strat.AskRatio)
-		} else {
-			// Linear strategy: price = askPrice0 + askGap * i
-			askGap := strat.AskGap
-			if askGap == nil {
-				askGap = new(big.Int)
-			}
-			idx := big.NewInt(int64(orderIndex))
-			price = new(big.Int).Add(askPrice0, new(big.Int).Mul(askGap, idx))
-			// revPrice for ask = price - askGap (the price when order flips to bid)
-			revPrice = new(big.Int).Sub(price, askGap)
-		}
-
-		// Ask order amount = baseAmt (base token)
 		amount = new(big.Int).Set(baseAmt)
 		initialBaseAmount = amount.String()
 		initialQuoteAmount = "0"
+		amountNormalized = fixedpoint.Amount(amount, pair.Base)
 	} else {
-		// Determine strategy type for bid orders
-		bidStrategy := strat.BidStrategy
-		bidPrice0 := strat.BidPrice0
-		if bidPrice0 == nil {
-			panic("bidPrice9 is nil")
-		}
-
-		if bidStrategy == StrategyTypeGeometry {
-			if strat.BidRatio == nil {
-				panic("bidRatio is nil")
-			}
-			// Geometry strategy: price = bidPrice0 * (bidRatio / RATIO_MULTIPLIER)^i
-			price = calcGeometryPrice(bidPrice0, strat.BidRatio, orderIndex)
-			// revPrice for bid = price * RATIO_MULTIPLIER / bidRatio (the price when order flips to ask)
-			revPrice = new(big.Int).Mul(price, ratioMultiplier)
-			revPrice.Div(revPrice, strat.BidRatio)
-		} else {
-			// Linear strategy: price = bidPrice0 + bidGap * i
-			bidGap := strat.BidGap
-			if bidGap == nil {
-				panic("bidGap is nil")
-			}
-			idx := big.NewInt(int64(orderIndex))
-			price = new(big.Int).Add(bidPrice0, new(big.Int).Mul(bidGap, idx))
-			// revPrice for bid = price + bidGap (the price when order flips to ask), bidGap is negative
-			revPrice = new(big.Int).Sub(price, bidGap)
-		}
-
-		// Bid order amount = calcQuoteAmount(baseAmt, price) (quote token)
-		// Apply decimal adjustment for tokens with different decimals
 		amount = calcQuoteAmount(baseAmt, price)
-		// amount.Mul(amount, decimalAdjustment)
 		initialBaseAmount = "0"
 		initialQuoteAmount = amount.String()
+		amountNormalized = fixedpoint.Amount(amount, pair.Quote)
 	}
-
-	orderIDStr := fmt.Sprintf("%d", gridOrderID)
+	priceNormalized, revPriceNormalized := pair.Price(price), pair.Price(revPrice)
 
 	if err := db.InsertOrder(ctx, tx, s.cfg.ChainID, orderIDStr, gridID, pairID,
 		isAsk, compound, oneshot, fee,
 		amount.String(), revAmount.String(),
 		initialBaseAmount, initialQuoteAmount,
 		price.String(), revPrice.String(),
+		priceNormalized, revPriceNormalized,
 		log.BlockNumber); err != nil {
 		return nil, err
 	}
 
-	msg := s.makeBaseMsg(log, kafka.EventOrderCreated)
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventOrderCreated)
+	if err != nil {
+		return nil, err
+	}
 	msg.Data = &kafka.OrderCreatedData{
 		OrderID:            orderIDStr,
 		GridID:             gridID,
@@ -530,6 +413,10 @@ func (s *Scanner) computeAndInsertOrder(ctx context.Context, tx pgx.Tx, log type
 		RevPrice:           revPrice.String(),
 		InitialBaseAmount:  initialBaseAmount,
 		InitialQuoteAmount: initialQuoteAmount,
+
+		AmountNormalized:   amountNormalized,
+		PriceNormalized:    priceNormalized,
+		RevPriceNormalized: revPriceNormalized,
 	}
 
 	return []*kafka.Message{msg}, nil
@@ -537,17 +424,18 @@ func (s *Scanner) computeAndInsertOrder(ctx context.Context, tx pgx.Tx, log type
 
 // handleFilledOrder processes a FilledOrder event.
 func (s *Scanner) handleFilledOrder(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeFilledOrder(log)
+	decoder := s.decoderAt(log)
+	event, err := decoder.DecodeFilledOrder(log)
 	if err != nil {
 		return nil, fmt.Errorf("decode FilledOrder: %w", err)
 	}
 
-	// In v2, orderId is uint64 and we need to look up grid_id from the orders table
-	orderIDStr := fmt.Sprintf("%d", event.OrderID)
+	orderIDStr := event.OrderID.String()
 
-	// Extract gridID from orderID directly: gridOrderId = (gridId << 16) | orderId
-	// gridId is the upper 48 bits, orderId is the lower 16 bits
-	gridID := int64(event.OrderID >> 16)
+	// Extract gridID from the gridOrderId directly, e.g. in v2
+	// gridOrderId = (gridId << 16) | orderId
+	rawGridID, _ := decoder.Version().SplitGridOrderID(event.OrderID)
+	gridID := int64(rawGridID)
 
 	// Get order info from database
 	orderInfo, err := db.GetOrderInfo(ctx, tx, s.cfg.ChainID, orderIDStr)
@@ -599,15 +487,23 @@ func (s *Scanner) handleFilledOrder(ctx context.Context, tx pgx.Tx, log types.Lo
 		gridProfit = calcGridProfit(priceGap, event.BaseAmt)
 	}
 
-	// Get block timestamp
-	block, err := s.client.BlockByNumber(ctx, new(big.Int).SetUint64(log.BlockNumber))
-	if err != nil {
-		// Fallback to current time if block fetch fails
-		s.logger.Warn("failed to get block timestamp, using current time", "error", err)
+	// Split orderFee between the grid and the protocol.
+	// oneshot orders contribute the share the oneshot protocol fee in effect leaves.
+	// non-oneshot, non-compound orders contribute 75% of orderFee.
+	var oneshotFeeBps uint32
+	if orderInfo.Oneshot {
+		oneshotFeeBps, err = s.oneshotProtocolFeeBps(ctx, tx, log)
+		if err != nil {
+			return nil, err
+		}
 	}
-	var ts = time.Now().UTC()
-	if block != nil {
-		ts = time.Unix(int64(block.Time()), 0).UTC()
+	feeShare := calcGridFeeShare(orderFee, orderInfo.Oneshot, orderInfo.Compound, oneshotFeeBps)
+	protocolFee := calcProtocolFee(event.QuoteVol, strategyInfo.Fee, orderFee, feeShare, orderInfo.Oneshot)
+
+	// Block timestamp, from the headers prefetched for the batch
+	ts, err := s.blockTime(ctx, log)
+	if err != nil {
+		return nil, err
 	}
 
 	// Insert order fill with new fields
@@ -615,7 +511,7 @@ func (s *Scanner) handleFilledOrder(ctx context.Context, tx pgx.Tx, log types.Lo
 		log.TxHash.Hex(), strings.ToLower(event.Taker.Hex()),
 		orderIDStr, event.BaseAmt.String(), event.QuoteVol.String(),
 		event.IsAsk, pairID, ts,
-		gridID, quoteAddress, priceGap, gridProfit, orderFee, isReverse,
+		gridID, quoteAddress, priceGap, gridProfit, orderFee, protocolFee, isReverse,
 		log.BlockNumber); err != nil {
 		return nil, err
 	}
@@ -628,9 +524,6 @@ func (s *Scanner) handleFilledOrder(ctx context.Context, tx pgx.Tx, log types.Lo
 	}
 
 	// Update grid's total_profit using gridProfit plus the grid's fee share.
-	// oneshot orders contribute 25% of orderFee.
-	// non-oneshot, non-compound orders contribute 75% of orderFee.
-	feeShare := calcGridFeeShare(orderFee, orderInfo.Oneshot, orderInfo.Compound)
 	totalProfitAdd := addBigStrings(gridProfit, feeShare)
 	if totalProfitAdd != "0" {
 		if err := db.UpdateGridProfits(ctx, tx, s.cfg.ChainID, gridID, totalProfitAdd, log.BlockNumber); err != nil {
@@ -641,7 +534,10 @@ func (s *Scanner) handleFilledOrder(ctx context.Context, tx pgx.Tx, log types.Lo
 		}
 	}
 
-	msg := s.makeBaseMsg(log, kafka.EventOrderFilled)
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventOrderFilled)
+	if err != nil {
+		return nil, err
+	}
 	msg.Data = &kafka.OrderFilledData{
 		OrderID:     orderIDStr,
 		GridID:      gridID,
@@ -658,13 +554,13 @@ func (s *Scanner) handleFilledOrder(ctx context.Context, tx pgx.Tx, log types.Lo
 
 // handleCancelGridOrder processes a CancelGridOrder event.
 func (s *Scanner) handleCancelGridOrder(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeCancelGridOrder(log)
+	event, err := s.decoderAt(log).DecodeCancelGridOrder(log)
 	if err != nil {
 		return nil, fmt.Errorf("decode CancelGridOrder: %w", err)
 	}
 
 	gridID := int64(event.GridID)
-	orderIDStr := fmt.Sprintf("%d", event.OrderID)
+	orderIDStr := event.OrderID.String()
 
 	s.logger.Info("CancelGridOrder",
 		"owner", event.Owner.Hex(),
@@ -676,7 +572,10 @@ func (s *Scanner) handleCancelGridOrder(ctx context.Context, tx pgx.Tx, log type
 		return nil, err
 	}
 
-	msg := s.makeBaseMsg(log, kafka.EventOrderCancelled)
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventOrderCancelled)
+	if err != nil {
+		return nil, err
+	}
 	msg.Data = &kafka.OrderCancelledData{
 		OrderID: orderIDStr,
 		GridID:  gridID,
@@ -688,7 +587,7 @@ func (s *Scanner) handleCancelGridOrder(ctx context.Context, tx pgx.Tx, log type
 
 // handleCancelWholeGrid processes a CancelWholeGrid event.
 func (s *Scanner) handleCancelWholeGrid(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeCancelWholeGrid(log)
+	event, err := s.decoderAt(log).DecodeCancelWholeGrid(log)
 	if err != nil {
 		return nil, fmt.Errorf("decode CancelWholeGrid: %w", err)
 	}
@@ -714,7 +613,10 @@ func (s *Scanner) handleCancelWholeGrid(ctx context.Context, tx pgx.Tx, log type
 		return nil, err
 	}
 
-	msg := s.makeBaseMsg(log, kafka.EventGridCancelled)
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventGridCancelled)
+	if err != nil {
+		return nil, err
+	}
 	msg.Data = &kafka.GridCancelledData{
 		GridID: gridID,
 		Owner:  strings.ToLower(event.Owner.Hex()),
@@ -725,7 +627,7 @@ func (s *Scanner) handleCancelWholeGrid(ctx context.Context, tx pgx.Tx, log type
 
 // handleGridFeeChanged processes a GridFeeChanged event.
 func (s *Scanner) handleGridFeeChanged(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeGridFeeChanged(log)
+	event, err := s.decoderAt(log).DecodeGridFeeChanged(log)
 	if err != nil {
 		return nil, fmt.Errorf("decode GridFeeChanged: %w", err)
 	}
@@ -738,7 +640,10 @@ func (s *Scanner) handleGridFeeChanged(ctx context.Context, tx pgx.Tx, log types
 		return nil, err
 	}
 
-	msg := s.makeBaseMsg(log, kafka.EventGridFeeChanged)
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventGridFeeChanged)
+	if err != nil {
+		return nil, err
+	}
 	msg.Data = &kafka.GridFeeChangedData{
 		GridID: gridID,
 		Fee:    int(event.Fee),
@@ -749,7 +654,7 @@ func (s *Scanner) handleGridFeeChanged(ctx context.Context, tx pgx.Tx, log types
 
 // handleWithdrawProfit processes a WithdrawProfit event.
 func (s *Scanner) handleWithdrawProfit(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
-	event, err := s.decoder.DecodeWithdrawProfit(log)
+	event, err := s.decoderAt(log).DecodeWithdrawProfit(log)
 	if err != nil {
 		return nil, fmt.Errorf("decode WithdrawProfit: %w", err)
 	}
@@ -767,7 +672,10 @@ func (s *Scanner) handleWithdrawProfit(ctx context.Context, tx pgx.Tx, log types
 		return nil, err
 	}
 
-	msg := s.makeBaseMsg(log, kafka.EventProfitWithdrawn)
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventProfitWithdrawn)
+	if err != nil {
+		return nil, err
+	}
 	msg.Data = &kafka.ProfitWithdrawnData{
 		GridID: gridID,
 		Quote:  strings.ToLower(event.Quote.Hex()),
@@ -778,15 +686,8 @@ func (s *Scanner) handleWithdrawProfit(ctx context.Context, tx pgx.Tx, log types
 	return []*kafka.Message{msg}, nil
 }
 
-// toGridOrderIDV2 constructs a gridOrderId from gridId and orderId (v2 format).
-// gridOrderId = (gridId << 16) | orderId
-// gridId is uint48, orderId is uint16
-func toGridOrderIDV2(gridID uint64, orderID uint16) uint64 {
-	return (gridID << 16) | uint64(orderID)
-}
-
 // priceMultiplier is 10^36, matching Lens.sol PRICE_MULTIPLIER.
-var priceMultiplier = new(big.Int).Exp(big.NewInt(10), big.NewInt(36), nil)
+var priceMultiplier = fixedpoint.PriceMultiplier
 
 // ratioMultiplier is 10^18, matching Geometry.sol RATIO_MULTIPLIER.
 var ratioMultiplier = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
@@ -794,10 +695,7 @@ var ratioMultiplier = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
 // calcQuoteAmount mirrors Lens.calcQuoteAmount(baseAmt, price, false).
 // It computes floor(baseAmt * price / PRICE_MULTIPLIER).
 func calcQuoteAmount(baseAmt, price *big.Int) *big.Int {
-	// numerator = baseAmt * price
-	numerator := new(big.Int).Mul(baseAmt, price)
-	// result = floor(numerator / PRICE_MULTIPLIER)
-	return new(big.Int).Div(numerator, priceMultiplier)
+	return fixedpoint.QuoteAmount(baseAmt, price)
 }
 
 // calcGeometryPrice computes price_i = price0 * (ratio / RATIO_MULTIPLIER)^i
@@ -817,65 +715,6 @@ func calcGeometryPrice(price0, ratio *big.Int, idx uint32) *big.Int {
 	return price
 }
 
-// calcInitialAmountsLinear computes initial amounts for Linear strategy.
-// For the bid side, it iterates through each bid order index and computes:
-//
-//	price_i = bidPrice0 + bidGap * i   (bidGap is int256, typically negative for bids)
-//	quoteAmt_i = floor(baseAmt * price_i / PRICE_MULTIPLIER)
-//	totalQuoteAmt = sum of all quoteAmt_i
-//
-// For the ask side: initialBaseAmount = baseAmt * askCount
-func calcInitialAmountsLinear(baseAmt *big.Int, bidPrice0, bidGap *big.Int, askCount, bidCount uint32) (initialBaseAmount, initialQuoteAmount *big.Int) {
-	// initialBaseAmount = baseAmt * askCount
-	initialBaseAmount = new(big.Int).Mul(baseAmt, big.NewInt(int64(askCount)))
-
-	// initialQuoteAmount = sum of calcQuoteAmount for each bid order
-	initialQuoteAmount = new(big.Int)
-	for i := range bidCount {
-		// price_i = bidPrice0 + bidGap * i
-		offset := new(big.Int).Mul(bidGap, big.NewInt(int64(i)))
-		price := new(big.Int).Add(bidPrice0, offset)
-
-		amt := calcQuoteAmount(baseAmt, price)
-		initialQuoteAmount.Add(initialQuoteAmount, amt)
-	}
-
-	return initialBaseAmount, initialQuoteAmount
-}
-
-// calcInitialAmountsGeometry computes initial amounts for Geometry strategy.
-// For the bid side, it iterates through each bid order index and computes:
-//
-//	price_i = bidPrice0 * (bidRatio / RATIO_MULTIPLIER)^i
-//	quoteAmt_i = floor(baseAmt * price_i / PRICE_MULTIPLIER)
-//	totalQuoteAmt = sum of all quoteAmt_i
-//
-// For the ask side: initialBaseAmount = baseAmt * askCount
-func calcInitialAmountsGeometry(baseAmt *big.Int, bidPrice0, bidRatio *big.Int, askCount, bidCount uint32) (initialBaseAmount, initialQuoteAmount *big.Int) {
-	// initialBaseAmount = baseAmt * askCount
-	initialBaseAmount = new(big.Int).Mul(baseAmt, big.NewInt(int64(askCount)))
-
-	// initialQuoteAmount = sum of calcQuoteAmount for each bid order
-	initialQuoteAmount = new(big.Int)
-	for i := range bidCount {
-		price := calcGeometryPrice(bidPrice0, bidRatio, i)
-		amt := calcQuoteAmount(baseAmt, price)
-		initialQuoteAmount.Add(initialQuoteAmount, amt)
-	}
-
-	return initialBaseAmount, initialQuoteAmount
-}
-
-// calcInitialAmounts computes initial amounts based on strategy type.
-// It dispatches to the appropriate strategy-specific function.
-func calcInitialAmounts(baseAmt *big.Int, bidPrice0, bidGap, bidRatio *big.Int, bidStrategy StrategyType, askCount, bidCount uint32) (initialBaseAmount, initialQuoteAmount *big.Int) {
-	if bidStrategy == StrategyTypeGeometry && bidRatio != nil && bidPrice0 != nil {
-		return calcInitialAmountsGeometry(baseAmt, bidPrice0, bidRatio, askCount, bidCount)
-	}
-	// Default to Linear strategy (or fallback if geometry params missing)
-	return calcInitialAmountsLinear(baseAmt, bidPrice0, bidGap, askCount, bidCount)
-}
-
 // calcPriceGap calculates the price gap for an order based on its strategy.
 // For Linear strategy: priceGap = |price - revPrice| = |gap|
 // For Geometry strategy: priceGap = |price - revPrice| = |price * (1 - RATIO_MULTIPLIER/ratio)|
@@ -918,10 +757,10 @@ func calcOrderFee(quoteVol *big.Int, fee int) string {
 }
 
 // calcGridFeeShare calculates the portion of orderFee credited to grid total_profit.
-// oneshot orders credit 25% of orderFee.
+// oneshot orders credit what the protocol leaves of orderFee: (10000 - oneshotFeeBps) / 10000.
 // non-oneshot orders with compound=false credit 75% of orderFee.
 // other orders credit 0.
-func calcGridFeeShare(orderFee string, oneshot, compound bool) string {
+func calcGridFeeShare(orderFee string, oneshot, compound bool, oneshotFeeBps uint32) string {
 	feeInt, ok := new(big.Int).SetString(orderFee, 10)
 	if !ok || feeInt.Sign() <= 0 {
 		return "0"
@@ -929,7 +768,11 @@ func calcGridFeeShare(orderFee string, oneshot, compound bool) string {
 
 	switch {
 	case oneshot:
-		return new(big.Int).Div(feeInt, big.NewInt(4)).String()
+		if oneshotFeeBps >= bpsDenominator {
+			return "0"
+		}
+		numerator := new(big.Int).Mul(feeInt, big.NewInt(int64(bpsDenominator-oneshotFeeBps)))
+		return numerator.Div(numerator, big.NewInt(bpsDenominator)).String()
 	case !compound:
 		numerator := new(big.Int).Mul(feeInt, big.NewInt(3))
 		return numerator.Div(numerator, big.NewInt(4)).String()
@@ -938,7 +781,28 @@ func calcGridFeeShare(orderFee string, oneshot, compound bool) string {
 	}
 }
 
-// calcGridProfit calculates the grid profit for a reverse fill.
+// calcProtocolFee calculates the protocol's part of a fill's fee: the quarter
+// of the total fee left out of orderFee (quoteVol * fee / 4000000), plus for
+// oneshot orders the part of orderFee not credited to the grid.
+func calcProtocolFee(quoteVol *big.Int, fee int, orderFee, gridFeeShare string, oneshot bool) string {
+	if quoteVol == nil || quoteVol.Sign() <= 0 || fee <= 0 {
+		return "0"
+	}
+
+	protocolFee := new(big.Int).Mul(quoteVol, big.NewInt(int64(fee)))
+	protocolFee.Div(protocolFee, big.NewInt(4000000))
+
+	if oneshot {
+		orderFeeInt, ok1 := new(big.Int).SetString(orderFee, 10)
+		shareInt, ok2 := new(big.Int).SetString(gridFeeShare, 10)
+		if ok1 && ok2 {
+			protocolFee.Add(protocolFee, orderFeeInt.Sub(orderFeeInt, shareInt))
+		}
+	}
+	return protocolFee.String()
+}
+
+// calcGridProfit calculates the grid profit for a reverse fill, in raw quote units.
 // gridProfit = priceGap * baseAmt / 10^36
 func calcGridProfit(priceGapStr string, baseAmt *big.Int) string {
 	priceGap, ok := new(big.Int).SetString(priceGapStr, 10)
@@ -949,11 +813,9 @@ func calcGridProfit(priceGapStr string, baseAmt *big.Int) string {
 		return "0"
 	}
 
-	// gridProfit = priceGap * baseAmt / 10^36
-	numerator := new(big.Int).Mul(priceGap, baseAmt)
-	gridProfit := new(big.Int).Div(numerator, priceMultiplier)
-
-	return gridProfit.String()
+	// The price gap is a price difference, so this is the quote amount of
+	// baseAmt at that price.
+	return fixedpoint.QuoteAmount(baseAmt, priceGap).String()
 }
 
 // addBigStrings adds two big integer strings and returns the result as a string.
@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// headerCacheSize bounds the number of headers kept in memory. It comfortably
+// covers the blocks with events of a few batches in flight.
+const headerCacheSize = 4096
+
+// headerKey identifies a header by number and hash, so a reorged block never
+// answers for its replacement.
+type headerKey struct {
+	number uint64
+	hash   common.Hash
+}
+
+// headerCache is an LRU cache of block headers. It is safe for concurrent use
+// because backfill workers fill it while the main loop reads it.
+type headerCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used; values are *types.Header
+	entries map[headerKey]*list.Element
+}
+
+func newHeaderCache(size int) *headerCache {
+	return &headerCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[headerKey]*list.Element),
+	}
+}
+
+func (c *headerCache) get(number uint64, hash common.Hash) (*types.Header, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[headerKey{number, hash}]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*types.Header), true
+}
+
+func (c *headerCache) add(h *types.Header) {
+	key := headerKey{h.Number.Uint64(), h.Hash()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(h)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		old := oldest.Value.(*types.Header)
+		delete(c.entries, headerKey{old.Number.Uint64(), old.Hash()})
+	}
+}
+
+// prefetchHeaders loads the header of every block in logs that is not cached
+// yet, in one batch request. A header whose hash differs from the one the logs
+// were read at means the block was reorged in between; the batch is failed so
+// it is re-read rather than stamped with the wrong block's time.
+func (s *Scanner) prefetchHeaders(ctx context.Context, logs []types.Log) error {
+	var numbers []uint64
+	want := make(map[uint64]common.Hash)
+	for _, log := range logs {
+		if _, ok := want[log.BlockNumber]; ok {
+			continue
+		}
+		if _, ok := s.headers.get(log.BlockNumber, log.BlockHash); ok {
+			continue
+		}
+		want[log.BlockNumber] = log.BlockHash
+		numbers = append(numbers, log.BlockNumber)
+	}
+	if len(numbers) == 0 {
+		return nil
+	}
+
+	headers, err := s.fetchHeaders(ctx, numbers)
+	if err != nil {
+		return fmt.Errorf("prefetch headers: %w", err)
+	}
+	for n, h := range headers {
+		if h.Hash() != want[n] {
+			return fmt.Errorf("block %d hash changed from %s to %s", n, want[n].Hex(), h.Hash().Hex())
+		}
+		s.headers.add(h)
+	}
+	return nil
+}
+
+// blockTime returns the timestamp of the block a log was emitted in. Headers
+// are normally prefetched for the whole batch; a miss is fetched on its own.
+func (s *Scanner) blockTime(ctx context.Context, log types.Log) (time.Time, error) {
+	h, ok := s.headers.get(log.BlockNumber, log.BlockHash)
+	if !ok {
+		var err error
+		h, err = s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(log.BlockNumber))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("fetch header %d: %w", log.BlockNumber, err)
+		}
+		if h.Hash() != log.BlockHash {
+			return time.Time{}, fmt.Errorf("block %d hash changed from %s to %s",
+				log.BlockNumber, log.BlockHash.Hex(), h.Hash().Hex())
+		}
+		s.headers.add(h)
+	}
+	return time.Unix(int64(h.Time), 0).UTC(), nil
+}
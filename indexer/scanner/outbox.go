@@ -0,0 +1,183 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+	"github.com/gridex/indexer/metrics"
+)
+
+// outboxPruneInterval is how often the relay deletes sent messages past
+// outbox.retention_hours.
+const outboxPruneInterval = time.Hour
+
+// enqueue queues Kafka messages in event_outbox within tx. The relay publishes
+// them once tx has committed; see runOutboxRelay.
+func (s *Scanner) enqueue(ctx context.Context, tx pgx.Tx, msgs []*kafka.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	assignIdempotencyKeys(msgs)
+
+	events := make([]db.OutboxEvent, len(msgs))
+	for i, msg := range msgs {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("marshal kafka message: %w", err)
+		}
+		events[i] = db.OutboxEvent{
+			IdempotencyKey: msg.IdempotencyKey,
+			EventType:      string(msg.EventType),
+			PartitionKey:   msg.PartitionKey(),
+			Payload:        payload,
+			BlockNumber:    msg.BlockNumber,
+		}
+	}
+	return db.InsertOutboxEvents(ctx, tx, s.cfg.ChainID, events)
+}
+
+// assignIdempotencyKeys gives every message without an idempotency key one
+// derived from the log it was produced for:
+//
+//	chain_id:block_hash:tx_hash:log_index:event_type[:provisional]:n
+//
+// n numbers the messages of the same log and type in msgs, e.g. the
+// order_created messages of a GridOrderCreated log. Handlers are deterministic,
+// so processing a log again yields the same keys. The block hash tells a
+// transaction apart from the same one included again after a reorg.
+func assignIdempotencyKeys(msgs []*kafka.Message) {
+	seen := make(map[string]int)
+	for _, msg := range msgs {
+		if msg.IdempotencyKey != "" {
+			continue
+		}
+		base := fmt.Sprintf("%d:%s:%s:%d:%s", msg.ChainID, msg.BlockHash, msg.TxHash, msg.LogIndex, msg.EventType)
+		if msg.Provisional {
+			base += ":provisional"
+		}
+		msg.IdempotencyKey = fmt.Sprintf("%s:%d", base, seen[base])
+		seen[base]++
+	}
+}
+
+// notifyOutbox wakes the relay after a transaction that queued messages
+// committed.
+func (s *Scanner) notifyOutbox() {
+	select {
+	case s.outboxNotify <- struct{}{}:
+	default:
+	}
+}
+
+// runOutboxRelay publishes the messages queued in event_outbox in order and
+// marks them sent. It blocks until ctx is cancelled. A Kafka failure is
+// retried after outbox.poll_interval_ms; indexing goes on meanwhile, and the
+// messages wait in the table. A message may be published again if marking it
+// sent fails, so delivery is at-least-once.
+func (s *Scanner) runOutboxRelay(ctx context.Context) {
+	pollInterval := time.Duration(s.cfg.Outbox.PollInterval) * time.Millisecond
+	retention := time.Duration(s.cfg.Outbox.RetentionHours) * time.Hour
+
+	s.logger.Info("starting outbox relay", "poll_interval", pollInterval,
+		"batch_size", s.cfg.Outbox.BatchSize, "retention", retention)
+
+	var lastPrune time.Time
+	for {
+		n, err := s.relayOutbox(ctx)
+		if err != nil && ctx.Err() == nil {
+			metrics.OutboxErrors.Add(s.cfg.Name, 1)
+			s.logger.Error("failed to publish outbox messages", "error", err)
+		}
+		if pending, err := s.repo.CountPendingOutboxEvents(ctx, s.cfg.ChainID); err == nil {
+			metrics.Set(metrics.OutboxPending, s.cfg.Name, pending)
+		}
+
+		// A full batch means more are waiting.
+		if err == nil && n == s.cfg.Outbox.BatchSize {
+			continue
+		}
+
+		if time.Since(lastPrune) >= outboxPruneInterval {
+			lastPrune = time.Now()
+			if deleted, err := s.repo.PruneOutbox(ctx, s.cfg.ChainID, retention); err != nil {
+				s.logger.Warn("failed to prune outbox", "error", err)
+			} else if deleted > 0 {
+				s.logger.Info("pruned sent outbox messages", "deleted", deleted)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("outbox relay stopped")
+			return
+		case <-s.outboxNotify:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// relayOutbox publishes the oldest batch of unsent messages and marks them
+// sent. It returns the number published.
+func (s *Scanner) relayOutbox(ctx context.Context) (int, error) {
+	events, err := s.repo.GetPendingOutboxEvents(ctx, s.cfg.ChainID, s.cfg.Outbox.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	recs := make([]kafka.Record, len(events))
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		recs[i] = kafka.Record{Key: e.PartitionKey, IdempotencyKey: e.IdempotencyKey, Value: e.Payload}
+		ids[i] = e.ID
+	}
+	if err := s.producer.WriteRecords(ctx, recs); err != nil {
+		return 0, fmt.Errorf("publish %d messages from id %d: %w", len(events), events[0].ID, err)
+	}
+
+	err = s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		return db.MarkOutboxEventsSent(ctx, tx, s.cfg.ChainID, ids)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("mark %d published messages sent: %w", len(events), err)
+	}
+
+	// Store the latest Kafka offset for tradebot synchronization.
+	// Non-fatal: offset tracking is for tradebot optimization.
+	if lastOffset, err := s.producer.LastOffset(s.kafkaBrokers, s.kafkaTopic); err != nil {
+		s.logger.Warn("failed to get kafka offset", "error", err)
+	} else if lastOffset > 0 {
+		err := s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+			return db.UpdateKafkaOffset(ctx, tx, s.cfg.ChainID, lastOffset)
+		})
+		if err != nil {
+			s.logger.Warn("failed to update kafka offset", "error", err)
+		}
+	}
+
+	metrics.OutboxPublished.Add(s.cfg.Name, int64(len(events)))
+	s.logger.Debug("published outbox messages", "count", len(events), "last_id", ids[len(ids)-1])
+	return len(events), nil
+}
+
+// FlushOutbox publishes every queued message of the chain and returns once
+// none is left, for runs that exit without starting the relay.
+func (s *Scanner) FlushOutbox(ctx context.Context) error {
+	for {
+		n, err := s.relayOutbox(ctx)
+		if err != nil {
+			return err
+		}
+		if n < s.cfg.Outbox.BatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/config"
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/metrics"
+)
+
+// orderPrice is the price and reverse price of an order.
+type orderPrice struct {
+	price    *big.Int
+	revPrice *big.Int
+}
+
+// checksPrices reports whether the prices of new orders are read from the
+// strategy contracts.
+func (s *Scanner) checksPrices() bool {
+	return s.cfg.PriceSource == config.PriceSourceVerify || s.cfg.PriceSource == config.PriceSourceOnchain
+}
+
+// usesOnchainPrices reports whether new orders are stored with the prices of
+// the strategy contracts.
+func (s *Scanner) usesOnchainPrices() bool {
+	return s.cfg.PriceSource == config.PriceSourceOnchain
+}
+
+// fetchOrderPrices reads getPrice and getReversePrice of every order of a new
+// grid from its strategy contracts at the creation block, in one batch. The
+// result is indexed by order index, per side. It returns nil slices unless
+// price_source is verify or onchain. In verify mode an order whose calls
+// fail gets no entry; in onchain mode that is an error, since its price would
+// not be the contract's.
+func (s *Scanner) fetchOrderPrices(ctx context.Context, log types.Log, event *contracts.GridOrderCreatedEvent, ask, bid *gridSide) (askPrices, bidPrices []*orderPrice, err error) {
+	if !s.checksPrices() {
+		return nil, nil, nil
+	}
+
+	type pendingPrice struct {
+		price, revPrice *contracts.Pending[*big.Int]
+	}
+	b := s.caller.NewBatchAt(log.BlockNumber)
+	queue := func(side *gridSide, isAsk bool, count uint32) []pendingPrice {
+		if side == nil {
+			return nil
+		}
+		pending := make([]pendingPrice, count)
+		for i := range count {
+			pending[i] = pendingPrice{
+				price:    b.StrategyPrice(side.addr, isAsk, event.GridID, uint16(i)),
+				revPrice: b.StrategyReversePrice(side.addr, isAsk, event.GridID, uint16(i)),
+			}
+		}
+		return pending
+	}
+	askPending := queue(ask, true, event.Asks)
+	bidPending := queue(bid, false, event.Bids)
+	if err := b.Execute(ctx); err != nil {
+		return nil, nil, fmt.Errorf("read order prices: %w", err)
+	}
+
+	collect := func(pending []pendingPrice, isAsk bool) ([]*orderPrice, error) {
+		prices := make([]*orderPrice, len(pending))
+		for i, p := range pending {
+			if p.price.Err != nil || p.revPrice.Err != nil {
+				if s.usesOnchainPrices() {
+					return nil, fmt.Errorf("read price of order %d (ask=%v): %w", i, isAsk, firstErr(p.price.Err, p.revPrice.Err))
+				}
+				s.logger.Warn("failed to read order price from strategy contract",
+					"grid_id", event.GridID, "is_ask", isAsk, "index", i,
+					"price_error", p.price.Err, "rev_price_error", p.revPrice.Err)
+				continue
+			}
+			prices[i] = &orderPrice{price: p.price.Value, revPrice: p.revPrice.Value}
+		}
+		return prices, nil
+	}
+	if askPrices, err = collect(askPending, true); err != nil {
+		return nil, nil, err
+	}
+	if bidPrices, err = collect(bidPending, false); err != nil {
+		return nil, nil, err
+	}
+	return askPrices, bidPrices, nil
+}
+
+// firstErr returns the first non-nil error.
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// priceAt returns the entry for order i, or nil.
+func priceAt(prices []*orderPrice, i uint32) *orderPrice {
+	if int(i) >= len(prices) {
+		return nil
+	}
+	return prices[i]
+}
+
+// samePrices reports whether computed and onchain hold the same prices.
+func samePrices(computed, onchain orderPrice) bool {
+	return computed.price.Cmp(onchain.price) == 0 && computed.revPrice.Cmp(onchain.revPrice) == 0
+}
+
+// checkOrderPrice compares the computed prices of a new order with its
+// strategy contract's. A divergence is logged, counted and recorded in
+// order_price_divergences. It returns the prices to store: the contract's in
+// onchain mode, the computed ones otherwise.
+func (s *Scanner) checkOrderPrice(ctx context.Context, tx pgx.Tx, log types.Log, gridID int64, orderID string, isAsk bool,
+	side *gridSide, computed orderPrice, onchain *orderPrice) (orderPrice, error) {
+	if onchain == nil || samePrices(computed, *onchain) {
+		return computed, nil
+	}
+
+	useOnchain := s.usesOnchainPrices()
+	s.logger.Warn("order price differs from strategy contract",
+		"grid_id", gridID,
+		"order_id", orderID,
+		"strategy", side.strategy.Type(),
+		"computed_price", computed.price.String(),
+		"onchain_price", onchain.price.String(),
+		"computed_rev_price", computed.revPrice.String(),
+		"onchain_rev_price", onchain.revPrice.String(),
+		"used_onchain", useOnchain,
+	)
+	metrics.PriceDivergences.Add(s.cfg.Name+"/"+string(side.strategy.Type()), 1)
+
+	err := db.InsertPriceDivergence(ctx, tx, s.cfg.ChainID, db.PriceDivergence{
+		GridID:           gridID,
+		OrderID:          orderID,
+		IsAsk:            isAsk,
+		Strategy:         string(side.strategy.Type()),
+		StrategyAddress:  strings.ToLower(side.addr.Hex()),
+		ComputedPrice:    computed.price.String(),
+		OnchainPrice:     onchain.price.String(),
+		ComputedRevPrice: computed.revPrice.String(),
+		OnchainRevPrice:  onchain.revPrice.String(),
+		UsedOnchain:      useOnchain,
+	}, log.BlockNumber)
+	if err != nil {
+		return orderPrice{}, err
+	}
+	if useOnchain {
+		return *onchain, nil
+	}
+	return computed, nil
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+	"github.com/gridex/indexer/metrics"
+)
+
+// loadPausedState reads the paused state from the last indexed Paused or
+// Unpaused event.
+func (s *Scanner) loadPausedState(ctx context.Context) error {
+	paused, err := s.repo.GetPaused(ctx, s.cfg.ChainID)
+	if err != nil {
+		return err
+	}
+	if s.paused.Swap(paused) != paused {
+		s.logger.Warn("GridEx paused state changed", "paused", paused)
+	}
+	var v int64
+	if paused {
+		v = 1
+	}
+	metrics.Set(metrics.Paused, s.cfg.Name, v)
+	return nil
+}
+
+// changesPausedState reports whether logs hold a Paused or Unpaused event of
+// the GridEx contract.
+func (s *Scanner) changesPausedState(logs []types.Log) bool {
+	for _, log := range logs {
+		if log.Address == s.gridExAddr && len(log.Topics) > 0 &&
+			(log.Topics[0] == contracts.TopicPaused || log.Topics[0] == contracts.TopicUnpaused) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePaused records a Paused or Unpaused event. The paused state itself is
+// reloaded once the batch is committed, so provisional (tip mode) events
+// don't change it.
+func (s *Scanner) handlePaused(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodePaused(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode Paused: %w", err)
+	}
+
+	name, eventType := db.ProtocolEventPaused, kafka.EventPaused
+	if log.Topics[0] == contracts.TopicUnpaused {
+		name, eventType = db.ProtocolEventUnpaused, kafka.EventUnpaused
+	}
+
+	s.logger.Warn(name, "account", event.Account.Hex())
+
+	data := &kafka.ProtocolPauseData{Account: strings.ToLower(event.Account.Hex())}
+	return s.recordProtocolEvent(ctx, tx, log, name, eventType, data)
+}
+
+// handleFacetUpdated records a function selector being routed to a new facet.
+// A facet of a configured contract version switches the decoder of the logs
+// that follow. An unannounced facet upgrade may change the layout of the
+// events it emits: CheckLayout catches a changed layout under the same topic,
+// and processLog reports unknown events that follow such an upgrade.
+func (s *Scanner) handleFacetUpdated(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodeFacetUpdated(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode FacetUpdated: %w", err)
+	}
+
+	s.logger.Warn("FacetUpdated",
+		"selector", hexutil.Encode(event.Selector[:]),
+		"facet", event.Facet.Hex(),
+	)
+	if version, ok := s.versions.facetUpdated(log, event.Facet); ok {
+		s.logger.Warn("GridEx contract version switched", "version", version, "block", log.BlockNumber)
+	}
+
+	data := &kafka.FacetUpdatedData{
+		Selector: hexutil.Encode(event.Selector[:]),
+		Facet:    strings.ToLower(event.Facet.Hex()),
+	}
+	return s.recordProtocolEvent(ctx, tx, log, db.ProtocolEventFacetUpdated, kafka.EventFacetUpdated, data)
+}
+
+// handleOwnershipTransferred records an ownership change of the GridEx
+// contract or the Vault.
+func (s *Scanner) handleOwnershipTransferred(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodeOwnershipTransferred(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode OwnershipTransferred: %w", err)
+	}
+
+	s.logger.Warn("OwnershipTransferred",
+		"contract", log.Address.Hex(),
+		"previous_owner", event.PreviousOwner.Hex(),
+		"new_owner", event.NewOwner.Hex(),
+	)
+
+	data := &kafka.OwnershipTransferredData{
+		Contract:      strings.ToLower(log.Address.Hex()),
+		PreviousOwner: strings.ToLower(event.PreviousOwner.Hex()),
+		NewOwner:      strings.ToLower(event.NewOwner.Hex()),
+	}
+	return s.recordProtocolEvent(ctx, tx, log, db.ProtocolEventOwnershipTransferred, kafka.EventOwnership, data)
+}
+
+// recordProtocolEvent stores a protocol event in the audit table and returns
+// its Kafka message, which carries the same data.
+func (s *Scanner) recordProtocolEvent(ctx context.Context, tx pgx.Tx, log types.Log, name string, eventType kafka.EventType, data any) ([]*kafka.Message, error) {
+	ts, err := s.blockTime(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.InsertProtocolEvent(ctx, tx, s.cfg.ChainID, db.ProtocolEvent{
+		Contract:  strings.ToLower(log.Address.Hex()),
+		Event:     name,
+		Data:      data,
+		TxHash:    log.TxHash.Hex(),
+		LogIndex:  log.Index,
+		Timestamp: ts,
+	}, log.BlockNumber); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.makeBaseMsg(ctx, log, eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Data = data
+	return []*kafka.Message{msg}, nil
+}
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+)
+
+const (
+	// bpsDenominator is 100% in basis points.
+	bpsDenominator = 10000
+	// defaultOneshotProtocolFeeBps is the oneshot protocol fee the GridEx
+	// contract is deployed with, in effect until the first OneshotProtocolFeeChanged.
+	defaultOneshotProtocolFeeBps = 7500
+)
+
+// handleOneshotProtocolFeeChanged records a change of the share of oneshot
+// order fees taken by the protocol. Fills after it in the chain use the new rate.
+func (s *Scanner) handleOneshotProtocolFeeChanged(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodeOneshotProtocolFeeChanged(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode OneshotProtocolFeeChanged: %w", err)
+	}
+
+	s.logger.Info("OneshotProtocolFeeChanged",
+		"old_fee_bps", event.OldFeeBps,
+		"new_fee_bps", event.NewFeeBps,
+		"sender", event.Sender.Hex(),
+	)
+
+	if err := db.InsertOneshotProtocolFeeChange(ctx, tx, s.cfg.ChainID, db.OneshotProtocolFeeChange{
+		Sender:    strings.ToLower(event.Sender.Hex()),
+		OldFeeBps: event.OldFeeBps,
+		NewFeeBps: event.NewFeeBps,
+		TxHash:    log.TxHash.Hex(),
+		LogIndex:  log.Index,
+	}, log.BlockNumber); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// handleCollectProtocol records a payout of accrued protocol fees.
+func (s *Scanner) handleCollectProtocol(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodeCollectProtocol(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode CollectProtocol: %w", err)
+	}
+
+	token, err := s.collectedToken(ctx, log, event)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("CollectProtocol",
+		"recipient", event.Recipient.Hex(),
+		"token", token,
+		"amount", event.Amount.String(),
+	)
+
+	ts, err := s.blockTime(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.InsertProtocolFeeCollection(ctx, tx, s.cfg.ChainID, db.ProtocolFeeCollection{
+		Sender:    strings.ToLower(event.Sender.Hex()),
+		Recipient: strings.ToLower(event.Recipient.Hex()),
+		Token:     token,
+		Amount:    event.Amount.String(),
+		TxHash:    log.TxHash.Hex(),
+		LogIndex:  log.Index,
+		Timestamp: ts,
+	}, log.BlockNumber); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// collectedToken returns the token of a CollectProtocol payout, which the event
+// does not carry: the ERC20 Transfer of the same amount to the recipient in
+// the same transaction. It returns "" when there is none, e.g. for a payout in
+// the native token.
+func (s *Scanner) collectedToken(ctx context.Context, log types.Log, event *contracts.CollectProtocolEvent) (string, error) {
+	receipt, err := s.logReceipt(ctx, log)
+	if err != nil {
+		return "", err
+	}
+
+	for _, l := range receipt.Logs {
+		if len(l.Topics) == 0 || l.Topics[0] != contracts.TopicTransfer {
+			continue
+		}
+		transfer, err := s.decoder.DecodeTransfer(*l)
+		if err != nil {
+			continue // ERC721 or malformed
+		}
+		if transfer.To == event.Recipient && transfer.Value.Cmp(event.Amount) == 0 {
+			return strings.ToLower(l.Address.Hex()), nil
+		}
+	}
+
+	s.logger.Warn("no token transfer found for CollectProtocol, recording it without token",
+		"tx", log.TxHash.Hex(), "recipient", event.Recipient.Hex(), "amount", event.Amount.String())
+	return "", nil
+}
+
+// logReceipt fetches the receipt of the transaction that emitted log and
+// checks that it is from the log's block.
+func (s *Scanner) logReceipt(ctx context.Context, log types.Log) (*types.Receipt, error) {
+	receipt, err := s.client.TransactionReceipt(ctx, log.TxHash)
+	if err != nil {
+		return nil, fmt.Errorf("fetch receipt %s: %w", log.TxHash.Hex(), err)
+	}
+	if receipt.BlockHash != (common.Hash{}) && receipt.BlockHash != log.BlockHash {
+		return nil, fmt.Errorf("receipt %s is from block %s, log from %s",
+			log.TxHash.Hex(), receipt.BlockHash.Hex(), log.BlockHash.Hex())
+	}
+	return receipt, nil
+}
+
+// oneshotProtocolFeeBps returns the oneshot protocol fee in effect for a log:
+// the last OneshotProtocolFeeChanged before it, or the contract default.
+func (s *Scanner) oneshotProtocolFeeBps(ctx context.Context, tx pgx.Tx, log types.Log) (uint32, error) {
+	bps, ok, err := db.GetOneshotProtocolFeeBps(ctx, tx, s.cfg.ChainID, log.BlockNumber, log.Index)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return defaultOneshotProtocolFeeBps, nil
+	}
+	return bps, nil
+}
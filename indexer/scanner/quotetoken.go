@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+	"github.com/gridex/indexer/pricing"
+)
+
+// handleQuotableTokenUpdated records the priority of a quote token. The zero
+// address stands for the chain's native currency, which has no ERC20 metadata.
+func (s *Scanner) handleQuotableTokenUpdated(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodeQuotableTokenUpdated(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode QuotableTokenUpdated: %w", err)
+	}
+
+	s.logger.Info("QuotableTokenUpdated",
+		"token", event.Quote.Hex(),
+		"priority", event.Priority.String(),
+	)
+
+	symbol := ""
+	if event.Quote != (common.Address{}) {
+		info, err := s.getOrFetchToken(ctx, tx, event.Quote, log.BlockNumber)
+		if err != nil {
+			return nil, fmt.Errorf("fetch quote token: %w", err)
+		}
+		symbol = info.Symbol
+	}
+
+	token := strings.ToLower(event.Quote.Hex())
+	if err := db.UpsertQuoteToken(ctx, tx, s.cfg.ChainID, token, event.Priority.String(), log.BlockNumber); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventQuoteToken)
+	if err != nil {
+		return nil, err
+	}
+	msg.Data = &kafka.QuoteTokenUpdatedData{
+		Token:    token,
+		Symbol:   symbol,
+		Priority: event.Priority.String(),
+	}
+	return []*kafka.Message{msg}, nil
+}
+
+// checkPairOrientation checks a new pair against the quote token registry: the
+// quote must be the token with the higher priority. It only warns. The
+// event's orientation is authoritative: the contract stores the pair as the
+// event reports it, and every order, price and amount of the pair is
+// expressed in that orientation, so flipping it here would misread them all.
+// The contract applies the same rule when it creates the pair, so a mismatch
+// means the registry is incomplete, e.g. because indexing started after some
+// QuotableTokenUpdated events.
+func (s *Scanner) checkPairOrientation(ctx context.Context, tx pgx.Tx, pairID uint64, base, quote common.Address) error {
+	baseAddr, quoteAddr := strings.ToLower(base.Hex()), strings.ToLower(quote.Hex())
+	priorities, err := db.GetQuoteTokenPriorities(ctx, tx, s.cfg.ChainID, baseAddr, quoteAddr)
+	if err != nil {
+		return err
+	}
+
+	quotePriority, ok := priorities[quoteAddr]
+	if !ok {
+		if len(priorities) > 0 {
+			s.logger.Warn("pair quote token is not in the quote token registry",
+				"pair_id", pairID, "quote", quote.Hex())
+		}
+		return nil
+	}
+	if basePriority, ok := priorities[baseAddr]; quotePriority.Sign() == 0 || ok && basePriority.Cmp(quotePriority) >= 0 {
+		s.logger.Warn("pair orientation disagrees with the quote token registry, keeping the event's",
+			"pair_id", pairID,
+			"base", base.Hex(), "base_priority", bigString(basePriority),
+			"quote", quote.Hex(), "quote_priority", quotePriority.String(),
+		)
+	}
+	return nil
+}
+
+// pricingAnchors returns the tokens priced without a price lookup, the same
+// set for APR and TVL: the quotable tokens among the built-in stablecoins and
+// wrapped native token and the configured stablecoins. Before any
+// QuotableTokenUpdated event is indexed, all of them count.
+func (s *Scanner) pricingAnchors(ctx context.Context) (map[string]pricing.TokenType, error) {
+	tokens, err := s.repo.GetQuoteTokens(ctx, s.cfg.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	quotable := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		quotable[t.Address] = t.Priority != "0"
+	}
+
+	anchors := pricing.AnchorTokens(s.cfg.ChainID, s.cfg.Stablecoins)
+	if len(tokens) > 0 {
+		maps.DeleteFunc(anchors, func(addr string, _ pricing.TokenType) bool { return !quotable[addr] })
+	}
+	return anchors, nil
+}
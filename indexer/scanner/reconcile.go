@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+	"github.com/gridex/indexer/metrics"
+)
+
+// runReconciler periodically compares a sample of active grids with the
+// contract. It blocks until ctx is cancelled.
+func (s *Scanner) runReconciler(ctx context.Context) {
+	interval := time.Duration(s.cfg.Reconcile.Interval) * time.Second
+
+	s.logger.Info("starting reconciler", "interval", interval,
+		"sample_size", s.cfg.Reconcile.SampleSize, "auto_repair", s.cfg.Reconcile.AutoRepair)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("reconciler stopped")
+			return
+		case <-ticker.C:
+			if err := s.reconcile(ctx); err != nil {
+				s.logger.Error("failed to reconcile grids", "error", err)
+			}
+		}
+	}
+}
+
+// gridViews are the view calls queued for one sampled grid.
+type gridViews struct {
+	config  *contracts.Pending[*contracts.GridConfig]
+	profits *contracts.Pending[*big.Int]
+	orders  *contracts.Pending[[]*contracts.GridOrder]
+	ids     []string // order IDs of orders, as stored in the DB
+}
+
+// reconcile compares a random sample of active grids and their active orders
+// with getGridConfig, getGridProfits and getGridOrders at the last indexed
+// block, which the DB rows reflect. Mismatches are recorded in
+// reconciliation_issues, alerted and, with auto_repair, written to the DB.
+func (s *Scanner) reconcile(ctx context.Context) error {
+	block, grids, err := s.repo.SampleActiveGrids(ctx, s.cfg.ChainID, s.cfg.Reconcile.SampleSize)
+	if err != nil {
+		return fmt.Errorf("sample active grids: %w", err)
+	}
+	if len(grids) == 0 {
+		return nil
+	}
+
+	batch := s.caller.NewBatchAt(block)
+	views := make([]gridViews, len(grids))
+	for i, g := range grids {
+		v := &views[i]
+		v.config = batch.GridConfig(uint64(g.GridID))
+		v.profits = batch.GridProfits(uint64(g.GridID))
+		var ids []uint64
+		for _, o := range g.Orders {
+			// Orders of v1 grids have uint256 IDs that getGridOrders cannot take.
+			id, err := strconv.ParseUint(o.OrderID, 10, 64)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+			v.ids = append(v.ids, o.OrderID)
+		}
+		if len(ids) > 0 {
+			v.orders = batch.GridOrders(ids)
+		}
+	}
+	if err := batch.Execute(ctx); err != nil {
+		return fmt.Errorf("call view functions at block %d: %w", block, err)
+	}
+
+	total := 0
+	for i, g := range grids {
+		v := views[i]
+		orders := make(map[string]*contracts.GridOrder, len(v.ids))
+		if v.orders != nil {
+			if v.orders.Err != nil || len(v.orders.Value) != len(v.ids) {
+				s.logger.Warn("reconcile: getGridOrders failed", "grid_id", g.GridID, "block", block, "error", v.orders.Err)
+				continue
+			}
+			for j, id := range v.ids {
+				orders[id] = v.orders.Value[j]
+			}
+		}
+		if v.config.Err != nil || v.profits.Err != nil {
+			s.logger.Warn("reconcile: grid view calls failed", "grid_id", g.GridID, "block", block,
+				"config_error", v.config.Err, "profits_error", v.profits.Err)
+			continue
+		}
+
+		issues := diffGrid(g, v.config.Value, v.profits.Value, orders)
+		if err := s.recordReconciliation(ctx, g.GridID, block, issues, v.config.Value, v.profits.Value, orders); err != nil {
+			return fmt.Errorf("record reconciliation of grid %d: %w", g.GridID, err)
+		}
+		total += len(issues)
+	}
+	if total > 0 {
+		s.notifyOutbox()
+	}
+
+	s.logger.Info("reconciled grids", "block", block, "grids", len(grids), "issues", total)
+	return nil
+}
+
+// recordReconciliation stores the issues found for a grid, repairing the DB
+// first if auto_repair is set, and raises an alert for each of them.
+func (s *Scanner) recordReconciliation(ctx context.Context, gridID int64, block uint64, issues []db.ReconciliationIssue,
+	cfg *contracts.GridConfig, profits *big.Int, orders map[string]*contracts.GridOrder) error {
+	return s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if s.cfg.Reconcile.AutoRepair && len(issues) > 0 {
+			repaired := make(map[string]bool) // by order ID, "" for the grid
+			for _, issue := range issues {
+				if _, done := repaired[issue.OrderID]; done {
+					continue
+				}
+				var (
+					ok  bool
+					err error
+				)
+				if issue.OrderID == "" {
+					ok, err = db.RepairGrid(ctx, tx, s.cfg.ChainID, gridID, int(cfg.Status), int(cfg.Fee), profits.String(), block)
+				} else {
+					o := orders[issue.OrderID]
+					ok, err = db.RepairOrder(ctx, tx, s.cfg.ChainID, issue.OrderID, o.Amount.String(), o.RevAmount.String(), block)
+				}
+				if err != nil {
+					return err
+				}
+				repaired[issue.OrderID] = ok
+			}
+			for i := range issues {
+				issues[i].Repaired = repaired[issues[i].OrderID]
+			}
+		}
+
+		if err := db.RecordReconciliation(ctx, tx, s.cfg.ChainID, gridID, block, issues); err != nil {
+			return err
+		}
+		if len(issues) == 0 {
+			return nil
+		}
+
+		msgs := make([]*kafka.Message, len(issues))
+		for i, issue := range issues {
+			s.logger.Error("reconciliation mismatch",
+				"grid_id", issue.GridID, "order_id", issue.OrderID, "field", issue.Field,
+				"db_value", issue.DBValue, "chain_value", issue.ChainValue,
+				"block", block, "repaired", issue.Repaired)
+			metrics.ReconciliationIssues.Add(s.cfg.Name+"/"+issue.Field, 1)
+			msgs[i] = &kafka.Message{
+				EventType:   kafka.EventReconciliation,
+				ChainID:     s.cfg.ChainID,
+				BlockNumber: block,
+				Timestamp:   time.Now().Unix(),
+				IdempotencyKey: fmt.Sprintf("%d:%s:%d:%d:%s:%s", s.cfg.ChainID, kafka.EventReconciliation,
+					block, issue.GridID, issue.OrderID, issue.Field),
+				Data: kafka.ReconciliationIssueData{
+					GridID:     issue.GridID,
+					OrderID:    issue.OrderID,
+					Field:      issue.Field,
+					DBValue:    issue.DBValue,
+					ChainValue: issue.ChainValue,
+					Repaired:   issue.Repaired,
+				},
+			}
+		}
+		if err := s.enqueue(ctx, tx, msgs); err != nil {
+			return fmt.Errorf("queue reconciliation_issue messages: %w", err)
+		}
+		return nil
+	})
+}
+
+// diffGrid compares the indexed state of a grid with the contract's: the
+// grid's status, fee and profits, and the amounts of the orders in orders,
+// which is keyed by order ID. Orders missing from orders are not compared.
+func diffGrid(g db.ReconcileGrid, cfg *contracts.GridConfig, profits *big.Int, orders map[string]*contracts.GridOrder) []db.ReconciliationIssue {
+	var issues []db.ReconciliationIssue
+	add := func(orderID, field, dbValue, chainValue string) {
+		issues = append(issues, db.ReconciliationIssue{
+			GridID:     g.GridID,
+			OrderID:    orderID,
+			Field:      field,
+			DBValue:    dbValue,
+			ChainValue: chainValue,
+		})
+	}
+	sameAmount := func(dbValue string, chainValue *big.Int) bool {
+		v, ok := new(big.Int).SetString(dbValue, 10)
+		return ok && v.Cmp(chainValue) == 0
+	}
+
+	if g.Status != int(cfg.Status) {
+		add("", db.ReconcileFieldStatus, strconv.Itoa(g.Status), strconv.FormatUint(uint64(cfg.Status), 10))
+	}
+	if g.Fee != int(cfg.Fee) {
+		add("", db.ReconcileFieldFee, strconv.Itoa(g.Fee), strconv.FormatUint(uint64(cfg.Fee), 10))
+	}
+	if !sameAmount(g.Profits, profits) {
+		add("", db.ReconcileFieldProfits, g.Profits, profits.String())
+	}
+	for _, o := range g.Orders {
+		chain, ok := orders[o.OrderID]
+		if !ok {
+			continue
+		}
+		if !sameAmount(o.Amount, chain.Amount) {
+			add(o.OrderID, db.ReconcileFieldAmount, o.Amount, chain.Amount.String())
+		}
+		if !sameAmount(o.RevAmount, chain.RevAmount) {
+			add(o.OrderID, db.ReconcileFieldRevAmount, o.RevAmount, chain.RevAmount.String())
+		}
+	}
+	return issues
+}
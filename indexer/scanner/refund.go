@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+)
+
+// refundActions maps the GridEx events that can send native currency back to
+// the user to the action recorded with a failed refund.
+var refundActions = map[common.Hash]kafka.EventType{
+	contracts.TopicGridOrderCreated:   kafka.EventGridCreated,
+	contracts.TopicCancelWholeGrid:    kafka.EventGridCancelled,
+	contracts.TopicCancelGridOrder:    kafka.EventOrderCancelled,
+	contracts.TopicFilledOrder:        kafka.EventOrderFilled,
+	contracts.TopicWithdrawProfit:     kafka.EventProfitWithdrawn,
+	contracts.TopicGridOrderCreatedV1: kafka.EventGridCreated,
+	contracts.TopicCancelWholeGridV1:  kafka.EventGridCancelled,
+	contracts.TopicCancelGridOrderV1:  kafka.EventOrderCancelled,
+	contracts.TopicFilledOrderV1:      kafka.EventOrderFilled,
+	contracts.TopicWithdrawProfitV1:   kafka.EventProfitWithdrawn,
+}
+
+// handleRefundFailed records native currency the GridEx contract failed to
+// send back to a user, together with the GridEx action of the same transaction.
+func (s *Scanner) handleRefundFailed(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodeRefundFailed(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode RefundFailed: %w", err)
+	}
+
+	action, gridID, err := s.refundAction(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Warn("RefundFailed",
+		"to", event.To.Hex(),
+		"amount", event.Amount.String(),
+		"action", action,
+		"tx", log.TxHash.Hex(),
+	)
+
+	ts, err := s.blockTime(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+
+	address := strings.ToLower(event.To.Hex())
+	failure := db.RefundFailure{
+		Address:   address,
+		Amount:    event.Amount.String(),
+		Action:    string(action),
+		TxHash:    log.TxHash.Hex(),
+		LogIndex:  log.Index,
+		Timestamp: ts,
+	}
+	if gridID > 0 {
+		failure.GridID = &gridID
+	}
+	if err := db.InsertRefundFailure(ctx, tx, s.cfg.ChainID, failure, log.BlockNumber); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.makeBaseMsg(ctx, log, kafka.EventRefundFailed)
+	if err != nil {
+		return nil, err
+	}
+	msg.Data = &kafka.RefundFailedData{
+		Address: address,
+		Amount:  event.Amount.String(),
+		Action:  string(action),
+		GridID:  gridID,
+	}
+	return []*kafka.Message{msg}, nil
+}
+
+// refundAction finds the GridEx event in the transaction of a RefundFailed log
+// that triggered the refund: the last one emitted before it. It returns the
+// action and, for events that name a grid, the grid ID.
+func (s *Scanner) refundAction(ctx context.Context, log types.Log) (kafka.EventType, int64, error) {
+	receipt, err := s.logReceipt(ctx, log)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var cause *types.Log
+	for _, l := range receipt.Logs {
+		if l.Index >= log.Index {
+			break
+		}
+		if l.Address != s.gridExAddr || len(l.Topics) == 0 {
+			continue
+		}
+		if _, ok := refundActions[l.Topics[0]]; ok {
+			cause = l
+		}
+	}
+	if cause == nil {
+		return "", 0, nil
+	}
+
+	action := refundActions[cause.Topics[0]]
+	switch cause.Topics[0] {
+	case contracts.TopicGridOrderCreated, contracts.TopicGridOrderCreatedV1:
+		created, err := s.decoderAt(*cause).DecodeGridOrderCreated(*cause)
+		if err != nil {
+			return "", 0, fmt.Errorf("decode GridOrderCreated of refund: %w", err)
+		}
+		return action, int64(created.GridID), nil
+	case contracts.TopicCancelWholeGrid, contracts.TopicCancelWholeGridV1:
+		cancelled, err := s.decoderAt(*cause).DecodeCancelWholeGrid(*cause)
+		if err != nil {
+			return "", 0, fmt.Errorf("decode CancelWholeGrid of refund: %w", err)
+		}
+		return action, int64(cancelled.GridID), nil
+	case contracts.TopicCancelGridOrder, contracts.TopicCancelGridOrderV1:
+		cancelled, err := s.decoderAt(*cause).DecodeCancelGridOrder(*cause)
+		if err != nil {
+			return "", 0, fmt.Errorf("decode CancelGridOrder of refund: %w", err)
+		}
+		return action, int64(cancelled.GridID), nil
+	}
+	return action, 0, nil
+}
@@ -0,0 +1,228 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+)
+
+// ErrReorgTooDeep is returned when no stored block within reorg_depth matches
+// the canonical chain. Rolling back further is unsafe, so the scanner stops.
+var ErrReorgTooDeep = errors.New("chain reorganization deeper than reorg_depth")
+
+// errBatchHashMismatch means the node switched forks while a batch was being
+// fetched. The batch is discarded and retried.
+var errBatchHashMismatch = errors.New("log block hash does not match canonical header")
+
+// checkReorg verifies that the block before currentBlock is still the one we
+// indexed, by comparing the parent hash of currentBlock's header with the
+// stored hash. It returns the header of currentBlock so it can be recorded
+// with the batch, and reorged=true if the chain no longer links up.
+func (s *Scanner) checkReorg(ctx context.Context, currentBlock uint64) (*types.Header, bool, error) {
+	header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(currentBlock))
+	if err != nil {
+		return nil, false, fmt.Errorf("fetch header %d: %w", currentBlock, err)
+	}
+	if currentBlock == 0 {
+		return header, false, nil
+	}
+
+	stored, ok, err := s.repo.GetBlockHash(ctx, s.cfg.ChainID, currentBlock-1)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		// Nothing recorded for the previous block (fresh start or pruned history)
+		return header, false, nil
+	}
+	if header.ParentHash != common.HexToHash(stored) {
+		s.logger.Warn("chain reorganization detected",
+			"block", currentBlock-1,
+			"stored_hash", stored,
+			"canonical_hash", header.ParentHash.Hex())
+		return header, true, nil
+	}
+	return header, false, nil
+}
+
+// findCommonAncestor walks the stored block hashes back from fromBlock and
+// returns the newest one that is still part of the canonical chain.
+func (s *Scanner) findCommonAncestor(ctx context.Context, fromBlock uint64) (db.BlockRef, error) {
+	var minBlock uint64
+	if fromBlock > s.cfg.ReorgDepth {
+		minBlock = fromBlock - s.cfg.ReorgDepth
+	}
+
+	refs, err := s.repo.GetRecentBlockHashes(ctx, s.cfg.ChainID, fromBlock, int(s.cfg.ReorgDepth)+1)
+	if err != nil {
+		return db.BlockRef{}, err
+	}
+
+	for _, ref := range refs {
+		if ref.Number < minBlock {
+			break
+		}
+		header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(ref.Number))
+		if err != nil {
+			return db.BlockRef{}, fmt.Errorf("fetch header %d: %w", ref.Number, err)
+		}
+		if header.Hash() == common.HexToHash(ref.Hash) {
+			return ref, nil
+		}
+	}
+
+	return db.BlockRef{}, fmt.Errorf("%w: no canonical block found in [%d, %d]", ErrReorgTooDeep, minBlock, fromBlock)
+}
+
+// rollbackReorg reverts all indexed state above the common ancestor of the
+// orphaned branch and emits a chain_reorg message so downstream consumers can
+// discard the events they received for the reverted range. It returns the
+// block to resume scanning from.
+func (s *Scanner) rollbackReorg(ctx context.Context, currentBlock uint64) (uint64, error) {
+	ancestor, err := s.findCommonAncestor(ctx, currentBlock-1)
+	if err != nil {
+		return 0, err
+	}
+	// The orphaned head identifies the reorg in the message's idempotency key.
+	orphaned, _, err := s.repo.GetBlockHash(ctx, s.cfg.ChainID, currentBlock-1)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		res, err := db.RollbackToBlock(ctx, tx, s.cfg.ChainID, ancestor.Number)
+		if err != nil {
+			return fmt.Errorf("rollback to block %d: %w", ancestor.Number, err)
+		}
+
+		s.logger.Warn("rolled back orphaned blocks",
+			"ancestor", ancestor.Number,
+			"ancestor_hash", ancestor.Hash,
+			"reverted_to", currentBlock-1,
+			"grids", len(res.GridIDs),
+			"fill_txs", len(res.FillTxs),
+			"journal_rows", res.JournalRows)
+
+		msg := &kafka.Message{
+			EventType:      kafka.EventChainReorg,
+			ChainID:        s.cfg.ChainID,
+			BlockNumber:    ancestor.Number,
+			TxHash:         ancestor.Hash,
+			Timestamp:      time.Now().Unix(),
+			IdempotencyKey: fmt.Sprintf("%d:%s:%s", s.cfg.ChainID, kafka.EventChainReorg, orphaned),
+			Data: kafka.ChainReorgData{
+				AncestorBlock:    ancestor.Number,
+				AncestorHash:     ancestor.Hash,
+				FromBlock:        ancestor.Number + 1,
+				ToBlock:          currentBlock - 1,
+				RevertedGridIDs:  res.GridIDs,
+				RevertedFillTxes: res.FillTxs,
+			},
+		}
+		if err := s.enqueue(ctx, tx, []*kafka.Message{msg}); err != nil {
+			return fmt.Errorf("queue chain_reorg message: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.notifyOutbox()
+
+	// Strategy params and pair tokens cached from the orphaned branch must not
+	// leak into the re-scan.
+	clear(s.strategyCache)
+	clear(s.pairTokens)
+
+	if err := s.loadPausedState(ctx); err != nil {
+		s.logger.Warn("failed to reload paused state", "error", err)
+	}
+	if err := s.loadVersionSchedule(ctx); err != nil {
+		s.logger.Warn("failed to reload contract versions", "error", err)
+	}
+
+	return ancestor.Number + 1, nil
+}
+
+// checkEndHeader reads the header of a batch's end block again once the
+// batch's logs are fetched, and returns errBatchHashMismatch if its hash
+// changed. A reorg that replaced a block of the range in the meantime changed
+// the end block too; comparing log block hashes alone would miss it when the
+// old version of the replaced block had no logs.
+func (s *Scanner) checkEndHeader(ctx context.Context, endHeader *types.Header) error {
+	header, err := s.client.HeaderByNumber(ctx, endHeader.Number)
+	if err != nil {
+		return fmt.Errorf("fetch header %d: %w", endHeader.Number.Uint64(), err)
+	}
+	if header.Hash() != endHeader.Hash() {
+		return fmt.Errorf("%w: block %d header changed from %s to %s while fetching logs",
+			errBatchHashMismatch, endHeader.Number.Uint64(), endHeader.Hash().Hex(), header.Hash().Hex())
+	}
+	return nil
+}
+
+// batchBlockRefs builds the block hashes to record for a processed batch: the
+// first and last block of the range plus every block that produced a log.
+// It returns errBatchHashMismatch if a log's block hash disagrees with the
+// headers fetched for the batch, which means the node switched forks mid-batch.
+//
+// Blocks without logs are not recorded, which saves a header request per
+// block. Detection relies on the anchors instead: a block's hash commits to
+// all its ancestors, so replacing any block of a committed batch, with or
+// without logs, also replaces its end block. checkReorg of the next batch
+// sees that through the parent hash, and findCommonAncestor rolls back to the
+// newest recorded block that is still canonical, at or below the fork point.
+func batchBlockRefs(startHeader, endHeader *types.Header, logs []types.Log) ([]db.BlockRef, error) {
+	var refs []db.BlockRef
+
+	for _, h := range []*types.Header{startHeader, endHeader} {
+		if h == nil {
+			continue
+		}
+		number := h.Number.Uint64()
+		if len(refs) > 0 && refs[0].Number == number {
+			continue
+		}
+		refs = append(refs, db.BlockRef{
+			Number:     number,
+			Hash:       h.Hash().Hex(),
+			ParentHash: h.ParentHash.Hex(),
+		})
+	}
+
+	return appendLogBlockRefs(refs, logs)
+}
+
+// appendLogBlockRefs adds the blocks of logs that are not in refs yet. It
+// returns errBatchHashMismatch if a log's block hash disagrees with refs.
+func appendLogBlockRefs(refs []db.BlockRef, logs []types.Log) ([]db.BlockRef, error) {
+	known := make(map[uint64]string, len(refs))
+	for _, ref := range refs {
+		known[ref.Number] = ref.Hash
+	}
+
+	for _, log := range logs {
+		if hash, ok := known[log.BlockNumber]; ok {
+			if hash != log.BlockHash.Hex() {
+				return nil, fmt.Errorf("%w: block %d log=%s header=%s",
+					errBatchHashMismatch, log.BlockNumber, log.BlockHash.Hex(), hash)
+			}
+			continue
+		}
+		known[log.BlockNumber] = log.BlockHash.Hex()
+		refs = append(refs, db.BlockRef{
+			Number: log.BlockNumber,
+			Hash:   log.BlockHash.Hex(),
+		})
+	}
+	return refs, nil
+}
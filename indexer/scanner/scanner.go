@@ -2,31 +2,39 @@ package scanner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 	"github.com/jackc/pgx/v5"
 
 	"github.com/gridex/indexer/config"
 	"github.com/gridex/indexer/contracts"
 	"github.com/gridex/indexer/db"
 	"github.com/gridex/indexer/kafka"
+	"github.com/gridex/indexer/metrics"
 	"github.com/gridex/indexer/pricing"
 )
 
-// EthClient defines the subset of ethclient.Client methods used by Scanner.
+// EthClient defines the subset of ethclient.Client methods used by Scanner,
+// plus JSON-RPC batching from the underlying rpc.Client.
 // This interface enables mocking in tests.
 type EthClient interface {
 	BlockNumber(ctx context.Context) (uint64, error)
 	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
 	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
 	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	BatchCallContext(ctx context.Context, b []gethrpc.BatchElem) error
 }
 
 // StrategyType represents the type of grid strategy
@@ -37,25 +45,13 @@ const (
 	StrategyTypeGeometry StrategyType = "geometry"
 )
 
-// strategyInfo holds strategy parameters from strategy events,
-// keyed by gridId. This is populated before GridOrderCreated in the same tx.
-// There can be two events per grid: one for ask side, one for bid side.
-type strategyInfo struct {
-	AskStrategy StrategyType // "linear" or "geometry"
-	BidStrategy StrategyType // "linear" or "geometry"
-	// Linear strategy parameters
-	AskPrice0 *big.Int // ask starting price (uint256)
-	AskGap    *big.Int // ask price gap between consecutive orders (int256)
-	BidPrice0 *big.Int // bid starting price (uint256)
-	BidGap    *big.Int // bid price gap between consecutive orders (int256)
-	// Geometry strategy parameters
-	AskRatio *big.Int // ask ratio for geometry strategy (uint256, scaled by 10^18)
-	BidRatio *big.Int // bid ratio for geometry strategy (uint256, scaled by 10^18)
+// gridSide is the strategy and parameters of one side of a grid.
+type gridSide struct {
+	strategy Strategy
+	addr     common.Address // the strategy contract
+	params   *contracts.StrategyParams
 }
 
-// linearStrategyInfo is kept for backward compatibility
-type linearStrategyInfo = strategyInfo
-
 // Scanner scans a single chain for GridEx events.
 type Scanner struct {
 	cfg      config.ChainConfig
@@ -66,9 +62,10 @@ type Scanner struct {
 	producer *kafka.Producer
 	logger   *slog.Logger
 
-	gridExAddr           common.Address
-	linearStrategyAddr   common.Address
-	geometryStrategyAddr common.Address
+	gridExAddr common.Address
+
+	// vaultAddr is the Vault contract, zero when vault_address is not configured
+	vaultAddr common.Address
 
 	// Kafka brokers and topic for offset tracking
 	kafkaBrokers []string
@@ -77,20 +74,77 @@ type Scanner struct {
 	// tokenCache avoids repeated on-chain calls for the same token
 	tokenCache map[common.Address]*contracts.TokenInfo
 
-	// strategyCache holds LinearStrategyCreated data keyed by gridId (string).
-	// Populated when processing LinearStrategyCreated, consumed by GridOrderCreated.
+	// pairTokens caches the base and quote token of each pair, which never
+	// change once the pair is registered
+	pairTokens map[uint64][2]common.Address
+
+	// provisional is set while scanTip runs the handlers on unconfirmed
+	// blocks, whose results are rolled back
+	provisional bool
+
+	// strategies maps the configured and whitelisted strategy contracts to
+	// their implementation
+	strategies *strategyRegistry
+
+	// versions selects the decoder of GridEx logs by contract version
+	versions *versionSchedule
+
+	// strategyCache holds strategy creation events keyed by gridId + "_ask"/"_bid".
+	// Populated by handleStrategyCreated, consumed by GridOrderCreated.
 	// Entries are removed after consumption.
-	strategyCache map[string]*linearStrategyInfo
+	strategyCache map[string]*gridSide
 
 	// okxPriceClient fetches token prices from OKX DEX API
 	okxPriceClient *pricing.OKXPriceClient
 
 	// binanceClient fetches spot prices from Binance for TVL calculation
 	binanceClient *pricing.BinancePriceClient
+
+	// batch learns the eth_getLogs window size the RPC provider accepts
+	batch *batchController
+
+	// ws streams heads and logs over WebSocket when ws_url is configured (nil otherwise)
+	ws *wsIngestor
+
+	// tipHead is the latest block covered by the last tip mode pass.
+	tipHead uint64
+	// tipLogs are the logs scanTip fetched up to block tipLogsTo, whose hash
+	// was tipLogsHash.
+	tipLogs     []types.Log
+	tipLogsTo   uint64
+	tipLogsHash common.Hash
+
+	// finalityTagUnsupportedUntil is set when the RPC rejects the
+	// "safe"/"finalized" block tag; until then finality_mode falls back to
+	// confirmations.
+	finalityTagUnsupportedUntil time.Time
+
+	// taggedBlock is the highest "safe"/"finalized" block read from the node.
+	taggedBlock uint64
+
+	// blockReceiptsUnsupported is set once the RPC rejects eth_getBlockReceipts.
+	// Read by backfill workers, hence atomic.
+	blockReceiptsUnsupported atomic.Bool
+
+	// headers caches the headers of blocks holding our events, for timestamps.
+	headers *headerCache
+
+	// paused mirrors the GridEx paused state as of the last committed batch.
+	paused atomic.Bool
+
+	// quarantined counts the logs stored in unknown_logs by processLog, so
+	// the metric is only bumped for committed batches.
+	quarantined int
+	// unconfiguredFacetLogs counts the quarantined GridEx logs that follow an
+	// upgrade to a facet of no configured version, likewise.
+	unconfiguredFacetLogs int
+
+	// outboxNotify wakes the outbox relay when messages were queued.
+	outboxNotify chan struct{}
 }
 
 // New creates a new Scanner for a chain.
-// The client parameter must implement EthClient (e.g. *ethclient.Client or
+// The client parameter must implement EthClient (e.g. *rpc.Pool or
 // *rpc.RateLimitedClient). If using a rate-limited client that also implements
 // contracts.ContractCaller, it will be used for contract calls as well.
 func New(
@@ -110,12 +164,14 @@ func New(
 
 	gridExAddr := common.HexToAddress(cfg.GridExAddress)
 
-	if cfg.LinearStrategyAddress == "" {
-		panic("LinearStrategyAddress is not configured")
+	strategies, err := newStrategyRegistry(cfg.Strategies, decoder)
+	if err != nil {
+		return nil, err
 	}
-	strategyAddr := common.HexToAddress(cfg.LinearStrategyAddress)
-	if strategyAddr == (common.Address{}) {
-		panic("LinearStrategyAddress is the zero address")
+
+	versions, err := newVersionSchedule(cfg.ABIVersions, decoder)
+	if err != nil {
+		return nil, err
 	}
 
 	// The client must also implement ContractCaller for on-chain reads.
@@ -141,35 +197,41 @@ func New(
 		logger.Warn("OKX API credentials not configured, init_price will be empty")
 	}
 
-	// Parse geometry strategy address (optional)
-	var geometryStrategyAddr common.Address
-	if cfg.GeometryStrategyAddress != "" {
-		geometryStrategyAddr = common.HexToAddress(cfg.GeometryStrategyAddress)
-	} else {
-		panic("GeometryStrategyAddress is the zero address")
-	}
-
-	return &Scanner{
-		cfg:                  cfg,
-		client:               client,
-		decoder:              decoder,
-		caller:               caller,
-		repo:                 repo,
-		producer:             producer,
-		logger:               logger.With("chain", cfg.Name, "chain_id", cfg.ChainID),
-		gridExAddr:           gridExAddr,
-		linearStrategyAddr:   strategyAddr,
-		geometryStrategyAddr: geometryStrategyAddr,
-		kafkaBrokers:         kafkaBrokers,
-		kafkaTopic:           kafkaTopic,
-		tokenCache:           make(map[common.Address]*contracts.TokenInfo),
-		strategyCache:        make(map[string]*strategyInfo),
-		okxPriceClient:       okxPriceClient,
-		binanceClient:        pricing.NewBinancePriceClient(logger),
-	}, nil
+	s := &Scanner{
+		cfg:            cfg,
+		client:         client,
+		decoder:        decoder,
+		caller:         caller,
+		repo:           repo,
+		producer:       producer,
+		logger:         logger.With("chain", cfg.Name, "chain_id", cfg.ChainID),
+		gridExAddr:     gridExAddr,
+		vaultAddr:      common.HexToAddress(cfg.VaultAddress),
+		strategies:     strategies,
+		versions:       versions,
+		kafkaBrokers:   kafkaBrokers,
+		kafkaTopic:     kafkaTopic,
+		tokenCache:     make(map[common.Address]*contracts.TokenInfo),
+		strategyCache:  make(map[string]*gridSide),
+		pairTokens:     make(map[uint64][2]common.Address),
+		headers:        newHeaderCache(headerCacheSize),
+		okxPriceClient: okxPriceClient,
+		binanceClient:  pricing.NewBinancePriceClient(logger),
+		outboxNotify:   make(chan struct{}, 1),
+	}
+	s.batch = newBatchController(cfg.Name, cfg.BlockBatchSize, cfg.MaxBlockBatchSize,
+		time.Duration(cfg.SlowRPCMs)*time.Millisecond, s.logger)
+
+	if cfg.WSURL != "" {
+		s.ws = newWSIngestor(cfg.WSURL, s.contractAddresses(), s.logger)
+	}
+
+	return s, nil
 }
 
-// Run starts the scanning loop. It blocks until ctx is cancelled.
+// Run starts the scanning loop. It blocks until ctx is cancelled, or returns
+// ErrReorgTooDeep if the chain reorganized beyond the configured reorg_depth,
+// or contracts.ErrABIMismatch if a log does not match the event ABI it claims.
 func (s *Scanner) Run(ctx context.Context) error {
 	// Pre-populate token cache from DB to avoid redundant RPC calls on restart.
 	// This is critical for rate-limited RPC endpoints (e.g. Tatum free tier: 5 req/min)
@@ -178,9 +240,35 @@ func (s *Scanner) Run(ctx context.Context) error {
 		s.logger.Warn("failed to pre-populate token cache from DB (will fetch from chain)", "error", err)
 	}
 
+	// Watch the strategy contracts whitelisted in previous runs.
+	if err := s.loadWhitelistedStrategies(ctx); err != nil {
+		return err
+	}
+
+	if err := s.loadPausedState(ctx); err != nil {
+		return fmt.Errorf("load paused state: %w", err)
+	}
+
+	// Resume the contract versions switched to by indexed facet upgrades.
+	if err := s.loadVersionSchedule(ctx); err != nil {
+		return fmt.Errorf("load contract versions: %w", err)
+	}
+
+	// Publish the Kafka messages queued by this and previous runs
+	go s.runOutboxRelay(ctx)
+
 	// Start APR updater in background goroutine
 	go s.runAPRUpdater(ctx)
 
+	if s.cfg.Reconcile.Interval > 0 {
+		go s.runReconciler(ctx)
+	}
+
+	// Start WebSocket ingestion; polling below covers anything it misses
+	if s.ws != nil {
+		go s.ws.run(ctx)
+	}
+
 	// Determine start block
 	lastBlock, err := s.repo.GetLastBlock(ctx, s.cfg.ChainID)
 	if err != nil {
@@ -192,11 +280,19 @@ func (s *Scanner) Run(ctx context.Context) error {
 		startBlock = lastBlock + 1
 	}
 
-	s.logger.Info("starting scanner", "start_block", startBlock)
+	// Resume with the batch size learned in the previous run
+	batchSize, err := s.repo.GetBatchSize(ctx, s.cfg.ChainID)
+	if err != nil {
+		s.logger.Warn("failed to load learned batch size, using block_batch_size", "error", err)
+	} else if batchSize > 0 {
+		s.batch.restore(batchSize)
+	}
+
+	s.logger.Info("starting scanner", "start_block", startBlock, "batch_size", s.batch.current())
 
 	currentBlock := startBlock
 	pollInterval := time.Duration(s.cfg.PollInterval) * time.Millisecond
-	var latestBlock uint64
+	var latestBlock, safeBlock uint64
 
 	for {
 		select {
@@ -207,36 +303,94 @@ func (s *Scanner) Run(ctx context.Context) error {
 		}
 
 		// Only fetch the latest block number when we're close to the chain tip
-		// (within 100 blocks) or on the first iteration (latestBlock == 0).
-		if latestBlock == 0 || latestBlock < currentBlock+100 {
-			newBlock, err := s.client.BlockNumber(ctx)
+		// (within 100 blocks), caught up with the safe block, or on the first
+		// iteration (latestBlock == 0). The safe/finalized tag may trail the
+		// head by more than 100 blocks, so being caught up alone refreshes it.
+		if latestBlock == 0 || latestBlock < currentBlock+100 || currentBlock > safeBlock {
+			newBlock, err := s.latestBlockNumber(ctx)
 			if err != nil {
 				s.logger.Error("failed to get latest block", "error", err)
 				time.Sleep(pollInterval)
 				continue
 			}
 			latestBlock = newBlock
-		}
 
-		// Apply confirmations
-		safeBlock := latestBlock
-		if safeBlock > s.cfg.Confirmations {
-			safeBlock -= s.cfg.Confirmations
+			// Apply confirmations or the node's safe/finalized tag
+			safeBlock = s.resolveSafeBlock(ctx, latestBlock)
 		}
 
 		if currentBlock > safeBlock {
-			// We're caught up, wait for new blocks
-			time.Sleep(pollInterval)
+			// We're caught up. In tip mode, publish provisional events for the
+			// unconfirmed blocks, then wait for new blocks.
+			if s.cfg.TipMode {
+				if err := s.scanTip(ctx, currentBlock, latestBlock); err != nil {
+					s.logger.Warn("failed to scan tip", "from", currentBlock, "to", latestBlock, "error", err)
+				}
+			}
+			s.waitForNewBlock(ctx, pollInterval)
+			continue
+		}
+
+		// Far behind the head: fetch windows in parallel and commit in order,
+		// stopping short of the head where live mode takes over.
+		if workers := s.backfillWorkers(); workers > 0 && safeBlock-currentBlock > s.backfillDistance(workers) {
+			next, err := s.backfill(ctx, currentBlock, safeBlock-s.backfillDistance(workers), workers)
+			currentBlock = next
+			if errors.Is(err, contracts.ErrABIMismatch) {
+				return err
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("backfill failed", "block", currentBlock, "error", err)
+					time.Sleep(pollInterval)
+				}
+			}
 			continue
 		}
 
 		// Calculate the end block for this batch
-		endBlock := min(currentBlock+s.cfg.BlockBatchSize-1, safeBlock)
+		endBlock := min(currentBlock+s.batch.current()-1, safeBlock)
 
-		s.logger.Info("scanning blocks", "from", currentBlock, "to", endBlock, "latest", latestBlock)
+		// Make sure the block before this batch is still the one we indexed.
+		// On a reorg, roll back to the common ancestor and re-scan from there.
+		startHeader, reorged, err := s.checkReorg(ctx, currentBlock)
+		if err != nil {
+			s.logger.Error("failed to check for reorg", "block", currentBlock, "error", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+		if reorged {
+			resumeBlock, err := s.rollbackReorg(ctx, currentBlock)
+			if errors.Is(err, ErrReorgTooDeep) {
+				return err
+			}
+			if err != nil {
+				s.logger.Error("failed to roll back reorg", "block", currentBlock, "error", err)
+				time.Sleep(pollInterval)
+				continue
+			}
+			currentBlock = resumeBlock
+			continue
+		}
+
+		s.logger.Info("scanning blocks", "from", currentBlock, "to", endBlock, "latest", latestBlock,
+			"batch_size", s.batch.current(), "splits", s.batch.splitCount())
 
-		// Fetch logs with adaptive range splitting on "limit exceeded" errors
-		logs, err := s.fetchLogsAdaptive(ctx, currentBlock, endBlock)
+		// The end header anchors the batch. It is read before the logs and
+		// checked again after them, see checkEndHeader.
+		endHeader := startHeader
+		if endBlock != currentBlock {
+			endHeader, err = s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(endBlock))
+			if err != nil {
+				s.logger.Error("failed to fetch header", "block", endBlock, "error", err)
+				time.Sleep(pollInterval)
+				continue
+			}
+		}
+
+		// Fetch logs from the WebSocket buffer, or with adaptive range
+		// splitting on "limit exceeded" errors
+		logs, fetched, err := s.fetchBatchLogs(ctx, currentBlock, endBlock)
 		if err != nil {
 			if err != context.Canceled {
 				s.logger.Error("failed to fetch logs", "from", currentBlock, "to", endBlock, "error", err)
@@ -245,8 +399,29 @@ func (s *Scanner) Run(ctx context.Context) error {
 			continue
 		}
 
+		// Record the hashes of the blocks this batch is anchored on. A changed
+		// end header, or a log whose block hash disagrees with the headers,
+		// means the node switched forks while we were fetching, so the batch
+		// is retried.
+		err = s.checkEndHeader(ctx, endHeader)
+		var blockRefs []db.BlockRef
+		if err == nil {
+			blockRefs, err = batchBlockRefs(startHeader, endHeader, logs)
+		}
+		if err != nil {
+			s.logger.Warn("chain changed while fetching batch, retrying", "from", currentBlock, "to", endBlock, "error", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+
 		// Process all logs in a single transaction
-		if err := s.processLogs(ctx, logs, endBlock); err != nil {
+		if err := s.processLogs(ctx, logs, fetched, currentBlock, endBlock, blockRefs); err != nil {
+			if errors.Is(err, contracts.ErrABIMismatch) {
+				// Decoding would silently produce wrong values; stop until the
+				// decoder knows the new layout.
+				s.logger.Error("event ABI mismatch, stopping scanner", "from", currentBlock, "to", endBlock, "error", err)
+				return err
+			}
 			s.logger.Error("failed to process logs", "from", currentBlock, "to", endBlock, "error", err)
 			time.Sleep(pollInterval)
 			continue
@@ -254,10 +429,59 @@ func (s *Scanner) Run(ctx context.Context) error {
 
 		s.logger.Info("processed blocks", "from", currentBlock, "to", endBlock, "events", len(logs))
 
+		if s.ws != nil {
+			s.ws.prune(endBlock)
+		}
+
 		currentBlock = endBlock + 1
 	}
 }
 
+// latestBlockNumber returns the chain head, taken from the WebSocket
+// subscription when it is live so no RPC request is spent on it. A
+// subscription without a new head for wsStaleHeadTimeout is not trusted, and
+// the head is read over RPC instead.
+func (s *Scanner) latestBlockNumber(ctx context.Context) (uint64, error) {
+	if s.ws != nil {
+		if latest := s.ws.latestBlock(); latest > 0 {
+			return latest, nil
+		}
+	}
+	return s.client.BlockNumber(ctx)
+}
+
+// waitForNewBlock sleeps for pollInterval, returning early when the WebSocket
+// subscription reports a new head.
+func (s *Scanner) waitForNewBlock(ctx context.Context, pollInterval time.Duration) {
+	var wake <-chan struct{}
+	if s.ws != nil {
+		wake = s.ws.wake
+	}
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-wake:
+	case <-timer.C:
+	}
+}
+
+// fetchBatchLogs returns the logs for [fromBlock, toBlock], served from the
+// WebSocket buffer when the range is fully covered by the live subscription
+// and fetched with fetchLogsAdaptive otherwise (startup, gaps, reconnects).
+// It also returns the contracts the logs were fetched for; the subscription
+// only covers the contracts watched when the scanner started.
+func (s *Scanner) fetchBatchLogs(ctx context.Context, fromBlock, toBlock uint64) ([]types.Log, []common.Address, error) {
+	if s.ws != nil {
+		if logs, ok := s.ws.logsInRange(fromBlock, toBlock); ok {
+			return logs, s.ws.addresses, nil
+		}
+	}
+	addresses := s.contractAddresses()
+	logs, err := s.fetchLogsAdaptive(ctx, fromBlock, toBlock)
+	return logs, addresses, err
+}
+
 // isLimitExceededErr checks whether an error from the RPC node indicates that
 // the getLogs request exceeded the node's limits (response size, block range,
 // or rate). Different RPC providers return different error messages.
@@ -280,14 +504,22 @@ func isLimitExceededErr(err error) bool {
 // bisects the range until each sub-range succeeds or a single block still
 // fails (in which case it fetches that block's events per-topic as a fallback).
 func (s *Scanner) fetchLogsAdaptive(ctx context.Context, fromBlock, toBlock uint64) ([]types.Log, error) {
-	logs, err := s.fetchLogs(ctx, fromBlock, toBlock)
+	return s.fetchAddressLogsAdaptive(ctx, s.contractAddresses(), fromBlock, toBlock)
+}
+
+// fetchAddressLogsAdaptive is fetchLogsAdaptive for the logs of addresses.
+func (s *Scanner) fetchAddressLogsAdaptive(ctx context.Context, addresses []common.Address, fromBlock, toBlock uint64) ([]types.Log, error) {
+	started := time.Now()
+	logs, err := s.fetchLogs(ctx, addresses, fromBlock, toBlock)
 	if err == nil {
+		s.batch.observeSuccess(toBlock-fromBlock+1, time.Since(started))
 		return logs, nil
 	}
 
 	if !isLimitExceededErr(err) {
 		return nil, err
 	}
+	s.batch.observeLimitExceeded(toBlock - fromBlock + 1)
 
 	s.logger.Warn("fetchLogs failed", "fromBlock", fromBlock, "toBlock", toBlock, "error", err)
 
@@ -295,7 +527,7 @@ func (s *Scanner) fetchLogsAdaptive(ctx context.Context, fromBlock, toBlock uint
 	if fromBlock == toBlock {
 		s.logger.Warn("single block exceeds log limit, fetching per-address",
 			"block", fromBlock)
-		return s.fetchLogsSingleBlockPerAddress(ctx, fromBlock)
+		return s.fetchLogsSingleBlockPerAddress(ctx, addresses, fromBlock)
 	}
 
 	// Bisect the range and fetch each half
@@ -303,12 +535,12 @@ func (s *Scanner) fetchLogsAdaptive(ctx context.Context, fromBlock, toBlock uint
 	s.logger.Warn("splitting block range due to limit exceeded",
 		"from", fromBlock, "to", toBlock, "mid", mid)
 
-	logsFirst, err := s.fetchLogsAdaptive(ctx, fromBlock, mid)
+	logsFirst, err := s.fetchAddressLogsAdaptive(ctx, addresses, fromBlock, mid)
 	if err != nil {
 		return nil, err
 	}
 
-	logsSecond, err := s.fetchLogsAdaptive(ctx, mid+1, toBlock)
+	logsSecond, err := s.fetchAddressLogsAdaptive(ctx, addresses, mid+1, toBlock)
 	if err != nil {
 		return nil, err
 	}
@@ -320,9 +552,7 @@ func (s *Scanner) fetchLogsAdaptive(ctx context.Context, fromBlock, toBlock uint
 // each contract address individually. This is a fallback when even a single-block
 // query with all addresses exceeds the RPC limit. If a per-address query still
 // exceeds the limit, it falls back to receipt-based log extraction.
-func (s *Scanner) fetchLogsSingleBlockPerAddress(ctx context.Context, blockNum uint64) ([]types.Log, error) {
-	addresses := []common.Address{s.gridExAddr, s.linearStrategyAddr, s.geometryStrategyAddr}
-
+func (s *Scanner) fetchLogsSingleBlockPerAddress(ctx context.Context, addresses []common.Address, blockNum uint64) ([]types.Log, error) {
 	var allLogs []types.Log
 	blockBig := new(big.Int).SetUint64(blockNum)
 
@@ -339,7 +569,7 @@ func (s *Scanner) fetchLogsSingleBlockPerAddress(ctx context.Context, blockNum u
 				// Even a single address exceeds the limit — fall back to receipt scanning
 				s.logger.Warn("single block per-address still exceeds limit, falling back to receipt scanning",
 					"block", blockNum, "address", addr.Hex())
-				return s.fetchLogsFromReceipts(ctx, blockNum)
+				return s.fetchLogsFromReceipts(ctx, addresses, blockNum)
 			}
 			return nil, fmt.Errorf("fetch logs block %d address %s: %w", blockNum, addr.Hex(), err)
 		}
@@ -352,45 +582,28 @@ func (s *Scanner) fetchLogsSingleBlockPerAddress(ctx context.Context, blockNum u
 	return allLogs, nil
 }
 
-// fetchLogsFromReceipts is the last-resort fallback. It fetches the full block,
-// iterates over every transaction receipt, and filters logs that match our
-// contract addresses. This avoids eth_getLogs entirely.
-func (s *Scanner) fetchLogsFromReceipts(ctx context.Context, blockNum uint64) ([]types.Log, error) {
+// fetchLogsFromReceipts is the last-resort fallback. It fetches every receipt
+// of the block (see fetchBlockReceipts) and filters the logs of addresses.
+// This avoids eth_getLogs entirely.
+func (s *Scanner) fetchLogsFromReceipts(ctx context.Context, addresses []common.Address, blockNum uint64) ([]types.Log, error) {
 	s.logger.Info("fetching logs from receipts", "block", blockNum)
 
-	block, err := s.client.BlockByNumber(ctx, new(big.Int).SetUint64(blockNum))
+	receipts, err := s.fetchBlockReceipts(ctx, blockNum)
 	if err != nil {
-		return nil, fmt.Errorf("fetch block %d: %w", blockNum, err)
+		return nil, err
 	}
 
 	// Build lookup set for fast address matching
-	addressSet := map[common.Address]struct{}{
-		s.gridExAddr:           {},
-		s.linearStrategyAddr:   {},
-		s.geometryStrategyAddr: {},
+	addressSet := make(map[common.Address]struct{})
+	for _, addr := range addresses {
+		addressSet[addr] = struct{}{}
 	}
 
-	var allLogs []types.Log
-
-	for _, tx := range block.Transactions() {
-		receipt, err := s.client.TransactionReceipt(ctx, tx.Hash())
-		if err != nil {
-			return nil, fmt.Errorf("fetch receipt for tx %s in block %d: %w",
-				tx.Hash().Hex(), blockNum, err)
-		}
-
-		for _, log := range receipt.Logs {
-			// Check address matches only — no topic filtering
-			if _, ok := addressSet[log.Address]; !ok {
-				continue
-			}
-			allLogs = append(allLogs, *log)
-		}
-	}
+	allLogs := receiptLogs(receipts, addressSet)
 
 	s.logger.Info("extracted logs from receipts",
 		"block", blockNum,
-		"transactions", len(block.Transactions()),
+		"transactions", len(receipts),
 		"matched_logs", len(allLogs))
 
 	// Already ordered by log index within the block from receipt ordering,
@@ -400,13 +613,23 @@ func (s *Scanner) fetchLogsFromReceipts(ctx context.Context, blockNum uint64) ([
 	return allLogs, nil
 }
 
+// contractAddresses returns the GridEx contract, the Vault (if configured) and
+// every watched strategy contract.
+func (s *Scanner) contractAddresses() []common.Address {
+	addresses := []common.Address{s.gridExAddr}
+	if s.vaultAddr != (common.Address{}) {
+		addresses = append(addresses, s.vaultAddr)
+	}
+	if s.strategies != nil {
+		addresses = append(addresses, s.strategies.addresses(0)...)
+	}
+	return addresses
+}
+
 // fetchLogs fetches all GridEx and strategy contract logs in the given block range.
 // It filters only by contract addresses — no topic filtering — so that all events
 // emitted by these contracts are captured.
-func (s *Scanner) fetchLogs(ctx context.Context, fromBlock, toBlock uint64) ([]types.Log, error) {
-	// Build the list of contract addresses to watch
-	addresses := []common.Address{s.gridExAddr, s.linearStrategyAddr, s.geometryStrategyAddr}
-
+func (s *Scanner) fetchLogs(ctx context.Context, addresses []common.Address, fromBlock, toBlock uint64) ([]types.Log, error) {
 	query := ethereum.FilterQuery{
 		FromBlock: new(big.Int).SetUint64(fromBlock),
 		ToBlock:   new(big.Int).SetUint64(toBlock),
@@ -440,30 +663,81 @@ func logLess(a, b types.Log) bool {
 	return a.Index < b.Index
 }
 
-// processLogs processes all logs within a single database transaction.
-func (s *Scanner) processLogs(ctx context.Context, logs []types.Log, endBlock uint64) error {
-	// Collect all kafka messages to send after DB commit
+// processLogs processes the logs of [fromBlock, endBlock] within a single
+// database transaction. fetched are the contracts the logs were fetched for;
+// logs of strategy contracts whitelisted since then are fetched here.
+// blockRefs are the block hashes recorded for reorg detection.
+func (s *Scanner) processLogs(ctx context.Context, logs []types.Log, fetched []common.Address, fromBlock, endBlock uint64, blockRefs []db.BlockRef) error {
+	// Collect all kafka messages to queue in the outbox with the batch
 	var kafkaMsgs []*kafka.Message
 
-	return s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
-		for _, log := range logs {
+	logs, blockRefs, err := s.addUnfetchedStrategyLogs(ctx, logs, fetched, fromBlock, endBlock, blockRefs)
+	if err != nil {
+		return err
+	}
+
+	// One batch request for the headers of every block with events, so each
+	// handler stamps its event with the block time.
+	if err := s.prefetchHeaders(ctx, logs); err != nil {
+		return err
+	}
+
+	s.quarantined, s.unconfiguredFacetLogs = 0, 0
+	err = s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		for i := 0; i < len(logs); i++ {
+			log := logs[i]
 			if len(log.Topics) == 0 {
 				continue
 			}
 
+			watched := s.strategies.size()
 			msgs, err := s.processLog(ctx, tx, log)
 			if err != nil {
 				return fmt.Errorf("process log block=%d txIdx=%d logIdx=%d: %w",
 					log.BlockNumber, log.TxIndex, log.Index, err)
 			}
 			kafkaMsgs = append(kafkaMsgs, msgs...)
+
+			// A strategy whitelisted by this log is watched from here on.
+			if added := s.strategies.addresses(watched); len(added) > 0 {
+				logs, blockRefs, err = s.addStrategyLogs(ctx, logs, added, log, endBlock, blockRefs)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Confirm or revert events published provisionally (tip mode) for these
+		// blocks. Runs regardless of tip_mode so a toggle leaves nothing pending.
+		resolved, err := s.resolveProvisionalEvents(ctx, tx, logs, endBlock)
+		if err != nil {
+			return err
 		}
+		kafkaMsgs = append(kafkaMsgs, resolved...)
 
 		// Update the last scanned block
 		if err := db.UpdateLastBlock(ctx, tx, s.cfg.ChainID, endBlock); err != nil {
 			return err
 		}
 
+		// Remember the learned batch size across restarts
+		if s.batch != nil {
+			if err := db.UpdateBatchSize(ctx, tx, s.cfg.ChainID, s.batch.current()); err != nil {
+				return err
+			}
+		}
+
+		// Record block hashes for reorg detection and drop history that is
+		// deeper than any reorg we are prepared to roll back.
+		if err := db.InsertBlockHashes(ctx, tx, s.cfg.ChainID, blockRefs); err != nil {
+			return err
+		}
+		if endBlock > s.cfg.ReorgDepth {
+			if err := db.PruneReorgHistory(ctx, tx, s.cfg.ChainID, endBlock-s.cfg.ReorgDepth); err != nil {
+				return err
+			}
+		}
+
 		// Compute and upsert protocol stats
 		if err := s.updateProtocolStats(ctx, tx, endBlock); err != nil {
 			s.logger.Warn("failed to update protocol stats", "error", err)
@@ -475,28 +749,29 @@ func (s *Scanner) processLogs(ctx context.Context, logs []types.Log, endBlock ui
 			s.logger.Warn("failed to update pair stats", "error", err)
 		}
 
-		// Send Kafka messages after successful DB operations but before commit
-		// Note: If Kafka send fails, the transaction will be rolled back
-		if len(kafkaMsgs) > 0 {
-			if err := s.producer.SendBatch(ctx, kafkaMsgs); err != nil {
-				return fmt.Errorf("send kafka messages: %w", err)
-			}
+		// Queue the Kafka messages in the same transaction; the outbox relay
+		// publishes them once it commits.
+		return s.enqueue(ctx, tx, kafkaMsgs)
+	})
+	if err != nil {
+		return err
+	}
+	if len(kafkaMsgs) > 0 {
+		s.notifyOutbox()
+	}
 
-			// Get the latest Kafka offset and store it for tradebot synchronization
-			lastOffset, err := s.producer.LastOffset(s.kafkaBrokers, s.kafkaTopic)
-			if err != nil {
-				s.logger.Warn("failed to get kafka offset", "error", err)
-				// Non-fatal: offset tracking is for tradebot optimization
-			} else if lastOffset > 0 {
-				if err := db.UpdateKafkaOffset(ctx, tx, s.cfg.ChainID, lastOffset); err != nil {
-					s.logger.Warn("failed to update kafka offset", "error", err)
-					// Non-fatal: offset tracking is for tradebot optimization
-				}
-			}
+	if s.quarantined > 0 {
+		metrics.UnknownLogs.Add(s.cfg.Name, int64(s.quarantined))
+	}
+	if s.unconfiguredFacetLogs > 0 {
+		metrics.UnconfiguredFacetLogs.Add(s.cfg.Name, int64(s.unconfiguredFacetLogs))
+	}
+	if s.changesPausedState(logs) {
+		if err := s.loadPausedState(ctx); err != nil {
+			s.logger.Warn("failed to reload paused state", "error", err)
 		}
-
-		return nil
-	})
+	}
+	return nil
 }
 
 // updateProtocolStats computes aggregate stats and upserts them into protocol_stats.
@@ -517,7 +792,12 @@ func (s *Scanner) updateProtocolStats(ctx context.Context, tx pgx.Tx, blockNumbe
 		}
 	}
 
-	stats, err := db.ComputeProtocolStats(ctx, tx, s.cfg.ChainID, nativeTokenPrice)
+	anchors, err := s.pricingAnchors(ctx)
+	if err != nil {
+		return fmt.Errorf("load pricing anchors: %w", err)
+	}
+
+	stats, err := db.ComputeProtocolStats(ctx, tx, s.cfg.ChainID, anchors, nativeTokenPrice)
 	if err != nil {
 		return err
 	}
@@ -533,33 +813,108 @@ func (s *Scanner) updatePairStats(ctx context.Context, tx pgx.Tx, blockNumber ui
 }
 
 // processLog processes a single event log and returns Kafka messages to send.
+// A log of a known event that does not match its ABI fails with
+// contracts.ErrABIMismatch.
 func (s *Scanner) processLog(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
 	topic := log.Topics[0]
 
+	decoder := s.decoderAt(log)
+	if err := decoder.CheckLayout(log); err != nil {
+		return nil, err
+	}
+
+	if s.strategies.watches(log.Address) {
+		if strat, ok := s.strategies.resolve(log.Address, topic); ok && topic == strat.CreatedTopic() {
+			return s.handleStrategyCreated(ctx, tx, log, strat)
+		}
+		return s.quarantineLog(ctx, tx, log)
+	}
+
+	// The Vault is only watched for its ownership changes.
+	if log.Address == s.vaultAddr && log.Address != s.gridExAddr {
+		if topic == contracts.TopicOwnershipTransferred {
+			return s.handleOwnershipTransferred(ctx, tx, log)
+		}
+		return s.quarantineLog(ctx, tx, log)
+	}
+
+	// An event of another configured contract version than the one in force
+	// at the log means abi_versions is missing a switch: stop rather than
+	// skip it, so the scan resumes at this log once the switch is configured.
+	// Events no version knows are quarantined.
+	if !decoder.Knows(topic) {
+		if version, ok := s.versions.versionOf(log, topic); ok {
+			return nil, fmt.Errorf("%w: event %s of %s at block %d before its version is in force (contract %s, tx %s, log %d); add a from_block or facet to abi_versions",
+				contracts.ErrABIMismatch, topic.Hex(), version, log.BlockNumber, log.Address.Hex(), log.TxHash.Hex(), log.Index)
+		}
+		// After an upgrade to a facet of no configured version, an unknown
+		// event may be one whose layout changed under a new topic.
+		if facet, ok := s.versions.unconfiguredFacet(log); ok {
+			s.logger.Error("unknown GridEx event after an upgrade to an unconfigured facet",
+				"facet", facet.Hex(),
+				"topic", topic.Hex(),
+				"block", log.BlockNumber,
+				"tx", log.TxHash.Hex(),
+				"log_index", log.Index,
+			)
+			s.unconfiguredFacetLogs++
+		}
+		return s.quarantineLog(ctx, tx, log)
+	}
+
 	switch topic {
-	case contracts.TopicLinearStrategyCreated:
-		return s.handleLinearStrategyCreated(ctx, tx, log)
-	case contracts.TopicGeometryStrategyCreated:
-		return s.handleGeometryStrategyCreated(ctx, tx, log)
 	case contracts.TopicPairCreated:
 		return s.handlePairCreated(ctx, tx, log)
-	case contracts.TopicGridOrderCreated:
+	case contracts.TopicGridOrderCreated, contracts.TopicGridOrderCreatedV1:
 		return s.handleGridOrderCreated(ctx, tx, log)
-	case contracts.TopicFilledOrder:
+	case contracts.TopicFilledOrder, contracts.TopicFilledOrderV1:
 		return s.handleFilledOrder(ctx, tx, log)
-	case contracts.TopicCancelGridOrder:
+	case contracts.TopicCancelGridOrder, contracts.TopicCancelGridOrderV1:
 		return s.handleCancelGridOrder(ctx, tx, log)
-	case contracts.TopicCancelWholeGrid:
+	case contracts.TopicCancelWholeGrid, contracts.TopicCancelWholeGridV1:
 		return s.handleCancelWholeGrid(ctx, tx, log)
-	case contracts.TopicGridFeeChanged:
+	case contracts.TopicGridFeeChanged, contracts.TopicGridFeeChangedV1:
 		return s.handleGridFeeChanged(ctx, tx, log)
-	case contracts.TopicWithdrawProfit:
+	case contracts.TopicWithdrawProfit, contracts.TopicWithdrawProfitV1:
 		return s.handleWithdrawProfit(ctx, tx, log)
+	case contracts.TopicStrategyWhitelistUpdated:
+		return s.handleStrategyWhitelistUpdated(ctx, tx, log)
+	case contracts.TopicCollectProtocol:
+		return s.handleCollectProtocol(ctx, tx, log)
+	case contracts.TopicOneshotProtocolFeeChanged:
+		return s.handleOneshotProtocolFeeChanged(ctx, tx, log)
+	case contracts.TopicQuotableTokenUpdated:
+		return s.handleQuotableTokenUpdated(ctx, tx, log)
+	case contracts.TopicPaused, contracts.TopicUnpaused:
+		return s.handlePaused(ctx, tx, log)
+	case contracts.TopicFacetUpdated:
+		return s.handleFacetUpdated(ctx, tx, log)
+	case contracts.TopicOwnershipTransferred:
+		return s.handleOwnershipTransferred(ctx, tx, log)
+	case contracts.TopicRefundFailed:
+		return s.handleRefundFailed(ctx, tx, log)
 	default:
-		return nil, nil
+		return s.quarantineLog(ctx, tx, log)
 	}
 }
 
+// getOrFetchPairTokens returns the base and quote token of a pair, using
+// cache when available.
+func (s *Scanner) getOrFetchPairTokens(ctx context.Context, pairID uint64) (base, quote common.Address, err error) {
+	if tokens, ok := s.pairTokens[pairID]; ok {
+		return tokens[0], tokens[1], nil
+	}
+	base, quote, err = s.caller.GetPairTokens(ctx, pairID)
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	if s.pairTokens == nil {
+		s.pairTokens = make(map[uint64][2]common.Address)
+	}
+	s.pairTokens[pairID] = [2]common.Address{base, quote}
+	return base, quote, nil
+}
+
 // getOrFetchToken returns token info, using cache when available.
 func (s *Scanner) getOrFetchToken(ctx context.Context, tx pgx.Tx, addr common.Address, blockNumber uint64) (*contracts.TokenInfo, error) {
 	if info, ok := s.tokenCache[addr]; ok {
@@ -582,9 +937,41 @@ func (s *Scanner) getOrFetchToken(ctx context.Context, tx pgx.Tx, addr common.Ad
 	return info, nil
 }
 
+// getOrFetchTokens is getOrFetchToken for several tokens at once: the ones
+// missing from the cache are fetched in a single batch.
+func (s *Scanner) getOrFetchTokens(ctx context.Context, tx pgx.Tx, blockNumber uint64, addrs ...common.Address) ([]*contracts.TokenInfo, error) {
+	var missing []common.Address
+	for _, addr := range addrs {
+		if _, ok := s.tokenCache[addr]; !ok && !slices.Contains(missing, addr) {
+			missing = append(missing, addr)
+		}
+	}
+
+	if len(missing) > 0 {
+		infos, err := s.caller.GetTokenInfos(ctx, missing)
+		if err != nil {
+			return nil, fmt.Errorf("fetch token infos: %w", err)
+		}
+		for i, info := range infos {
+			s.tokenCache[missing[i]] = info
+			if err := db.UpsertToken(ctx, tx, s.cfg.ChainID,
+				strings.ToLower(missing[i].Hex()), info.Symbol, info.Name, int(info.Decimals), blockNumber); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	out := make([]*contracts.TokenInfo, len(addrs))
+	for i, addr := range addrs {
+		out[i] = s.tokenCache[addr]
+	}
+	return out, nil
+}
+
 // loadTokenCache pre-populates the in-memory token cache from the database.
-// This avoids expensive on-chain RPC calls (3 per token) for tokens that have
-// already been indexed, which is critical for rate-limited endpoints.
+// This avoids on-chain RPC calls (a multicall, or 3 calls on chains without
+// Multicall3, per token) for tokens that have already been indexed, which is
+// critical for rate-limited endpoints.
 func (s *Scanner) loadTokenCache(ctx context.Context) error {
 	rows, err := s.repo.GetTokensByChain(ctx, s.cfg.ChainID)
 	if err != nil {
@@ -605,13 +992,19 @@ func (s *Scanner) loadTokenCache(ctx context.Context) error {
 	return nil
 }
 
-func (s *Scanner) makeBaseMsg(log types.Log, eventType kafka.EventType) *kafka.Message {
-	return &kafka.Message{
-		EventType:   eventType,
-		ChainID:     s.cfg.ChainID,
-		BlockNumber: log.BlockNumber,
-		TxHash:      log.TxHash.Hex(),
-		LogIndex:    log.Index,
-		Timestamp:   time.Now().Unix(),
+func (s *Scanner) makeBaseMsg(ctx context.Context, log types.Log, eventType kafka.EventType) (*kafka.Message, error) {
+	blockTime, err := s.blockTime(ctx, log)
+	if err != nil {
+		return nil, err
 	}
+	return &kafka.Message{
+		EventType:      eventType,
+		ChainID:        s.cfg.ChainID,
+		BlockNumber:    log.BlockNumber,
+		TxHash:         log.TxHash.Hex(),
+		LogIndex:       log.Index,
+		Timestamp:      time.Now().Unix(),
+		BlockTimestamp: blockTime.Unix(),
+		BlockHash:      log.BlockHash.Hex(),
+	}, nil
 }
@@ -3,23 +3,50 @@ package scanner
 import (
 	"context"
 	"errors"
+	"expvar"
+	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"math"
 	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/gridex/indexer/config"
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/fixedpoint"
+	"github.com/gridex/indexer/kafka"
+	"github.com/gridex/indexer/metrics"
+	"github.com/gridex/indexer/pricing"
 )
 
 type mockEthClient struct {
 	blockNumberFn        func(ctx context.Context) (uint64, error)
 	filterLogsFn         func(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
 	blockByNumberFn      func(ctx context.Context, number *big.Int) (*types.Block, error)
+	headerByNumberFn     func(ctx context.Context, number *big.Int) (*types.Header, error)
 	transactionReceiptFn func(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	batchCallContextFn   func(ctx context.Context, b []gethrpc.BatchElem) error
 }
 
 func (m *mockEthClient) BlockNumber(ctx context.Context) (uint64, error) {
@@ -43,6 +70,13 @@ func (m *mockEthClient) BlockByNumber(ctx context.Context, number *big.Int) (*ty
 	return m.blockByNumberFn(ctx, number)
 }
 
+func (m *mockEthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if m.headerByNumberFn == nil {
+		panic("HeaderByNumber not mocked")
+	}
+	return m.headerByNumberFn(ctx, number)
+}
+
 func (m *mockEthClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
 	if m.transactionReceiptFn == nil {
 		panic("TransactionReceipt not mocked")
@@ -50,10 +84,243 @@ func (m *mockEthClient) TransactionReceipt(ctx context.Context, txHash common.Ha
 	return m.transactionReceiptFn(ctx, txHash)
 }
 
+func (m *mockEthClient) BatchCallContext(ctx context.Context, b []gethrpc.BatchElem) error {
+	if m.batchCallContextFn == nil {
+		panic("BatchCallContext not mocked")
+	}
+	return m.batchCallContextFn(ctx, b)
+}
+
+// batchEthClient adds BatchCallContext to a plain ethclient.Client.
+type batchEthClient struct {
+	*ethclient.Client
+}
+
+func (c batchEthClient) BatchCallContext(ctx context.Context, b []gethrpc.BatchElem) error {
+	return c.Client.Client().BatchCallContext(ctx, b)
+}
+
+// fakeDB is a db.Pool whose statements are answered by execFn and queryFn.
+// Without them every statement affects one row and every query is empty.
+// Transactions share the fakeDB and only count commits and rollbacks; the
+// statements of a rolled back transaction stay recorded. Commits fail with
+// commitErr when it is set.
+type fakeDB struct {
+	execFn    func(sql string, args []any) pgconn.CommandTag
+	queryFn   func(sql string, args []any) [][]any
+	commitErr error
+
+	execs     []string
+	commits   int
+	rollbacks int
+}
+
+func (d *fakeDB) tx() *fakeTx { return &fakeTx{db: d} }
+
+func (d *fakeDB) Begin(context.Context) (pgx.Tx, error) { return d.tx(), nil }
+
+func (d *fakeDB) BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error) { return d.tx(), nil }
+
+func (d *fakeDB) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	d.execs = append(d.execs, sql)
+	if d.execFn != nil {
+		return d.execFn(sql, args), nil
+	}
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (d *fakeDB) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	var rows [][]any
+	if d.queryFn != nil {
+		rows = d.queryFn(sql, args)
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+func (d *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, _ := d.Query(ctx, sql, args...)
+	return fakeRow{rows.(*fakeRows)}
+}
+
+// fakeTx is a transaction, or a savepoint, of a fakeDB. The methods it does
+// not override panic.
+type fakeTx struct {
+	pgx.Tx
+	db        *fakeDB
+	savepoint bool
+	done      bool
+}
+
+func (tx *fakeTx) Begin(context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: tx.db, savepoint: true}, nil
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	if !tx.savepoint {
+		if tx.db.commitErr != nil {
+			return tx.db.commitErr
+		}
+		tx.db.commits++
+	}
+	tx.done = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	if !tx.done && !tx.savepoint {
+		tx.db.rollbacks++
+	}
+	tx.done = true
+	return nil
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+// fakeRows scans each row's values into the destinations of the same types.
+type fakeRows struct {
+	pgx.Rows
+	rows [][]any
+	n    int
+}
+
+func (r *fakeRows) Next() bool {
+	r.n++
+	return r.n <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.rows[r.n-1][i]))
+	}
+	return nil
+}
+
+func (r *fakeRows) Close()     {}
+func (r *fakeRows) Err() error { return nil }
+
+// fakeRow is the first row of a query.
+type fakeRow struct{ rows *fakeRows }
+
+func (r fakeRow) Scan(dest ...any) error {
+	if !r.rows.Next() {
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+// rowsFor answers the queries containing each key with its rows.
+func rowsFor(answers map[string][][]any) func(sql string, args []any) [][]any {
+	return func(sql string, _ []any) [][]any {
+		for key, rows := range answers {
+			if strings.Contains(sql, key) {
+				return rows
+			}
+		}
+		return nil
+	}
+}
+
 func testLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))
 }
 
+// testStrategies registers a single linear strategy contract.
+func testStrategies(t *testing.T, linear common.Address) *strategyRegistry {
+	t.Helper()
+	r, err := newStrategyRegistry([]config.StrategyConfig{{Type: "linear", Address: linear.Hex()}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// testGridEx is the GridEx diamond the scanner tests index.
+var testGridEx = common.HexToAddress("0x4f805a66448f53fb6bfa5a7e29dbae36c158aacf")
+
+// newTestScanner returns a BSC scanner of testGridEx over pool, with the
+// latest ABI version, a linear strategy at 0x5 and the given headers cached.
+// Its client has no behaviour; tests replace it when they reach the chain.
+func newTestScanner(t *testing.T, pool db.Pool, headers ...*types.Header) *Scanner {
+	t.Helper()
+	decoder, err := contracts.NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := newVersionSchedule(nil, decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newHeaderCache(16)
+	for _, h := range headers {
+		cache.add(h)
+	}
+	return &Scanner{
+		client: &mockEthClient{}, repo: db.NewRepository(pool), cfg: config.ChainConfig{ChainID: 56, Name: t.Name()},
+		decoder: decoder, versions: versions, gridExAddr: testGridEx, strategies: testStrategies(t, common.HexToAddress("0x5")),
+		headers: cache, tokenCache: map[common.Address]*contracts.TokenInfo{}, strategyCache: map[string]*gridSide{}, logger: testLogger(),
+	}
+}
+
+var (
+	insertRe = regexp.MustCompile(`(?s)INSERT INTO \w+ \((.*?)\)\s*VALUES \((.*?)\)`)
+	selectRe = regexp.MustCompile(`(?s)SELECT (.*?) FROM`)
+)
+
+// insertedRow maps the columns of an INSERT to what it writes: the bound
+// argument of a $N placeholder, or the SQL literal itself.
+func insertedRow(t *testing.T, sql string, args []any) map[string]any {
+	t.Helper()
+	m := insertRe.FindStringSubmatch(sql)
+	if m == nil {
+		t.Fatalf("not an INSERT: %s", sql)
+	}
+	cols, values := strings.Split(m[1], ","), strings.Split(m[2], ",")
+	if len(cols) != len(values) {
+		t.Fatalf("%d columns for %d values: %s", len(cols), len(values), sql)
+	}
+	row := make(map[string]any, len(cols))
+	for i, col := range cols {
+		var v any = strings.TrimSpace(values[i])
+		if n, ok := strings.CutPrefix(v.(string), "$"); ok {
+			pos, err := strconv.Atoi(n)
+			if err != nil {
+				t.Fatalf("bad placeholder $%s: %s", n, sql)
+			}
+			v = args[pos-1]
+		}
+		row[strings.TrimSpace(col)] = v
+	}
+	return row
+}
+
+// selectedRow returns the values of row for the columns a SELECT lists.
+func selectedRow(t *testing.T, sql string, row map[string]any) []any {
+	t.Helper()
+	m := selectRe.FindStringSubmatch(sql)
+	if m == nil {
+		t.Fatalf("not a SELECT: %s", sql)
+	}
+	var out []any
+	for _, col := range strings.Split(m[1], ",") {
+		v, ok := row[strings.TrimSpace(col)]
+		if !ok {
+			t.Fatalf("no column %s in %v", col, row)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
 func TestIsLimitExceededErr(t *testing.T) {
 	cases := []struct {
 		name string
@@ -100,8 +367,8 @@ func TestFetchLogsAdaptive_NoSplit(t *testing.T) {
 		panic(err.Error())
 	}
 
-	s := &Scanner{client: client, logger: testLogger(), gridExAddr: grid, linearStrategyAddr: strategy}
-	logs, err := s.fetchLogs(ctx, fromBlock, fromBlock+100)
+	s := &Scanner{client: batchEthClient{client}, logger: testLogger(), gridExAddr: grid, strategies: testStrategies(t, strategy)}
+	logs, err := s.fetchLogs(ctx, s.contractAddresses(), fromBlock, fromBlock+100)
 	if err != nil {
 		t.Fatalf("fetchLogs err=%v", err)
 	}
@@ -149,7 +416,7 @@ func TestFetchLogsAdaptive_SplitsOnLimitExceeded(t *testing.T) {
 		},
 	}
 
-	s := &Scanner{client: m, logger: testLogger(), gridExAddr: grid, linearStrategyAddr: strategy}
+	s := &Scanner{client: m, logger: testLogger(), gridExAddr: grid, strategies: testStrategies(t, strategy)}
 	logs, err := s.fetchLogsAdaptive(ctx, 1, 10)
 	if err != nil {
 		t.Fatalf("fetchLogsAdaptive err=%v", err)
@@ -162,6 +429,37 @@ func TestFetchLogsAdaptive_SplitsOnLimitExceeded(t *testing.T) {
 	}
 }
 
+func TestFetchContractLogs_SplitsOnLimitExceeded(t *testing.T) {
+	grid := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	strategy := common.HexToAddress("0x0000000000000000000000000000000000000002")
+
+	var ranges [][2]uint64
+	m := &mockEthClient{filterLogsFn: func(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+		if len(q.Addresses) != 1 || q.Addresses[0] != strategy {
+			t.Fatalf("unexpected addresses %v", q.Addresses)
+		}
+		from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+		ranges = append(ranges, [2]uint64{from, to})
+		if to-from > 4 {
+			return nil, errors.New("query returned more than 10000 results")
+		}
+		return []types.Log{{Address: strategy, BlockNumber: from}}, nil
+	}}
+
+	s := &Scanner{client: m, logger: testLogger(), gridExAddr: grid, strategies: testStrategies(t, strategy)}
+	logs, err := s.fetchContractLogs(context.Background(), []common.Address{strategy}, 1, 10)
+	if err != nil {
+		t.Fatalf("fetchContractLogs err=%v", err)
+	}
+	want := [][2]uint64{{1, 10}, {1, 5}, {6, 10}}
+	if !slices.Equal(ranges, want) {
+		t.Fatalf("queried %v, want %v", ranges, want)
+	}
+	if len(logs) != 2 || logs[0].BlockNumber != 1 || logs[1].BlockNumber != 6 {
+		t.Fatalf("logs=%v", logs)
+	}
+}
+
 func TestFetchLogsAdaptive_SingleBlockFallsBackToPerAddressAndSorts(t *testing.T) {
 	ctx := context.Background()
 	grid := common.HexToAddress("0x0000000000000000000000000000000000000001")
@@ -191,7 +489,7 @@ func TestFetchLogsAdaptive_SingleBlockFallsBackToPerAddressAndSorts(t *testing.T
 		return nil, nil
 	}
 
-	s := &Scanner{client: m, logger: testLogger(), gridExAddr: grid, linearStrategyAddr: strategy}
+	s := &Scanner{client: m, logger: testLogger(), gridExAddr: grid, strategies: testStrategies(t, strategy)}
 	logs, err := s.fetchLogsAdaptive(ctx, 7, 7)
 	if err != nil {
 		t.Fatalf("fetchLogsAdaptive err=%v", err)
@@ -242,16 +540,30 @@ func TestFetchLogsSingleBlockPerAddress_LimitExceededFallsBackToReceipts(t *test
 		}
 		return block, nil
 	}
-	m.transactionReceiptFn = func(_ context.Context, h common.Hash) (*types.Receipt, error) {
-		r, ok := receipts[h]
-		if !ok {
-			return nil, errors.New("missing receipt")
+	// The node lacks eth_getBlockReceipts, so receipts come in one batch.
+	batches := 0
+	m.batchCallContextFn = func(_ context.Context, b []gethrpc.BatchElem) error {
+		batches++
+		for i := range b {
+			switch b[i].Method {
+			case "eth_getBlockReceipts":
+				b[i].Error = errors.New("the method eth_getBlockReceipts does not exist/is not available")
+			case "eth_getTransactionReceipt":
+				r, ok := receipts[b[i].Args[0].(common.Hash)]
+				if !ok {
+					b[i].Error = errors.New("missing receipt")
+					continue
+				}
+				*b[i].Result.(**types.Receipt) = r
+			default:
+				t.Fatalf("unexpected batch method %s", b[i].Method)
+			}
 		}
-		return r, nil
+		return nil
 	}
 
-	s := &Scanner{client: m, logger: testLogger(), gridExAddr: grid, linearStrategyAddr: strategy}
-	logs, err := s.fetchLogsSingleBlockPerAddress(ctx, blockNum)
+	s := &Scanner{client: m, logger: testLogger(), gridExAddr: grid, strategies: testStrategies(t, strategy)}
+	logs, err := s.fetchLogsSingleBlockPerAddress(ctx, s.contractAddresses(), blockNum)
 	if err != nil {
 		t.Fatalf("fetchLogsSingleBlockPerAddress err=%v", err)
 	}
@@ -265,4 +577,1897 @@ func TestFetchLogsSingleBlockPerAddress_LimitExceededFallsBackToReceipts(t *test
 	if logs[1].Address != strategy || logs[1].Index != 1 {
 		t.Fatalf("unexpected logs[1]=%+v", logs[1])
 	}
+	if batches != 2 || !s.blockReceiptsUnsupported.Load() {
+		t.Fatalf("batches=%d unsupported=%v, want 2 and true", batches, s.blockReceiptsUnsupported.Load())
+	}
+}
+
+func TestFetchBlockReceiptsAndTimes(t *testing.T) {
+	ctx := context.Background()
+	m := &mockEthClient{}
+	header := func(n uint64) *types.Header {
+		return &types.Header{Number: new(big.Int).SetUint64(n), Time: 1000 + n}
+	}
+	var methods []string
+	m.batchCallContextFn = func(_ context.Context, b []gethrpc.BatchElem) error {
+		for i := range b {
+			methods = append(methods, b[i].Method)
+			switch b[i].Method {
+			case "eth_getBlockReceipts":
+				*b[i].Result.(*[]*types.Receipt) = []*types.Receipt{{TxHash: common.HexToHash("0x01")}}
+			case "eth_getBlockByNumber":
+				n, _ := hexutil.DecodeUint64(b[i].Args[0].(string))
+				*b[i].Result.(**types.Header) = header(n)
+			default:
+				t.Fatalf("unexpected batch method %s", b[i].Method)
+			}
+		}
+		return nil
+	}
+	s := &Scanner{client: m, logger: testLogger(), headers: newHeaderCache(2)}
+
+	receipts, err := s.fetchBlockReceipts(ctx, 7)
+	if err != nil || len(receipts) != 1 {
+		t.Fatalf("receipts=%v err=%v", receipts, err)
+	}
+
+	logAt := func(n uint64) types.Log {
+		return types.Log{BlockNumber: n, BlockHash: header(n).Hash()}
+	}
+	logs := []types.Log{logAt(5), logAt(5), logAt(6)}
+	if err := s.prefetchHeaders(ctx, logs); err != nil {
+		t.Fatalf("prefetchHeaders err=%v", err)
+	}
+	if got, err := s.blockTime(ctx, logs[2]); err != nil || got.Unix() != 1006 {
+		t.Fatalf("blockTime(6)=%d err=%v want 1006", got.Unix(), err)
+	}
+	// Cached headers are not fetched again.
+	if err := s.prefetchHeaders(ctx, logs[1:]); err != nil {
+		t.Fatalf("prefetchHeaders err=%v", err)
+	}
+	// Receipts, then both blocks in one batch.
+	want := []string{"eth_getBlockReceipts", "eth_getBlockByNumber", "eth_getBlockByNumber"}
+	if !slices.Equal(methods, want) {
+		t.Fatalf("batch methods=%v want %v", methods, want)
+	}
+
+	// A header that no longer matches the logs' block hash fails the batch,
+	// as does a block whose header can't be fetched.
+	reorged := logAt(8)
+	reorged.BlockHash = common.HexToHash("0xbad")
+	if err := s.prefetchHeaders(ctx, []types.Log{reorged}); err == nil {
+		t.Fatalf("prefetchHeaders accepted a mismatched block hash")
+	}
+	m.headerByNumberFn = func(context.Context, *big.Int) (*types.Header, error) {
+		return nil, errors.New("header not found")
+	}
+	if _, err := s.blockTime(ctx, logAt(9)); err == nil {
+		t.Fatalf("blockTime fell back instead of failing")
+	}
+
+	// The least recently used header is evicted first.
+	s.headers.get(6, header(6).Hash())
+	s.headers.add(header(10))
+	if _, ok := s.headers.get(6, header(6).Hash()); !ok {
+		t.Fatalf("recently used header 6 evicted")
+	}
+	if _, ok := s.headers.get(5, header(5).Hash()); ok {
+		t.Fatalf("header 5 still cached past capacity")
+	}
+}
+
+func TestBatchBlockRefs(t *testing.T) {
+	start := &types.Header{Number: big.NewInt(10), ParentHash: common.HexToHash("0x09")}
+	end := &types.Header{Number: big.NewInt(12), ParentHash: common.HexToHash("0x11")}
+	logs := []types.Log{
+		{BlockNumber: 11, BlockHash: common.HexToHash("0xb11"), Index: 0},
+		{BlockNumber: 11, BlockHash: common.HexToHash("0xb11"), Index: 1},
+		{BlockNumber: 12, BlockHash: end.Hash(), Index: 2},
+	}
+
+	refs, err := batchBlockRefs(start, end, logs)
+	if err != nil {
+		t.Fatalf("batchBlockRefs err=%v", err)
+	}
+	if len(refs) != 3 {
+		t.Fatalf("len(refs)=%d want 3", len(refs))
+	}
+	if refs[0].Number != 10 || refs[0].Hash != start.Hash().Hex() || refs[0].ParentHash != start.ParentHash.Hex() {
+		t.Fatalf("unexpected refs[0]=%+v", refs[0])
+	}
+	if refs[1].Number != 12 || refs[1].Hash != end.Hash().Hex() {
+		t.Fatalf("unexpected refs[1]=%+v", refs[1])
+	}
+	if refs[2].Number != 11 || refs[2].Hash != common.HexToHash("0xb11").Hex() {
+		t.Fatalf("unexpected refs[2]=%+v", refs[2])
+	}
+
+	// A log from a different fork than the end header must abort the batch.
+	logs = append(logs, types.Log{BlockNumber: 12, BlockHash: common.HexToHash("0xdead"), Index: 3})
+	if _, err := batchBlockRefs(start, end, logs); !errors.Is(err, errBatchHashMismatch) {
+		t.Fatalf("batchBlockRefs err=%v want errBatchHashMismatch", err)
+	}
+}
+
+// rpcCodeError implements go-ethereum's rpc.Error.
+type rpcCodeError struct {
+	code int
+	msg  string
+}
+
+func (e rpcCodeError) Error() string  { return e.msg }
+func (e rpcCodeError) ErrorCode() int { return e.code }
+
+func TestIsBlockTagUnsupportedErr(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"not found", ethereum.NotFound, false},
+		{"safe block not found", errors.New("safe block not found"), false},
+		{"finalized block not found", errors.New("finalized block not found"), false},
+		{"connection reset", errors.New("connection reset"), false},
+		{"invalid params", rpcCodeError{-32602, "invalid argument 0"}, true},
+		{"invalid block tag", errors.New("invalid block tag safe"), true},
+		{"not supported", errors.New("block tag finalized not supported"), true},
+		{"unmarshal", errors.New("json: cannot unmarshal string into Go value of type hexutil.Uint64"), true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isBlockTagUnsupportedErr(tc.err); got != tc.want {
+				t.Fatalf("isBlockTagUnsupportedErr(%v)=%v want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveSafeBlock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("confirmations", func(t *testing.T) {
+		s := &Scanner{client: &mockEthClient{}, logger: testLogger(),
+			cfg: config.ChainConfig{FinalityMode: config.FinalityConfirmations, Confirmations: 3}}
+		if got := s.resolveSafeBlock(ctx, 100); got != 97 {
+			t.Fatalf("resolveSafeBlock=%d want 97", got)
+		}
+	})
+
+	t.Run("finalized tag", func(t *testing.T) {
+		m := &mockEthClient{}
+		m.headerByNumberFn = func(_ context.Context, n *big.Int) (*types.Header, error) {
+			if n.Int64() != -3 {
+				t.Fatalf("HeaderByNumber got %v want finalized tag (-3)", n)
+			}
+			return &types.Header{Number: big.NewInt(60)}, nil
+		}
+		s := &Scanner{client: m, logger: testLogger(),
+			cfg: config.ChainConfig{FinalityMode: config.FinalityFinalized, Confirmations: 3}}
+		if got := s.resolveSafeBlock(ctx, 100); got != 60 {
+			t.Fatalf("resolveSafeBlock=%d want 60", got)
+		}
+	})
+
+	t.Run("unsupported tag falls back once", func(t *testing.T) {
+		calls := 0
+		m := &mockEthClient{}
+		m.headerByNumberFn = func(_ context.Context, _ *big.Int) (*types.Header, error) {
+			calls++
+			return nil, errors.New("invalid block tag safe")
+		}
+		s := &Scanner{client: m, logger: testLogger(),
+			cfg: config.ChainConfig{FinalityMode: config.FinalitySafe, Confirmations: 3}}
+		for range 2 {
+			if got := s.resolveSafeBlock(ctx, 100); got != 97 {
+				t.Fatalf("resolveSafeBlock=%d want 97", got)
+			}
+		}
+		if calls != 1 {
+			t.Fatalf("HeaderByNumber calls=%d want 1", calls)
+		}
+
+		// The tag is probed again once the fallback expires.
+		s.finalityTagUnsupportedUntil = time.Now().Add(-time.Second)
+		m.headerByNumberFn = func(_ context.Context, _ *big.Int) (*types.Header, error) {
+			return &types.Header{Number: big.NewInt(60)}, nil
+		}
+		if got := s.resolveSafeBlock(ctx, 100); got != 60 {
+			t.Fatalf("after re-probe resolveSafeBlock=%d want 60", got)
+		}
+	})
+
+	// Neither a transient failure nor a tag the node has not set yet may
+	// move the safe block past the last finalized block.
+	for name, fail := range map[string]error{
+		"transient error keeps previous": errors.New("connection reset"),
+		"not found keeps previous":       ethereum.NotFound,
+		"safe block not found":           errors.New("safe block not found"),
+		"finalized block not found":      errors.New("finalized block not found"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var failing bool
+			m := &mockEthClient{}
+			m.headerByNumberFn = func(_ context.Context, _ *big.Int) (*types.Header, error) {
+				if failing {
+					return nil, fail
+				}
+				return &types.Header{Number: big.NewInt(60)}, nil
+			}
+			s := &Scanner{client: m, logger: testLogger(),
+				cfg: config.ChainConfig{FinalityMode: config.FinalityFinalized, Confirmations: 3}}
+			if got := s.resolveSafeBlock(ctx, 100); got != 60 {
+				t.Fatalf("resolveSafeBlock=%d want 60", got)
+			}
+			failing = true
+			for range 2 {
+				if got := s.resolveSafeBlock(ctx, 120); got != 60 {
+					t.Fatalf("resolveSafeBlock=%d want 60", got)
+				}
+			}
+			if !s.finalityTagUnsupportedUntil.IsZero() {
+				t.Fatal("a failed read disabled the tag")
+			}
+		})
+	}
+
+	t.Run("not found before the first finalized block", func(t *testing.T) {
+		m := &mockEthClient{}
+		m.headerByNumberFn = func(_ context.Context, _ *big.Int) (*types.Header, error) {
+			return nil, ethereum.NotFound
+		}
+		s := &Scanner{client: m, logger: testLogger(),
+			cfg: config.ChainConfig{FinalityMode: config.FinalityFinalized, Confirmations: 3}}
+		if got := s.resolveSafeBlock(ctx, 5); got != 0 {
+			t.Fatalf("resolveSafeBlock=%d want 0", got)
+		}
+	})
+}
+
+func TestWSIngestorLogsInRange(t *testing.T) {
+	w := newWSIngestor("ws://unused", nil, testLogger())
+
+	// Not subscribed yet: nothing is covered.
+	if _, ok := w.logsInRange(1, 1); ok {
+		t.Fatalf("logsInRange ok before any head")
+	}
+
+	headers := make(map[uint64]*types.Header)
+	parent := common.Hash{}
+	for n := uint64(10); n <= 15; n++ {
+		h := &types.Header{Number: new(big.Int).SetUint64(n), ParentHash: parent}
+		headers[n] = h
+		parent = h.Hash()
+		w.addHead(h)
+	}
+	if got := w.latestBlock(); got != 15 {
+		t.Fatalf("latestBlock=%d want 15", got)
+	}
+
+	txA := common.HexToHash("0xa")
+	txB := common.HexToHash("0xb")
+	w.addLog(types.Log{BlockNumber: 11, BlockHash: headers[11].Hash(), TxHash: txB, Index: 2})
+	w.addLog(types.Log{BlockNumber: 11, BlockHash: headers[11].Hash(), TxHash: txA, Index: 1})
+	w.addLog(types.Log{BlockNumber: 12, BlockHash: headers[12].Hash(), TxHash: txA, Index: 0})
+	// Duplicate delivery is ignored.
+	w.addLog(types.Log{BlockNumber: 12, BlockHash: headers[12].Hash(), TxHash: txA, Index: 0})
+	// Removed by a reorg.
+	w.addLog(types.Log{BlockNumber: 12, BlockHash: headers[12].Hash(), TxHash: txA, Index: 0, Removed: true})
+
+	logs, ok := w.logsInRange(10, 12)
+	if !ok {
+		t.Fatalf("logsInRange(10,12) not covered")
+	}
+	if len(logs) != 2 || logs[0].Index != 1 || logs[1].Index != 2 {
+		t.Fatalf("unexpected logs %+v", logs)
+	}
+
+	// Before the subscription started and the blocks within the margin of the
+	// head are not served: their logs may arrive after the next heads.
+	if _, ok := w.logsInRange(9, 12); ok {
+		t.Fatalf("logsInRange(9,12) ok, want fallback for uncovered block")
+	}
+	if _, ok := w.logsInRange(12, 13); ok {
+		t.Fatalf("logsInRange(12,13) ok, want fallback for block within the margin")
+	}
+	w.addLog(types.Log{BlockNumber: 13, BlockHash: headers[13].Hash(), TxHash: txB, Index: 0})
+	w.addHead(&types.Header{Number: big.NewInt(16), ParentHash: parent})
+	if logs, ok := w.logsInRange(13, 13); !ok || len(logs) != 1 {
+		t.Fatalf("logsInRange(13,13)=%v ok=%v, want the late log", logs, ok)
+	}
+
+	// A head that does not link to the buffered parent restarts coverage.
+	w.addHead(&types.Header{Number: big.NewInt(17), ParentHash: common.HexToHash("0xdead")})
+	w.addHead(&types.Header{Number: big.NewInt(18)})
+	if _, ok := w.logsInRange(11, 12); ok {
+		t.Fatalf("logsInRange(11,12) ok after broken parent link")
+	}
+
+	// A subscription without new heads is stale: the head is read over RPC.
+	s := &Scanner{ws: w, client: &mockEthClient{blockNumberFn: func(context.Context) (uint64, error) {
+		return 20, nil
+	}}}
+	if got, err := s.latestBlockNumber(context.Background()); err != nil || got != 18 {
+		t.Fatalf("latestBlockNumber live=%d err=%v want 18", got, err)
+	}
+	w.mu.Lock()
+	w.lastHead = time.Now().Add(-wsStaleHeadTimeout - time.Second)
+	w.mu.Unlock()
+	if w.latestBlock() != 0 {
+		t.Fatalf("latestBlock of a stale subscription=%d want 0", w.latestBlock())
+	}
+	if got, err := s.latestBlockNumber(context.Background()); err != nil || got != 20 {
+		t.Fatalf("latestBlockNumber stale=%d err=%v want 20", got, err)
+	}
+	w.addHead(&types.Header{Number: big.NewInt(19)})
+	if got, err := s.latestBlockNumber(context.Background()); err != nil || got != 19 {
+		t.Fatalf("latestBlockNumber after a new head=%d err=%v want 19", got, err)
+	}
+
+	// A disconnect drops coverage entirely.
+	w.reset()
+	if w.latestBlock() != 0 {
+		t.Fatalf("latestBlock after reset=%d want 0", w.latestBlock())
+	}
+}
+
+type burstMockEthClient struct {
+	mockEthClient
+	burst int
+}
+
+func (m *burstMockEthClient) Burst() int { return m.burst }
+
+func TestBackfillWorkers(t *testing.T) {
+	cases := []struct {
+		name    string
+		workers int
+		client  EthClient
+		want    int
+	}{
+		{"disabled", 0, &mockEthClient{}, 0},
+		{"single worker is sequential", 1, &mockEthClient{}, 0},
+		{"no limiter", 8, &mockEthClient{}, 8},
+		{"unlimited limiter", 8, &burstMockEthClient{burst: 0}, 8},
+		{"capped by burst", 8, &burstMockEthClient{burst: 3}, 3},
+		{"burst of one disables", 8, &burstMockEthClient{burst: 1}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Scanner{client: tc.client, cfg: config.ChainConfig{BackfillWorkers: tc.workers}}
+			if got := s.backfillWorkers(); got != tc.want {
+				t.Fatalf("backfillWorkers()=%d want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBackfillWindows(t *testing.T) {
+	s := &Scanner{logger: testLogger()}
+	window := func(from, to uint64) backfillWindow {
+		return backfillWindow{from: from, to: to, logs: []types.Log{{BlockNumber: from}}}
+	}
+
+	t.Run("commits in block order when fetched out of order", func(t *testing.T) {
+		var (
+			mu      sync.Mutex
+			fetched []uint64
+		)
+		others := make(chan struct{}, 16)
+		fetch := func(_ context.Context, from, to uint64) backfillWindow {
+			if from == 1 {
+				// The first window is fetched last of the first round.
+				<-others
+				<-others
+			} else {
+				others <- struct{}{}
+			}
+			mu.Lock()
+			fetched = append(fetched, from)
+			mu.Unlock()
+			return window(from, to)
+		}
+		var committed []uint64
+		commit := func(_ context.Context, w backfillWindow) error {
+			committed = append(committed, w.from)
+			return nil
+		}
+
+		next, err := s.backfillWindows(context.Background(), 1, 60, 3, 10, fetch, commit)
+		if err != nil || next != 61 {
+			t.Fatalf("next=%d err=%v want 61", next, err)
+		}
+		if fetched[0] == 1 {
+			t.Fatalf("fetched %v, want the first window later", fetched)
+		}
+		if want := []uint64{1, 11, 21, 31, 41, 51}; !slices.Equal(committed, want) {
+			t.Fatalf("committed %v want %v", committed, want)
+		}
+	})
+
+	t.Run("a failing fetch stops before its window", func(t *testing.T) {
+		fetch := func(_ context.Context, from, to uint64) backfillWindow {
+			w := window(from, to)
+			if from == 31 {
+				w.err = errors.New("rpc down")
+			}
+			return w
+		}
+		var committed []uint64
+		commit := func(_ context.Context, w backfillWindow) error {
+			committed = append(committed, w.from)
+			return nil
+		}
+		next, err := s.backfillWindows(context.Background(), 1, 60, 3, 10, fetch, commit)
+		if err == nil || !strings.Contains(err.Error(), "fetch blocks 31-40") || next != 31 {
+			t.Fatalf("next=%d err=%v want 31", next, err)
+		}
+		if want := []uint64{1, 11, 21}; !slices.Equal(committed, want) {
+			t.Fatalf("committed %v want %v", committed, want)
+		}
+	})
+
+	t.Run("a failing commit stops at its window", func(t *testing.T) {
+		fetch := func(_ context.Context, from, to uint64) backfillWindow { return window(from, to) }
+		var committed []uint64
+		commit := func(_ context.Context, w backfillWindow) error {
+			if w.from == 21 {
+				return errors.New("db down")
+			}
+			committed = append(committed, w.from)
+			return nil
+		}
+		next, err := s.backfillWindows(context.Background(), 1, 60, 3, 10, fetch, commit)
+		if err == nil || !strings.Contains(err.Error(), "process blocks 21-30") || next != 21 {
+			t.Fatalf("next=%d err=%v want 21", next, err)
+		}
+		if want := []uint64{1, 11}; !slices.Equal(committed, want) {
+			t.Fatalf("committed %v want %v", committed, want)
+		}
+	})
+
+	t.Run("cancellation stops after the last committed window", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fetch := func(ctx context.Context, from, to uint64) backfillWindow {
+			w := window(from, to)
+			if from > 11 {
+				<-ctx.Done()
+				w.err = ctx.Err()
+			}
+			return w
+		}
+		var committed []uint64
+		commit := func(_ context.Context, w backfillWindow) error {
+			committed = append(committed, w.from)
+			if w.from == 11 {
+				cancel()
+			}
+			return nil
+		}
+		next, err := s.backfillWindows(ctx, 1, 60, 3, 10, fetch, commit)
+		if !errors.Is(err, context.Canceled) || next != 21 {
+			t.Fatalf("next=%d err=%v want 21 and context.Canceled", next, err)
+		}
+		if want := []uint64{1, 11}; !slices.Equal(committed, want) {
+			t.Fatalf("committed %v want %v", committed, want)
+		}
+	})
+}
+
+func TestBatchController(t *testing.T) {
+	c := newBatchController("test-batch", 100, 200, time.Second, testLogger())
+
+	// A limit error caps the window at half the failing range.
+	c.observeLimitExceeded(100)
+	if got := c.current(); got != 50 {
+		t.Fatalf("after limit exceeded size=%d want 50", got)
+	}
+	// Successes on sub-ranges of a split batch don't grow the window.
+	for range batchGrowAfter {
+		c.observeSuccess(25, time.Millisecond)
+	}
+	if got := c.current(); got != 50 {
+		t.Fatalf("after sub-range successes size=%d want 50", got)
+	}
+	// Consecutive full-size successes grow it by a quarter.
+	for range batchGrowAfter {
+		c.observeSuccess(50, time.Millisecond)
+	}
+	if got := c.current(); got != 62 {
+		t.Fatalf("after successes size=%d want 62", got)
+	}
+	// Slow responses shrink it.
+	c.observeSuccess(62, 2*time.Second)
+	if got := c.current(); got != 46 {
+		t.Fatalf("after slow response size=%d want 46", got)
+	}
+	// Never beyond the configured maximum or below one block.
+	c.restore(1000)
+	if got := c.current(); got != 200 {
+		t.Fatalf("restore(1000) size=%d want 200", got)
+	}
+	c.observeLimitExceeded(1)
+	if got := c.current(); got != 1 {
+		t.Fatalf("after single-block limit size=%d want 1", got)
+	}
+	if got := c.splitCount(); got != 2 {
+		t.Fatalf("splitCount=%d want 2", got)
+	}
+
+	// A nil controller is a fixed single-block window.
+	var none *batchController
+	none.restore(100)
+	none.observeLimitExceeded(10)
+	none.observeSuccess(1, time.Millisecond)
+	if none.current() != minBatchSize || none.splitCount() != 0 {
+		t.Fatalf("nil controller size=%d splits=%d", none.current(), none.splitCount())
+	}
+}
+
+func TestStrategyRegistry(t *testing.T) {
+	linear := common.HexToAddress("0x01")
+	geometry := common.HexToAddress("0x02")
+	r, err := newStrategyRegistry([]config.StrategyConfig{
+		{Type: "linear", Address: linear.Hex()},
+		{Type: "geometry", Address: geometry.Hex()},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := r.lookup(geometry); !ok || s.Type() != StrategyTypeGeometry {
+		t.Fatalf("lookup(geometry)=%v,%v", s, ok)
+	}
+	if _, ok := r.lookup(common.Address{}); ok {
+		t.Fatalf("zero address resolved to a strategy")
+	}
+
+	for _, cfgs := range [][]config.StrategyConfig{
+		{{Type: "linear", Address: "0x0000000000000000000000000000000000000000"}},
+		{{Type: "curve", Address: linear.Hex()}},
+		{{Type: "linear", Address: linear.Hex()}, {Type: "geometry", Address: linear.Hex()}},
+	} {
+		if _, err := newStrategyRegistry(cfgs, nil); err == nil {
+			t.Errorf("newStrategyRegistry(%+v) accepted an invalid config", cfgs)
+		}
+	}
+}
+
+func TestWhitelistedStrategyLogs(t *testing.T) {
+	ctx := context.Background()
+	gridEx := common.HexToAddress("0xaa")
+	linear := common.HexToAddress("0x01")
+	added := common.HexToAddress("0x03")
+	header := func(n uint64) *types.Header {
+		return &types.Header{Number: new(big.Int).SetUint64(n), Time: 1000 + n}
+	}
+	logAt := func(addr common.Address, n uint64, txIdx, idx uint) types.Log {
+		return types.Log{Address: addr, BlockNumber: n, BlockHash: header(n).Hash(), TxIndex: txIdx, Index: idx}
+	}
+
+	var queries []ethereum.FilterQuery
+	var chainLogs []types.Log
+	m := &mockEthClient{filterLogsFn: func(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+		queries = append(queries, q)
+		return chainLogs, nil
+	}}
+	s := &Scanner{client: m, logger: testLogger(), gridExAddr: gridEx,
+		strategies: testStrategies(t, linear), headers: newHeaderCache(16)}
+	for _, n := range []uint64{10, 12} {
+		s.headers.add(header(n))
+	}
+
+	// A whitelisted contract is watched, but its type is only known once it
+	// emits a creation event.
+	if !s.strategies.add(added) || s.strategies.add(added) || s.strategies.add(linear) {
+		t.Fatalf("add did not report new contracts only")
+	}
+	if _, ok := s.strategies.lookup(added); ok || !s.strategies.watches(added) {
+		t.Fatalf("whitelisted contract resolved before its first event")
+	}
+	if strat, ok := s.strategies.resolve(added, contracts.TopicGeometryStrategyCreated); !ok || strat.Type() != StrategyTypeGeometry {
+		t.Fatalf("resolve=%v,%v", strat, ok)
+	}
+	if got := s.contractAddresses(); !slices.Equal(got, []common.Address{gridEx, linear, added}) {
+		t.Fatalf("contractAddresses()=%v", got)
+	}
+
+	// Logs of the new contract after the whitelisting log are merged in order.
+	whitelist := logAt(gridEx, 10, 1, 2)
+	logs := []types.Log{whitelist, logAt(gridEx, 12, 1, 3)}
+	refs, err := batchBlockRefs(nil, nil, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainLogs = []types.Log{logAt(added, 10, 0, 1), logAt(added, 10, 1, 3), logAt(added, 12, 0, 1)}
+	want := []types.Log{whitelist, chainLogs[1], chainLogs[2], logs[1]}
+	logs, refs, err = s.addStrategyLogs(ctx, logs, []common.Address{added}, whitelist, 12, refs)
+	if err != nil {
+		t.Fatalf("addStrategyLogs err=%v", err)
+	}
+	if len(logs) != len(want) {
+		t.Fatalf("logs=%s", spew.Sdump(logs))
+	}
+	for i := range want {
+		if logs[i].Address != want[i].Address || logs[i].BlockNumber != want[i].BlockNumber || logs[i].Index != want[i].Index {
+			t.Fatalf("logs[%d]=%s want %s", i, spew.Sdump(logs[i]), spew.Sdump(want[i]))
+		}
+	}
+	if len(refs) != 2 {
+		t.Fatalf("refs=%+v", refs)
+	}
+	q := queries[0]
+	if !slices.Equal(q.Addresses, []common.Address{added}) || q.FromBlock.Uint64() != 10 || q.ToBlock.Uint64() != 12 {
+		t.Fatalf("unexpected query %+v", q)
+	}
+
+	// A window fetched before the whitelisting gets the missing contract's
+	// logs, without duplicating the ones it already holds.
+	chainLogs = []types.Log{logAt(added, 12, 0, 1)}
+	fetched := []common.Address{gridEx, linear}
+	logs, _, err = s.addUnfetchedStrategyLogs(ctx, logs, fetched, 10, 12, refs)
+	if err != nil || len(logs) != len(want) {
+		t.Fatalf("addUnfetchedStrategyLogs len=%d err=%v", len(logs), err)
+	}
+	if q := queries[1]; !slices.Equal(q.Addresses, []common.Address{added}) {
+		t.Fatalf("unexpected query %+v", q)
+	}
+	queries = nil
+	if _, _, err := s.addUnfetchedStrategyLogs(ctx, logs, s.contractAddresses(), 10, 12, refs); err != nil || len(queries) != 0 {
+		t.Fatalf("fully fetched window queried again: %d queries err=%v", len(queries), err)
+	}
+}
+
+func TestStrategyPrices(t *testing.T) {
+	e18 := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	price0 := new(big.Int).Mul(big.NewInt(100), priceMultiplier) // 100 quote per base
+	baseAmt := new(big.Int).Set(e18)
+
+	// Linear bids step down by the (negative) gap; the reverse price is one gap up.
+	gap := new(big.Int).Neg(priceMultiplier)
+	linear := linearStrategy{}
+	bid := &contracts.StrategyParams{Price0: price0, Gap: gap}
+	if err := linear.Validate(bid); err != nil {
+		t.Fatal(err)
+	}
+	if got := linear.Price(bid, 2); got.Cmp(new(big.Int).Mul(big.NewInt(98), priceMultiplier)) != 0 {
+		t.Fatalf("linear Price(2)=%s", got)
+	}
+	if got := linear.ReversePrice(bid, price0); got.Cmp(new(big.Int).Mul(big.NewInt(101), priceMultiplier)) != 0 {
+		t.Fatalf("linear ReversePrice=%s", got)
+	}
+	// 100 + 99 + 98 quote for three bids of one base token each
+	if got := linear.InitialAmount(bid, false, baseAmt, 3); got.Cmp(new(big.Int).Mul(big.NewInt(297), e18)) != 0 {
+		t.Fatalf("linear bid InitialAmount=%s", got)
+	}
+	if got := linear.InitialAmount(bid, true, baseAmt, 3); got.Cmp(new(big.Int).Mul(big.NewInt(3), e18)) != 0 {
+		t.Fatalf("linear ask InitialAmount=%s", got)
+	}
+	if err := linear.Validate(&contracts.StrategyParams{Price0: price0}); err == nil {
+		t.Fatalf("linear params without gap validated")
+	}
+
+	// Geometry asks grow by the ratio; the reverse price is one step down.
+	ratio := new(big.Int).Div(new(big.Int).Mul(big.NewInt(11), e18), big.NewInt(10)) // 1.1
+	geometry := geometryStrategy{}
+	ask := &contracts.StrategyParams{Price0: price0, Ratio: ratio}
+	if got := geometry.Price(ask, 2); got.Cmp(new(big.Int).Mul(big.NewInt(121), priceMultiplier)) != 0 {
+		t.Fatalf("geometry Price(2)=%s", got)
+	}
+	if got := geometry.ReversePrice(ask, new(big.Int).Mul(big.NewInt(110), priceMultiplier)); got.Cmp(price0) != 0 {
+		t.Fatalf("geometry ReversePrice=%s", got)
+	}
+	if err := geometry.Validate(&contracts.StrategyParams{Price0: price0, Ratio: new(big.Int)}); err == nil {
+		t.Fatalf("geometry params with a zero ratio validated")
+	}
+}
+
+func TestProtocolFeeSplit(t *testing.T) {
+	quoteVol := big.NewInt(4_000_000_000)
+	fee := 1000 // 0.1%: total fee 4_000_000, protocol cut 1_000_000
+	orderFee := calcOrderFee(quoteVol, fee)
+	if orderFee != "3000000" {
+		t.Fatalf("orderFee=%s", orderFee)
+	}
+
+	cases := []struct {
+		oneshot, compound bool
+		bps               uint32
+		share, protocol   string
+	}{
+		{oneshot: false, compound: false, share: "2250000", protocol: "1000000"},
+		{oneshot: false, compound: true, share: "0", protocol: "1000000"},
+		{oneshot: true, bps: defaultOneshotProtocolFeeBps, share: "750000", protocol: "3250000"},
+		{oneshot: true, bps: 5000, share: "1500000", protocol: "2500000"},
+		{oneshot: true, bps: bpsDenominator, share: "0", protocol: "4000000"},
+	}
+	for _, c := range cases {
+		share := calcGridFeeShare(orderFee, c.oneshot, c.compound, c.bps)
+		protocol := calcProtocolFee(quoteVol, fee, orderFee, share, c.oneshot)
+		if share != c.share || protocol != c.protocol {
+			t.Errorf("%+v: share=%s protocol=%s", c, share, protocol)
+		}
+	}
+}
+
+func TestCollectedToken(t *testing.T) {
+	decoder, err := contracts.NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := common.HexToAddress("0xfee")
+	token := common.HexToAddress("0x55d398326f99059ff775485246999027b3197955")
+	amount := big.NewInt(12345)
+	transfer := func(addr, to common.Address, value *big.Int) *types.Log {
+		return &types.Log{
+			Address: addr,
+			Topics:  []common.Hash{contracts.TopicTransfer, common.HexToHash("0xaa"), common.BytesToHash(to.Bytes())},
+			Data:    common.LeftPadBytes(value.Bytes(), 32),
+		}
+	}
+
+	receipt := &types.Receipt{Logs: []*types.Log{
+		transfer(common.HexToAddress("0x01"), recipient, big.NewInt(1)), // other amount
+		transfer(common.HexToAddress("0x02"), common.HexToAddress("0xbb"), amount),
+		transfer(token, recipient, amount),
+	}}
+	m := &mockEthClient{transactionReceiptFn: func(context.Context, common.Hash) (*types.Receipt, error) {
+		return receipt, nil
+	}}
+	s := &Scanner{client: m, decoder: decoder, logger: testLogger()}
+	event := &contracts.CollectProtocolEvent{Recipient: recipient, Amount: amount}
+
+	got, err := s.collectedToken(context.Background(), types.Log{}, event)
+	if err != nil || got != strings.ToLower(token.Hex()) {
+		t.Fatalf("collectedToken=%q err=%v", got, err)
+	}
+
+	receipt.Logs = receipt.Logs[:2]
+	if got, err := s.collectedToken(context.Background(), types.Log{}, event); err != nil || got != "" {
+		t.Fatalf("collectedToken without transfer=%q err=%v", got, err)
+	}
+}
+
+func TestRefundAction(t *testing.T) {
+	decoder, err := contracts.NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gridEx := common.HexToAddress("0x4f805a66448f53fb6bfa5a7e29dbae36c158aacf")
+	owner := common.BytesToHash(common.HexToAddress("0xaa").Bytes())
+	cancelWholeGrid := &types.Log{
+		Address: gridEx,
+		Topics:  []common.Hash{contracts.TopicCancelWholeGrid, owner, common.BigToHash(big.NewInt(42))},
+		Index:   3,
+	}
+	refund := types.Log{
+		Address: gridEx,
+		Topics:  []common.Hash{contracts.TopicRefundFailed, owner},
+		Index:   5,
+	}
+
+	receipt := &types.Receipt{Logs: []*types.Log{
+		{Address: common.HexToAddress("0x01"), Topics: []common.Hash{contracts.TopicCancelWholeGrid}, Index: 1}, // other contract
+		cancelWholeGrid,
+		{Address: gridEx, Topics: []common.Hash{contracts.TopicGridOrderCreated, owner}, Index: 7}, // after the refund
+	}}
+	m := &mockEthClient{transactionReceiptFn: func(context.Context, common.Hash) (*types.Receipt, error) {
+		return receipt, nil
+	}}
+	versions, err := newVersionSchedule(nil, decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{client: m, decoder: decoder, versions: versions, gridExAddr: gridEx, logger: testLogger()}
+
+	action, gridID, err := s.refundAction(context.Background(), refund)
+	if err != nil || action != kafka.EventGridCancelled || gridID != 42 {
+		t.Fatalf("refundAction=%q, %d err=%v", action, gridID, err)
+	}
+
+	receipt.Logs = receipt.Logs[:1]
+	if action, gridID, err := s.refundAction(context.Background(), refund); err != nil || action != "" || gridID != 0 {
+		t.Fatalf("refundAction without GridEx event=%q, %d err=%v", action, gridID, err)
+	}
+}
+
+func TestVersionSchedule(t *testing.T) {
+	decoder, err := contracts.NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := uint64(0)
+	facet := common.HexToAddress("0xface7")
+	vs, err := newVersionSchedule([]config.ABIVersion{
+		{Version: "v1", FromBlock: &from},
+		{Version: "v2", Facets: []string{facet.Hex()}},
+	}, decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(block uint64, index uint) contracts.Version {
+		return vs.at(types.Log{BlockNumber: block, Index: index}).Version()
+	}
+	if v := at(100, 0); v != contracts.V1 {
+		t.Fatalf("before the upgrade: %s", v)
+	}
+
+	upgrade := types.Log{BlockNumber: 100, Index: 4}
+	if v, ok := vs.facetUpdated(upgrade, common.HexToAddress("0x01")); ok {
+		t.Fatalf("unknown facet switched to %s", v)
+	}
+	if v, ok := vs.facetUpdated(upgrade, facet); !ok || v != contracts.V2 {
+		t.Fatalf("facetUpdated=%s, %v", v, ok)
+	}
+	// The upgrade routes several selectors to the facet; only the first switches.
+	if _, ok := vs.facetUpdated(types.Log{BlockNumber: 100, Index: 5}, facet); ok {
+		t.Fatal("second selector switched again")
+	}
+	if v := at(100, 3); v != contracts.V1 {
+		t.Fatalf("log before the upgrade in its block: %s", v)
+	}
+	if v := at(100, 6); v != contracts.V2 {
+		t.Fatalf("log after the upgrade: %s", v)
+	}
+
+	// A schedule restored from the DB after a reorg drops orphaned upgrades.
+	tip := vs.clone()
+	tip.facetUpdated(types.Log{BlockNumber: 50}, facet)
+	if v := at(60, 0); v != contracts.V1 {
+		t.Fatalf("clone changed the original: %s", v)
+	}
+	vs.load(nil)
+	if v := at(200, 0); v != contracts.V1 {
+		t.Fatalf("after load without upgrades: %s", v)
+	}
+	vs.load([]db.FacetUpdate{{Facet: strings.ToLower(facet.Hex()), BlockNumber: 150, LogIndex: 1}})
+	if v := at(150, 2); v != contracts.V2 {
+		t.Fatalf("after load: %s", v)
+	}
+
+	// A v1 event after the upgrade means a switch is missing: processLog stops
+	// instead of quarantining it.
+	v1Log := types.Log{
+		Topics:      []common.Hash{contracts.TopicGridOrderCreatedV1},
+		BlockNumber: 150, Index: 3,
+	}
+	if v, ok := vs.versionOf(v1Log, v1Log.Topics[0]); !ok || v != contracts.V1 {
+		t.Fatalf("versionOf=%s, %v", v, ok)
+	}
+	if _, ok := vs.versionOf(v1Log, common.HexToHash("0x01")); ok {
+		t.Fatal("versionOf knows an unknown topic")
+	}
+	s := &Scanner{decoder: decoder, versions: vs, logger: testLogger(), strategies: testStrategies(t, common.HexToAddress("0x5"))}
+	if _, err := s.processLog(context.Background(), nil, v1Log); !errors.Is(err, contracts.ErrABIMismatch) {
+		t.Fatalf("processLog of a v1 event under v2: %v", err)
+	}
+
+	// An unknown event after an upgrade to an unconfigured facet is still
+	// quarantined, but reported.
+	unknown := types.Log{
+		Address:     common.HexToAddress("0x4f805a66448f53fb6bfa5a7e29dbae36c158aacf"),
+		Topics:      []common.Hash{common.HexToHash("0xbad")},
+		BlockNumber: 300, Index: 2,
+	}
+	if _, ok := vs.unconfiguredFacet(unknown); ok {
+		t.Fatal("unconfiguredFacet before any upgrade")
+	}
+	unconfigured := common.HexToAddress("0xbeef")
+	vs.facetUpdated(types.Log{BlockNumber: 300, Index: 1}, unconfigured)
+	if f, ok := vs.unconfiguredFacet(unknown); !ok || f != unconfigured {
+		t.Fatalf("unconfiguredFacet=%s, %v", f.Hex(), ok)
+	}
+	if _, ok := vs.unconfiguredFacet(types.Log{BlockNumber: 300, Index: 0}); ok {
+		t.Fatal("unconfiguredFacet before the upgrade in its block")
+	}
+	fdb := &fakeDB{}
+	if _, err := s.processLog(context.Background(), fdb.tx(), unknown); err != nil {
+		t.Fatal(err)
+	}
+	if s.quarantined != 1 || s.unconfiguredFacetLogs != 1 || len(fdb.execs) != 1 {
+		t.Fatalf("quarantined=%d unconfiguredFacetLogs=%d execs=%d", s.quarantined, s.unconfiguredFacetLogs, len(fdb.execs))
+	}
+	vs.load(nil)
+	if _, ok := vs.unconfiguredFacet(unknown); ok {
+		t.Fatal("load kept an orphaned upgrade")
+	}
+
+	if _, err := newVersionSchedule([]config.ABIVersion{{Version: "v9", FromBlock: &from}}, decoder); err == nil {
+		t.Fatal("expected an error for an unknown version")
+	}
+}
+
+func TestDiffGrid(t *testing.T) {
+	g := db.ReconcileGrid{
+		GridID:  7,
+		Status:  1,
+		Fee:     500,
+		Profits: "1000",
+		Orders: []db.ReconcileOrder{
+			{OrderID: "491520", Amount: "100", RevAmount: "0"},
+			{OrderID: "458752", Amount: "200", RevAmount: "50"},
+			{OrderID: "458753", Amount: "300", RevAmount: "0"},
+		},
+	}
+	cfg := &contracts.GridConfig{GridID: 7, Status: 1, Fee: 500}
+	orders := map[string]*contracts.GridOrder{
+		"491520": {Amount: big.NewInt(100), RevAmount: big.NewInt(0)},
+		"458752": {Amount: big.NewInt(200), RevAmount: big.NewInt(50)},
+		// 458753 was not queried
+	}
+	if issues := diffGrid(g, cfg, big.NewInt(1000), orders); len(issues) != 0 {
+		t.Fatalf("matching grid: %+v", issues)
+	}
+
+	cfg.Fee = 300
+	orders["458752"] = &contracts.GridOrder{Amount: big.NewInt(150), RevAmount: big.NewInt(60)}
+	issues := diffGrid(g, cfg, big.NewInt(900), orders)
+	want := []db.ReconciliationIssue{
+		{GridID: 7, Field: db.ReconcileFieldFee, DBValue: "500", ChainValue: "300"},
+		{GridID: 7, Field: db.ReconcileFieldProfits, DBValue: "1000", ChainValue: "900"},
+		{GridID: 7, OrderID: "458752", Field: db.ReconcileFieldAmount, DBValue: "200", ChainValue: "150"},
+		{GridID: 7, OrderID: "458752", Field: db.ReconcileFieldRevAmount, DBValue: "50", ChainValue: "60"},
+	}
+	if !slices.Equal(issues, want) {
+		t.Fatalf("issues:\n got %+v\nwant %+v", issues, want)
+	}
+}
+
+// fakeStrategyContract answers getPrice and getReversePrice of a geometry
+// strategy contract from params, with price overrides by order index.
+type fakeStrategyContract struct {
+	abi       abi.ABI
+	params    *contracts.StrategyParams
+	overrides map[uint16]*big.Int
+	reverts   map[uint16]bool
+	block     *big.Int
+}
+
+func (f *fakeStrategyContract) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if *msg.To == contracts.Multicall3Address {
+		return nil, nil // no Multicall3
+	}
+	f.block = block
+	method, err := f.abi.MethodById(msg.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	args, err := method.Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	idx := args[2].(uint16)
+	if f.reverts[idx] {
+		return nil, errors.New("execution reverted")
+	}
+	g := geometryStrategy{}
+	price := g.Price(f.params, uint32(idx))
+	if p, ok := f.overrides[idx]; ok {
+		price = p
+	}
+	if method.Name == "getReversePrice" {
+		price = g.ReversePrice(f.params, price)
+	}
+	return method.Outputs.Pack(price)
+}
+
+// fakeGridChain answers getGridConfig on the GridEx contract and
+// strategies(uint256) on a linear strategy contract, and records the blocks
+// it is called at.
+type fakeGridChain struct {
+	gridABI, linearABI abi.ABI
+	gridEx, linear     common.Address
+	config             any
+	price0, gap        *big.Int
+	blocks             []*big.Int
+}
+
+func (f *fakeGridChain) CallContract(_ context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if *msg.To == contracts.Multicall3Address {
+		return nil, nil // no Multicall3
+	}
+	f.blocks = append(f.blocks, block)
+	switch *msg.To {
+	case f.gridEx:
+		return f.gridABI.Methods["getGridConfig"].Outputs.Pack(f.config)
+	case f.linear:
+		return f.linearABI.Methods["strategies"].Outputs.Pack(f.price0, f.gap)
+	}
+	return nil, errors.New("execution reverted")
+}
+
+// TestLoadGridStrategies checks where the strategies of a new grid come from
+// when the cache misses: grid_strategy_params first, then the contracts at
+// the block of the event.
+func TestLoadGridStrategies(t *testing.T) {
+	gridABI, err := abi.JSON(strings.NewReader(`[{"name": "getGridConfig", "type": "function", "stateMutability": "view",
+		"inputs": [{"name": "gridId", "type": "uint48"}],
+		"outputs": [{"name": "", "type": "tuple", "components": [
+			{"name": "owner", "type": "address"}, {"name": "askStrategy", "type": "address"},
+			{"name": "bidStrategy", "type": "address"}, {"name": "profits", "type": "uint128"},
+			{"name": "baseAmt", "type": "uint128"}, {"name": "gridId", "type": "uint48"},
+			{"name": "pairId", "type": "uint64"}, {"name": "askOrderCount", "type": "uint16"},
+			{"name": "bidOrderCount", "type": "uint16"}, {"name": "fee", "type": "uint32"},
+			{"name": "compound", "type": "bool"}, {"name": "oneshot", "type": "bool"},
+			{"name": "status", "type": "uint32"}]}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linearABI, err := abi.JSON(strings.NewReader(`[{"name": "strategies", "type": "function", "stateMutability": "view",
+		"inputs": [{"name": "", "type": "uint256"}],
+		"outputs": [{"name": "basePrice", "type": "uint256"}, {"name": "gap", "type": "int256"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gridEx := common.HexToAddress("0xaa")
+	linear := common.HexToAddress("0xcc")
+	chain := &fakeGridChain{
+		gridABI: gridABI, linearABI: linearABI, gridEx: gridEx, linear: linear,
+		config: struct {
+			Owner         common.Address
+			AskStrategy   common.Address
+			BidStrategy   common.Address
+			Profits       *big.Int
+			BaseAmt       *big.Int
+			GridId        *big.Int
+			PairId        uint64
+			AskOrderCount uint16
+			BidOrderCount uint16
+			Fee           uint32
+			Compound      bool
+			Oneshot       bool
+			Status        uint32
+		}{AskStrategy: linear, Profits: big.NewInt(0), BaseAmt: big.NewInt(5), GridId: big.NewInt(42), AskOrderCount: 2, Status: 1},
+		price0: big.NewInt(2000), gap: big.NewInt(20),
+	}
+	caller, err := contracts.NewCaller(chain, gridEx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{cfg: config.ChainConfig{ChainID: 56}, caller: caller, strategies: testStrategies(t, linear), logger: testLogger()}
+	event := &contracts.GridOrderCreatedEvent{GridID: 42, Asks: 2}
+
+	// Indexed params are used without calling the contracts.
+	fdb := &fakeDB{queryFn: rowsFor(map[string][][]any{
+		"FROM grid_strategy_params": {{int64(42), true, "linear", strings.ToLower(linear.Hex()), "1000", "10", ""}},
+	})}
+	ask, bid, err := s.loadGridStrategies(context.Background(), fdb.tx(), event, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bid != nil || ask == nil || ask.addr != linear || ask.params.Price0.Int64() != 1000 || ask.params.Gap.Int64() != 10 {
+		t.Fatalf("from DB: ask=%+v bid=%+v", ask, bid)
+	}
+	if len(chain.blocks) != 0 || len(fdb.execs) != 0 {
+		t.Fatalf("from DB: %d contract calls, %d writes", len(chain.blocks), len(fdb.execs))
+	}
+
+	// Otherwise the config and params are read at the event's block and stored.
+	fdb = &fakeDB{}
+	ask, bid, err = s.loadGridStrategies(context.Background(), fdb.tx(), event, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bid != nil || ask == nil || ask.addr != linear || ask.params.Price0.Int64() != 2000 || ask.params.Gap.Int64() != 20 {
+		t.Fatalf("from contracts: ask=%+v bid=%+v", ask, bid)
+	}
+	if len(chain.blocks) != 2 {
+		t.Fatalf("%d contract calls, want getGridConfig and strategies", len(chain.blocks))
+	}
+	for _, b := range chain.blocks {
+		if b == nil || b.Uint64() != 500 {
+			t.Fatalf("read at block %v, want 500", b)
+		}
+	}
+	if len(fdb.execs) != 1 {
+		t.Fatalf("%d writes, want the params upsert", len(fdb.execs))
+	}
+
+	// The cache filled by the strategy events comes first.
+	s.strategyCache = map[string]*gridSide{strategyCacheKey(42, true): {strategy: linearStrategy{}, addr: linear,
+		params: &contracts.StrategyParams{Price0: big.NewInt(3000), Gap: big.NewInt(30)}}}
+	if ask, _, err := s.loadGridStrategies(context.Background(), nil, event, 500); err != nil || ask.params.Price0.Int64() != 3000 {
+		t.Fatalf("from cache: ask=%+v err=%v", ask, err)
+	}
+}
+
+func TestFetchOrderPrices(t *testing.T) {
+	priceABI, err := abi.JSON(strings.NewReader(`[
+		{"name": "getPrice", "type": "function", "stateMutability": "view",
+		 "inputs": [{"name": "isAsk", "type": "bool"}, {"name": "gridId", "type": "uint48"}, {"name": "idx", "type": "uint16"}],
+		 "outputs": [{"name": "", "type": "uint256"}]},
+		{"name": "getReversePrice", "type": "function", "stateMutability": "view",
+		 "inputs": [{"name": "isAsk", "type": "bool"}, {"name": "gridId", "type": "uint48"}, {"name": "idx", "type": "uint16"}],
+		 "outputs": [{"name": "", "type": "uint256"}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e18 := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	params := &contracts.StrategyParams{
+		Price0: new(big.Int).Mul(big.NewInt(100), priceMultiplier),
+		Ratio:  new(big.Int).Div(new(big.Int).Mul(big.NewInt(11), e18), big.NewInt(10)),
+	}
+	side := &gridSide{strategy: geometryStrategy{}, addr: common.HexToAddress("0xdd"), params: params}
+	rounded := new(big.Int).Add(geometryStrategy{}.Price(params, 2), big.NewInt(1))
+	chain := &fakeStrategyContract{
+		abi:       priceABI,
+		params:    params,
+		overrides: map[uint16]*big.Int{2: rounded},
+		reverts:   map[uint16]bool{1: true},
+	}
+	caller, err := contracts.NewCaller(chain, common.HexToAddress("0xaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{
+		cfg:    config.ChainConfig{PriceSource: config.PriceSourceVerify},
+		caller: caller,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	log := types.Log{BlockNumber: 500}
+	event := &contracts.GridOrderCreatedEvent{GridID: 42, Asks: 3}
+
+	asks, bids, err := s.fetchOrderPrices(context.Background(), log, event, side, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.block == nil || chain.block.Uint64() != 500 {
+		t.Fatalf("prices read at block %v, want 500", chain.block)
+	}
+	if len(asks) != 3 || len(bids) != 0 {
+		t.Fatalf("asks=%v bids=%v", asks, bids)
+	}
+	computed := func(i uint32) orderPrice {
+		p := side.strategy.Price(params, i)
+		return orderPrice{price: p, revPrice: side.strategy.ReversePrice(params, p)}
+	}
+	if asks[0] == nil || !samePrices(computed(0), *asks[0]) {
+		t.Errorf("order 0: %+v", asks[0])
+	}
+	if asks[1] != nil {
+		t.Errorf("order 1 reverted but has prices %+v", asks[1])
+	}
+	if asks[2] == nil || samePrices(computed(2), *asks[2]) || asks[2].price.Cmp(rounded) != 0 {
+		t.Errorf("order 2: %+v", asks[2])
+	}
+	if priceAt(asks, 3) != nil || priceAt(nil, 0) != nil {
+		t.Error("priceAt out of range")
+	}
+
+	// Matching prices are stored as computed without touching the DB.
+	got, err := s.checkOrderPrice(context.Background(), nil, log, 42, "0", true, side, computed(0), asks[0])
+	if err != nil || !samePrices(got, computed(0)) {
+		t.Errorf("checkOrderPrice=%+v, %v", got, err)
+	}
+
+	// In onchain mode an order without the contract's prices is an error.
+	s.cfg.PriceSource = config.PriceSourceOnchain
+	if _, _, err := s.fetchOrderPrices(context.Background(), log, event, side, nil); err == nil {
+		t.Error("expected an error for a reverting price call in onchain mode")
+	}
+
+	s.cfg.PriceSource = config.PriceSourceComputed
+	if asks, _, err := s.fetchOrderPrices(context.Background(), log, event, side, nil); err != nil || asks != nil {
+		t.Errorf("computed mode read prices: %v, %v", asks, err)
+	}
+}
+
+// TestCalculateAPRMixedDecimals values a WETH(18)/USDC(6) grid: one ask of
+// 0.5 WETH at 3100 and one bid of 1500 USDC at 3000, with WETH rising from
+// $3000 to $3200 over a year.
+func TestCalculateAPRMixedDecimals(t *testing.T) {
+	pair := fixedpoint.Pair{Base: 18, Quote: 6}
+	orders := []db.GridOrderForTheoretical{
+		{IsAsk: true, Price: "3100000000000000000000000000", Amount: "500000000000000000", RevAmt: "0"},
+		{IsAsk: false, Price: "3000000000000000000000000000", Amount: "1500000000", RevAmt: "0"},
+	}
+	theoretical, aprReal, err := calculateAPR(pair,
+		"500000000000000000", "1500000000",
+		"3000", "1",
+		"500000000000000000", "1500000000",
+		"3200", "1",
+		"0",
+		orders,
+		time.Now().Add(-8760*time.Hour),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invested $3000. Untouched, the grid holds $3100; without the grid
+	// the ask would have sold at 3100, leaving 1550 + 1500 USDC.
+	check := func(name, got string, want float64) {
+		t.Helper()
+		var v float64
+		if _, err := fmt.Sscanf(got, "%g", &v); err != nil {
+			t.Fatalf("%s=%q: %v", name, got, err)
+		}
+		if math.Abs(v-want) > 1e-6 {
+			t.Errorf("%s=%s, want %.8f", name, got, want)
+		}
+	}
+	check("apr_real", aprReal, 3100.0/3000-1)
+	check("apr_theoretical", theoretical, 3050.0/3000-1)
+}
+
+func TestAssignIdempotencyKeys(t *testing.T) {
+	build := func() []*kafka.Message {
+		logMsg := func(eventType kafka.EventType, logIndex uint, provisional bool) *kafka.Message {
+			return &kafka.Message{EventType: eventType, ChainID: 97, BlockNumber: 100,
+				BlockHash: "0xb1", TxHash: "0xt1", LogIndex: logIndex, Provisional: provisional}
+		}
+		return []*kafka.Message{
+			logMsg(kafka.EventGridCreated, 3, false),
+			logMsg(kafka.EventOrderCreated, 3, false),
+			logMsg(kafka.EventOrderCreated, 3, false),
+			logMsg(kafka.EventOrderFilled, 4, false),
+			logMsg(kafka.EventOrderFilled, 4, true),
+			{EventType: kafka.EventReconciliation, ChainID: 97, IdempotencyKey: "preset"},
+		}
+	}
+
+	msgs := build()
+	assignIdempotencyKeys(msgs)
+	want := []string{
+		"97:0xb1:0xt1:3:grid_created:0",
+		"97:0xb1:0xt1:3:order_created:0",
+		"97:0xb1:0xt1:3:order_created:1",
+		"97:0xb1:0xt1:4:order_filled:0",
+		"97:0xb1:0xt1:4:order_filled:provisional:0",
+		"preset",
+	}
+	for i, msg := range msgs {
+		if msg.IdempotencyKey != want[i] {
+			t.Errorf("msgs[%d] key=%q, want %q", i, msg.IdempotencyKey, want[i])
+		}
+	}
+
+	// Processing the same logs again yields the same keys.
+	again := build()
+	assignIdempotencyKeys(again)
+	for i := range again {
+		if again[i].IdempotencyKey != msgs[i].IdempotencyKey {
+			t.Errorf("msgs[%d] key changed to %q", i, again[i].IdempotencyKey)
+		}
+	}
+}
+
+// provisionalDB keeps provisional_events like the table does: unique by
+// (tx hash, log index, block hash).
+type provisionalDB struct {
+	fakeDB
+	rows   [][]any // block_number, block_hash, tx_hash, log_index, event_types
+	outbox []string
+}
+
+func newProvisionalDB() *provisionalDB {
+	d := &provisionalDB{}
+	d.execFn = func(sql string, args []any) pgconn.CommandTag {
+		switch {
+		case strings.Contains(sql, "INSERT INTO provisional_events"):
+			row := []any{args[1].(int64), args[2].(string), args[3].(string), args[4].(int), args[5].(string)}
+			for _, r := range d.rows {
+				if r[1] == row[1] && r[2] == row[2] && r[3] == row[3] {
+					return pgconn.NewCommandTag("INSERT 0 0")
+				}
+			}
+			d.rows = append(d.rows, row)
+		case strings.Contains(sql, "INSERT INTO event_outbox"):
+			d.outbox = append(d.outbox, args[1].(string))
+		}
+		return pgconn.NewCommandTag("INSERT 0 1")
+	}
+	d.queryFn = func(sql string, args []any) [][]any {
+		var out [][]any
+		switch {
+		case strings.Contains(sql, "SELECT tx_hash, log_index, block_hash FROM provisional_events"):
+			for _, r := range d.rows {
+				if r[0].(int64) >= args[1].(int64) && r[0].(int64) <= args[2].(int64) {
+					out = append(out, []any{r[2], r[3], r[1]})
+				}
+			}
+		case strings.Contains(sql, "DELETE FROM provisional_events"):
+			out, d.rows = d.rows, nil
+		}
+		return out
+	}
+	return d
+}
+
+// TestScanTip publishes a tip window, replays it unchanged and after a reorg
+// of its last block, and resolves it against the canonical logs.
+func TestScanTip(t *testing.T) {
+	ctx := context.Background()
+	admin := common.HexToAddress("0xad")
+	whitelisted := common.HexToAddress("0x5717")
+	facet := common.HexToAddress("0xface7")
+	txA, txB := common.HexToHash("0xa"), common.HexToHash("0xb")
+
+	h100 := &types.Header{Number: big.NewInt(100), Time: 1000}
+	h101 := &types.Header{Number: big.NewInt(101), Time: 1003, ParentHash: h100.Hash()}
+	h101b := &types.Header{Number: big.NewInt(101), Time: 1004, ParentHash: h100.Hash()}
+	h102 := &types.Header{Number: big.NewInt(102), Time: 1007, ParentHash: h101b.Hash()}
+	h103 := &types.Header{Number: big.NewInt(103), Time: 1010, ParentHash: h102.Hash()}
+	chain := map[uint64]*types.Header{100: h100, 101: h101, 102: h102, 103: h103}
+
+	word := func(a common.Address) common.Hash { return common.BytesToHash(a.Bytes()) }
+	paused := types.Log{Address: testGridEx, Topics: []common.Hash{contracts.TopicPaused},
+		Data: word(admin).Bytes(), BlockNumber: 100, BlockHash: h100.Hash(), TxHash: txA, Index: 0}
+	whitelist := types.Log{Address: testGridEx, Topics: []common.Hash{contracts.TopicStrategyWhitelistUpdated, word(admin), word(whitelisted)},
+		Data: common.BigToHash(big.NewInt(1)).Bytes(), BlockNumber: 100, BlockHash: h100.Hash(), TxHash: txA, Index: 1}
+	upgrade := func(h *types.Header) types.Log {
+		return types.Log{Address: testGridEx, Topics: []common.Hash{contracts.TopicFacetUpdated, common.HexToHash("0x12345678"), word(facet)},
+			BlockNumber: 101, BlockHash: h.Hash(), TxHash: txB, Index: 0}
+	}
+	unknown := func(h *types.Header) types.Log {
+		return types.Log{Address: testGridEx, Topics: []common.Hash{common.HexToHash("0xbad")},
+			BlockNumber: 101, BlockHash: h.Hash(), TxHash: txB, Index: 1}
+	}
+
+	chainLogs := []types.Log{paused, whitelist, upgrade(h101), unknown(h101)}
+	var fetched [][2]uint64
+	m := &mockEthClient{
+		filterLogsFn: func(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+			from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+			fetched = append(fetched, [2]uint64{from, to})
+			var logs []types.Log
+			for _, log := range chainLogs {
+				if log.BlockNumber >= from && log.BlockNumber <= to {
+					logs = append(logs, log)
+				}
+			}
+			return logs, nil
+		},
+		headerByNumberFn: func(_ context.Context, n *big.Int) (*types.Header, error) {
+			return chain[n.Uint64()], nil
+		},
+	}
+	pdb := newProvisionalDB()
+	s := newTestScanner(t, pdb, h100, h101, h101b, h102, h103)
+	s.client = m
+
+	if err := s.scanTip(ctx, 100, 101); err != nil {
+		t.Fatal(err)
+	}
+	// Every log is recorded, and the messages of the two with handlers
+	// published.
+	if len(pdb.rows) != 4 || len(pdb.outbox) != 2 {
+		t.Fatalf("recorded %d logs, queued %v", len(pdb.rows), pdb.outbox)
+	}
+	for _, key := range pdb.outbox {
+		if !strings.Contains(key, ":provisional:") {
+			t.Errorf("idempotency key %s is not provisional", key)
+		}
+	}
+	if s.tipHead != 101 {
+		t.Fatalf("tipHead=%d want 101", s.tipHead)
+	}
+	// The handlers ran in a scratch transaction on copies of the caches.
+	if pdb.commits != 1 || pdb.rollbacks < 1 {
+		t.Fatalf("commits=%d rollbacks=%d, want the scratch transaction rolled back", pdb.commits, pdb.rollbacks)
+	}
+	if s.strategies.watches(whitelisted) || len(s.versions.unconfigured) != 0 ||
+		s.quarantined != 0 || s.unconfiguredFacetLogs != 0 {
+		t.Fatal("the provisional pass changed the canonical state")
+	}
+
+	// The same head is skipped; the same logs are not published again.
+	if err := s.scanTip(ctx, 100, 101); err != nil || len(pdb.outbox) != 2 {
+		t.Fatalf("same head: err=%v queued %d", err, len(pdb.outbox))
+	}
+	s.tipHead = 0
+	if err := s.scanTip(ctx, 100, 101); err != nil || len(pdb.outbox) != 2 || pdb.commits != 1 {
+		t.Fatalf("replay: err=%v queued %d commits %d", err, len(pdb.outbox), pdb.commits)
+	}
+
+	// Block 101 is replaced: the cached logs are dropped, the window fetched
+	// again and only the logs of the new block 101 published.
+	chainLogs = []types.Log{paused, whitelist, upgrade(h101b), unknown(h101b)}
+	chain[101] = h101b
+	fetched = nil
+	if err := s.scanTip(ctx, 100, 102); err != nil {
+		t.Fatal(err)
+	}
+	if len(pdb.rows) != 6 || len(pdb.outbox) != 3 {
+		t.Fatalf("after reorg: recorded %d logs, queued %v", len(pdb.rows), pdb.outbox)
+	}
+	if !slices.Equal(fetched, [][2]uint64{{100, 102}}) {
+		t.Fatalf("after reorg fetched %v, want the whole window", fetched)
+	}
+
+	// The next head extends the cached window: only the new block is fetched
+	// and, without new logs, the handlers don't run.
+	fetched = nil
+	commits := pdb.commits
+	if err := s.scanTip(ctx, 100, 103); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fetched, [][2]uint64{{103, 103}}) || pdb.commits != commits || len(pdb.outbox) != 3 {
+		t.Fatalf("next head fetched %v, commits %d, queued %d", fetched, pdb.commits-commits, len(pdb.outbox))
+	}
+	if len(s.tipLogs) != 4 || s.tipLogsTo != 103 || s.tipLogsHash != h103.Hash() {
+		t.Fatalf("cached %d logs up to %d (%s)", len(s.tipLogs), s.tipLogsTo, s.tipLogsHash)
+	}
+
+	// Once final, the logs still canonical are confirmed and the orphaned one
+	// reverted. Logs without messages are not resolved.
+	msgs, err := s.resolveProvisionalEvents(ctx, pdb.tx(), chainLogs, 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]kafka.EventType)
+	for _, msg := range msgs {
+		got[fmt.Sprintf("%s:%d:%s", msg.TxHash, msg.LogIndex, msg.BlockHash)] = msg.EventType
+	}
+	want := map[string]kafka.EventType{
+		fmt.Sprintf("%s:0:%s", txA.Hex(), h100.Hash().Hex()):  kafka.EventConfirmed,
+		fmt.Sprintf("%s:0:%s", txB.Hex(), h101.Hash().Hex()):  kafka.EventReverted,
+		fmt.Sprintf("%s:0:%s", txB.Hex(), h101b.Hash().Hex()): kafka.EventConfirmed,
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("resolved %v, want %v", got, want)
+	}
+	if len(pdb.rows) != 0 {
+		t.Fatalf("%d provisional events left", len(pdb.rows))
+	}
+}
+
+// quoteTokenDB answers quote_tokens queries from priorities, keyed by address.
+func quoteTokenDB(priorities map[string]string) *fakeDB {
+	return &fakeDB{queryFn: func(sql string, args []any) [][]any {
+		if !strings.Contains(sql, "FROM quote_tokens") {
+			return nil
+		}
+		var rows [][]any
+		for addr, p := range priorities {
+			if len(args) > 1 && !slices.Contains(args[1].([]string), addr) {
+				continue
+			}
+			rows = append(rows, []any{addr, p})
+		}
+		return rows
+	}}
+}
+
+func TestCheckPairOrientation(t *testing.T) {
+	base := common.HexToAddress("0xb1")
+	quote := common.HexToAddress("0xc1")
+	baseAddr, quoteAddr := strings.ToLower(base.Hex()), strings.ToLower(quote.Hex())
+
+	cases := []struct {
+		name       string
+		priorities map[string]string
+		warning    string
+	}{
+		{"empty registry", nil, ""},
+		{"quote ranks higher", map[string]string{baseAddr: "1", quoteAddr: "2"}, ""},
+		{"only the quote is registered", map[string]string{quoteAddr: "1"}, ""},
+		{"quote not registered", map[string]string{baseAddr: "1"}, "not in the quote token registry"},
+		{"base ranks higher", map[string]string{baseAddr: "3", quoteAddr: "2"}, "disagrees"},
+		{"equal priorities", map[string]string{baseAddr: "2", quoteAddr: "2"}, "disagrees"},
+		{"quote removed", map[string]string{quoteAddr: "0"}, "disagrees"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs strings.Builder
+			s := &Scanner{cfg: config.ChainConfig{ChainID: 56}, logger: slog.New(slog.NewTextHandler(&logs, nil))}
+			if err := s.checkPairOrientation(context.Background(), quoteTokenDB(tc.priorities).tx(), 7, base, quote); err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tc.warning == "" && logs.Len() > 0:
+				t.Fatalf("unexpected warning: %s", logs.String())
+			case tc.warning != "" && !strings.Contains(logs.String(), tc.warning):
+				t.Fatalf("want a warning containing %q, got %q", tc.warning, logs.String())
+			}
+		})
+	}
+}
+
+func TestPricingAnchors(t *testing.T) {
+	const (
+		usdt  = "0x55d398326f99059ff775485246999027b3197955" // built-in on chain 56
+		usdc  = "0x8ac76a51cc950d9822d68b83fe1ad97b32cd580d" // built-in on chain 56
+		wbnb  = "0xbb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c" // built-in wrapped native on chain 56
+		extra = "0x00000000000000000000000000000000000000e1" // from the stablecoins config
+	)
+	cases := []struct {
+		name       string
+		priorities map[string]string
+		want       []string
+	}{
+		{"empty registry", nil, []string{usdt, usdc, wbnb, extra}},
+		{"quotable only", map[string]string{usdt: "5", extra: "1", wbnb: "9"}, []string{usdt, wbnb, extra}},
+		{"zero priority removes", map[string]string{usdt: "5", usdc: "0", extra: "0"}, []string{usdt}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Scanner{
+				cfg:  config.ChainConfig{ChainID: 56, Stablecoins: []string{strings.ToUpper(extra[:2]) + extra[2:]}},
+				repo: db.NewRepository(quoteTokenDB(tc.priorities)),
+			}
+			anchors, err := s.pricingAnchors(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := slices.Sorted(maps.Keys(anchors))
+			if want := slices.Sorted(slices.Values(tc.want)); !slices.Equal(got, want) {
+				t.Fatalf("anchors %v, want %v", got, want)
+			}
+			// Only stablecoins are priced at $1; the wrapped native token is
+			// priced at the native spot price.
+			for addr, typ := range anchors {
+				want := pricing.TokenTypeStablecoin
+				if addr == wbnb {
+					want = pricing.TokenTypeWrappedNative
+				}
+				if typ != want {
+					t.Errorf("%s has token type %d, want %d", addr, typ, want)
+				}
+			}
+		})
+	}
+}
+
+// TestQuarantine stores an unknown log with its batch, counts it only once
+// the batch commits, and decodes it later with -reprocess-unknown.
+func TestQuarantine(t *testing.T) {
+	ctx := context.Background()
+	header := &types.Header{Number: big.NewInt(100), Time: 1000}
+
+	unknown := types.Log{Address: testGridEx, Topics: []common.Hash{common.HexToHash("0xbad")},
+		BlockNumber: 100, BlockHash: header.Hash(), TxHash: common.HexToHash("0xa"), Index: 0}
+	paused := types.Log{Address: testGridEx, Topics: []common.Hash{contracts.TopicPaused},
+		Data:        common.BytesToHash(common.HexToAddress("0xad").Bytes()).Bytes(),
+		BlockNumber: 100, BlockHash: header.Hash(), TxHash: common.HexToHash("0xa"), Index: 1}
+
+	counted := func(t *testing.T) int64 {
+		if v, ok := metrics.UnknownLogs.Get(t.Name()).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	inserts := func(fdb *fakeDB) int {
+		n := 0
+		for _, sql := range fdb.execs {
+			if strings.Contains(sql, "INSERT INTO unknown_logs") {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("counted on commit", func(t *testing.T) {
+		fdb := &fakeDB{}
+		s := newTestScanner(t, fdb, header)
+		if err := s.processLogs(ctx, []types.Log{unknown}, s.contractAddresses(), 100, 100, nil); err != nil {
+			t.Fatal(err)
+		}
+		if inserts(fdb) != 1 || fdb.commits != 1 || counted(t) != 1 {
+			t.Fatalf("inserts=%d commits=%d counted=%d", inserts(fdb), fdb.commits, counted(t))
+		}
+	})
+
+	t.Run("not counted on rollback", func(t *testing.T) {
+		fdb := &fakeDB{commitErr: errors.New("connection reset")}
+		s := newTestScanner(t, fdb, header)
+		if err := s.processLogs(ctx, []types.Log{unknown}, s.contractAddresses(), 100, 100, nil); err == nil {
+			t.Fatal("expected the commit error")
+		}
+		if inserts(fdb) != 1 || counted(t) != 0 {
+			t.Fatalf("inserts=%d counted=%d", inserts(fdb), counted(t))
+		}
+	})
+
+	t.Run("reprocess", func(t *testing.T) {
+		row := func(id int64, log types.Log) []any {
+			topics := make([]string, len(log.Topics))
+			for i, topic := range log.Topics {
+				topics[i] = topic.Hex()
+			}
+			return []any{id, strings.ToLower(log.Address.Hex()), topics, log.Data, log.BlockHash.Hex(),
+				log.TxHash.Hex(), int(log.TxIndex), int(log.Index), int64(log.BlockNumber)}
+		}
+		var decoded []any
+		fdb := &fakeDB{
+			queryFn: rowsFor(map[string][][]any{"FROM unknown_logs": {row(1, unknown), row(2, paused)}}),
+			execFn: func(sql string, args []any) pgconn.CommandTag {
+				if strings.Contains(sql, "UPDATE unknown_logs SET decoded_at") {
+					decoded = append(decoded, args[0])
+				}
+				return pgconn.NewCommandTag("INSERT 0 1")
+			},
+		}
+		s := newTestScanner(t, fdb, header)
+		n, err := s.ReprocessUnknownLogs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The still unknown log is quarantined again, which the insert's
+		// ON CONFLICT turns into a no-op; it stays pending and uncounted.
+		if n != 1 || !slices.Equal(decoded, []any{int64(2)}) {
+			t.Fatalf("decoded %d logs: %v", n, decoded)
+		}
+		if inserts(fdb) != 1 || s.quarantined != 0 || counted(t) != 0 {
+			t.Fatalf("inserts=%d quarantined=%d counted=%d", inserts(fdb), s.quarantined, counted(t))
+		}
+		if fdb.commits != 2 {
+			t.Fatalf("commits=%d, want one per log", fdb.commits)
+		}
+	})
+}
+
+// fakePairChain answers getPairTokens on the GridEx contract.
+type fakePairChain struct {
+	base, quote common.Address
+}
+
+func (f *fakePairChain) CallContract(_ context.Context, msg ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	if *msg.To == contracts.Multicall3Address {
+		return nil, nil // no Multicall3
+	}
+	return append(common.LeftPadBytes(f.base.Bytes(), 32), common.LeftPadBytes(f.quote.Bytes(), 32)...), nil
+}
+
+var profitRe = regexp.MustCompile(`SET total_profit = .*?\$(\d+)`)
+
+// gridStore keeps the grid and order rows written by the handlers by column
+// and answers the reads of handleFilledOrder from them.
+type gridStore struct {
+	fakeDB
+	grid        map[string]any
+	orders      map[string]map[string]any
+	pair        map[string]any
+	profitAdded *big.Int
+}
+
+func newGridStore(t *testing.T, quote common.Address) *gridStore {
+	d := &gridStore{
+		orders:      make(map[string]map[string]any),
+		pair:        map[string]any{"quote_token_address": strings.ToLower(quote.Hex())},
+		profitAdded: new(big.Int),
+	}
+	d.execFn = func(sql string, args []any) pgconn.CommandTag {
+		switch {
+		case strings.Contains(sql, "INSERT INTO grids"):
+			d.grid = insertedRow(t, sql, args)
+		case strings.Contains(sql, "INSERT INTO orders"):
+			row := insertedRow(t, sql, args)
+			d.orders[row["order_id"].(string)] = row
+		case strings.Contains(sql, "UPDATE grids SET total_profit"):
+			pos, _ := strconv.Atoi(profitRe.FindStringSubmatch(sql)[1])
+			amt, _ := new(big.Int).SetString(args[pos-1].(string), 10)
+			d.profitAdded.Add(d.profitAdded, amt)
+		}
+		return pgconn.NewCommandTag("INSERT 0 1")
+	}
+	d.queryFn = func(sql string, args []any) [][]any {
+		switch {
+		case strings.Contains(sql, "FROM orders WHERE chain_id = $1 AND order_id = $2"):
+			return [][]any{selectedRow(t, sql, d.orders[args[1].(string)])}
+		case strings.Contains(sql, "FROM grids WHERE chain_id = $1 AND grid_id = $2"):
+			return [][]any{selectedRow(t, sql, d.grid)}
+		case strings.Contains(sql, "FROM pairs"):
+			return [][]any{selectedRow(t, sql, d.pair)}
+		}
+		return nil
+	}
+	return d
+}
+
+// TestMixedDecimalGrid indexes a WETH(18)/USDC(6) grid on Ethereum from its
+// GridOrderCreated event through two fills of its first bid: 0.5 WETH per
+// order, asks at 3100 and 3200 USDC, bids at 3000 and 2900 USDC, a gap of
+// 100 USDC and a 0.05% fee. Amounts are raw token units, as on chain.
+func TestMixedDecimalGrid(t *testing.T) {
+	ctx := context.Background()
+	f, err := os.Open("../contracts/abi/TradeFacet.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	trade, err := abi.JSON(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weth := common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
+	usdc := common.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48")
+	caller, err := contracts.NewCaller(&fakePairChain{base: weth, quote: usdc}, testGridEx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := &types.Header{Number: big.NewInt(100), Time: 1000}
+
+	// A price is raw USDC per raw WETH times 10^36: 3000 USDC is 3000e6 / 1e18 * 1e36.
+	usdPrice := func(usd int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(usd), new(big.Int).Exp(big.NewInt(10), big.NewInt(24), nil))
+	}
+	const gridID = 9
+	store := newGridStore(t, usdc)
+	s := newTestScanner(t, store, header)
+	s.cfg.ChainID = 1
+	s.caller = caller
+	s.tokenCache[weth] = &contracts.TokenInfo{Address: weth, Symbol: "WETH", Decimals: 18}
+	s.tokenCache[usdc] = &contracts.TokenInfo{Address: usdc, Symbol: "USDC", Decimals: 6}
+	s.strategyCache[strategyCacheKey(gridID, true)] = &gridSide{strategy: linearStrategy{},
+		params: &contracts.StrategyParams{Price0: usdPrice(3100), Gap: usdPrice(100)}}
+	s.strategyCache[strategyCacheKey(gridID, false)] = &gridSide{strategy: linearStrategy{},
+		params: &contracts.StrategyParams{Price0: usdPrice(3000), Gap: usdPrice(-100)}}
+
+	log := func(event string, topics []common.Hash, args ...any) types.Log {
+		data, err := trade.Events[event].Inputs.NonIndexed().Pack(args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.Log{Address: testGridEx, Topics: append([]common.Hash{trade.Events[event].ID}, topics...), Data: data,
+			BlockNumber: 100, BlockHash: header.Hash()}
+	}
+	halfWETH := big.NewInt(5e17)
+	owner := common.BytesToHash(common.HexToAddress("0x0aa").Bytes())
+	created := log("GridOrderCreated", []common.Hash{owner}, uint64(3), halfWETH, big.NewInt(gridID), uint32(2), uint32(2), uint32(500), false, false)
+	if _, err := s.handleGridOrderCreated(ctx, store.tx(), created); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two asks of 0.5 WETH; bids of 1500 and 1450 USDC.
+	columns := func(row map[string]any, cols ...string) map[string]any {
+		out := make(map[string]any, len(cols))
+		for _, c := range cols {
+			out[c] = row[c]
+		}
+		return out
+	}
+	if got, want := columns(store.grid, "initial_base_amount", "initial_quote_amount", "base_decimals", "quote_decimals",
+		"initial_base_amount_normalized", "initial_quote_amount_normalized"), map[string]any{
+		"initial_base_amount": "1000000000000000000", "initial_quote_amount": "2950000000",
+		"base_decimals": 18, "quote_decimals": 6,
+		"initial_base_amount_normalized": "1", "initial_quote_amount_normalized": "2950",
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("grid initial amounts and decimals %v, want %v", got, want)
+	}
+	bid := store.orders[strconv.Itoa(gridID<<16)]
+	if got, want := columns(bid, "amount", "price", "rev_price", "price_normalized", "rev_price_normalized"), map[string]any{
+		"amount": "1500000000", "price": usdPrice(3000).String(), "rev_price": usdPrice(3100).String(),
+		"price_normalized": "3000", "rev_price_normalized": "3100",
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("first bid amount and prices %v, want %v", got, want)
+	}
+
+	// A taker sells 0.5 WETH into the bid for 1500 USDC, then buys it back
+	// from the flipped order at 3100 for 1550 USDC. Only the reverse fill
+	// earns the gap: 0.5 * 100 = 50 USDC. The grid keeps 3/4 of the
+	// 0.0375% order fee of both fills: 421875 + 435937 raw USDC.
+	taker := common.HexToAddress("0x7a")
+	bidID := uint64(gridID << 16)
+	fills := []types.Log{
+		log("FilledOrder", nil, taker, bidID, halfWETH, big.NewInt(1500e6), big.NewInt(0), halfWETH, false),
+		log("FilledOrder", nil, taker, bidID, halfWETH, big.NewInt(1550e6), big.NewInt(1550e6), big.NewInt(0), true),
+	}
+	for _, fill := range fills {
+		if _, err := s.handleFilledOrder(ctx, store.tx(), fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.profitAdded.String(); got != "50857812" {
+		t.Fatalf("total_profit %s raw USDC, want 50857812", got)
+	}
+	if got := fixedpoint.Amount(store.profitAdded, 6); got != "50.857812" {
+		t.Fatalf("total_profit %s USDC, want 50.857812", got)
+	}
+}
+
+// TestReorgOfLogFreeBlock replaces a block of a committed batch that had no
+// logs, so no hash was recorded for it. The end anchor still catches it.
+func TestReorgOfLogFreeBlock(t *testing.T) {
+	ctx := context.Background()
+	chain := func(fork string, from *types.Header, to uint64) map[uint64]*types.Header {
+		headers := map[uint64]*types.Header{from.Number.Uint64(): from}
+		for n, parent := from.Number.Uint64()+1, from; n <= to; n++ {
+			h := &types.Header{Number: new(big.Int).SetUint64(n), ParentHash: parent.Hash(), Extra: []byte(fork)}
+			headers[n], parent = h, h
+		}
+		return headers
+	}
+	genesis := &types.Header{Number: big.NewInt(99)}
+	old := chain("a", genesis, 103)
+	canonical := chain("b", old[100], 103) // block 101 and everything above replaced
+
+	// The batch [100, 102] had a single log, in block 100; block 101 had none.
+	refs, err := batchBlockRefs(old[100], old[102], []types.Log{{BlockNumber: 100, BlockHash: old[100].Hash()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range refs {
+		if ref.Number == 101 {
+			t.Fatal("the log-free block was recorded")
+		}
+	}
+	var stored [][]any
+	for _, ref := range refs {
+		stored = append(stored, []any{int64(ref.Number), ref.Hash, ref.ParentHash})
+	}
+	slices.SortFunc(stored, func(a, b []any) int { return int(b[0].(int64) - a[0].(int64)) })
+	fdb := &fakeDB{queryFn: func(sql string, args []any) [][]any {
+		switch {
+		case strings.Contains(sql, "SELECT block_hash FROM block_hashes"):
+			for _, r := range stored {
+				if r[0] == args[1] {
+					return [][]any{{r[1]}}
+				}
+			}
+		case strings.Contains(sql, "FROM block_hashes"):
+			var out [][]any
+			for _, r := range stored {
+				if r[0].(int64) <= args[1].(int64) {
+					out = append(out, r)
+				}
+			}
+			return out
+		}
+		return nil
+	}}
+	s := &Scanner{
+		client: &mockEthClient{headerByNumberFn: func(_ context.Context, n *big.Int) (*types.Header, error) {
+			return canonical[n.Uint64()], nil
+		}},
+		repo: db.NewRepository(fdb), cfg: config.ChainConfig{ChainID: 56, ReorgDepth: 10}, logger: testLogger(),
+	}
+
+	if _, reorged, err := s.checkReorg(ctx, 103); err != nil || !reorged {
+		t.Fatalf("checkReorg: reorged=%v err=%v", reorged, err)
+	}
+	ancestor, err := s.findCommonAncestor(ctx, 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ancestor.Number != 100 || ancestor.Hash != old[100].Hash().Hex() {
+		t.Fatalf("ancestor %+v, want block 100", ancestor)
+	}
+}
+
+// TestFetchBackfillWindowEndHeaderChanged replaces the end block while the
+// window's logs are being fetched: the window fails instead of recording the
+// new end hash over logs of the old fork.
+func TestFetchBackfillWindowEndHeaderChanged(t *testing.T) {
+	old := &types.Header{Number: big.NewInt(110), Extra: []byte("a")}
+	replaced := &types.Header{Number: big.NewInt(110), Extra: []byte("b")}
+	for _, tc := range []struct {
+		name    string
+		headers []*types.Header
+		wantErr bool
+	}{
+		{"stable", []*types.Header{old, old}, false},
+		{"reorged while fetching", []*types.Header{old, replaced}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reads := 0
+			s := &Scanner{
+				client: &mockEthClient{
+					headerByNumberFn: func(context.Context, *big.Int) (*types.Header, error) {
+						h := tc.headers[min(reads, len(tc.headers)-1)]
+						reads++
+						return h, nil
+					},
+					filterLogsFn: func(context.Context, ethereum.FilterQuery) ([]types.Log, error) { return nil, nil },
+				},
+				strategies: testStrategies(t, common.HexToAddress("0x5")),
+				headers:    newHeaderCache(16),
+				logger:     testLogger(),
+			}
+			w := s.fetchBackfillWindow(context.Background(), 101, 110)
+			if reads != 2 {
+				t.Fatalf("%d header reads, want one before and one after the logs", reads)
+			}
+			if tc.wantErr != errors.Is(w.err, errBatchHashMismatch) {
+				t.Fatalf("err=%v", w.err)
+			}
+			if !tc.wantErr && (len(w.blockRefs) != 1 || w.blockRefs[0].Hash != old.Hash().Hex()) {
+				t.Fatalf("refs %+v", w.blockRefs)
+			}
+		})
+	}
 }
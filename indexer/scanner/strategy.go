@@ -0,0 +1,291 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/gridex/indexer/config"
+	"github.com/gridex/indexer/contracts"
+)
+
+// Strategy is a kind of grid strategy contract. It knows the event the
+// contract emits when a grid side is created and how that side's order prices
+// follow from its parameters. Parameters are expressed as price0 plus a gap
+// and/or a ratio, which is how they are stored on the grids table.
+type Strategy interface {
+	// Type identifies the strategy in the grids and grid_strategy_params tables.
+	Type() StrategyType
+	// CreatedTopic is the topic of the event emitted for a new grid side.
+	CreatedTopic() common.Hash
+	// DecodeCreated decodes that event.
+	DecodeCreated(log types.Log) (*StrategyCreated, error)
+	// QueueParams queues the on-chain read of a grid side's parameters.
+	QueueParams(b *contracts.Batch, addr common.Address, isAsk bool, gridID uint64) *contracts.Pending[*contracts.StrategyParams]
+	// Validate reports whether p holds everything Price and ReversePrice need.
+	Validate(p *contracts.StrategyParams) error
+	// Price returns the price of order i (0-based) on a side.
+	Price(p *contracts.StrategyParams, i uint32) *big.Int
+	// ReversePrice returns the price an order at price flips to once filled.
+	ReversePrice(p *contracts.StrategyParams, price *big.Int) *big.Int
+	// InitialAmount returns the tokens deposited for count orders of baseAmt
+	// each: base tokens for asks, quote tokens for bids.
+	InitialAmount(p *contracts.StrategyParams, isAsk bool, baseAmt *big.Int, count uint32) *big.Int
+}
+
+// StrategyCreated is a decoded strategy creation event.
+type StrategyCreated struct {
+	IsAsk  bool
+	GridID uint64
+	Params *contracts.StrategyParams
+}
+
+// strategyTypes lists the known strategy implementations. Supporting a new
+// kind of strategy contract means implementing Strategy and adding it here;
+// its deployments are then configured under a chain's strategies, or picked
+// up once the GridEx whitelists them.
+var strategyTypes = map[StrategyType]func(d *contracts.Decoder) Strategy{
+	StrategyTypeLinear:   func(d *contracts.Decoder) Strategy { return linearStrategy{d} },
+	StrategyTypeGeometry: func(d *contracts.Decoder) Strategy { return geometryStrategy{d} },
+}
+
+// strategyRegistry maps the watched strategy contracts of a chain to their
+// implementation. It starts with the configured contracts and grows as the
+// GridEx whitelists new ones; a whitelisted contract's type is learned from
+// the first creation event it emits. It is safe for concurrent use because
+// backfill workers read the address set while the main loop extends it.
+type strategyRegistry struct {
+	mu        sync.RWMutex
+	byAddress map[common.Address]Strategy // nil while the type is unknown
+	byType    map[StrategyType]Strategy
+	watched   []common.Address // configured first, then in whitelist order
+}
+
+func newStrategyRegistry(cfgs []config.StrategyConfig, d *contracts.Decoder) (*strategyRegistry, error) {
+	r := &strategyRegistry{
+		byAddress: make(map[common.Address]Strategy),
+		byType:    make(map[StrategyType]Strategy),
+	}
+	for t, newStrategy := range strategyTypes {
+		r.byType[t] = newStrategy(d)
+	}
+	for _, c := range cfgs {
+		strat, ok := r.byType[StrategyType(c.Type)]
+		if !ok {
+			return nil, fmt.Errorf("strategy %s: unknown type %q", c.Address, c.Type)
+		}
+		if !common.IsHexAddress(c.Address) {
+			return nil, fmt.Errorf("strategy %s: invalid address %q", c.Type, c.Address)
+		}
+		addr := common.HexToAddress(c.Address)
+		if addr == (common.Address{}) {
+			return nil, fmt.Errorf("strategy %s: zero address", c.Type)
+		}
+		if _, dup := r.byAddress[addr]; dup {
+			return nil, fmt.Errorf("strategy %s: address %s configured twice", c.Type, addr.Hex())
+		}
+		r.byAddress[addr] = strat
+		r.watched = append(r.watched, addr)
+	}
+	return r, nil
+}
+
+// lookup returns the strategy deployed at addr, if its type is known.
+func (r *strategyRegistry) lookup(addr common.Address) (Strategy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	strat := r.byAddress[addr]
+	return strat, strat != nil
+}
+
+// ofType returns the implementation of a strategy type, as stored in the DB.
+func (r *strategyRegistry) ofType(t StrategyType) (Strategy, bool) {
+	strat, ok := r.byType[t]
+	return strat, ok
+}
+
+// watches reports whether logs of addr are fetched.
+func (r *strategyRegistry) watches(addr common.Address) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.byAddress[addr]
+	return ok
+}
+
+// resolve returns the strategy of a watched contract for one of its logs. A
+// contract of unknown type is identified by a creation event topic.
+func (r *strategyRegistry) resolve(addr common.Address, topic common.Hash) (Strategy, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if strat := r.byAddress[addr]; strat != nil {
+		return strat, true
+	}
+	for _, strat := range r.byType {
+		if strat.CreatedTopic() == topic {
+			r.byAddress[addr] = strat
+			return strat, true
+		}
+	}
+	return nil, false
+}
+
+// add starts watching a whitelisted contract. It reports false if the
+// contract was already watched.
+func (r *strategyRegistry) add(addr common.Address) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byAddress[addr]; ok {
+		return false
+	}
+	r.byAddress[addr] = nil
+	r.watched = append(r.watched, addr)
+	return true
+}
+
+// size returns the number of watched contracts.
+func (r *strategyRegistry) size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.watched)
+}
+
+// addresses returns the watched contracts from the n-th on.
+func (r *strategyRegistry) addresses(n int) []common.Address {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.watched[n:])
+}
+
+// clone returns an independent copy, for handlers run on unconfirmed blocks.
+func (r *strategyRegistry) clone() *strategyRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &strategyRegistry{
+		byAddress: maps.Clone(r.byAddress),
+		byType:    r.byType,
+		watched:   slices.Clone(r.watched),
+	}
+}
+
+// errMissingParam is returned by Validate for incomplete parameters.
+var errMissingParam = errors.New("missing strategy parameter")
+
+// sumQuoteAmounts adds up the quote amounts of count bid orders of baseAmt
+// each, priced by strat. It mirrors Lens.sol calcGridAmount.
+func sumQuoteAmounts(strat Strategy, p *contracts.StrategyParams, baseAmt *big.Int, count uint32) *big.Int {
+	total := new(big.Int)
+	for i := range count {
+		total.Add(total, calcQuoteAmount(baseAmt, strat.Price(p, i)))
+	}
+	return total
+}
+
+// linearStrategy prices orders at price0 + gap * i. gap is negative for bids.
+type linearStrategy struct {
+	d *contracts.Decoder
+}
+
+func (linearStrategy) Type() StrategyType { return StrategyTypeLinear }
+
+func (linearStrategy) CreatedTopic() common.Hash { return contracts.TopicLinearStrategyCreated }
+
+func (s linearStrategy) DecodeCreated(log types.Log) (*StrategyCreated, error) {
+	event, err := s.d.DecodeLinearStrategyCreated(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode LinearStrategyCreated: %w", err)
+	}
+	return &StrategyCreated{
+		IsAsk:  event.IsAsk,
+		GridID: event.GridID.Uint64(),
+		Params: &contracts.StrategyParams{Price0: event.Price0, Gap: event.Gap},
+	}, nil
+}
+
+func (linearStrategy) QueueParams(b *contracts.Batch, addr common.Address, isAsk bool, gridID uint64) *contracts.Pending[*contracts.StrategyParams] {
+	return b.LinearStrategy(addr, isAsk, gridID)
+}
+
+func (linearStrategy) Validate(p *contracts.StrategyParams) error {
+	if p.Price0 == nil {
+		return fmt.Errorf("linear: price0: %w", errMissingParam)
+	}
+	if p.Gap == nil {
+		return fmt.Errorf("linear: gap: %w", errMissingParam)
+	}
+	return nil
+}
+
+func (linearStrategy) Price(p *contracts.StrategyParams, i uint32) *big.Int {
+	offset := new(big.Int).Mul(p.Gap, big.NewInt(int64(i)))
+	return offset.Add(offset, p.Price0)
+}
+
+// ReversePrice is one gap back: lower for asks, higher for bids.
+func (linearStrategy) ReversePrice(p *contracts.StrategyParams, price *big.Int) *big.Int {
+	return new(big.Int).Sub(price, p.Gap)
+}
+
+func (s linearStrategy) InitialAmount(p *contracts.StrategyParams, isAsk bool, baseAmt *big.Int, count uint32) *big.Int {
+	if isAsk {
+		return new(big.Int).Mul(baseAmt, big.NewInt(int64(count)))
+	}
+	return sumQuoteAmounts(s, p, baseAmt, count)
+}
+
+// geometryStrategy prices orders at price0 * (ratio / RATIO_MULTIPLIER)^i.
+type geometryStrategy struct {
+	d *contracts.Decoder
+}
+
+func (geometryStrategy) Type() StrategyType { return StrategyTypeGeometry }
+
+func (geometryStrategy) CreatedTopic() common.Hash { return contracts.TopicGeometryStrategyCreated }
+
+func (s geometryStrategy) DecodeCreated(log types.Log) (*StrategyCreated, error) {
+	event, err := s.d.DecodeGeometryStrategyCreated(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode GeometryStrategyCreated: %w", err)
+	}
+	return &StrategyCreated{
+		IsAsk:  event.IsAsk,
+		GridID: event.GridID.Uint64(),
+		Params: &contracts.StrategyParams{Price0: event.Price0, Ratio: event.Ratio},
+	}, nil
+}
+
+func (geometryStrategy) QueueParams(b *contracts.Batch, addr common.Address, isAsk bool, gridID uint64) *contracts.Pending[*contracts.StrategyParams] {
+	return b.GeometryStrategy(addr, isAsk, gridID)
+}
+
+func (geometryStrategy) Validate(p *contracts.StrategyParams) error {
+	if p.Price0 == nil {
+		return fmt.Errorf("geometry: price0: %w", errMissingParam)
+	}
+	if p.Ratio == nil || p.Ratio.Sign() == 0 {
+		return fmt.Errorf("geometry: ratio: %w", errMissingParam)
+	}
+	return nil
+}
+
+func (geometryStrategy) Price(p *contracts.StrategyParams, i uint32) *big.Int {
+	return calcGeometryPrice(p.Price0, p.Ratio, i)
+}
+
+// ReversePrice is price * RATIO_MULTIPLIER / ratio, one step back.
+func (geometryStrategy) ReversePrice(p *contracts.StrategyParams, price *big.Int) *big.Int {
+	rev := new(big.Int).Mul(price, ratioMultiplier)
+	return rev.Div(rev, p.Ratio)
+}
+
+func (s geometryStrategy) InitialAmount(p *contracts.StrategyParams, isAsk bool, baseAmt *big.Int, count uint32) *big.Int {
+	if isAsk {
+		return new(big.Int).Mul(baseAmt, big.NewInt(int64(count)))
+	}
+	return sumQuoteAmounts(s, p, baseAmt, count)
+}
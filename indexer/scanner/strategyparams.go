@@ -0,0 +1,199 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+)
+
+// strategyCacheKey is the strategyCache key of one side of a grid.
+func strategyCacheKey(gridID uint64, isAsk bool) string {
+	if isAsk {
+		return fmt.Sprintf("%d_ask", gridID)
+	}
+	return fmt.Sprintf("%d_bid", gridID)
+}
+
+// loadGridStrategies returns the ask and bid strategy of a new grid.
+// They normally come from the in-memory cache filled by the strategy events of
+// the same transaction. After a restart the cache is empty, so they are read
+// from grid_strategy_params, and if the events were never indexed there either,
+// from the strategy contracts themselves. A side without orders may be nil.
+func (s *Scanner) loadGridStrategies(ctx context.Context, tx pgx.Tx, event *contracts.GridOrderCreatedEvent, blockNumber uint64) (ask, bid *gridSide, err error) {
+	ask = s.strategyCache[strategyCacheKey(event.GridID, true)]
+	bid = s.strategyCache[strategyCacheKey(event.GridID, false)]
+	missing := func() bool {
+		return (ask == nil && event.Asks > 0) || (bid == nil && event.Bids > 0)
+	}
+
+	if missing() {
+		rows, err := db.GetGridStrategyParams(ctx, tx, s.cfg.ChainID, int64(event.GridID))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, row := range rows {
+			side, err := s.gridSideFromParams(row)
+			if err != nil {
+				return nil, nil, err
+			}
+			if row.IsAsk && ask == nil {
+				ask = side
+			} else if !row.IsAsk && bid == nil {
+				bid = side
+			}
+		}
+	}
+
+	if missing() {
+		s.logger.Warn("strategy params not indexed, reading them from the strategy contracts",
+			"grid_id", event.GridID)
+		if err := s.fetchGridStrategies(ctx, tx, event, blockNumber, &ask, &bid); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if ask == nil && bid == nil {
+		return nil, nil, fmt.Errorf("not found strategy for grid")
+	}
+	for _, side := range []*gridSide{ask, bid} {
+		if side == nil {
+			continue
+		}
+		if err := side.strategy.Validate(side.params); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ask, bid, nil
+}
+
+// fetchGridStrategies fills the missing sides from the grid's strategy
+// contracts and stores them. Both the grid config and the params are read at
+// blockNumber, the block of the GridOrderCreated event, so they describe the
+// grid as created even if it was cancelled or changed since.
+func (s *Scanner) fetchGridStrategies(ctx context.Context, tx pgx.Tx, event *contracts.GridOrderCreatedEvent, blockNumber uint64, ask, bid **gridSide) error {
+	cb := s.caller.NewBatchAt(blockNumber)
+	pendingCfg := cb.GridConfig(event.GridID)
+	if err := cb.Execute(ctx); err != nil {
+		return fmt.Errorf("get grid config: %w", err)
+	}
+	if pendingCfg.Err != nil {
+		return fmt.Errorf("get grid config: %w", pendingCfg.Err)
+	}
+	cfg := pendingCfg.Value
+
+	type pendingSide struct {
+		isAsk    bool
+		side     **gridSide
+		addr     common.Address
+		strategy Strategy
+		params   *contracts.Pending[*contracts.StrategyParams]
+	}
+	var sides []*pendingSide
+	if *ask == nil && event.Asks > 0 {
+		sides = append(sides, &pendingSide{isAsk: true, side: ask, addr: cfg.AskStrategy})
+	}
+	if *bid == nil && event.Bids > 0 {
+		sides = append(sides, &pendingSide{isAsk: false, side: bid, addr: cfg.BidStrategy})
+	}
+
+	b := s.caller.NewBatchAt(blockNumber)
+	for _, ps := range sides {
+		strat, ok := s.strategies.lookup(ps.addr)
+		if !ok {
+			return fmt.Errorf("grid %d uses unknown strategy contract %s", event.GridID, ps.addr.Hex())
+		}
+		ps.strategy = strat
+		ps.params = strat.QueueParams(b, ps.addr, ps.isAsk, event.GridID)
+	}
+	if err := b.Execute(ctx); err != nil {
+		return fmt.Errorf("read strategy params: %w", err)
+	}
+
+	for _, ps := range sides {
+		if ps.params.Err != nil {
+			return fmt.Errorf("read strategy params: %w", ps.params.Err)
+		}
+		p := ps.params.Value
+		if p.Price0.Sign() == 0 {
+			return fmt.Errorf("strategy %s has no params for grid %d (ask=%v)", ps.addr.Hex(), event.GridID, ps.isAsk)
+		}
+		*ps.side = &gridSide{strategy: ps.strategy, addr: ps.addr, params: p}
+
+		row := strategyParamsRow(event.GridID, ps.isAsk, ps.strategy, ps.addr, p)
+		if err := db.UpsertGridStrategyParams(ctx, tx, s.cfg.ChainID, row, blockNumber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columns returns the grids table strategy columns of a side; all empty for nil.
+func (g *gridSide) columns() (strategy, price0, gap, ratio string) {
+	if g == nil {
+		return "", "", "", ""
+	}
+	return string(g.strategy.Type()), bigString(g.params.Price0), bigString(g.params.Gap), bigString(g.params.Ratio)
+}
+
+// strategyParamsRow builds the grid_strategy_params row of a grid side.
+func strategyParamsRow(gridID uint64, isAsk bool, strat Strategy, addr common.Address, p *contracts.StrategyParams) db.GridStrategyParams {
+	return db.GridStrategyParams{
+		GridID:          int64(gridID),
+		IsAsk:           isAsk,
+		Strategy:        string(strat.Type()),
+		StrategyAddress: strings.ToLower(addr.Hex()),
+		Price0:          bigString(p.Price0),
+		Gap:             bigString(p.Gap),
+		Ratio:           bigString(p.Ratio),
+	}
+}
+
+// gridSideFromParams converts a grid_strategy_params row.
+func (s *Scanner) gridSideFromParams(p db.GridStrategyParams) (*gridSide, error) {
+	addr := common.HexToAddress(p.StrategyAddress)
+	strat, ok := s.strategies.lookup(addr)
+	if !ok {
+		strat, ok = s.strategies.ofType(StrategyType(p.Strategy))
+	}
+	if !ok {
+		return nil, fmt.Errorf("grid %d: strategy %q is not configured", p.GridID, p.Strategy)
+	}
+
+	parse := func(name, v string) (*big.Int, error) {
+		if v == "" {
+			return nil, nil
+		}
+		n, ok := new(big.Int).SetString(v, 10)
+		if !ok {
+			return nil, fmt.Errorf("grid %d: invalid strategy %s %q", p.GridID, name, v)
+		}
+		return n, nil
+	}
+	var params contracts.StrategyParams
+	var err error
+	if params.Price0, err = parse("price0", p.Price0); err != nil {
+		return nil, err
+	}
+	if params.Gap, err = parse("gap", p.Gap); err != nil {
+		return nil, err
+	}
+	if params.Ratio, err = parse("ratio", p.Ratio); err != nil {
+		return nil, err
+	}
+	return &gridSide{strategy: strat, addr: addr, params: &params}, nil
+}
+
+// bigString formats n in base 10, or "" for nil.
+func bigString(n *big.Int) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
@@ -0,0 +1,261 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+)
+
+// scanTip publishes provisional events for the unconfirmed blocks
+// [fromBlock, latestBlock] when tip_mode is enabled. Handlers run in a scratch
+// transaction that is rolled back, so nothing reaches the canonical tables;
+// the published logs are recorded in provisional_events and resolved by the
+// canonical pass (see resolveProvisionalEvents).
+//
+// The whole unconfirmed window is replayed because later logs (e.g. a fill)
+// depend on state created by earlier ones (e.g. the grid), but only the new
+// blocks are fetched (see tipWindowLogs) and the handlers run only when one of
+// them has a log. Logs that were already published for the same block hash are
+// not sent again.
+func (s *Scanner) scanTip(ctx context.Context, fromBlock, latestBlock uint64) error {
+	if fromBlock > latestBlock || latestBlock == s.tipHead {
+		return nil
+	}
+
+	logs, err := s.tipWindowLogs(ctx, fromBlock, latestBlock)
+	if err != nil {
+		return fmt.Errorf("fetch tip logs: %w", err)
+	}
+
+	known, err := s.repo.GetProvisionalEventKeys(ctx, s.cfg.ChainID, fromBlock, latestBlock)
+	if err != nil {
+		return err
+	}
+	fresh := 0
+	for _, log := range logs {
+		if _, ok := known[provisionalKey(log)]; !ok {
+			fresh++
+		}
+	}
+	if fresh == 0 {
+		s.tipHead = latestBlock
+		return nil
+	}
+
+	msgsByLog, err := s.buildProvisionalMessages(ctx, logs)
+	if err != nil {
+		return err
+	}
+
+	var published int
+	err = s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		var kafkaMsgs []*kafka.Message
+		for i, log := range logs {
+			msgs := msgsByLog[i]
+			ev := db.ProvisionalEvent{
+				BlockNumber: log.BlockNumber,
+				BlockHash:   log.BlockHash.Hex(),
+				TxHash:      log.TxHash.Hex(),
+				LogIndex:    log.Index,
+			}
+			for _, msg := range msgs {
+				ev.EventTypes = append(ev.EventTypes, string(msg.EventType))
+			}
+			// Logs without messages (e.g. strategy events) are recorded too,
+			// so the window is not replayed again for them.
+			inserted, err := db.InsertProvisionalEvent(ctx, tx, s.cfg.ChainID, ev)
+			if err != nil {
+				return err
+			}
+			if !inserted {
+				continue
+			}
+			for _, msg := range msgs {
+				msg.Provisional = true
+			}
+			kafkaMsgs = append(kafkaMsgs, msgs...)
+		}
+
+		if err := s.enqueue(ctx, tx, kafkaMsgs); err != nil {
+			return fmt.Errorf("queue provisional messages: %w", err)
+		}
+		published = len(kafkaMsgs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if published > 0 {
+		s.notifyOutbox()
+	}
+
+	s.tipHead = latestBlock
+	s.logger.Info("published provisional events", "from", fromBlock, "to", latestBlock, "messages", published)
+	return nil
+}
+
+// tipWindowLogs returns the logs of [fromBlock, latestBlock]. The logs of the
+// previous pass are reused while the block they were fetched up to is still
+// canonical, so usually only the new blocks are fetched. Otherwise the whole
+// window is fetched again.
+func (s *Scanner) tipWindowLogs(ctx context.Context, fromBlock, latestBlock uint64) ([]types.Log, error) {
+	latest, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(latestBlock))
+	if err != nil {
+		return nil, fmt.Errorf("fetch header %d: %w", latestBlock, err)
+	}
+
+	start := fromBlock
+	var cached []types.Log
+	if s.tipLogsHash != (common.Hash{}) && s.tipLogsTo >= fromBlock && s.tipLogsTo < latestBlock {
+		canonical, err := s.tipLogsCanonical(ctx, latest)
+		if err != nil {
+			return nil, err
+		}
+		if canonical {
+			start = s.tipLogsTo + 1
+			for _, log := range s.tipLogs {
+				if log.BlockNumber >= fromBlock {
+					cached = append(cached, log)
+				}
+			}
+		}
+	}
+
+	logs, err := s.fetchLogsAdaptive(ctx, start, latestBlock)
+	if err != nil {
+		return nil, err
+	}
+	logs = append(cached, logs...)
+	s.tipLogs, s.tipLogsTo, s.tipLogsHash = logs, latestBlock, latest.Hash()
+	return logs, nil
+}
+
+// tipLogsCanonical reports whether block tipLogsTo still has the hash the
+// cached tip logs were fetched on. A block hash commits to its ancestors, so
+// the cached logs below it are then unchanged too. When latest is the next
+// block its parent hash answers that without another request.
+func (s *Scanner) tipLogsCanonical(ctx context.Context, latest *types.Header) (bool, error) {
+	if latest.Number.Uint64() == s.tipLogsTo+1 {
+		return latest.ParentHash == s.tipLogsHash, nil
+	}
+	header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(s.tipLogsTo))
+	if err != nil {
+		return false, fmt.Errorf("fetch header %d: %w", s.tipLogsTo, err)
+	}
+	return header.Hash() == s.tipLogsHash, nil
+}
+
+// buildProvisionalMessages runs the regular handlers for logs inside a scratch
+// transaction and returns the Kafka messages produced for each log. A log whose
+// handler fails (e.g. it depends on state that is not indexed yet) yields no
+// messages; it will be published normally by the canonical pass.
+func (s *Scanner) buildProvisionalMessages(ctx context.Context, logs []types.Log) ([][]*kafka.Message, error) {
+	// Handlers mutate the in-memory caches and the watched strategies. Work on
+	// copies so nothing derived from unconfirmed blocks leaks into the
+	// canonical pass.
+	tokenCache, strategyCache, pairTokens, strategies, versions, quarantined, unconfigured := s.tokenCache, s.strategyCache, s.pairTokens, s.strategies, s.versions, s.quarantined, s.unconfiguredFacetLogs
+	s.tokenCache = maps.Clone(tokenCache)
+	s.strategyCache = maps.Clone(strategyCache)
+	s.pairTokens = maps.Clone(pairTokens)
+	s.strategies = strategies.clone()
+	s.versions = versions.clone()
+	s.provisional = true
+	defer func() {
+		s.tokenCache, s.strategyCache, s.pairTokens, s.strategies, s.versions, s.quarantined, s.unconfiguredFacetLogs = tokenCache, strategyCache, pairTokens, strategies, versions, quarantined, unconfigured
+		s.provisional = false
+	}()
+
+	if err := s.prefetchHeaders(ctx, logs); err != nil {
+		return nil, err
+	}
+
+	msgsByLog := make([][]*kafka.Message, len(logs))
+	err := s.repo.WithScratchTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		for i, log := range logs {
+			if len(log.Topics) == 0 {
+				continue
+			}
+
+			// Savepoint per log, so one failing handler doesn't abort the rest.
+			sp, err := tx.Begin(ctx)
+			if err != nil {
+				return fmt.Errorf("begin savepoint: %w", err)
+			}
+			msgs, err := s.processLog(ctx, sp, log)
+			if err != nil {
+				s.logger.Debug("skipping provisional log",
+					"block", log.BlockNumber, "tx", log.TxHash.Hex(), "log_index", log.Index, "error", err)
+				if err := sp.Rollback(ctx); err != nil {
+					return fmt.Errorf("rollback savepoint: %w", err)
+				}
+				continue
+			}
+			if err := sp.Commit(ctx); err != nil {
+				return fmt.Errorf("release savepoint: %w", err)
+			}
+			msgsByLog[i] = msgs
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msgsByLog, nil
+}
+
+// resolveProvisionalEvents is called by the canonical pass once blocks up to
+// endBlock are final. Every provisional log at or below endBlock gets an
+// event_confirmed message if the same log (tx hash, log index and block hash)
+// is part of the canonical batch, and event_reverted otherwise.
+func (s *Scanner) resolveProvisionalEvents(ctx context.Context, tx pgx.Tx, logs []types.Log, endBlock uint64) ([]*kafka.Message, error) {
+	pending, err := db.TakeProvisionalEvents(ctx, tx, s.cfg.ChainID, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	canonical := make(map[string]struct{}, len(logs))
+	for _, log := range logs {
+		canonical[provisionalKey(log)] = struct{}{}
+	}
+
+	var msgs []*kafka.Message
+	for _, ev := range pending {
+		if len(ev.EventTypes) == 0 {
+			continue
+		}
+		eventType := kafka.EventReverted
+		if _, ok := canonical[ev.Key()]; ok {
+			eventType = kafka.EventConfirmed
+		}
+		msgs = append(msgs, &kafka.Message{
+			EventType:   eventType,
+			ChainID:     s.cfg.ChainID,
+			BlockNumber: ev.BlockNumber,
+			TxHash:      ev.TxHash,
+			LogIndex:    ev.LogIndex,
+			Timestamp:   time.Now().Unix(),
+			BlockHash:   ev.BlockHash,
+			Data: &kafka.ProvisionalResolvedData{
+				BlockHash:  ev.BlockHash,
+				EventTypes: ev.EventTypes,
+			},
+		})
+	}
+	return msgs, nil
+}
+
+func provisionalKey(log types.Log) string {
+	return db.ProvisionalEventKey(log.TxHash.Hex(), log.Index, log.BlockHash.Hex())
+}
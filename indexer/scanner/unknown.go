@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+)
+
+// quarantineLog stores a log of a watched contract that no handler recognizes
+// in unknown_logs, so it can be decoded once the indexer learns its event.
+func (s *Scanner) quarantineLog(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	s.logger.Debug("quarantining unknown log",
+		"contract", log.Address.Hex(),
+		"topic", log.Topics[0].Hex(),
+		"block", log.BlockNumber,
+		"tx", log.TxHash.Hex(),
+		"log_index", log.Index,
+	)
+	if err := db.InsertUnknownLog(ctx, tx, s.cfg.ChainID, log); err != nil {
+		return nil, err
+	}
+	s.quarantined++
+	return nil, nil
+}
+
+// ReprocessUnknownLogs runs the quarantined logs of the chain through the
+// current handlers, oldest first. Logs a handler now recognizes are marked
+// decoded and their Kafka messages queued in the outbox; the others stay
+// quarantined.
+// Each log is processed in its own transaction against the current state, so
+// this suits events whose handlers do not depend on the logs around them.
+// It returns the number of logs decoded.
+func (s *Scanner) ReprocessUnknownLogs(ctx context.Context) (int, error) {
+	pending, err := s.repo.GetPendingUnknownLogs(ctx, s.cfg.ChainID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.loadWhitelistedStrategies(ctx); err != nil {
+		return 0, err
+	}
+	if err := s.loadVersionSchedule(ctx); err != nil {
+		return 0, err
+	}
+
+	decoded := 0
+	for _, u := range pending {
+		handled := false
+		err := s.repo.WithTx(ctx, func(ctx context.Context, tx pgx.Tx) error {
+			quarantined := s.quarantined
+			msgs, err := s.processLog(ctx, tx, u.Log)
+			if err != nil {
+				return err
+			}
+			if s.quarantined > quarantined {
+				s.quarantined = quarantined
+				return nil
+			}
+			if err := db.MarkUnknownLogDecoded(ctx, tx, u.ID); err != nil {
+				return err
+			}
+			handled = true
+			return s.enqueue(ctx, tx, msgs)
+		})
+		if err != nil {
+			return decoded, fmt.Errorf("reprocess log block=%d tx=%s logIdx=%d: %w",
+				u.Log.BlockNumber, u.Log.TxHash.Hex(), u.Log.Index, err)
+		}
+		if handled {
+			decoded++
+		}
+	}
+
+	if decoded > 0 {
+		s.notifyOutbox()
+	}
+	s.logger.Info("reprocessed unknown logs", "pending", len(pending), "decoded", decoded)
+	return decoded, nil
+}
@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/gridex/indexer/config"
+	"github.com/gridex/indexer/contracts"
+	"github.com/gridex/indexer/db"
+)
+
+// versionSwitch is the position in the chain from which a contract version
+// applies. A switch learned from a FacetUpdated event applies from that event
+// on.
+type versionSwitch struct {
+	block   uint64
+	index   uint
+	version contracts.Version
+}
+
+// before reports whether the switch precedes the position of log.
+func (v versionSwitch) before(log types.Log) bool {
+	return v.block < log.BlockNumber || v.block == log.BlockNumber && v.index <= log.Index
+}
+
+// facetUpgrade is a FacetUpdated event routing a selector to a facet of no
+// configured version.
+type facetUpgrade struct {
+	block uint64
+	index uint
+	facet common.Address
+}
+
+// versionSchedule selects the decoder of a GridEx log by the contract version
+// in force at its position in the chain. It starts with the abi_versions that
+// have a from_block and learns the switches to versions configured by their
+// facets from FacetUpdated events. Logs before the first switch use the
+// latest version. It also keeps the upgrades to facets of no configured
+// version, whose events the decoders may not know.
+type versionSchedule struct {
+	decoders     map[contracts.Version]*contracts.Decoder
+	facets       map[common.Address]contracts.Version
+	fixed        []versionSwitch // configured by from_block, in chain order
+	switches     []versionSwitch // fixed plus the learned ones, in chain order
+	unconfigured []facetUpgrade  // in chain order
+}
+
+func newVersionSchedule(cfgs []config.ABIVersion, latest *contracts.Decoder) (*versionSchedule, error) {
+	vs := &versionSchedule{
+		decoders: map[contracts.Version]*contracts.Decoder{latest.Version(): latest},
+		facets:   make(map[common.Address]contracts.Version),
+	}
+	for _, c := range cfgs {
+		version, err := contracts.ParseVersion(c.Version)
+		if err != nil {
+			return nil, fmt.Errorf("abi_versions: %w", err)
+		}
+		if _, ok := vs.decoders[version]; !ok {
+			d, err := contracts.NewVersionDecoder(version)
+			if err != nil {
+				return nil, fmt.Errorf("create %s decoder: %w", version, err)
+			}
+			vs.decoders[version] = d
+		}
+		if c.FromBlock != nil {
+			vs.fixed = append(vs.fixed, versionSwitch{block: *c.FromBlock, version: version})
+		}
+		for _, facet := range c.Facets {
+			if !common.IsHexAddress(facet) {
+				return nil, fmt.Errorf("abi_versions %s: invalid facet address %q", version, facet)
+			}
+			addr := common.HexToAddress(facet)
+			if known, dup := vs.facets[addr]; dup && known != version {
+				return nil, fmt.Errorf("abi_versions: facet %s configured for %s and %s", addr.Hex(), known, version)
+			}
+			vs.facets[addr] = version
+		}
+	}
+	slices.SortStableFunc(vs.fixed, func(a, b versionSwitch) int {
+		return cmp.Compare(a.block, b.block)
+	})
+	vs.switches = slices.Clone(vs.fixed)
+	return vs, nil
+}
+
+// at returns the decoder for a log.
+func (vs *versionSchedule) at(log types.Log) *contracts.Decoder {
+	version := contracts.Latest
+	for _, s := range vs.switches {
+		if !s.before(log) {
+			break
+		}
+		version = s.version
+	}
+	return vs.decoders[version]
+}
+
+// versionOf returns a configured version other than the one in force at log
+// whose ABI has the event of topic.
+func (vs *versionSchedule) versionOf(log types.Log, topic common.Hash) (contracts.Version, bool) {
+	current := vs.at(log).Version()
+	for version, d := range vs.decoders {
+		if version != current && d.Knows(topic) {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// facetUpdated applies a FacetUpdated event routing a selector to facet. It
+// reports the version switched to, if the facet belongs to a configured
+// version other than the one in force.
+func (vs *versionSchedule) facetUpdated(log types.Log, facet common.Address) (contracts.Version, bool) {
+	version, ok := vs.facets[facet]
+	if !ok {
+		vs.unconfigured = append(vs.unconfigured, facetUpgrade{block: log.BlockNumber, index: log.Index, facet: facet})
+		return "", false
+	}
+	if vs.at(log).Version() == version {
+		return "", false
+	}
+	s := versionSwitch{block: log.BlockNumber, index: log.Index, version: version}
+	i := len(vs.switches)
+	for i > 0 && !vs.switches[i-1].before(log) {
+		i--
+	}
+	vs.switches = slices.Insert(vs.switches, i, s)
+	return version, true
+}
+
+// unconfiguredFacet returns the last upgrade to a facet of no configured
+// version before log.
+func (vs *versionSchedule) unconfiguredFacet(log types.Log) (common.Address, bool) {
+	for i := len(vs.unconfigured) - 1; i >= 0; i-- {
+		u := vs.unconfigured[i]
+		if u.block < log.BlockNumber || u.block == log.BlockNumber && u.index <= log.Index {
+			return u.facet, true
+		}
+	}
+	return common.Address{}, false
+}
+
+// load replaces the learned switches and upgrades with the ones of updates,
+// which are in chain order.
+func (vs *versionSchedule) load(updates []db.FacetUpdate) {
+	vs.switches = slices.Clone(vs.fixed)
+	vs.unconfigured = nil
+	for _, u := range updates {
+		if !common.IsHexAddress(u.Facet) {
+			continue
+		}
+		vs.facetUpdated(types.Log{BlockNumber: u.BlockNumber, Index: u.LogIndex}, common.HexToAddress(u.Facet))
+	}
+}
+
+// clone returns a copy whose learned switches can change independently.
+func (vs *versionSchedule) clone() *versionSchedule {
+	c := *vs
+	c.switches = slices.Clone(vs.switches)
+	c.unconfigured = slices.Clone(vs.unconfigured)
+	return &c
+}
+
+// decoderAt returns the decoder for a GridEx log, by the contract version in
+// force at its position in the chain.
+func (s *Scanner) decoderAt(log types.Log) *contracts.Decoder {
+	return s.versions.at(log)
+}
+
+// loadVersionSchedule learns the version switches and unconfigured facet
+// upgrades of the FacetUpdated events indexed so far.
+func (s *Scanner) loadVersionSchedule(ctx context.Context) error {
+	updates, err := s.repo.GetFacetUpdates(ctx, s.cfg.ChainID)
+	if err != nil {
+		return err
+	}
+	s.versions.load(updates)
+	return nil
+}
@@ -0,0 +1,153 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gridex/indexer/db"
+	"github.com/gridex/indexer/kafka"
+)
+
+// handleStrategyWhitelistUpdated records a change of the GridEx strategy
+// whitelist and starts watching newly whitelisted contracts. A contract removed
+// from the whitelist stays watched until the next restart; it can no longer be
+// used for new grids, so there is nothing left to index from it.
+func (s *Scanner) handleStrategyWhitelistUpdated(ctx context.Context, tx pgx.Tx, log types.Log) ([]*kafka.Message, error) {
+	event, err := s.decoder.DecodeStrategyWhitelistUpdated(log)
+	if err != nil {
+		return nil, fmt.Errorf("decode StrategyWhitelistUpdated: %w", err)
+	}
+
+	s.logger.Info("StrategyWhitelistUpdated",
+		"strategy", event.Strategy.Hex(),
+		"whitelisted", event.Whitelisted,
+		"sender", event.Sender.Hex(),
+	)
+
+	if err := db.InsertStrategyWhitelistUpdate(ctx, tx, s.cfg.ChainID, db.StrategyWhitelistUpdate{
+		Address:     strings.ToLower(event.Strategy.Hex()),
+		Whitelisted: event.Whitelisted,
+		Sender:      strings.ToLower(event.Sender.Hex()),
+		TxHash:      log.TxHash.Hex(),
+		LogIndex:    log.Index,
+	}, log.BlockNumber); err != nil {
+		return nil, err
+	}
+
+	if event.Whitelisted && event.Strategy != s.gridExAddr && s.strategies.add(event.Strategy) {
+		s.logger.Info("watching whitelisted strategy contract", "address", event.Strategy.Hex(), "block", log.BlockNumber)
+	}
+	return nil, nil
+}
+
+// loadWhitelistedStrategies watches the strategy contracts that were
+// whitelisted in previous runs.
+func (s *Scanner) loadWhitelistedStrategies(ctx context.Context) error {
+	addrs, err := s.repo.GetWhitelistedStrategies(ctx, s.cfg.ChainID)
+	if err != nil {
+		return fmt.Errorf("load whitelisted strategies: %w", err)
+	}
+	added := 0
+	for _, addr := range addrs {
+		if s.strategies.add(common.HexToAddress(addr)) {
+			added++
+		}
+	}
+	if added > 0 {
+		s.logger.Info("watching whitelisted strategy contracts", "count", added)
+	}
+	return nil
+}
+
+// addUnfetchedStrategyLogs adds the logs in [fromBlock, toBlock] of the
+// watched contracts missing from fetched. That happens when a backfill window
+// was prefetched before an earlier window whitelisted a strategy, or when the
+// logs come from the WebSocket subscription.
+func (s *Scanner) addUnfetchedStrategyLogs(ctx context.Context, logs []types.Log, fetched []common.Address, fromBlock, toBlock uint64, refs []db.BlockRef) ([]types.Log, []db.BlockRef, error) {
+	var missing []common.Address
+	for _, addr := range s.contractAddresses() {
+		if !slices.Contains(fetched, addr) {
+			missing = append(missing, addr)
+		}
+	}
+	if len(missing) == 0 {
+		return logs, refs, nil
+	}
+
+	extra, err := s.fetchContractLogs(ctx, missing, fromBlock, toBlock)
+	if err != nil {
+		return nil, nil, err
+	}
+	if refs, err = appendLogBlockRefs(refs, extra); err != nil {
+		return nil, nil, err
+	}
+	return mergeLogs(logs, extra), refs, nil
+}
+
+// addStrategyLogs adds the logs of newly whitelisted contracts that follow
+// after, up to toBlock, to a batch being processed.
+func (s *Scanner) addStrategyLogs(ctx context.Context, logs []types.Log, addrs []common.Address, after types.Log, toBlock uint64, refs []db.BlockRef) ([]types.Log, []db.BlockRef, error) {
+	extra, err := s.fetchContractLogs(ctx, addrs, after.BlockNumber, toBlock)
+	if err != nil {
+		return nil, nil, err
+	}
+	extra = slices.DeleteFunc(extra, func(l types.Log) bool { return !logLess(after, l) })
+	if len(extra) == 0 {
+		return logs, refs, nil
+	}
+
+	if refs, err = appendLogBlockRefs(refs, extra); err != nil {
+		return nil, nil, err
+	}
+	if err := s.prefetchHeaders(ctx, extra); err != nil {
+		return nil, nil, err
+	}
+	s.logger.Info("added logs of whitelisted strategy contracts", "from", after.BlockNumber, "to", toBlock, "events", len(extra))
+	return mergeLogs(logs, extra), refs, nil
+}
+
+// fetchContractLogs fetches the logs of addrs in [fromBlock, toBlock], splitting
+// the range like the regular fetch when the RPC limits the response.
+func (s *Scanner) fetchContractLogs(ctx context.Context, addrs []common.Address, fromBlock, toBlock uint64) ([]types.Log, error) {
+	logs, err := s.fetchAddressLogsAdaptive(ctx, addrs, fromBlock, toBlock)
+	if err != nil {
+		return nil, fmt.Errorf("fetch strategy logs %d-%d: %w", fromBlock, toBlock, err)
+	}
+	return logs, nil
+}
+
+// mergeLogs returns logs and extra in processing order, without the logs of
+// extra that logs already holds.
+func mergeLogs(logs, extra []types.Log) []types.Log {
+	type logKey struct {
+		block common.Hash
+		index uint
+	}
+	seen := make(map[logKey]struct{}, len(logs))
+	for _, log := range logs {
+		seen[logKey{log.BlockHash, log.Index}] = struct{}{}
+	}
+
+	merged := slices.Clone(logs)
+	for _, log := range extra {
+		if _, ok := seen[logKey{log.BlockHash, log.Index}]; !ok {
+			merged = append(merged, log)
+		}
+	}
+	slices.SortStableFunc(merged, func(a, b types.Log) int {
+		switch {
+		case logLess(a, b):
+			return -1
+		case logLess(b, a):
+			return 1
+		}
+		return 0
+	})
+	return merged
+}
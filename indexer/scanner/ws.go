@@ -0,0 +1,287 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// wsMaxBufferedBlocks bounds the ingestor's memory while the scanner is
+	// still backfilling far behind the head. Older blocks are dropped and
+	// served by eth_getLogs instead.
+	wsMaxBufferedBlocks = 10000
+	// wsLogMargin is how many heads must follow a block before its logs are
+	// served from the buffer. Providers deliver logs asynchronously and may
+	// send them after the next head.
+	wsLogMargin = 3
+	// wsMaxReconnectBackoff caps the delay between reconnect attempts.
+	wsMaxReconnectBackoff = time.Minute
+	// wsStaleHeadTimeout is how long the subscription may go without a new
+	// head before the scanner stops trusting it. Some providers keep a dead
+	// subscription open without reporting an error.
+	wsStaleHeadTimeout = time.Minute
+)
+
+// wsClient is the subset of ethclient.Client used for subscriptions.
+type wsClient interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error)
+	Close()
+}
+
+// wsDialer opens a WebSocket client. Replaced in tests.
+type wsDialer func(ctx context.Context, url string) (wsClient, error)
+
+func dialWS(ctx context.Context, url string) (wsClient, error) {
+	return ethclient.DialContext(ctx, url)
+}
+
+// wsIngestor subscribes to newHeads and to the logs of the watched contracts
+// over WebSocket and buffers them per block. The scanner reads block ranges
+// from the buffer when they are fully covered by the current subscription,
+// and falls back to eth_getLogs for anything else (startup gap, reconnects,
+// blocks dropped from the buffer).
+type wsIngestor struct {
+	url       string
+	addresses []common.Address
+	dial      wsDialer
+	logger    *slog.Logger
+
+	mu sync.Mutex
+	// latest is the number of the most recent head received, at lastHead.
+	latest   uint64
+	lastHead time.Time
+	// coveredFrom is the first block whose logs are guaranteed to be in the
+	// buffer. Zero while no subscription is active.
+	coveredFrom uint64
+	heads       map[uint64]common.Hash
+	logs        map[uint64][]types.Log
+
+	// wake is signalled (non-blocking) on every new head.
+	wake chan struct{}
+}
+
+func newWSIngestor(url string, addresses []common.Address, logger *slog.Logger) *wsIngestor {
+	return &wsIngestor{
+		url:       url,
+		addresses: addresses,
+		dial:      dialWS,
+		logger:    logger.With("component", "ws"),
+		heads:     make(map[uint64]common.Hash),
+		logs:      make(map[uint64][]types.Log),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// run keeps the subscriptions alive until ctx is cancelled, reconnecting with
+// exponential backoff. Coverage is reset on every disconnect so the scanner
+// re-fetches the gap through eth_getLogs.
+func (w *wsIngestor) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := w.subscribe(ctx)
+		w.reset()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) > wsMaxReconnectBackoff {
+			backoff = time.Second
+		}
+		w.logger.Warn("websocket subscription ended, reconnecting", "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, wsMaxReconnectBackoff)
+	}
+}
+
+// subscribe dials the endpoint and pumps both subscriptions into the buffer
+// until one of them fails.
+func (w *wsIngestor) subscribe(ctx context.Context) error {
+	client, err := w.dial(ctx, w.url)
+	if err != nil {
+		return fmt.Errorf("dial websocket: %w", err)
+	}
+	defer client.Close()
+
+	// Subscribe to logs before heads: every head received afterwards belongs
+	// to a block whose logs are delivered by the log subscription.
+	logCh := make(chan types.Log, 1024)
+	logSub, err := client.SubscribeFilterLogs(ctx, ethereum.FilterQuery{Addresses: w.addresses}, logCh)
+	if err != nil {
+		return fmt.Errorf("subscribe logs: %w", err)
+	}
+	defer logSub.Unsubscribe()
+
+	headCh := make(chan *types.Header, 64)
+	headSub, err := client.SubscribeNewHead(ctx, headCh)
+	if err != nil {
+		return fmt.Errorf("subscribe new heads: %w", err)
+	}
+	defer headSub.Unsubscribe()
+
+	w.logger.Info("websocket subscriptions established", "addresses", len(w.addresses))
+
+	stale := time.NewTimer(wsStaleHeadTimeout)
+	defer stale.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-logSub.Err():
+			return fmt.Errorf("logs subscription: %w", err)
+		case err := <-headSub.Err():
+			return fmt.Errorf("new heads subscription: %w", err)
+		case <-stale.C:
+			return fmt.Errorf("no new head for %s", wsStaleHeadTimeout)
+		case log := <-logCh:
+			w.addLog(log)
+		case header := <-headCh:
+			w.addHead(header)
+			stale.Reset(wsStaleHeadTimeout)
+		}
+	}
+}
+
+// addHead records a new head. A head that replaces a known block number with
+// a different hash discards the heads above it, which belonged to the old fork.
+// A head whose parent does not match the buffered previous head means blocks
+// below it changed without a notification, so coverage restarts at this head.
+func (w *wsIngestor) addHead(header *types.Header) {
+	number := header.Number.Uint64()
+	hash := header.Hash()
+
+	w.mu.Lock()
+	if w.coveredFrom == 0 {
+		w.coveredFrom = number
+	}
+	if prev, ok := w.heads[number]; ok && prev != hash {
+		for n := range w.heads {
+			if n > number {
+				delete(w.heads, n)
+			}
+		}
+	}
+	if parent, ok := w.heads[number-1]; ok && parent != header.ParentHash {
+		for n := range w.heads {
+			if n < number {
+				delete(w.heads, n)
+			}
+		}
+		w.coveredFrom = number
+	}
+	w.heads[number] = hash
+	w.latest = number
+	w.lastHead = time.Now()
+
+	for len(w.heads) > wsMaxBufferedBlocks {
+		delete(w.heads, w.coveredFrom)
+		delete(w.logs, w.coveredFrom)
+		w.coveredFrom++
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// addLog buffers a log, or drops it again when the node reports it as removed
+// by a reorg.
+func (w *wsIngestor) addLog(log types.Log) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	logs := w.logs[log.BlockNumber]
+	for i, l := range logs {
+		if l.BlockHash == log.BlockHash && l.TxHash == log.TxHash && l.Index == log.Index {
+			if log.Removed {
+				w.logs[log.BlockNumber] = append(logs[:i], logs[i+1:]...)
+			}
+			return
+		}
+	}
+	if !log.Removed {
+		w.logs[log.BlockNumber] = append(logs, log)
+	}
+}
+
+// logsInRange returns the buffered logs for [fromBlock, toBlock] on the chain
+// of heads we have seen. ok is false if any block in the range is not fully
+// covered, in which case the caller must use eth_getLogs. Blocks within
+// wsLogMargin of the head are never served, since their logs may still be in
+// flight.
+func (w *wsIngestor) logsInRange(fromBlock, toBlock uint64) ([]types.Log, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.coveredFrom == 0 || fromBlock < w.coveredFrom || toBlock+wsLogMargin > w.latest {
+		return nil, false
+	}
+
+	var out []types.Log
+	for n := fromBlock; n <= toBlock; n++ {
+		hash, ok := w.heads[n]
+		if !ok {
+			return nil, false
+		}
+		for _, l := range w.logs[n] {
+			if l.BlockHash == hash {
+				out = append(out, l)
+			}
+		}
+	}
+	sortLogsByIndex(out)
+	return out, true
+}
+
+// latestBlock returns the most recent head number, or 0 if not subscribed or
+// if no head arrived for wsStaleHeadTimeout.
+func (w *wsIngestor) latestBlock() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.coveredFrom == 0 || time.Since(w.lastHead) > wsStaleHeadTimeout {
+		return 0
+	}
+	return w.latest
+}
+
+// prune drops buffered blocks at or below upTo once they have been indexed.
+func (w *wsIngestor) prune(upTo uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for n := range w.heads {
+		if n <= upTo {
+			delete(w.heads, n)
+		}
+	}
+	for n := range w.logs {
+		if n <= upTo {
+			delete(w.logs, n)
+		}
+	}
+}
+
+// reset marks the buffer as uncovered after a disconnect.
+func (w *wsIngestor) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.latest = 0
+	w.coveredFrom = 0
+	clear(w.heads)
+	clear(w.logs)
+}